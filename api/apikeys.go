@@ -0,0 +1,122 @@
+package api
+
+import (
+	"druid-insight/auth"
+	"druid-insight/config"
+	"druid-insight/logging"
+	"druid-insight/report"
+	"druid-insight/store"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type apiKeyInput struct {
+	Name        string   `json:"name"`
+	Username    string   `json:"username"`
+	Admin       bool     `json:"admin"`
+	Datasources []string `json:"datasources,omitempty"`
+	Endpoints   []string `json:"endpoints,omitempty"`
+	ExpiresDays int      `json:"expires_days,omitempty"` // 0 = sans expiration
+}
+
+// APIKeysHandler gère /api/apikeys (admin uniquement, par JWT : une clé ne peut pas en créer) :
+// GET (liste, ?user= pour filtrer), POST (création, le secret n'est retourné qu'une fois)
+// et DELETE ?id= (révocation).
+func APIKeysHandler(cfg *auth.Config, druidCfg *config.DruidConfig, keys *auth.APIKeys, accessLogger *logging.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tok, err := auth.ParseAccessToken(r, cfg.JWT.Secret)
+		if err != nil || tok.Username == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if !tok.Admin {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		switch r.Method {
+		case "GET":
+			user := r.URL.Query().Get("user")
+			list, err := keys.List(func(k *store.APIKey) bool { return user == "" || k.Username == user })
+			if err != nil {
+				http.Error(w, "Erreur stockage", http.StatusInternalServerError)
+				return
+			}
+			if list == nil {
+				list = []*store.APIKey{}
+			}
+			writeJSON(w, http.StatusOK, list)
+
+		case "POST":
+			var in apiKeyInput
+			if err := report.DecodeStrict(r.Body, &in); err != nil {
+				writeValidationError(w, err)
+				return
+			}
+			if errs := validateAPIKeyInput(&in, druidCfg); len(errs) > 0 {
+				writeValidationError(w, &report.ValidationError{Errors: errs})
+				return
+			}
+			secret, key, err := keys.Create(auth.APIKeyOptions{
+				Name:        in.Name,
+				Username:    in.Username,
+				Admin:       in.Admin,
+				Datasources: in.Datasources,
+				Endpoints:   in.Endpoints,
+				TTL:         time.Duration(in.ExpiresDays) * 24 * time.Hour,
+				CreatedBy:   tok.Username,
+			})
+			if err != nil {
+				http.Error(w, "Erreur stockage", http.StatusInternalServerError)
+				return
+			}
+			key.Hash = ""
+			writeJSON(w, http.StatusCreated, map[string]interface{}{"key": secret, "api_key": key})
+			accessLogger.Write("APIKEY_CREATE user=" + tok.Username + " id=" + key.ID + " for=" + key.Username)
+
+		case "DELETE":
+			id := r.URL.Query().Get("id")
+			if id == "" {
+				http.Error(w, "id requis", http.StatusBadRequest)
+				return
+			}
+			err := keys.Revoke(id, tok.Username)
+			if errors.Is(err, store.ErrNotFound) {
+				http.Error(w, "Not found", http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				http.Error(w, "Erreur stockage", http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+			accessLogger.Write("APIKEY_REVOKE user=" + tok.Username + " id=" + id)
+
+		default:
+			http.Error(w, "Méthode non autorisée", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func validateAPIKeyInput(in *apiKeyInput, druidCfg *config.DruidConfig) []report.FieldError {
+	var errs []report.FieldError
+	if in.Username == "" {
+		errs = append(errs, report.FieldError{Field: "username", Message: "required"})
+	}
+	for i, ds := range in.Datasources {
+		if _, ok := druidCfg.Datasources[ds]; !ok {
+			errs = append(errs, report.FieldError{Field: fmt.Sprintf("datasources[%d]", i), Message: "unknown datasource " + ds})
+		}
+	}
+	for i, p := range in.Endpoints {
+		if !strings.HasPrefix(p, "/api/") {
+			errs = append(errs, report.FieldError{Field: fmt.Sprintf("endpoints[%d]", i), Message: "expected a path starting with /api/"})
+		}
+	}
+	if in.ExpiresDays < 0 {
+		errs = append(errs, report.FieldError{Field: "expires_days", Message: "must be positive"})
+	}
+	return errs
+}
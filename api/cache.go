@@ -0,0 +1,48 @@
+package api
+
+import (
+	"druid-insight/auth"
+	"druid-insight/logging"
+	"druid-insight/worker"
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// CachePurgeHandler vide le cache de résultats (admin uniquement), éventuellement pour une seule datasource
+func CachePurgeHandler(cfg *auth.Config, accessLogger *logging.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Méthode non autorisée", http.StatusMethodNotAllowed)
+			return
+		}
+		username, isAdmin, err := auth.ExtractUserAndAdminFromJWT(r, cfg.JWT.Secret)
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if !isAdmin {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			accessLogger.Write("CACHE_PURGE_FORBIDDEN user=" + username)
+			return
+		}
+		var req struct {
+			Datasource string `json:"datasource"`
+		}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Bad JSON", http.StatusBadRequest)
+				return
+			}
+		}
+		resultCache := worker.ResultCache()
+		if resultCache == nil {
+			http.Error(w, "Cache disabled", http.StatusConflict)
+			return
+		}
+		purged := resultCache.Purge(req.Datasource)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int{"purged": purged})
+		accessLogger.Write("CACHE_PURGE user=" + username + " datasource=" + req.Datasource + " purged=" + strconv.Itoa(purged))
+	}
+}
@@ -10,15 +10,19 @@ import (
 	"strings"
 )
 
-// DownloadReportCSV télécharge le CSV du rapport demandé (nécessite JWT valide)
-func DownloadReportCSV(cfg *auth.Config) http.HandlerFunc {
+// DownloadReportCSV télécharge le CSV du rapport demandé (nécessite JWT valide et la capacité export)
+func DownloadReportCSV(cfg *auth.Config, users *auth.UsersFile) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Validation du JWT
-		username, _, err := auth.ExtractUserAndAdminFromJWT(r, cfg.JWT.Secret)
+		username, isAdmin, err := auth.ExtractUserAndAdminFromJWT(r, cfg.JWT.Secret)
 		if err != nil {
 			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
 			return
 		}
+		if !auth.UserGrants(username, isAdmin, users, cfg).Can(auth.CapExport) {
+			http.Error(w, "Forbidden: export capability required", http.StatusForbidden)
+			return
+		}
 
 		// Extraction du paramètre GET id
 		reportID := r.URL.Query().Get("id")
@@ -27,21 +31,26 @@ func DownloadReportCSV(cfg *auth.Config) http.HandlerFunc {
 			return
 		}
 
-		// Chemin du fichier
-		csvPath := filepath.Join("csv", reportID+".csv")
+		// Log (optionnel)
+		log.Printf("[DOWNLOAD] user=%s id=%s\n", username, reportID)
 
-		// Vérification existence
-		if _, err := os.Stat(csvPath); err != nil {
-			http.Error(w, "Fichier CSV non trouvé pour ce rapport", http.StatusNotFound)
-			return
-		}
+		serveReportCSV(w, r, reportID)
+	}
+}
 
-		// Log (optionnel)
-		log.Printf("[DOWNLOAD] user=%s id=%s path=%s\n", username, reportID, csvPath)
+// serveReportCSV envoie csv/<id>.csv en pièce jointe
+func serveReportCSV(w http.ResponseWriter, r *http.Request, reportID string) {
+	// Chemin du fichier
+	csvPath := filepath.Join("csv", reportID+".csv")
 
-		// Envoi du fichier CSV
-		w.Header().Set("Content-Type", "text/csv")
-		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"report_%s.csv\"", strings.ReplaceAll(reportID, "\"", "")))
-		http.ServeFile(w, r, csvPath)
+	// Vérification existence
+	if _, err := os.Stat(csvPath); err != nil {
+		http.Error(w, "Fichier CSV non trouvé pour ce rapport", http.StatusNotFound)
+		return
 	}
+
+	// Envoi du fichier CSV
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"report_%s.csv\"", strings.ReplaceAll(reportID, "\"", "")))
+	http.ServeFile(w, r, csvPath)
 }
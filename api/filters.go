@@ -1,10 +1,9 @@
 package api
 
 import (
-	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"slices"
@@ -12,7 +11,9 @@ import (
 	"time"
 
 	"druid-insight/auth"
+	"druid-insight/cache"
 	"druid-insight/config"
+	"druid-insight/druid"
 )
 
 type filterCache struct {
@@ -20,7 +21,7 @@ type filterCache struct {
 	ExpiresAt time.Time
 }
 
-var filterMemoryCache sync.Map // key = datasource|dimension, value = filterCache
+var filterMemoryCache sync.Map // key = cache.Key de la requête finale, value = filterCache
 
 type FilterRequest struct {
 	Datasource string `json:"datasource"`
@@ -31,7 +32,9 @@ type FilterResponse struct {
 	Values []string `json:"values"`
 }
 
-func GetDimensionValues(cfg *auth.Config, druidCfg *config.DruidConfig) http.HandlerFunc {
+// GetDimensionValues retourne les valeurs d'une dimension accordée par les rôles de l'utilisateur,
+// restreintes à ses filtres d'accès
+func GetDimensionValues(cfg *auth.Config, users *auth.UsersFile, druidCfg *config.DruidConfig, druidClusters *druid.Clusters) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		username, isAdmin, err := auth.ExtractUserAndAdminFromJWT(r, cfg.JWT.Secret)
 		if err != nil {
@@ -55,6 +58,15 @@ func GetDimensionValues(cfg *auth.Config, druidCfg *config.DruidConfig) http.Han
 			http.Error(w, "Datasource not found in configuration", http.StatusBadRequest)
 			return
 		}
+		if !auth.DatasourceAllowed(r, filterReq.Datasource) {
+			http.Error(w, "Forbidden: datasource outside the API key scope", http.StatusForbidden)
+			return
+		}
+		grants := auth.UserGrants(username, isAdmin, users, cfg)
+		if !grants.DatasourceAllowed(filterReq.Datasource) {
+			http.Error(w, "Forbidden: access denied to datasource", http.StatusForbidden)
+			return
+		}
 
 		druidDimension, ok := dsConfig.Dimensions[filterReq.Dimension]
 		if !ok {
@@ -62,49 +74,31 @@ func GetDimensionValues(cfg *auth.Config, druidCfg *config.DruidConfig) http.Han
 			return
 		}
 
-		if !isAdmin && druidDimension.Reserved {
+		if !grants.FieldAllowed(druidDimension) {
 			http.Error(w, "Forbidden: access denied to dimension", http.StatusForbidden)
 			return
 		}
 
-		cacheKey := filterReq.Datasource + "|" + druidDimension.Druid
-		now := time.Now()
-		if val, found := filterMemoryCache.Load(cacheKey); found {
-			cache := val.(filterCache)
-			if cache.ExpiresAt.After(now) {
-				log.Printf("filters.go - load %s from cache \n", cacheKey)
-				w.Header().Set("Content-Type", "application/json")
-				json.NewEncoder(w).Encode(FilterResponse{Values: cache.Values})
-				return
-			} else {
-				log.Printf("filters.go - expired cache for %s \n", cacheKey)
-			}
-		}
-
-		// Charger les droits locaux
-		usersFile, _ := auth.LoadUsers(cfg.Auth.UserFile)
-		accessFilters := auth.GetAccessFilters(username, isAdmin, filterReq.Datasource, druidCfg, usersFile, cfg)
+		accessFilters := auth.GetAccessFilters(username, isAdmin, filterReq.Datasource, druidCfg, users, cfg)
 
 		var druidFilter interface{} = nil
 		if accessFilters != nil {
-			if len(accessFilters) == 1 {
-				for dim := range accessFilters {
-					druidFilter = map[string]interface{}{
-						"type":      "in",
-						"dimension": dim,
-						"values":    accessFilters[dim],
-					}
-				}
-			} else {
-				fields := make([]map[string]interface{}, 0)
-				for dim := range accessFilters {
-					temp := map[string]interface{}{
-						"type":      "in",
-						"dimension": dim,
-						"values":    accessFilters[dim],
-					}
-					fields = append(fields, temp)
-				}
+			dims := make([]string, 0, len(accessFilters))
+			for dim := range accessFilters {
+				dims = append(dims, dim)
+			}
+			slices.Sort(dims)
+			fields := make([]map[string]interface{}, 0, len(dims))
+			for _, dim := range dims {
+				fields = append(fields, map[string]interface{}{
+					"type":      "in",
+					"dimension": dim,
+					"values":    accessFilters[dim],
+				})
+			}
+			if len(fields) == 1 {
+				druidFilter = fields[0]
+			} else if len(fields) > 1 {
 				druidFilter = map[string]interface{}{
 					"type":   "and",
 					"fields": fields,
@@ -113,7 +107,7 @@ func GetDimensionValues(cfg *auth.Config, druidCfg *config.DruidConfig) http.Han
 		}
 
 		druidQuery := map[string]interface{}{
-			"context":     map[string]string{"application": "druid-insight"},
+			"context":     map[string]interface{}{"application": "druid-insight"},
 			"queryType":   "groupBy",
 			"dataSource":  filterReq.Datasource,
 			"dimensions":  []string{druidDimension.Druid},
@@ -125,51 +119,44 @@ func GetDimensionValues(cfg *auth.Config, druidCfg *config.DruidConfig) http.Han
 			druidQuery["filter"] = druidFilter
 		}
 
-		queryBytes, err := json.Marshal(druidQuery)
-		if err != nil {
-			http.Error(w, "Failed to create Druid query", http.StatusInternalServerError)
-			return
-		}
-		log.Println(string(queryBytes))
-		log.Printf("filters.go - %s not in cache, calling api \n", cacheKey)
-		req, err := http.NewRequest("POST", druidCfg.HostURL+"/druid/v2/", bytes.NewBuffer(queryBytes))
-		if err != nil {
-			http.Error(w, "Failed to create request to Druid", http.StatusInternalServerError)
-			return
+		// la clé porte sur la requête finale : filtres d'accès de l'utilisateur compris
+		label := filterReq.Datasource + "|" + druidDimension.Druid
+		cacheKey := cache.Key(druidClusters.ClusterName(filterReq.Datasource), druidQuery)
+		now := time.Now()
+		if val, found := filterMemoryCache.Load(cacheKey); found {
+			entry := val.(filterCache)
+			if entry.ExpiresAt.After(now) {
+				log.Printf("filters.go - load %s from cache \n", label)
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(FilterResponse{Values: entry.Values})
+				return
+			} else {
+				log.Printf("filters.go - expired cache for %s \n", label)
+			}
 		}
-		req.Header.Set("Content-Type", "application/json")
 
-		resp, err := http.DefaultClient.Do(req)
+		druidClient, err := druidClusters.ForDatasource(filterReq.Datasource)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		defer resp.Body.Close()
-		body, err := io.ReadAll(resp.Body)
-
-		if resp.StatusCode != http.StatusOK {
-			http.Error(w, "Failed to fetch data from Druid", http.StatusInternalServerError)
-			log.Println(string(body))
-			return
-		}
-
+		log.Printf("filters.go - %s not in cache, calling api \n", label)
+		druidResp, err := druidClient.NativeQuery(r.Context(), druidQuery)
 		if err != nil {
-			http.Error(w, "Failed to read response from Druid", http.StatusInternalServerError)
-			return
-		}
-
-		var druidResp []struct {
-			Event map[string]interface{} `json:"event"`
-		}
-
-		if err := json.Unmarshal(body, &druidResp); err != nil {
-			http.Error(w, "Invalid response from Druid", http.StatusInternalServerError)
+			var httpErr *druid.HTTPError
+			if errors.As(err, &httpErr) {
+				http.Error(w, "Failed to fetch data from Druid", http.StatusInternalServerError)
+				log.Println(httpErr.Body)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
 		valuesSet := make(map[string]struct{})
 		for _, entry := range druidResp {
-			valRaw, ok := entry.Event[druidDimension.Druid]
+			event, _ := entry["event"].(map[string]interface{})
+			valRaw, ok := event[druidDimension.Druid]
 			if !ok || valRaw == nil {
 				continue
 			}
@@ -190,7 +177,7 @@ func GetDimensionValues(cfg *auth.Config, druidCfg *config.DruidConfig) http.Han
 			Values:    values,
 			ExpiresAt: now.Add(time.Hour),
 		})
-		log.Printf("filters.go - now in cache : %s \n", cacheKey)
+		log.Printf("filters.go - now in cache : %s \n", label)
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(FilterResponse{Values: values})
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"druid-insight/auth"
+	"druid-insight/druid"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGetDimensionValues_UsesLoadedUsers(t *testing.T) {
+	env := newTestEnv(t)
+	env.cfg.RBAC.Roles = map[string]auth.RoleConfig{"finance": {Datasources: []string{"billing"}}}
+	env.users.Users["carol"] = auth.UserInfo{Roles: []string{"finance"}}
+	h := GetDimensionValues(env.cfg, env.users, env.druidCfg, env.clusters)
+
+	body := map[string]string{"datasource": "events", "dimension": "browser"}
+	w := serve(h, env.request(t, "POST", "/api/filters/values", body, "carol", false))
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "access denied to datasource") {
+		t.Errorf("Expected carol's roles from the loaded users to deny events, got %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestGetDimensionValues_CacheKeepsAccessFilters(t *testing.T) {
+	// broker factice : Firefox seul si la requête porte un filtre, toutes les valeurs sinon
+	broker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var q map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&q)
+		rows := []map[string]interface{}{{"event": map[string]interface{}{"browser": "Firefox"}}}
+		if q["filter"] == nil {
+			rows = append(rows, map[string]interface{}{"event": map[string]interface{}{"browser": "Chrome"}})
+		}
+		json.NewEncoder(w).Encode(rows)
+	}))
+	defer broker.Close()
+	env := newTestEnv(t)
+	env.druidCfg.HostURL = broker.URL
+	clusters, err := druid.NewClusters(env.druidCfg)
+	if err != nil {
+		t.Fatalf("NewClusters failed: %v", err)
+	}
+	h := GetDimensionValues(env.cfg, env.users, env.druidCfg, clusters)
+
+	body := map[string]string{"datasource": "events", "dimension": "browser"}
+	if w := serve(h, env.request(t, "POST", "/api/filters/values", body, "root", true)); !strings.Contains(w.Body.String(), "Chrome") {
+		t.Fatalf("Expected all values for root, got %d: %s", w.Code, w.Body)
+	}
+	w := serve(h, env.request(t, "POST", "/api/filters/values", body, "bob", false))
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "Chrome") {
+		t.Errorf("Expected bob's access filters to apply after root's cached lookup, got %d: %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"druid-insight/auth"
+	"druid-insight/config"
+	"druid-insight/druid"
+	"druid-insight/logging"
+	"druid-insight/store"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+// testEnv : configuration minimale des handlers (backend file, une datasource, un cluster)
+type testEnv struct {
+	cfg      *auth.Config
+	users    *auth.UsersFile
+	druidCfg *config.DruidConfig
+	clusters *druid.Clusters
+	logger   *logging.Logger
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	cfg := &auth.Config{}
+	cfg.JWT.Secret = "test-secret"
+	cfg.JWT.ExpirationMinutes = 5
+	cfg.Auth.UserBackend = "file"
+	druidCfg := &config.DruidConfig{
+		HostURL: "http://druid:8082",
+		Datasources: map[string]config.DruidDatasourceSchema{
+			"events": {
+				Dimensions: map[string]config.DruidField{
+					"browser": {Druid: "browser"},
+					"country": {Druid: "country", Roles: []string{auth.RoleAdmin}},
+				},
+				Metrics: map[string]config.DruidField{"requests": {Druid: "requests"}},
+			},
+			"billing": {
+				Metrics: map[string]config.DruidField{"revenue": {Druid: "revenue"}},
+			},
+		},
+	}
+	clusters, err := druid.NewClusters(druidCfg)
+	if err != nil {
+		t.Fatalf("NewClusters failed: %v", err)
+	}
+	logger, err := logging.NewLogger(t.TempDir(), "access.log")
+	if err != nil {
+		t.Fatalf("NewLogger failed: %v", err)
+	}
+	t.Cleanup(logger.Close)
+	users := &auth.UsersFile{Users: map[string]auth.UserInfo{
+		"root":  {Admin: true},
+		"alice": {},
+		"bob": {Access: map[string]map[string][]string{
+			"events": {"browser": {"Firefox"}},
+		}},
+	}}
+	return &testEnv{cfg: cfg, users: users, druidCfg: druidCfg, clusters: clusters, logger: logger}
+}
+
+// request construit une requête authentifiée par JWT (username vide = anonyme)
+func (e *testEnv) request(t *testing.T, method, url string, body interface{}, username string, admin bool) *http.Request {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+	r := httptest.NewRequest(method, url, &buf)
+	if username != "" {
+		token, err := auth.GenerateJWT(e.cfg.JWT.Secret, username, admin, e.cfg.JWT.ExpirationMinutes)
+		if err != nil {
+			t.Fatalf("GenerateJWT failed: %v", err)
+		}
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	return r
+}
+
+func serve(h http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+// newUsersDB crée une base sqlite d'utilisateurs (nom => admin) et retourne son DSN
+func newUsersDB(t *testing.T, users map[string]bool) string {
+	t.Helper()
+	dsn := filepath.Join(t.TempDir(), "users.db")
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		t.Fatalf("sql.Open failed: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("CREATE TABLE users (name TEXT PRIMARY KEY, is_admin INTEGER)"); err != nil {
+		t.Fatalf("create table failed: %v", err)
+	}
+	for name, admin := range users {
+		db.Exec("INSERT INTO users (name, is_admin) VALUES (?, ?)", name, admin)
+	}
+	return dsn
+}
+
+// newAPIKey active les clés d'API sur st et crée une clé de username limitée à datasources
+func newAPIKey(t *testing.T, st *store.Store, username string, datasources ...string) string {
+	t.Helper()
+	keys, err := auth.NewAPIKeys(st)
+	if err != nil {
+		t.Fatalf("NewAPIKeys failed: %v", err)
+	}
+	auth.SetAPIKeys(keys)
+	t.Cleanup(func() { auth.SetAPIKeys(nil) })
+	raw, _, err := keys.Create(auth.APIKeyOptions{Name: "test", Username: username, Datasources: datasources})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	return raw
+}
+
+// keyRequest construit une requête authentifiée par clé d'API
+func keyRequest(method, url string, body interface{}, key string) *http.Request {
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+	r := httptest.NewRequest(method, url, &buf)
+	r.Header.Set("X-API-Key", key)
+	return r
+}
@@ -0,0 +1,22 @@
+package api
+
+import (
+	"druid-insight/auth"
+	"net/http"
+)
+
+// JWKSHandler publie les clés publiques de vérification des jetons (vide en HS256)
+func JWKSHandler(keys *auth.KeySet) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "Méthode non autorisée", http.StatusMethodNotAllowed)
+			return
+		}
+		jwks := []auth.JWK{}
+		if keys != nil {
+			jwks = keys.JWKS()
+		}
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		writeJSON(w, http.StatusOK, map[string]interface{}{"keys": jwks})
+	}
+}
@@ -7,13 +7,19 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"strconv"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 )
 
-func LoginHandler(cfg *auth.Config, users *auth.UsersFile, loginLogger *logging.Logger) http.HandlerFunc {
+// LoginHandler vérifie les identifiants ; les échecs sont comptés par utilisateur et par adresse
+// (limiter nil = protection désactivée) et un verrouillage en cours répond 429 avec Retry-After.
+// Avec un second facteur (actif ou imposé par le rôle), la réponse est un mfa_token à
+// présenter avec le code sur /api/login/2fa.
+func LoginHandler(cfg *auth.Config, users *auth.UsersFile, sessions *auth.Sessions, limiter *auth.LoginLimiter, twoFactor *auth.TwoFactorAuth, loginLogger *logging.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != "POST" {
 			http.Error(w, "Méthode non autorisée", http.StatusMethodNotAllowed)
@@ -29,25 +35,51 @@ func LoginHandler(cfg *auth.Config, users *auth.UsersFile, loginLogger *logging.
 			return
 		}
 		username := req.Username
+		ip := auth.ClientIP(r, cfg.LoginProtection.TrustForwardedFor)
+		if loginLocked(w, limiter, loginLogger, username, ip) {
+			return
+		}
+		fail := func(reason string) { loginFailed(limiter, loginLogger, username, ip, reason) }
 		var userHash, userSalt string
 		isAdmin := false
 
 		if cfg.Auth.UserBackend == "file" {
-			u, ok := users.Users[username]
+			var ok bool
+			userHash, userSalt, ok = users.Credentials(username)
 			if !ok {
+				// même coût qu'une vérification : le temps de réponse ne révèle pas les comptes existants
+				auth.ApplyHashMacro(cfg.Auth.HashMacro, req.Password, username, "", cfg.Auth.Salt)
 				http.Error(w, "Unauthorized", http.StatusUnauthorized)
 				log.Println("LOGIN FAIL (no user) user=" + username)
+				fail("no_user")
 				return
 			}
-			userHash, userSalt = u.Hash, u.Salt
-			isAdmin = u.Admin
+			isAdmin = users.Users[username].Admin
 
-			passHash, _ := auth.ApplyHashMacro(cfg.Auth.HashMacro, req.Password, username, userSalt, cfg.Auth.Salt)
-			if passHash != userHash {
+			valid, rehash := auth.VerifyPassword(cfg.Auth.HashMacro, cfg.Auth.LegacyHashMacros, userHash, req.Password, username, userSalt, cfg.Auth.Salt)
+			if !valid {
 				http.Error(w, "Unauthorized", http.StatusUnauthorized)
 				log.Println("LOGIN FAIL (wrong pass) user=" + username)
+				fail("wrong_password")
+				return
+			}
+			if rehash {
+				rehashPassword(cfg, cfg.Auth.HashMacro, username, req.Password)
+			}
+		} else if cfg.Auth.UserBackend == "ldap" {
+			u, err := auth.LDAP().Authenticate(username, req.Password)
+			if err != nil {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				log.Println("LOGIN FAIL (ldap) user=" + username + " " + err.Error())
+				fail("ldap")
 				return
 			}
+			isAdmin = u.Admin
+		} else if cfg.Auth.UserBackend == "oidc" {
+			// les mots de passe sont gérés par le fournisseur d'identité : /api/oidc/login
+			http.Error(w, "Connexion par mot de passe désactivée, utiliser /api/oidc/login", http.StatusUnauthorized)
+			log.Println("LOGIN FAIL (oidc backend) user=" + username)
+			return
 		} else if cfg.Auth.UserBackend == "mysql" || cfg.Auth.UserBackend == "postgres" || cfg.Auth.UserBackend == "sqlite" {
 			db, err := sql.Open(cfg.Auth.UserBackend, cfg.Auth.DBDSN)
 			if err != nil {
@@ -61,31 +93,88 @@ func LoginHandler(cfg *auth.Config, users *auth.UsersFile, loginLogger *logging.
 			if err != nil {
 				http.Error(w, "Unauthorized", http.StatusUnauthorized)
 				log.Println("LOGIN FAIL (db no user) user=" + username)
+				fail("db_no_user")
 				return
 			}
 			// if DBPassHash is true, it means the password hash was not checked
 			// by db sql call above, so it needs to be done now
 			if cfg.Auth.DBPassHash {
-				passHash, _ := auth.ApplyHashMacro(cfg.Auth.DBHashMacro, req.Password, username, userSalt, cfg.Auth.Salt)
-				if passHash != userHash {
+				valid, rehash := auth.VerifyPassword(cfg.Auth.DBHashMacro, cfg.Auth.LegacyHashMacros, userHash, req.Password, username, userSalt, cfg.Auth.Salt)
+				if !valid {
 					http.Error(w, "Unauthorized", http.StatusUnauthorized)
 					log.Println("LOGIN FAIL (db wrong pass) user=" + username)
+					fail("wrong_password")
 					return
 				}
+				if rehash && cfg.Auth.DBRehashRequest != "" {
+					rehashPassword(cfg, cfg.Auth.DBHashMacro, username, req.Password)
+				}
 			} else {
 				log.Println("LOGIN supposedly validate by DB")
 			}
 		}
 		// Ajoute ici la branche DB si tu veux
-		tokenString, err := auth.GenerateJWT(cfg.JWT.Secret, username, isAdmin, cfg.JWT.ExpirationMinutes)
-		if err != nil {
+		// les rôles rbac peuvent aussi donner les droits d'administration
+		grants := auth.UserGrants(username, isAdmin, users, cfg)
+		isAdmin = grants.Admin
+		if twoFactor != nil && requireSecondFactor(w, twoFactor, username, grants, ip, loginLogger) {
+			return
+		}
+		if err := writeTokens(w, cfg, sessions, username, isAdmin, ""); err != nil {
 			http.Error(w, "Erreur serveur", http.StatusInternalServerError)
-			log.Println("LOGIN FAIL (jwt error) user=" + username)
+			log.Println("LOGIN FAIL (jwt error) user=" + username + " " + err.Error())
 			return
 		}
-		resp := map[string]string{"token": tokenString}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(resp)
+		if limiter != nil {
+			limiter.Success(username)
+		}
 		log.Println("LOGIN OK user=" + username)
+		loginLogger.Write("LOGIN_OK user=" + username + " ip=" + ip)
+	}
+}
+
+// rehashPassword enregistre le mot de passe haché avec la macro courante après une connexion
+// réussie avec un ancien schéma ; un échec n'empêche pas la connexion
+func rehashPassword(cfg *auth.Config, macro, username, password string) {
+	hash, salt, err := auth.HashPassword(macro, password, username, cfg.Auth.Salt)
+	if err == nil {
+		if cfg.Auth.UserBackend == "file" {
+			err = auth.UpdateUserHash(cfg.Auth.UserFile, username, hash, salt)
+		} else {
+			err = auth.UpdateDBUserHash(cfg, username, hash, salt)
+		}
+	}
+	if err != nil {
+		log.Println("LOGIN REHASH FAIL user=" + username + " " + err.Error())
+		return
+	}
+	log.Println("LOGIN REHASH user=" + username)
+}
+
+// loginLocked répond 429 (avec Retry-After) si l'utilisateur ou l'adresse est verrouillé
+func loginLocked(w http.ResponseWriter, limiter *auth.LoginLimiter, loginLogger *logging.Logger, username, ip string) bool {
+	if limiter == nil {
+		return false
+	}
+	until, locked := limiter.Check(username, ip)
+	if !locked {
+		return false
+	}
+	retry := int(time.Until(until).Seconds()) + 1
+	w.Header().Set("Retry-After", strconv.Itoa(retry))
+	http.Error(w, "Trop de tentatives, réessayer plus tard", http.StatusTooManyRequests)
+	loginLogger.Write("LOGIN_LOCKED user=" + username + " ip=" + ip + " retry_after=" + strconv.Itoa(retry))
+	return true
+}
+
+// loginFailed compte l'échec et trace les verrouillages qu'il déclenche dans login.log
+func loginFailed(limiter *auth.LoginLimiter, loginLogger *logging.Logger, username, ip, reason string) {
+	loginLogger.Write("LOGIN_FAIL user=" + username + " ip=" + ip + " reason=" + reason)
+	if limiter == nil {
+		return
+	}
+	for _, lock := range limiter.Failure(username, ip) {
+		loginLogger.Write("LOCKOUT key=" + lock.Key + " level=" + strconv.Itoa(lock.Level) +
+			" failures=" + strconv.Itoa(lock.Failures) + " until=" + lock.LockedUntil.UTC().Format(time.RFC3339))
 	}
 }
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"crypto/subtle"
+	"druid-insight/auth"
+	"druid-insight/logging"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// oidcStateCookie lie le state au navigateur qui a lancé la connexion : un callback ouvert dans
+// un autre navigateur (lien envoyé par un tiers) est refusé
+const oidcStateCookie = "druid_insight_oidc_state"
+
+// OIDCLoginHandler redirige le navigateur vers le fournisseur d'identité (GET ?redirect=/chemin).
+// redirect est le chemin du front rouvert après connexion, "/" par défaut.
+func OIDCLoginHandler(cfg *auth.Config, loginLogger *logging.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "Méthode non autorisée", http.StatusMethodNotAllowed)
+			return
+		}
+		if cfg.Auth.UserBackend != "oidc" || auth.OIDC() == nil {
+			http.Error(w, "SSO non configuré", http.StatusNotFound)
+			return
+		}
+		redirect := r.URL.Query().Get("redirect")
+		if redirect == "" {
+			redirect = "/"
+		}
+		if !localPath(redirect) {
+			http.Error(w, "redirect doit être un chemin local", http.StatusBadRequest)
+			return
+		}
+		target, state, err := auth.OIDC().AuthCodeURL(redirect)
+		if err != nil {
+			http.Error(w, "Fournisseur d'identité indisponible", http.StatusBadGateway)
+			log.Println("OIDC LOGIN FAIL " + err.Error())
+			loginLogger.Write("OIDC_LOGIN_FAIL reason=" + err.Error())
+			return
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     oidcStateCookie,
+			Value:    state,
+			Path:     "/",
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		})
+		http.Redirect(w, r, target, http.StatusFound)
+	}
+}
+
+// OIDCCallbackHandler reçoit le retour du fournisseur (GET ?code=&state=), vérifie l'ID token et
+// redirige vers le front avec les jetons druid-insight dans le fragment de l'URL
+// (#token=...&refresh_token=...&expires_in=...), qui n'est jamais envoyé aux serveurs.
+func OIDCCallbackHandler(cfg *auth.Config, sessions *auth.Sessions, loginLogger *logging.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "Méthode non autorisée", http.StatusMethodNotAllowed)
+			return
+		}
+		if cfg.Auth.UserBackend != "oidc" || auth.OIDC() == nil {
+			http.Error(w, "SSO non configuré", http.StatusNotFound)
+			return
+		}
+		q := r.URL.Query()
+		if e := q.Get("error"); e != "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			log.Println("OIDC LOGIN FAIL (provider) error=" + e + " " + q.Get("error_description"))
+			loginLogger.Write("OIDC_LOGIN_FAIL reason=provider error=" + e)
+			return
+		}
+		if q.Get("state") == "" || q.Get("code") == "" {
+			http.Error(w, "code et state requis", http.StatusBadRequest)
+			return
+		}
+		cookie, err := r.Cookie(oidcStateCookie)
+		if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(q.Get("state"))) != 1 {
+			http.Error(w, "Connexion lancée depuis un autre navigateur, recommencer", http.StatusBadRequest)
+			log.Println("OIDC LOGIN FAIL (state cookie)")
+			loginLogger.Write("OIDC_LOGIN_FAIL reason=state_cookie")
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/", MaxAge: -1, HttpOnly: true})
+		u, redirect, err := auth.OIDC().Exchange(r.Context(), q.Get("state"), q.Get("code"))
+		if errors.Is(err, auth.ErrOIDCStateInvalid) {
+			http.Error(w, "Connexion expirée, recommencer", http.StatusBadRequest)
+			log.Println("OIDC LOGIN FAIL (state)")
+			loginLogger.Write("OIDC_LOGIN_FAIL reason=state")
+			return
+		}
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			log.Println("OIDC LOGIN FAIL " + err.Error())
+			loginLogger.Write("OIDC_LOGIN_FAIL reason=" + err.Error())
+			return
+		}
+		resp, err := issueTokens(cfg, sessions, u.Username, auth.UserGrants(u.Username, u.Admin, nil, cfg).Admin, "")
+		if err != nil {
+			http.Error(w, "Erreur serveur", http.StatusInternalServerError)
+			log.Println("OIDC LOGIN FAIL (jwt error) user=" + u.Username + " " + err.Error())
+			return
+		}
+		fragment := url.Values{}
+		for k, v := range resp {
+			fragment.Set(k, fmt.Sprint(v))
+		}
+		http.Redirect(w, r, redirect+"#"+fragment.Encode(), http.StatusFound)
+		log.Println("OIDC LOGIN OK user=" + u.Username)
+		loginLogger.Write("OIDC_LOGIN_OK user=" + u.Username)
+	}
+}
+
+// localPath refuse les redirections hors du site (URL absolue, //hote, \hote)
+func localPath(p string) bool {
+	return strings.HasPrefix(p, "/") && !strings.HasPrefix(p, "//") && !strings.HasPrefix(p, "/\\") && !strings.ContainsAny(p, "#\r\n")
+}
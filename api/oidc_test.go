@@ -0,0 +1,39 @@
+package api
+
+import (
+	"druid-insight/auth"
+	"druid-insight/store"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOIDCCallbackHandler_RequiresStateCookie(t *testing.T) {
+	env := newTestEnv(t)
+	env.cfg.Auth.UserBackend = "oidc"
+	st, err := store.Open("file", "", t.TempDir())
+	if err != nil {
+		t.Fatalf("store.Open failed: %v", err)
+	}
+	p, err := auth.NewOIDCProvider(auth.OIDCConfig{Issuer: "http://idp.invalid", ClientID: "druid-insight", RedirectURL: "http://localhost/api/oidc/callback"}, st)
+	if err != nil {
+		t.Fatalf("NewOIDCProvider failed: %v", err)
+	}
+	auth.SetOIDCProvider(p)
+	defer auth.SetOIDCProvider(nil)
+	h := OIDCCallbackHandler(env.cfg, nil, env.logger)
+
+	// lien de callback ouvert sans le cookie posé par /api/oidc/login, ou avec celui d'une autre connexion
+	for name, cookie := range map[string]*http.Cookie{
+		"missing": nil,
+		"other":   {Name: oidcStateCookie, Value: "victim-state"},
+	} {
+		r := httptest.NewRequest("GET", "/api/oidc/callback?state=attacker-state&code=c", nil)
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+		if w := serve(h, r); w.Code != http.StatusBadRequest {
+			t.Errorf("%s cookie: expected 400, got %d: %s", name, w.Code, w.Body)
+		}
+	}
+}
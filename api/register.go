@@ -3,17 +3,43 @@ package api
 import (
 	"druid-insight/auth"
 	"druid-insight/config"
+	"druid-insight/druid"
 	"druid-insight/logging"
+	"druid-insight/scheduler"
+	"druid-insight/store"
 	"net/http"
 )
 
-func RegisterHandlers(cfg *auth.Config, users *auth.UsersFile, druidCfg *config.DruidConfig, accessLogger, loginLogger, reportLogger *logging.Logger) {
-	http.HandleFunc("/api/login", withCORS(LoginHandler(cfg, users, loginLogger)))
-	http.HandleFunc("/api/schema", withCORS(SchemaHandler(cfg, druidCfg, accessLogger)))
+func RegisterHandlers(cfg *auth.Config, users *auth.UsersFile, druidCfg *config.DruidConfig, druidClusters *druid.Clusters, st *store.Store, sessions *auth.Sessions, apiKeys *auth.APIKeys, limiter *auth.LoginLimiter, twoFactor *auth.TwoFactorAuth, keys *auth.KeySet, sched *scheduler.Scheduler, accessLogger, loginLogger, reportLogger *logging.Logger) {
+	http.HandleFunc("/api/login", withCORS(LoginHandler(cfg, users, sessions, limiter, twoFactor, loginLogger)))
+	http.HandleFunc("/api/login/2fa", withCORS(LoginTwoFactorHandler(cfg, sessions, limiter, twoFactor, loginLogger)))
+	http.HandleFunc("/api/2fa", withCORS(TwoFactorHandler(cfg, users, limiter, twoFactor, loginLogger)))
+	http.HandleFunc("/api/2fa/enroll", withCORS(TwoFactorHandler(cfg, users, limiter, twoFactor, loginLogger)))
+	http.HandleFunc("/api/2fa/confirm", withCORS(TwoFactorHandler(cfg, users, limiter, twoFactor, loginLogger)))
+	http.HandleFunc("/api/token/refresh", withCORS(TokenRefreshHandler(cfg, users, sessions)))
+	http.HandleFunc("/api/oidc/login", withCORS(OIDCLoginHandler(cfg, loginLogger)))
+	http.HandleFunc("/api/oidc/callback", withCORS(OIDCCallbackHandler(cfg, sessions, loginLogger)))
+	http.HandleFunc("/api/logout", withCORS(LogoutHandler(cfg, sessions, accessLogger)))
+	http.HandleFunc("/api/apikeys", withCORS(APIKeysHandler(cfg, druidCfg, apiKeys, accessLogger)))
+	http.HandleFunc("/.well-known/jwks.json", withCORS(JWKSHandler(keys)))
+	http.HandleFunc("/api/schema", withCORS(SchemaHandler(cfg, users, druidCfg, accessLogger)))
+	http.HandleFunc("/api/reports", withCORS(ReportHistoryHandler(cfg, st)))
+	http.HandleFunc("/api/reports/rerun", withCORS(ReportRerunHandler(cfg, users, druidCfg, st, accessLogger)))
 	http.HandleFunc("/api/reports/execute", withCORS(ReportExecuteHandler(cfg, users, druidCfg, accessLogger)))
+	http.HandleFunc("/api/reports/explain", withCORS(ReportExplainHandler(cfg, users, druidCfg, druidClusters, accessLogger)))
 	http.HandleFunc("/api/reports/status", withCORS(ReportStatusHandler(cfg)))
-	http.HandleFunc("/api/reports/download", withCORS(DownloadReportCSV(cfg)))
-	http.HandleFunc("/api/filters/values", withCORS(GetDimensionValues(cfg, druidCfg)))
+	http.HandleFunc("/api/reports/events", withCORS(ReportEventsHandler(cfg)))
+	http.HandleFunc("/api/reports/events/ticket", withCORS(ReportEventsTicketHandler(cfg)))
+	http.HandleFunc("/api/reports/cancel", withCORS(ReportCancelHandler(cfg, accessLogger)))
+	http.HandleFunc("/api/reports/download", withCORS(DownloadReportCSV(cfg, users)))
+	http.HandleFunc("/api/filters/values", withCORS(GetDimensionValues(cfg, users, druidCfg, druidClusters)))
+	http.HandleFunc("/api/saved-reports", withCORS(SavedReportsHandler(cfg, users, druidCfg, st, accessLogger)))
+	http.HandleFunc("/api/saved-reports/run", withCORS(SavedReportRunHandler(cfg, users, druidCfg, st, accessLogger)))
+	http.HandleFunc("/api/schedules", withCORS(SchedulesHandler(cfg, users, st, sched, accessLogger)))
+	http.HandleFunc("/api/share", withCORS(ShareHandler(cfg, users, st, accessLogger)))
+	http.HandleFunc("/api/share/view", withCORS(ShareViewHandler(cfg, users, druidCfg, st, accessLogger)))
+	http.HandleFunc("/api/webhooks/deliveries", withCORS(WebhookDeliveriesHandler(cfg, st)))
+	http.HandleFunc("/api/cache/purge", withCORS(CachePurgeHandler(cfg, accessLogger)))
 }
 
 func StartServer(listenAddr string) error {
@@ -23,8 +49,8 @@ func StartServer(listenAddr string) error {
 func withCORS(h http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-API-Key")
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
 			return
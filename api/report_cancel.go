@@ -0,0 +1,35 @@
+package api
+
+import (
+	"druid-insight/auth"
+	"druid-insight/logging"
+	"druid-insight/worker"
+	"net/http"
+)
+
+// ReportCancelHandler annule un rapport en attente ou en cours (POST ?id=, propriétaire ou admin)
+func ReportCancelHandler(cfg *auth.Config, accessLogger *logging.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Méthode non autorisée", http.StatusMethodNotAllowed)
+			return
+		}
+		username, isAdmin, err := auth.ExtractUserAndAdminFromJWT(r, cfg.JWT.Secret)
+		if err != nil || username == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		id := r.URL.Query().Get("id")
+		owner, _, _, ok := worker.LookupReport(id)
+		if !ok || (owner != username && !isAdmin) {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+		if !worker.Cancel(id) {
+			http.Error(w, "Rapport déjà terminé", http.StatusConflict)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, map[string]string{"id": id, "status": string(worker.StatusCancelled)})
+		accessLogger.Write("CANCEL user=" + username + " id=" + id)
+	}
+}
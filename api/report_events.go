@@ -0,0 +1,181 @@
+package api
+
+import (
+	"druid-insight/auth"
+	"druid-insight/utils"
+	"druid-insight/worker"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const sseProgressInterval = 5 * time.Second
+
+// Tickets d'abonnement SSE : EventSource ne permettant pas d'en-têtes, le flux s'ouvre avec
+// un ticket à usage unique plutôt qu'avec le JWT, qui finirait dans les logs d'accès
+const streamTicketTTL = 30 * time.Second
+
+type streamTicket struct {
+	username  string
+	admin     bool
+	expiresAt time.Time
+}
+
+var streamTickets sync.Map // ticket => streamTicket
+
+// ReportEventsTicketHandler sert POST /api/reports/events/ticket : émet un ticket valable
+// 30 secondes pour une seule ouverture de /api/reports/events
+func ReportEventsTicketHandler(cfg *auth.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Méthode non autorisée", http.StatusMethodNotAllowed)
+			return
+		}
+		username, isAdmin, err := auth.ExtractUserAndAdminFromJWT(r, cfg.JWT.Secret)
+		if err != nil || username == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		now := time.Now()
+		streamTickets.Range(func(k, v interface{}) bool {
+			if now.After(v.(streamTicket).expiresAt) {
+				streamTickets.Delete(k)
+			}
+			return true
+		})
+		ticket := utils.RandomHex(32)
+		streamTickets.Store(ticket, streamTicket{username: username, admin: isAdmin, expiresAt: now.Add(streamTicketTTL)})
+		writeJSON(w, http.StatusCreated, map[string]interface{}{
+			"ticket":     ticket,
+			"expires_in": int(streamTicketTTL.Seconds()),
+		})
+	}
+}
+
+// consumeStreamTicket retourne l'utilisateur d'un ticket SSE et l'invalide
+func consumeStreamTicket(ticket string) (string, bool, bool) {
+	v, ok := streamTickets.LoadAndDelete(ticket)
+	if !ok || time.Now().After(v.(streamTicket).expiresAt) {
+		return "", false, false
+	}
+	t := v.(streamTicket)
+	return t.username, t.admin, true
+}
+
+// ReportEventsHandler diffuse en Server-Sent Events les changements de statut d'un rapport
+// (?id=) ou de tous les rapports de l'utilisateur. Le flux s'authentifie par JWT ou par un
+// ticket ?ticket= émis par ReportEventsTicketHandler.
+func ReportEventsHandler(cfg *auth.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "Méthode non autorisée", http.StatusMethodNotAllowed)
+			return
+		}
+		var username string
+		var isAdmin bool
+		if ticket := r.URL.Query().Get("ticket"); ticket != "" {
+			var ok bool
+			if username, isAdmin, ok = consumeStreamTicket(ticket); !ok {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+		} else {
+			var err error
+			username, isAdmin, err = auth.ExtractUserAndAdminFromJWT(r, cfg.JWT.Secret)
+			if err != nil || username == "" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "Streaming non supporté", http.StatusInternalServerError)
+			return
+		}
+
+		id := r.URL.Query().Get("id")
+		var initial []worker.Event
+		filter := func(e worker.Event) bool { return e.Owner == username }
+		if id != "" {
+			e, ok := worker.Snapshot(id)
+			if !ok || (e.Owner != username && !isAdmin) {
+				http.Error(w, "Not found", http.StatusNotFound)
+				return
+			}
+			initial = []worker.Event{e}
+			filter = func(e worker.Event) bool { return e.ID == id }
+		}
+		// Abonnement avant la photo initiale pour ne perdre aucune transition
+		events, unsubscribe := worker.Subscribe(filter)
+		defer unsubscribe()
+		if id == "" {
+			initial = worker.ActiveSnapshots(username)
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		// Rapports non terminés suivis : les rapports en cours reçoivent périodiquement le temps
+		// écoulé, et tous sont relus si le bus ferme le flux
+		active := map[string]worker.ReportStatus{}
+		send := func(e worker.Event) bool {
+			data, _ := json.Marshal(e)
+			fmt.Fprintf(w, "event: status\ndata: %s\n\n", data)
+			flusher.Flush()
+			if e.Terminal() {
+				delete(active, e.ID)
+			} else {
+				active[e.ID] = e.Status
+			}
+			return id != "" && e.Terminal()
+		}
+		for _, e := range initial {
+			if send(e) {
+				return
+			}
+		}
+
+		ticker := time.NewTicker(sseProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case e, ok := <-events:
+				if !ok {
+					// abonné débordé : l'état courant remplace les événements perdus (statuts
+					// finaux compris), puis le client se reconnecte
+					for pid := range active {
+						if e, ok := worker.Snapshot(pid); ok {
+							send(e)
+						}
+					}
+					return
+				}
+				if send(e) {
+					return
+				}
+			case <-ticker.C:
+				sent := false
+				for pid, status := range active {
+					if status != worker.StatusProcessing {
+						continue
+					}
+					sent = true
+					if e, ok := worker.Snapshot(pid); ok && send(e) {
+						return
+					}
+				}
+				if !sent {
+					fmt.Fprint(w, ": keep-alive\n\n")
+					flusher.Flush()
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestReportEventsTicket_SingleUse(t *testing.T) {
+	env := newTestEnv(t)
+	w := serve(ReportEventsTicketHandler(env.cfg), env.request(t, "POST", "/api/reports/events/ticket", nil, "alice", false))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body)
+	}
+	var out map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &out)
+	ticket, _ := out["ticket"].(string)
+
+	h := ReportEventsHandler(env.cfg)
+	url := "/api/reports/events?id=missing&ticket=" + ticket
+	// ticket accepté : le rapport inconnu donne 404
+	if w := serve(h, env.request(t, "GET", url, nil, "", false)); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 with a valid ticket, got %d", w.Code)
+	}
+	if w := serve(h, env.request(t, "GET", url, nil, "", false)); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 when the ticket is reused, got %d", w.Code)
+	}
+	if w := serve(h, env.request(t, "GET", "/api/reports/events?token=x", nil, "", false)); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without JWT or ticket, got %d", w.Code)
+	}
+}
@@ -4,9 +4,12 @@ import (
 	"druid-insight/auth"
 	"druid-insight/config"
 	"druid-insight/logging"
+	"druid-insight/notify"
+	"druid-insight/report"
 	"druid-insight/utils"
 	"druid-insight/worker"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/url"
 	"strings"
@@ -25,19 +28,28 @@ func ReportExecuteHandler(cfg *auth.Config, users *auth.UsersFile, druidCfg *con
 			accessLogger.Write("EXECUTE_FAIL user=<unauth>")
 			return
 		}
-		var payload map[string]interface{}
-		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-			http.Error(w, "Bad JSON", http.StatusBadRequest)
-			accessLogger.Write("EXECUTE_FAIL user=" + username + " bad_json")
+		grants := auth.UserGrants(username, isAdmin, users, cfg)
+		recipients, statusOnly, ok := notifyRecipients(w, r, cfg, grants)
+		if !ok {
+			accessLogger.Write("EXECUTE_FAIL user=" + username + " bad notify")
 			return
 		}
-		datasource, _ := payload["datasource"].(string)
-		if datasource == "" {
-			http.Error(w, "Datasource missing", http.StatusBadRequest)
-			accessLogger.Write("EXECUTE_FAIL user=" + username + " missing_datasource")
+		spec, err := report.Decode(r.Body)
+		if err != nil {
+			writeValidationError(w, err)
+			accessLogger.Write("EXECUTE_FAIL user=" + username + " bad_json " + err.Error())
+			return
+		}
+		if errs := spec.Validate(druidCfg); len(errs) > 0 {
+			writeValidationError(w, &report.ValidationError{Errors: errs})
+			accessLogger.Write("EXECUTE_FAIL user=" + username + " invalid errors=" + jsonString(errs))
 			return
 		}
-		problems := auth.CheckRights(payload, druidCfg, datasource, isAdmin)
+		if !checkKeyScope(w, r, spec.Datasource) {
+			accessLogger.Write("EXECUTE_FORBIDDEN user=" + username + " datasource=" + spec.Datasource + " key_scope")
+			return
+		}
+		problems := auth.CheckRights(spec, druidCfg, grants)
 		if len(problems) > 0 {
 			w.WriteHeader(http.StatusForbidden)
 			json.NewEncoder(w).Encode(map[string]interface{}{
@@ -47,45 +59,85 @@ func ReportExecuteHandler(cfg *auth.Config, users *auth.UsersFile, druidCfg *con
 			accessLogger.Write("EXECUTE_FORBIDDEN user=" + username + " problems=" + jsonString(problems))
 			return
 		}
-		origin := r.Header.Get("Origin")
-		if origin == "" {
-			origin = r.Header.Get("Referer")
-		}
-		domain := origin
-		if origin != "" {
-			u, err := url.Parse(origin)
-			if err == nil {
-				domain = u.Host
-			} else {
-				origin = strings.TrimPrefix(origin, "http://")
-				origin = strings.TrimPrefix(origin, "https://")
-				parts := strings.Split(origin, "/")
-				domain = parts[0]
-			}
-		}
-		if _, ok := cfg.Context[domain]; ok {
-			domain = cfg.Context[domain]
-		}
-		if domain == "" {
-			domain = "direct"
-		}
-		id := utils.GenerateRequestID()
-		req := &worker.ReportRequest{
-			ID:         id,
-			Payload:    payload,
+		id := enqueueReport(&worker.ReportRequest{
+			Spec:       spec,
 			Owner:      username,
 			Admin:      isAdmin,
-			Datasource: datasource,
-			CreatedAt:  time.Now(),
-			Context:    domain,
-		}
-		worker.AddPendingRequest(req)
+			Context:    requestDomain(r, cfg),
+			Notify:     recipients,
+			NotifyOnly: statusOnly,
+		})
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]string{"id": id})
 		accessLogger.Write("EXECUTE_OK user=" + username + " id=" + id)
 	}
 }
 
+// requestDomain détermine le contexte Druid ("application") à partir de Origin/Referer
+func requestDomain(r *http.Request, cfg *auth.Config) string {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		origin = r.Header.Get("Referer")
+	}
+	domain := origin
+	if origin != "" {
+		u, err := url.Parse(origin)
+		if err == nil {
+			domain = u.Host
+		} else {
+			origin = strings.TrimPrefix(origin, "http://")
+			origin = strings.TrimPrefix(origin, "https://")
+			parts := strings.Split(origin, "/")
+			domain = parts[0]
+		}
+	}
+	if _, ok := cfg.Context[domain]; ok {
+		domain = cfg.Context[domain]
+	}
+	if domain == "" {
+		domain = "direct"
+	}
+	return domain
+}
+
+// enqueueReport complète (id, date, datasource) et place un rapport validé dans la file
+// des workers, puis retourne son id
+func enqueueReport(req *worker.ReportRequest) string {
+	req.ID = utils.GenerateRequestID()
+	req.Datasource = req.Spec.Datasource
+	req.CreatedAt = time.Now()
+	worker.AddPendingRequest(req)
+	return req.ID
+}
+
+// notifyRecipients lit le paramètre ?notify=a@x.com,b@y.com (destinataires e-mail du résultat) ;
+// statusOnly : sans capacité export, les destinataires ne reçoivent que le statut
+func notifyRecipients(w http.ResponseWriter, r *http.Request, cfg *auth.Config, grants *auth.Grants) (recipients []string, statusOnly bool, ok bool) {
+	recipients = notify.ParseRecipients(r.URL.Query().Get("notify"))
+	if err := notify.ValidateRecipients(cfg, recipients); err != nil {
+		writeValidationError(w, &report.ValidationError{Errors: []report.FieldError{{Field: "notify", Message: err.Error()}}})
+		return nil, false, false
+	}
+	return recipients, !grants.Can(auth.CapExport), true
+}
+
+// writeValidationError répond 400 avec la liste des erreurs par champ
+func writeValidationError(w http.ResponseWriter, err error) {
+	var errs []report.FieldError
+	var verr *report.ValidationError
+	if errors.As(err, &verr) {
+		errs = verr.Errors
+	} else {
+		errs = []report.FieldError{{Field: "", Message: err.Error()}}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":  "invalid_request",
+		"errors": errs,
+	})
+}
+
 func jsonString(i interface{}) string {
 	b, _ := json.Marshal(i)
 	return string(b)
@@ -0,0 +1,128 @@
+package api
+
+import (
+	"druid-insight/auth"
+	"druid-insight/config"
+	"druid-insight/druid"
+	"druid-insight/logging"
+	"druid-insight/report"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// ReportExplainHandler exécute la même validation et la même construction de requête que
+// /api/reports/execute, sans interroger Druid, et retourne la requête générée.
+// Un admin peut expliquer un rapport pour le compte d'un autre utilisateur (champ "as_user") ;
+// un utilisateur standard ne voit que son propre périmètre d'accès.
+func ReportExplainHandler(cfg *auth.Config, users *auth.UsersFile, druidCfg *config.DruidConfig, druidClusters *druid.Clusters, accessLogger *logging.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Méthode non autorisée", http.StatusMethodNotAllowed)
+			return
+		}
+		username, isAdmin, err := auth.ExtractUserAndAdminFromJWT(r, cfg.JWT.Secret)
+		if err != nil || username == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var req struct {
+			report.Spec
+			AsUser string `json:"as_user,omitempty"`
+		}
+		if err := report.DecodeStrict(r.Body, &req); err != nil {
+			writeValidationError(w, err)
+			accessLogger.Write("EXPLAIN_FAIL user=" + username + " bad_json")
+			return
+		}
+		spec := &req.Spec
+		if errs := spec.Validate(druidCfg); len(errs) > 0 {
+			writeValidationError(w, &report.ValidationError{Errors: errs})
+			accessLogger.Write("EXPLAIN_FAIL user=" + username + " invalid errors=" + jsonString(errs))
+			return
+		}
+		if !auth.UserGrants(username, isAdmin, users, cfg).Can(auth.CapExplain) {
+			http.Error(w, "Forbidden: explain capability required", http.StatusForbidden)
+			accessLogger.Write("EXPLAIN_FORBIDDEN user=" + username + " capability=explain")
+			return
+		}
+		datasource := spec.Datasource
+		if !checkKeyScope(w, r, datasource) {
+			accessLogger.Write("EXPLAIN_FORBIDDEN user=" + username + " datasource=" + datasource + " key_scope")
+			return
+		}
+
+		// Identité pour laquelle la requête est construite
+		targetUser, targetAdmin := username, isAdmin
+		if asUser := req.AsUser; asUser != "" && asUser != username {
+			if !isAdmin {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				accessLogger.Write("EXPLAIN_FORBIDDEN user=" + username + " as_user=" + asUser)
+				return
+			}
+			// mêmes droits qu'une exécution réelle : drapeau admin relu dans le backend
+			admin, err := auth.LookupUserAdmin(asUser, users, cfg)
+			if errors.Is(err, auth.ErrUserNotFound) {
+				http.Error(w, "Utilisateur inconnu: "+asUser, http.StatusNotFound)
+				accessLogger.Write("EXPLAIN_FAIL user=" + username + " as_user=" + asUser + " unknown_user")
+				return
+			}
+			if err != nil {
+				http.Error(w, "Lecture de l'utilisateur impossible: "+err.Error(), http.StatusBadGateway)
+				accessLogger.Write("EXPLAIN_FAIL user=" + username + " as_user=" + asUser + " lookup " + err.Error())
+				return
+			}
+			targetUser, targetAdmin = asUser, admin
+		}
+
+		problems := auth.CheckRights(spec, druidCfg, auth.UserGrants(targetUser, targetAdmin, users, cfg))
+		if len(problems) > 0 {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error":    "forbidden",
+				"problems": problems,
+			})
+			accessLogger.Write("EXPLAIN_FORBIDDEN user=" + username + " problems=" + jsonString(problems))
+			return
+		}
+		ds := druidCfg.Datasources[datasource]
+		intervals, _ := spec.Intervals()
+
+		accessFilters, err := druid.ResolveAccessFilters(datasource, targetUser, targetAdmin, druidCfg, users, cfg)
+		if err != nil {
+			http.Error(w, "Erreur filtres d'accès: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		nativeQuery, err := druid.BuildDruidQuery(spec, targetUser, targetAdmin, druidCfg, users, cfg, "explain")
+		if err != nil {
+			http.Error(w, "Erreur construction requête Druid: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		sqlQuery, sqlErr := druid.BuildDruidSQLQuery(spec, targetUser, targetAdmin, druidCfg, users, cfg, "explain")
+		aggs, postAggs, _ := druid.BuildAggsAndPostAggs(spec.Metrics, ds)
+
+		queryMode := druid.QueryModeNative
+		if druid.UsesSQL(ds) {
+			queryMode = druid.QueryModeSQL
+		}
+		out := map[string]interface{}{
+			"datasource":        datasource,
+			"user":              targetUser,
+			"cluster":           druidClusters.ClusterName(datasource),
+			"query_mode":        queryMode,
+			"intervals":         intervals,
+			"access_filters":    accessFilters,
+			"aggregations":      aggs,
+			"post_aggregations": postAggs,
+			"native_query":      nativeQuery,
+		}
+		if sqlErr != nil {
+			out["sql_error"] = sqlErr.Error()
+		} else {
+			out["sql_query"] = sqlQuery
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(out)
+		accessLogger.Write("EXPLAIN_OK user=" + username + " as_user=" + targetUser + " datasource=" + datasource)
+	}
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestReportExplainHandler(t *testing.T) {
+	env := newTestEnv(t)
+	h := ReportExplainHandler(env.cfg, env.users, env.druidCfg, env.clusters, env.logger)
+	spec := func(extra map[string]interface{}) map[string]interface{} {
+		body := map[string]interface{}{"datasource": "events", "dimensions": []string{"browser"}, "metrics": []string{"requests"}}
+		for k, v := range extra {
+			body[k] = v
+		}
+		return body
+	}
+
+	w := serve(h, env.request(t, "POST", "/api/reports/explain", spec(nil), "", false))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without token, got %d", w.Code)
+	}
+
+	w = serve(h, env.request(t, "POST", "/api/reports/explain", spec(nil), "bob", false))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body)
+	}
+	var out map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &out)
+	if out["user"] != "bob" || out["cluster"] != "default" || out["native_query"] == nil {
+		t.Errorf("Unexpected explain output: %v", out)
+	}
+
+	w = serve(h, env.request(t, "POST", "/api/reports/explain", spec(map[string]interface{}{"dimensions": []string{"country"}}), "alice", false))
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "dimension:country:forbidden") {
+		t.Errorf("Expected 403 on an admin-only dimension, got %d: %s", w.Code, w.Body)
+	}
+
+	w = serve(h, env.request(t, "POST", "/api/reports/explain", spec(map[string]interface{}{"as_user": "root"}), "alice", false))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 on as_user for a non-admin, got %d", w.Code)
+	}
+}
+
+func TestReportExplainHandler_AsUser(t *testing.T) {
+	env := newTestEnv(t)
+	h := ReportExplainHandler(env.cfg, env.users, env.druidCfg, env.clusters, env.logger)
+	body := map[string]interface{}{"datasource": "events", "dimensions": []string{"country"}, "metrics": []string{"requests"}}
+
+	// l'admin cible garde ses droits d'admin, comme dans une exécution réelle
+	body["as_user"] = "root"
+	if w := serve(h, env.request(t, "POST", "/api/reports/explain", body, "root", true)); w.Code != http.StatusOK {
+		t.Errorf("Expected 200 for an admin target, got %d: %s", w.Code, w.Body)
+	}
+	body["as_user"] = "alice"
+	if w := serve(h, env.request(t, "POST", "/api/reports/explain", body, "root", true)); w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 with alice's rights, got %d", w.Code)
+	}
+	body["as_user"] = "ghost"
+	if w := serve(h, env.request(t, "POST", "/api/reports/explain", body, "root", true)); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown target, got %d", w.Code)
+	}
+
+	// backend SQL : le drapeau admin est relu par auth.user_lookup_request
+	env.cfg.Auth.UserBackend = "sqlite3"
+	env.cfg.Auth.DBDSN = newUsersDB(t, map[string]bool{"dba": true, "carol": false})
+	env.cfg.Auth.UserLookupRequest = "SELECT is_admin FROM users WHERE name = ?"
+	h = ReportExplainHandler(env.cfg, nil, env.druidCfg, env.clusters, env.logger)
+	body["as_user"] = "dba"
+	if w := serve(h, env.request(t, "POST", "/api/reports/explain", body, "root", true)); w.Code != http.StatusOK {
+		t.Errorf("Expected 200 for a SQL admin target, got %d: %s", w.Code, w.Body)
+	}
+	body["as_user"] = "carol"
+	if w := serve(h, env.request(t, "POST", "/api/reports/explain", body, "root", true)); w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a SQL non-admin target, got %d", w.Code)
+	}
+	body["as_user"] = "ghost"
+	if w := serve(h, env.request(t, "POST", "/api/reports/explain", body, "root", true)); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown SQL target, got %d", w.Code)
+	}
+}
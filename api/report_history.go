@@ -0,0 +1,171 @@
+package api
+
+import (
+	"druid-insight/auth"
+	"druid-insight/config"
+	"druid-insight/logging"
+	"druid-insight/report"
+	"druid-insight/store"
+	"druid-insight/worker"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const defaultHistoryLimit = 100
+
+// historyItem : entrée d'historique enrichie de la disponibilité du résultat
+type historyItem struct {
+	*store.HistoryEntry
+	ResultAvailable bool `json:"result_available"`
+}
+
+// ReportHistoryHandler liste les exécutions de l'utilisateur (GET), les plus récentes d'abord.
+// Filtres optionnels : datasource, status, from/to (YYYY-MM-DD, date de mise en file),
+// limit, et pour les admins user (un utilisateur) ou all=1 (tous).
+func ReportHistoryHandler(cfg *auth.Config, st *store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "Méthode non autorisée", http.StatusMethodNotAllowed)
+			return
+		}
+		username, isAdmin, err := auth.ExtractUserAndAdminFromJWT(r, cfg.JWT.Secret)
+		if err != nil || username == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		q := r.URL.Query()
+		owner := username
+		if isAdmin && q.Get("all") == "1" {
+			owner = ""
+		} else if u := q.Get("user"); u != "" && u != username {
+			if !isAdmin {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			owner = u
+		}
+		keep, errs := historyFilter(q.Get("datasource"), q.Get("status"), q.Get("from"), q.Get("to"), owner)
+		if len(errs) > 0 {
+			writeValidationError(w, &report.ValidationError{Errors: errs})
+			return
+		}
+		limit, err := strconv.Atoi(q.Get("limit"))
+		if err != nil || limit <= 0 {
+			limit = defaultHistoryLimit
+		}
+
+		list, err := st.ListHistory(keep)
+		if err != nil {
+			http.Error(w, "Erreur stockage", http.StatusInternalServerError)
+			return
+		}
+		list = append(list, worker.ActiveHistory(keep)...)
+		sort.SliceStable(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+		if len(list) > limit {
+			list = list[:limit]
+		}
+		items := make([]historyItem, 0, len(list))
+		for _, e := range list {
+			items = append(items, historyItem{HistoryEntry: e, ResultAvailable: e.Status == string(worker.StatusComplete) && worker.ResultAvailable(e.ID)})
+		}
+		writeJSON(w, http.StatusOK, items)
+	}
+}
+
+// ReportRerunHandler relance une exécution de l'historique (POST ?id=) avec les mêmes
+// paramètres, sous l'identité et les droits de l'utilisateur qui la relance.
+func ReportRerunHandler(cfg *auth.Config, users *auth.UsersFile, druidCfg *config.DruidConfig, st *store.Store, accessLogger *logging.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Méthode non autorisée", http.StatusMethodNotAllowed)
+			return
+		}
+		username, isAdmin, err := auth.ExtractUserAndAdminFromJWT(r, cfg.JWT.Secret)
+		if err != nil || username == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		grants := auth.UserGrants(username, isAdmin, users, cfg)
+		recipients, statusOnly, ok := notifyRecipients(w, r, cfg, grants)
+		if !ok {
+			return
+		}
+		sourceID := r.URL.Query().Get("id")
+		if sourceID == "" {
+			http.Error(w, "id requis", http.StatusBadRequest)
+			return
+		}
+		e, err := st.GetHistoryEntry(sourceID)
+		if errors.Is(err, store.ErrNotFound) {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Erreur stockage", http.StatusInternalServerError)
+			return
+		}
+		if e.Owner != username && !isAdmin {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+		// druid.yaml a pu changer depuis l'exécution : on revalide
+		spec := e.Spec
+		if errs := spec.Validate(druidCfg); len(errs) > 0 {
+			writeValidationError(w, &report.ValidationError{Errors: errs})
+			accessLogger.Write("RERUN_FAIL user=" + username + " source=" + sourceID + " invalid errors=" + jsonString(errs))
+			return
+		}
+		if !checkSpecRights(w, r, &spec, druidCfg, grants) {
+			accessLogger.Write("RERUN_FORBIDDEN user=" + username + " source=" + sourceID)
+			return
+		}
+		id := enqueueReport(&worker.ReportRequest{
+			Spec:       &spec,
+			Owner:      username,
+			Admin:      isAdmin,
+			Context:    requestDomain(r, cfg),
+			Notify:     recipients,
+			NotifyOnly: statusOnly,
+		})
+		writeJSON(w, http.StatusOK, map[string]string{"id": id})
+		accessLogger.Write("RERUN user=" + username + " source=" + sourceID + " id=" + id)
+	}
+}
+
+// historyFilter construit le filtre des entrées d'historique (owner "" = tous)
+func historyFilter(datasource, status, from, to, owner string) (func(*store.HistoryEntry) bool, []report.FieldError) {
+	var errs []report.FieldError
+	var fromT, toT time.Time
+	if from != "" {
+		t, err := time.ParseInLocation("2006-01-02", from, time.Local)
+		if err != nil {
+			errs = append(errs, report.FieldError{Field: "from", Message: "expected YYYY-MM-DD"})
+		}
+		fromT = t
+	}
+	if to != "" {
+		t, err := time.ParseInLocation("2006-01-02", to, time.Local)
+		if err != nil {
+			errs = append(errs, report.FieldError{Field: "to", Message: "expected YYYY-MM-DD"})
+		}
+		toT = t.AddDate(0, 0, 1) // fin incluse
+	}
+	return func(e *store.HistoryEntry) bool {
+		switch {
+		case owner != "" && e.Owner != owner:
+			return false
+		case datasource != "" && e.Datasource != datasource:
+			return false
+		case status != "" && e.Status != status:
+			return false
+		case !fromT.IsZero() && e.CreatedAt.Before(fromT):
+			return false
+		case !toT.IsZero() && !e.CreatedAt.Before(toT):
+			return false
+		}
+		return true
+	}, errs
+}
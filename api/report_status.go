@@ -5,6 +5,7 @@ import (
 	"druid-insight/worker"
 	"encoding/json"
 	"net/http"
+	"time"
 )
 
 func ReportStatusHandler(cfg *auth.Config) http.HandlerFunc {
@@ -19,29 +20,69 @@ func ReportStatusHandler(cfg *auth.Config) http.HandlerFunc {
 			http.Error(w, "Missing id", http.StatusBadRequest)
 			return
 		}
-		if _, ok := worker.PendingRequests().Load(id); ok {
-			json.NewEncoder(w).Encode(map[string]string{
-				"status": string(worker.StatusWaiting),
-			})
-			return
+		json.NewEncoder(w).Encode(reportStatus(id))
+	}
+}
+
+// reportStatus construit la réponse de statut d'un rapport (waiting, processing, complete,
+// error, cancelled ou unknown) avec position dans la file, horodatages et estimations
+func reportStatus(id string) map[string]interface{} {
+	if val, ok := worker.PendingRequests().Load(id); ok {
+		req := val.(*worker.ReportRequest)
+		position := worker.QueuePosition(id)
+		out := map[string]interface{}{
+			"status":      string(worker.StatusWaiting),
+			"position":    position,
+			"jobs_ahead":  max(position-1, 0),
+			"enqueued_at": req.CreatedAt,
+		}
+		if wait := worker.EstimatedWait(position); wait > 0 {
+			out["estimated_wait_ms"] = wait.Milliseconds()
+		}
+		return out
+	}
+	if val, ok := worker.ProcessingRequests().Load(id); ok {
+		rr := val.(*worker.ReportResult)
+		out := map[string]interface{}{
+			"status":      rr.Status,
+			"enqueued_at": rr.CreatedAt,
 		}
-		if val, ok := worker.ProcessingRequests().Load(id); ok {
-			rr := val.(*worker.ReportResult)
-			out := map[string]interface{}{
-				"status": rr.Status,
+		if !rr.StartedAt.IsZero() {
+			out["started_at"] = rr.StartedAt
+			out["worker_id"] = rr.WorkerID
+		}
+		/*if rr.Status == worker.StatusComplete {
+			out["result"] = rr.Result
+			out["csv"] = rr.CSVPath
+		}*/
+		switch rr.Status {
+		case worker.StatusProcessing:
+			elapsed := time.Since(rr.StartedAt)
+			out["elapsed_ms"] = elapsed.Milliseconds()
+			if remaining := worker.EstimatedRemaining(elapsed); remaining > 0 {
+				out["estimated_remaining_ms"] = remaining.Milliseconds()
 			}
-			/*if rr.Status == worker.StatusComplete {
-				out["result"] = rr.Result
-				out["csv"] = rr.CSVPath
-			}*/
-			if rr.Status == worker.StatusError {
-				out["error"] = rr.ErrorMsg
+		case worker.StatusComplete:
+			out["rows_written"] = rr.Rows
+		case worker.StatusError, worker.StatusCancelled:
+			out["error"] = rr.ErrorMsg
+		}
+		if !rr.FinishedAt.IsZero() {
+			out["finished_at"] = rr.FinishedAt
+			if !rr.StartedAt.IsZero() {
+				out["druid_ms"] = rr.DruidTime.Milliseconds()
+				out["duration_ms"] = rr.FinishedAt.Sub(rr.StartedAt).Milliseconds()
 			}
-			json.NewEncoder(w).Encode(out)
-			return
 		}
-		json.NewEncoder(w).Encode(map[string]string{
-			"status": "unknown",
-		})
+		if rr.Cache != "" {
+			out["cache"] = rr.Cache
+		}
+		if len(rr.Attempts) > 0 {
+			out["attempts"] = rr.Attempts
+		}
+		return out
+	}
+	return map[string]interface{}{
+		"status": "unknown",
 	}
 }
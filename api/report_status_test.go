@@ -0,0 +1,54 @@
+package api
+
+import (
+	"druid-insight/cache"
+	"druid-insight/worker"
+	"testing"
+	"time"
+)
+
+func TestReportStatus_Fields(t *testing.T) {
+	now := time.Now()
+	worker.AddPendingRequest(&worker.ReportRequest{ID: "status-waiting", CreatedAt: now})
+	worker.ProcessingRequests().Store("status-processing", &worker.ReportResult{
+		Status: worker.StatusProcessing, CreatedAt: now, StartedAt: now.Add(-time.Second), WorkerID: 2,
+	})
+	worker.ProcessingRequests().Store("status-complete", &worker.ReportResult{
+		Status: worker.StatusComplete, CreatedAt: now, StartedAt: now, FinishedAt: now.Add(time.Second),
+		WorkerID: 1, Rows: 12, Cache: cache.StatusMiss, DruidTime: 800 * time.Millisecond,
+	})
+	worker.ProcessingRequests().Store("status-error", &worker.ReportResult{
+		Status: worker.StatusError, CreatedAt: now, ErrorMsg: "boom", FinishedAt: now,
+	})
+
+	tests := []struct {
+		id      string
+		status  string
+		present []string
+		values  map[string]interface{}
+	}{
+		{"status-waiting", "waiting", []string{"position", "jobs_ahead", "enqueued_at"}, nil},
+		{"status-processing", "processing", []string{"started_at", "elapsed_ms"}, map[string]interface{}{"worker_id": 2}},
+		{"status-complete", "complete", []string{"finished_at"}, map[string]interface{}{
+			"rows_written": 12, "druid_ms": int64(800), "duration_ms": int64(1000), "cache": cache.StatusMiss,
+		}},
+		{"status-error", "error", []string{"finished_at"}, map[string]interface{}{"error": "boom"}},
+		{"status-missing", "unknown", nil, nil},
+	}
+	for _, tt := range tests {
+		out := reportStatus(tt.id)
+		if status := out["status"]; status != tt.status && status != worker.ReportStatus(tt.status) {
+			t.Errorf("%s: expected status %s, got %v", tt.id, tt.status, status)
+		}
+		for _, field := range tt.present {
+			if _, ok := out[field]; !ok {
+				t.Errorf("%s: expected field %s, got %v", tt.id, field, out)
+			}
+		}
+		for field, want := range tt.values {
+			if out[field] != want {
+				t.Errorf("%s: expected %s=%v, got %v", tt.id, field, want, out[field])
+			}
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package api
+
+import (
+	"druid-insight/auth"
+	"druid-insight/config"
+	"druid-insight/logging"
+	"druid-insight/report"
+	"druid-insight/store"
+	"druid-insight/utils"
+	"druid-insight/worker"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// savedReportInput : corps des requêtes de création / modification
+type savedReportInput struct {
+	Name       string       `json:"name"`
+	Visibility string       `json:"visibility,omitempty"`
+	Spec       *report.Spec `json:"spec,omitempty"`
+}
+
+// SavedReportsHandler gère /api/saved-reports :
+// GET (liste, ou un rapport avec son historique si ?id=), POST (création),
+// PUT ?id= (modification, nouvelle version) et DELETE ?id=.
+func SavedReportsHandler(cfg *auth.Config, users *auth.UsersFile, druidCfg *config.DruidConfig, st *store.Store, accessLogger *logging.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username, isAdmin, err := auth.ExtractUserAndAdminFromJWT(r, cfg.JWT.Secret)
+		if err != nil || username == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		id := r.URL.Query().Get("id")
+		switch r.Method {
+		case "GET":
+			team := auth.GetUserTeam(username, users, cfg)
+			if id == "" {
+				list, err := st.ListSavedReports(func(s *store.SavedReport) bool {
+					return s.VisibleTo(username, team, isAdmin)
+				})
+				if err != nil {
+					http.Error(w, "Erreur stockage", http.StatusInternalServerError)
+					return
+				}
+				for _, s := range list {
+					s.History = nil
+				}
+				if list == nil {
+					list = []*store.SavedReport{}
+				}
+				writeJSON(w, http.StatusOK, list)
+				return
+			}
+			s, ok := loadSavedReport(w, st, id)
+			if !ok {
+				return
+			}
+			if !s.VisibleTo(username, team, isAdmin) {
+				http.Error(w, "Not found", http.StatusNotFound)
+				return
+			}
+			writeJSON(w, http.StatusOK, s)
+
+		case "POST":
+			var in savedReportInput
+			if err := report.DecodeStrict(r.Body, &in); err != nil {
+				writeValidationError(w, err)
+				return
+			}
+			if in.Visibility == "" {
+				in.Visibility = store.VisibilityPrivate
+			}
+			if errs := validateSavedReportInput(&in, true, druidCfg); len(errs) > 0 {
+				writeValidationError(w, &report.ValidationError{Errors: errs})
+				accessLogger.Write("SAVED_FAIL user=" + username + " invalid errors=" + jsonString(errs))
+				return
+			}
+			if !checkSpecRights(w, r, in.Spec, druidCfg, auth.UserGrants(username, isAdmin, users, cfg)) {
+				accessLogger.Write("SAVED_FORBIDDEN user=" + username + " datasource=" + in.Spec.Datasource)
+				return
+			}
+			now := time.Now()
+			s := &store.SavedReport{
+				ID:         utils.GenerateRequestID(),
+				Name:       in.Name,
+				Owner:      username,
+				Team:       auth.GetUserTeam(username, users, cfg),
+				Visibility: in.Visibility,
+				Spec:       *in.Spec,
+				Version:    1,
+				CreatedAt:  now,
+				UpdatedBy:  username,
+				UpdatedAt:  now,
+			}
+			if err := st.PutSavedReport(s); err != nil {
+				http.Error(w, "Erreur stockage", http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, http.StatusCreated, s)
+			accessLogger.Write("SAVED_CREATE user=" + username + " id=" + s.ID)
+
+		case "PUT":
+			s, ok := loadSavedReport(w, st, id)
+			if !ok {
+				return
+			}
+			if !s.EditableBy(username, isAdmin) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				accessLogger.Write("SAVED_FORBIDDEN user=" + username + " id=" + id)
+				return
+			}
+			var in savedReportInput
+			if err := report.DecodeStrict(r.Body, &in); err != nil {
+				writeValidationError(w, err)
+				return
+			}
+			if errs := validateSavedReportInput(&in, false, druidCfg); len(errs) > 0 {
+				writeValidationError(w, &report.ValidationError{Errors: errs})
+				accessLogger.Write("SAVED_FAIL user=" + username + " id=" + id + " invalid errors=" + jsonString(errs))
+				return
+			}
+			if in.Spec != nil && !checkSpecRights(w, r, in.Spec, druidCfg, auth.UserGrants(username, isAdmin, users, cfg)) {
+				accessLogger.Write("SAVED_FORBIDDEN user=" + username + " id=" + id)
+				return
+			}
+			s.Update(in.Name, in.Visibility, in.Spec, username, time.Now())
+			if err := st.PutSavedReport(s); err != nil {
+				http.Error(w, "Erreur stockage", http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, http.StatusOK, s)
+			accessLogger.Write("SAVED_UPDATE user=" + username + " id=" + id + " version=" + strconv.Itoa(s.Version))
+
+		case "DELETE":
+			s, ok := loadSavedReport(w, st, id)
+			if !ok {
+				return
+			}
+			if !s.EditableBy(username, isAdmin) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				accessLogger.Write("SAVED_FORBIDDEN user=" + username + " id=" + id)
+				return
+			}
+			if err := st.DeleteSavedReport(id); err != nil {
+				http.Error(w, "Erreur stockage", http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+			accessLogger.Write("SAVED_DELETE user=" + username + " id=" + id)
+
+		default:
+			http.Error(w, "Méthode non autorisée", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// SavedReportRunHandler exécute un rapport sauvegardé (POST ?id=) avec l'identité et
+// les droits de l'utilisateur qui le lance, et retourne l'id de rapport à suivre.
+func SavedReportRunHandler(cfg *auth.Config, users *auth.UsersFile, druidCfg *config.DruidConfig, st *store.Store, accessLogger *logging.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Méthode non autorisée", http.StatusMethodNotAllowed)
+			return
+		}
+		username, isAdmin, err := auth.ExtractUserAndAdminFromJWT(r, cfg.JWT.Secret)
+		if err != nil || username == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		grants := auth.UserGrants(username, isAdmin, users, cfg)
+		recipients, statusOnly, ok := notifyRecipients(w, r, cfg, grants)
+		if !ok {
+			return
+		}
+		savedID := r.URL.Query().Get("id")
+		s, ok := loadSavedReport(w, st, savedID)
+		if !ok {
+			return
+		}
+		if !s.VisibleTo(username, auth.GetUserTeam(username, users, cfg), isAdmin) {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+		// druid.yaml a pu changer depuis l'enregistrement : on revalide
+		spec := s.Spec
+		if errs := spec.Validate(druidCfg); len(errs) > 0 {
+			writeValidationError(w, &report.ValidationError{Errors: errs})
+			accessLogger.Write("SAVED_RUN_FAIL user=" + username + " id=" + savedID + " invalid errors=" + jsonString(errs))
+			return
+		}
+		if !checkSpecRights(w, r, &spec, druidCfg, grants) {
+			accessLogger.Write("SAVED_RUN_FORBIDDEN user=" + username + " id=" + savedID)
+			return
+		}
+		id := enqueueReport(&worker.ReportRequest{
+			Spec:       &spec,
+			Owner:      username,
+			Admin:      isAdmin,
+			Context:    requestDomain(r, cfg),
+			Notify:     recipients,
+			NotifyOnly: statusOnly,
+		})
+		writeJSON(w, http.StatusOK, map[string]string{"id": id})
+		accessLogger.Write("SAVED_RUN user=" + username + " saved_id=" + savedID + " id=" + id)
+	}
+}
+
+// validateSavedReportInput : nom et spec obligatoires à la création, optionnels en modification
+func validateSavedReportInput(in *savedReportInput, create bool, druidCfg *config.DruidConfig) []report.FieldError {
+	var errs []report.FieldError
+	if create && in.Name == "" {
+		errs = append(errs, report.FieldError{Field: "name", Message: "required"})
+	}
+	if in.Visibility != "" && !store.ValidVisibility(in.Visibility) {
+		errs = append(errs, report.FieldError{Field: "visibility", Message: store.ErrInvalidVisibility.Error()})
+	}
+	if in.Spec == nil {
+		if create {
+			errs = append(errs, report.FieldError{Field: "spec", Message: "required"})
+		}
+		return errs
+	}
+	for _, fe := range in.Spec.Validate(druidCfg) {
+		fe.Field = "spec." + fe.Field
+		errs = append(errs, fe)
+	}
+	return errs
+}
+
+// checkSpecRights répond 403 si les rôles de l'utilisateur ne donnent pas accès à la datasource
+// ou aux champs du rapport, ou si la clé d'API de la requête ne couvre pas sa datasource
+func checkSpecRights(w http.ResponseWriter, r *http.Request, spec *report.Spec, druidCfg *config.DruidConfig, grants *auth.Grants) bool {
+	if !checkKeyScope(w, r, spec.Datasource) {
+		return false
+	}
+	problems := auth.CheckRights(spec, druidCfg, grants)
+	if len(problems) == 0 {
+		return true
+	}
+	writeJSON(w, http.StatusForbidden, map[string]interface{}{
+		"error":    "forbidden",
+		"problems": problems,
+	})
+	return false
+}
+
+// checkKeyScope répond 403 si la requête est authentifiée par une clé d'API limitée à
+// d'autres datasources
+func checkKeyScope(w http.ResponseWriter, r *http.Request, datasource string) bool {
+	if auth.DatasourceAllowed(r, datasource) {
+		return true
+	}
+	writeJSON(w, http.StatusForbidden, map[string]interface{}{
+		"error":    "forbidden",
+		"problems": []string{"datasource " + datasource + " is outside the API key scope"},
+	})
+	return false
+}
+
+func loadSavedReport(w http.ResponseWriter, st *store.Store, id string) (*store.SavedReport, bool) {
+	if id == "" {
+		http.Error(w, "id requis", http.StatusBadRequest)
+		return nil, false
+	}
+	s, err := st.GetSavedReport(id)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		http.Error(w, "Erreur stockage", http.StatusInternalServerError)
+		return nil, false
+	}
+	return s, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,218 @@
+package api
+
+import (
+	"druid-insight/auth"
+	"druid-insight/logging"
+	"druid-insight/notify"
+	"druid-insight/report"
+	"druid-insight/scheduler"
+	"druid-insight/store"
+	"druid-insight/utils"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// scheduleInput : corps des requêtes de création / modification (champs absents = inchangés)
+type scheduleInput struct {
+	Name          *string   `json:"name,omitempty"`
+	SavedReportID *string   `json:"saved_report_id,omitempty"`
+	Cron          *string   `json:"cron,omitempty"`
+	Timezone      *string   `json:"timezone,omitempty"`
+	Range         *string   `json:"range,omitempty"`
+	Recipients    *[]string `json:"recipients,omitempty"`
+	Enabled       *bool     `json:"enabled,omitempty"`
+}
+
+func (in *scheduleInput) apply(sc *store.Schedule) {
+	if in.Name != nil {
+		sc.Name = *in.Name
+	}
+	if in.SavedReportID != nil {
+		sc.SavedReportID = *in.SavedReportID
+	}
+	if in.Cron != nil {
+		sc.Cron = *in.Cron
+	}
+	if in.Timezone != nil {
+		sc.Timezone = *in.Timezone
+	}
+	if in.Range != nil {
+		sc.Range = *in.Range
+	}
+	if in.Recipients != nil {
+		sc.Recipients = *in.Recipients
+	}
+	if in.Enabled != nil {
+		sc.Enabled = *in.Enabled
+	}
+}
+
+// SchedulesHandler gère /api/schedules : GET (liste, ou une planification et son historique
+// si ?id=), POST (création), PUT ?id= et DELETE ?id= (propriétaire ou admin).
+func SchedulesHandler(cfg *auth.Config, users *auth.UsersFile, st *store.Store, sched *scheduler.Scheduler, accessLogger *logging.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username, isAdmin, err := auth.ExtractUserAndAdminFromJWT(r, cfg.JWT.Secret)
+		if err != nil || username == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		id := r.URL.Query().Get("id")
+		if (r.Method == "POST" || r.Method == "PUT") && !auth.UserGrants(username, isAdmin, users, cfg).Can(auth.CapSchedule) {
+			http.Error(w, "Forbidden: schedule capability required", http.StatusForbidden)
+			accessLogger.Write("SCHEDULE_FORBIDDEN user=" + username + " capability=schedule")
+			return
+		}
+
+		// validate contrôle la planification et l'accès au rapport sauvegardé ciblé ; outOfScope
+		// reçoit sa datasource si elle sort du périmètre de la clé d'API
+		var outOfScope string
+		validate := func(sc *store.Schedule) []report.FieldError {
+			errs := scheduler.Validate(sc)
+			if err := notify.ValidateRecipients(cfg, sc.Recipients); err != nil {
+				errs = append(errs, report.FieldError{Field: "recipients", Message: err.Error()})
+			}
+			if sc.SavedReportID == "" {
+				return append(errs, report.FieldError{Field: "saved_report_id", Message: "required"})
+			}
+			saved, err := st.GetSavedReport(sc.SavedReportID)
+			if err != nil || !saved.VisibleTo(username, auth.GetUserTeam(username, users, cfg), isAdmin) {
+				errs = append(errs, report.FieldError{Field: "saved_report_id", Message: "unknown saved report " + sc.SavedReportID})
+			} else if !auth.DatasourceAllowed(r, saved.Spec.Datasource) {
+				outOfScope = saved.Spec.Datasource
+			}
+			return errs
+		}
+		// forbidScope répond 403 si le rapport ciblé sort du périmètre de la clé d'API
+		forbidScope := func() bool {
+			if outOfScope == "" {
+				return false
+			}
+			checkKeyScope(w, r, outOfScope)
+			accessLogger.Write("SCHEDULE_FORBIDDEN user=" + username + " datasource=" + outOfScope + " reason=" + auth.ReasonOutOfScope)
+			return true
+		}
+
+		switch r.Method {
+		case "GET":
+			if id == "" {
+				list, err := st.ListSchedules(func(sc *store.Schedule) bool {
+					return isAdmin || sc.Owner == username
+				})
+				if err != nil {
+					http.Error(w, "Erreur stockage", http.StatusInternalServerError)
+					return
+				}
+				if list == nil {
+					list = []*store.Schedule{}
+				}
+				writeJSON(w, http.StatusOK, list)
+				return
+			}
+			sc, ok := loadSchedule(w, st, id, username, isAdmin)
+			if !ok {
+				return
+			}
+			writeJSON(w, http.StatusOK, sc)
+
+		case "POST":
+			var in scheduleInput
+			if err := report.DecodeStrict(r.Body, &in); err != nil {
+				writeValidationError(w, err)
+				return
+			}
+			now := time.Now()
+			sc := &store.Schedule{
+				ID:        utils.GenerateRequestID(),
+				Owner:     username,
+				Enabled:   true,
+				CreatedAt: now,
+				UpdatedAt: now,
+			}
+			in.apply(sc)
+			errs := validate(sc)
+			if forbidScope() {
+				return
+			}
+			if len(errs) > 0 {
+				writeValidationError(w, &report.ValidationError{Errors: errs})
+				accessLogger.Write("SCHEDULE_FAIL user=" + username + " invalid errors=" + jsonString(errs))
+				return
+			}
+			if err := sched.Create(sc); err != nil {
+				http.Error(w, "Erreur stockage", http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, http.StatusCreated, sc)
+			accessLogger.Write("SCHEDULE_CREATE user=" + username + " id=" + sc.ID + " cron=" + sc.Cron)
+
+		case "PUT":
+			if _, ok := loadSchedule(w, st, id, username, isAdmin); !ok {
+				return
+			}
+			var in scheduleInput
+			if err := report.DecodeStrict(r.Body, &in); err != nil {
+				writeValidationError(w, err)
+				return
+			}
+			var errs []report.FieldError
+			sc, err := sched.Update(id, func(sc *store.Schedule) error {
+				in.apply(sc)
+				sc.UpdatedAt = time.Now()
+				if errs = validate(sc); len(errs) > 0 {
+					return &report.ValidationError{Errors: errs}
+				}
+				if outOfScope != "" {
+					return errors.New("datasource outside the API key scope")
+				}
+				return nil
+			})
+			if forbidScope() {
+				return
+			}
+			if len(errs) > 0 {
+				writeValidationError(w, err)
+				accessLogger.Write("SCHEDULE_FAIL user=" + username + " id=" + id + " invalid errors=" + jsonString(errs))
+				return
+			}
+			if err != nil {
+				http.Error(w, "Erreur stockage", http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, http.StatusOK, sc)
+			accessLogger.Write("SCHEDULE_UPDATE user=" + username + " id=" + id)
+
+		case "DELETE":
+			if _, ok := loadSchedule(w, st, id, username, isAdmin); !ok {
+				return
+			}
+			if err := sched.Delete(id); err != nil && !errors.Is(err, store.ErrNotFound) {
+				http.Error(w, "Erreur stockage", http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+			accessLogger.Write("SCHEDULE_DELETE user=" + username + " id=" + id)
+
+		default:
+			http.Error(w, "Méthode non autorisée", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// loadSchedule charge une planification visible par l'utilisateur (propriétaire ou admin)
+func loadSchedule(w http.ResponseWriter, st *store.Store, id, username string, isAdmin bool) (*store.Schedule, bool) {
+	if id == "" {
+		http.Error(w, "id requis", http.StatusBadRequest)
+		return nil, false
+	}
+	sc, err := st.GetSchedule(id)
+	if errors.Is(err, store.ErrNotFound) || (err == nil && !isAdmin && sc.Owner != username) {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		http.Error(w, "Erreur stockage", http.StatusInternalServerError)
+		return nil, false
+	}
+	return sc, true
+}
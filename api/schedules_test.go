@@ -0,0 +1,48 @@
+package api
+
+import (
+	"druid-insight/report"
+	"druid-insight/scheduler"
+	"druid-insight/store"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSchedulesHandler_APIKeyScope(t *testing.T) {
+	env := newTestEnv(t)
+	st, err := store.Open("file", "", t.TempDir())
+	if err != nil {
+		t.Fatalf("store.Open failed: %v", err)
+	}
+	for id, ds := range map[string]string{"sr-events": "events", "sr-billing": "billing"} {
+		spec := report.Spec{Datasource: ds, Metrics: []string{"requests"}}
+		if ds == "billing" {
+			spec.Metrics = []string{"revenue"}
+		}
+		st.PutSavedReport(&store.SavedReport{ID: id, Owner: "alice", Visibility: store.VisibilityPrivate, Spec: spec})
+	}
+	st.PutSchedule(&store.Schedule{ID: "sc1", Owner: "alice", SavedReportID: "sr-events", Cron: "0 7 * * *", Enabled: true, CreatedAt: time.Now()})
+	key := newAPIKey(t, st, "alice", "events")
+	sched := scheduler.New(st, env.druidCfg, env.cfg, env.users, env.logger)
+	h := SchedulesHandler(env.cfg, env.users, st, sched, env.logger)
+
+	body := map[string]interface{}{"saved_report_id": "sr-billing", "cron": "0 7 * * *"}
+	w := serve(h, keyRequest("POST", "/api/schedules", body, key))
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "API key scope") {
+		t.Errorf("Expected 403 scheduling a report outside the key scope, got %d: %s", w.Code, w.Body)
+	}
+	w = serve(h, keyRequest("PUT", "/api/schedules?id=sc1", map[string]string{"saved_report_id": "sr-billing"}, key))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 retargeting a schedule outside the key scope, got %d: %s", w.Code, w.Body)
+	}
+	if sc, _ := st.GetSchedule("sc1"); sc.SavedReportID != "sr-events" {
+		t.Errorf("Expected the schedule to keep its report, got %s", sc.SavedReportID)
+	}
+
+	body["saved_report_id"] = "sr-events"
+	if w := serve(h, keyRequest("POST", "/api/schedules", body, key)); w.Code != http.StatusCreated {
+		t.Errorf("Expected 201 within the key scope, got %d: %s", w.Code, w.Body)
+	}
+}
@@ -9,7 +9,8 @@ import (
 	"sort"
 )
 
-func SchemaHandler(cfg *auth.Config, druidCfg *config.DruidConfig, accessLogger *logging.Logger) http.HandlerFunc {
+// SchemaHandler retourne les datasources et les champs accordés par les rôles de l'utilisateur
+func SchemaHandler(cfg *auth.Config, users *auth.UsersFile, druidCfg *config.DruidConfig, accessLogger *logging.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		user, isAdmin, err := auth.ExtractUserAndAdminFromJWT(r, cfg.JWT.Secret)
 		if err != nil {
@@ -17,6 +18,7 @@ func SchemaHandler(cfg *auth.Config, druidCfg *config.DruidConfig, accessLogger
 			return
 		}
 		accessLogger.Write("SCHEMA user=" + user)
+		grants := auth.UserGrants(user, isAdmin, users, cfg)
 
 		type MetricObj struct {
 			Name string `json:"name"`
@@ -30,7 +32,9 @@ func SchemaHandler(cfg *auth.Config, druidCfg *config.DruidConfig, accessLogger
 
 		dsNames := make([]string, 0, len(druidCfg.Datasources))
 		for name := range druidCfg.Datasources {
-			dsNames = append(dsNames, name)
+			if auth.DatasourceAllowed(r, name) && grants.DatasourceAllowed(name) {
+				dsNames = append(dsNames, name)
+			}
 		}
 		sort.Strings(dsNames)
 
@@ -40,7 +44,7 @@ func SchemaHandler(cfg *auth.Config, druidCfg *config.DruidConfig, accessLogger
 			var mets []MetricObj
 
 			for k, v := range ds.Dimensions {
-				if !v.Reserved || isAdmin {
+				if grants.FieldAllowed(v) {
 					dims = append(dims, k)
 				}
 			}
@@ -49,7 +53,7 @@ func SchemaHandler(cfg *auth.Config, druidCfg *config.DruidConfig, accessLogger
 			var metNames []string
 			metType := make(map[string]string)
 			for k, v := range ds.Metrics {
-				if !v.Reserved || isAdmin {
+				if grants.FieldAllowed(v) {
 					metNames = append(metNames, k)
 					metType[k] = v.Type
 				}
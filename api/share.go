@@ -0,0 +1,300 @@
+package api
+
+import (
+	"druid-insight/auth"
+	"druid-insight/config"
+	"druid-insight/logging"
+	"druid-insight/report"
+	"druid-insight/store"
+	"druid-insight/utils"
+	"druid-insight/worker"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const defaultShareTTLMinutes = 7 * 24 * 60
+
+// ShareHandler gère /api/share : POST émet un lien signé pour un rapport sauvegardé
+// (saved_report_id) ou un résultat (report_id), GET liste les liens émis (tous pour un admin),
+// DELETE ?id= révoque un lien.
+func ShareHandler(cfg *auth.Config, users *auth.UsersFile, st *store.Store, accessLogger *logging.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username, isAdmin, err := auth.ExtractUserAndAdminFromJWT(r, cfg.JWT.Secret)
+		if err != nil || username == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.Method {
+		case "GET":
+			links, err := st.ListShareLinks(func(l *store.ShareLink) bool {
+				return isAdmin || l.Sharer == username
+			})
+			if err != nil {
+				http.Error(w, "Erreur stockage", http.StatusInternalServerError)
+				return
+			}
+			if links == nil {
+				links = []*store.ShareLink{}
+			}
+			writeJSON(w, http.StatusOK, links)
+
+		case "POST":
+			// un lien donne accès au CSV : le partage suppose le droit d'exporter
+			if !auth.UserGrants(username, isAdmin, users, cfg).Can(auth.CapExport) {
+				http.Error(w, "Forbidden: export capability required", http.StatusForbidden)
+				accessLogger.Write("SHARE_FORBIDDEN user=" + username + " capability=export")
+				return
+			}
+			var in struct {
+				SavedReportID    string `json:"saved_report_id,omitempty"`
+				ReportID         string `json:"report_id,omitempty"`
+				ExpiresInMinutes int    `json:"expires_in_minutes,omitempty"`
+			}
+			if err := report.DecodeStrict(r.Body, &in); err != nil {
+				writeValidationError(w, err)
+				return
+			}
+			link := &store.ShareLink{ID: utils.GenerateRequestID(), Sharer: username}
+			switch {
+			case in.SavedReportID != "" && in.ReportID == "":
+				s, ok := loadSavedReport(w, st, in.SavedReportID)
+				if !ok {
+					return
+				}
+				if !s.VisibleTo(username, auth.GetUserTeam(username, users, cfg), isAdmin) {
+					http.Error(w, "Not found", http.StatusNotFound)
+					return
+				}
+				if !checkKeyScope(w, r, s.Spec.Datasource) {
+					accessLogger.Write("SHARE_FORBIDDEN user=" + username + " datasource=" + s.Spec.Datasource + " reason=" + auth.ReasonOutOfScope)
+					return
+				}
+				link.Kind, link.Target = auth.ShareKindSavedReport, s.ID
+			case in.ReportID != "" && in.SavedReportID == "":
+				owner, spec, _, ok := worker.LookupReport(in.ReportID)
+				if !ok || (owner != username && !isAdmin) {
+					http.Error(w, "Not found", http.StatusNotFound)
+					return
+				}
+				if spec != nil && !checkKeyScope(w, r, spec.Datasource) {
+					accessLogger.Write("SHARE_FORBIDDEN user=" + username + " datasource=" + spec.Datasource + " reason=" + auth.ReasonOutOfScope)
+					return
+				}
+				link.Kind, link.Target = auth.ShareKindResult, in.ReportID
+			default:
+				writeValidationError(w, &report.ValidationError{Errors: []report.FieldError{
+					{Field: "saved_report_id", Message: "exactly one of saved_report_id or report_id is required"},
+				}})
+				return
+			}
+			ttl := in.ExpiresInMinutes
+			if ttl <= 0 {
+				ttl = cfg.Share.DefaultTTLMinutes
+			}
+			if ttl <= 0 {
+				ttl = defaultShareTTLMinutes
+			}
+			if cfg.Share.MaxTTLMinutes > 0 && ttl > cfg.Share.MaxTTLMinutes {
+				ttl = cfg.Share.MaxTTLMinutes
+			}
+			link.CreatedAt = time.Now()
+			link.ExpiresAt = link.CreatedAt.Add(time.Duration(ttl) * time.Minute)
+
+			token, err := auth.SignShareToken(cfg.ShareSecret(), auth.ShareClaims{
+				ID:        link.ID,
+				Kind:      link.Kind,
+				Target:    link.Target,
+				Sharer:    link.Sharer,
+				ExpiresAt: link.ExpiresAt.Unix(),
+			})
+			if err != nil {
+				http.Error(w, "Erreur serveur", http.StatusInternalServerError)
+				return
+			}
+			if err := st.PutShareLink(link); err != nil {
+				http.Error(w, "Erreur stockage", http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, http.StatusCreated, map[string]interface{}{
+				"id":         link.ID,
+				"token":      token,
+				"url":        cfg.Share.BaseURL + "/api/share/view?token=" + url.QueryEscape(token),
+				"kind":       link.Kind,
+				"target":     link.Target,
+				"expires_at": link.ExpiresAt,
+			})
+			accessLogger.Write("SHARE_CREATE user=" + username + " id=" + link.ID + " kind=" + link.Kind + " target=" + link.Target)
+
+		case "DELETE":
+			id := r.URL.Query().Get("id")
+			link, err := st.GetShareLink(id)
+			if errors.Is(err, store.ErrNotFound) || (err == nil && link.Sharer != username && !isAdmin) {
+				http.Error(w, "Not found", http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				http.Error(w, "Erreur stockage", http.StatusInternalServerError)
+				return
+			}
+			if link.RevokedAt == nil {
+				now := time.Now()
+				link.RevokedAt, link.RevokedBy = &now, username
+				if err := st.PutShareLink(link); err != nil {
+					http.Error(w, "Erreur stockage", http.StatusInternalServerError)
+					return
+				}
+			}
+			w.WriteHeader(http.StatusNoContent)
+			accessLogger.Write("SHARE_REVOKE user=" + username + " id=" + id)
+
+		default:
+			http.Error(w, "Méthode non autorisée", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// ShareViewHandler sert /api/share/view?token=... sans JWT obligatoire. Les droits du partageur
+// sont résolus à chaque consultation. GET décrit le lien, ou renvoie le statut d'un résultat
+// servi tel quel (son CSV avec download=1) ; POST relance le rapport sous l'identité configurée
+// (share.run_as), dont le suivi se fait en GET avec &report=<id> (et download=1).
+func ShareViewHandler(cfg *auth.Config, users *auth.UsersFile, druidCfg *config.DruidConfig, st *store.Store, accessLogger *logging.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" && r.Method != "POST" {
+			http.Error(w, "Méthode non autorisée", http.StatusMethodNotAllowed)
+			return
+		}
+		q := r.URL.Query()
+		claims, err := auth.VerifyShareToken(cfg.ShareSecret(), q.Get("token"), time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			accessLogger.Write("SHARE_VIEW_FAIL " + err.Error())
+			return
+		}
+		link, err := st.GetShareLink(claims.ID)
+		if err != nil || !link.Active(time.Now()) || link.Target != claims.Target || link.Kind != claims.Kind {
+			http.Error(w, "revoked share token", http.StatusUnauthorized)
+			accessLogger.Write("SHARE_VIEW_FAIL revoked id=" + claims.ID)
+			return
+		}
+
+		// Identité d'exécution : le partageur doit toujours exister, ses droits sont ceux du moment
+		username := link.Sharer
+		sharerAdmin, err := auth.LookupUserAdmin(link.Sharer, users, cfg)
+		if errors.Is(err, auth.ErrUserNotFound) {
+			http.Error(w, "share owner no longer exists", http.StatusUnauthorized)
+			accessLogger.Write("SHARE_VIEW_FAIL unknown_sharer id=" + link.ID + " user=" + link.Sharer)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Erreur annuaire utilisateurs", http.StatusBadGateway)
+			return
+		}
+		isAdmin := sharerAdmin
+		// le rapport sauvegardé a pu devenir privé ou le partageur changer d'équipe
+		var saved *store.SavedReport
+		if link.Kind == auth.ShareKindSavedReport {
+			saved, err = st.GetSavedReport(link.Target)
+			if err != nil || !saved.VisibleTo(link.Sharer, auth.GetUserTeam(link.Sharer, users, cfg), sharerAdmin) {
+				http.Error(w, "Not found", http.StatusNotFound)
+				accessLogger.Write("SHARE_VIEW_FAIL not_visible id=" + link.ID + " user=" + link.Sharer)
+				return
+			}
+		}
+		if cfg.ShareRunAs() == auth.ShareRunAsViewer && !link.Direct {
+			viewer, viewerAdmin, err := auth.ExtractUserAndAdminFromJWT(r, cfg.JWT.Secret)
+			if err != nil || viewer == "" {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			username, isAdmin = viewer, viewerAdmin
+		}
+		grants := auth.UserGrants(username, isAdmin, users, cfg)
+		download := q.Get("download") == "1"
+		// serveResult répond le statut d'un résultat ou, avec download=1, son CSV si
+		// l'identité d'exécution peut exporter
+		serveResult := func(id string) bool {
+			if !download {
+				writeJSON(w, http.StatusOK, reportStatus(id))
+				return true
+			}
+			if !grants.Can(auth.CapExport) {
+				http.Error(w, "Forbidden: export capability required", http.StatusForbidden)
+				accessLogger.Write("SHARE_VIEW_FORBIDDEN id=" + link.ID + " user=" + username + " capability=export")
+				return false
+			}
+			serveReportCSV(w, r, id)
+			return true
+		}
+
+		// Résultat partagé tel quel
+		if link.Kind == auth.ShareKindResult && (link.Direct || cfg.ShareRunAs() == auth.ShareRunAsSharer) {
+			if r.Method != "GET" {
+				http.Error(w, "Méthode non autorisée", http.StatusMethodNotAllowed)
+				return
+			}
+			// le spec n'est plus connu après un redémarrage : seul le partageur est alors vérifié
+			if _, resultSpec, _, ok := worker.LookupReport(link.Target); ok && resultSpec != nil {
+				if !checkSpecRights(w, r, resultSpec, druidCfg, grants) {
+					accessLogger.Write("SHARE_VIEW_FORBIDDEN id=" + link.ID + " user=" + username)
+					return
+				}
+			}
+			if serveResult(link.Target) {
+				accessLogger.Write("SHARE_VIEW id=" + link.ID + " result=" + link.Target)
+			}
+			return
+		}
+
+		if r.Method == "GET" {
+			// Suivi d'une exécution lancée par ce lien
+			if runID := q.Get("report"); runID != "" {
+				owner, _, share, ok := worker.LookupReport(runID)
+				if !ok || share != link.ID || owner != username {
+					http.Error(w, "Not found", http.StatusNotFound)
+					return
+				}
+				serveResult(runID)
+				return
+			}
+			// Simple consultation (aperçus, robots) : aucune requête Druid
+			writeJSON(w, http.StatusOK, map[string]interface{}{
+				"id":         link.ID,
+				"kind":       link.Kind,
+				"target":     link.Target,
+				"expires_at": link.ExpiresAt,
+			})
+			return
+		}
+
+		var spec report.Spec
+		if saved != nil {
+			spec = saved.Spec
+		} else {
+			_, resultSpec, _, ok := worker.LookupReport(link.Target)
+			if !ok || resultSpec == nil {
+				http.Error(w, "Not found", http.StatusNotFound)
+				return
+			}
+			spec = *resultSpec
+		}
+		if errs := spec.Validate(druidCfg); len(errs) > 0 {
+			writeValidationError(w, &report.ValidationError{Errors: errs})
+			return
+		}
+		if !checkSpecRights(w, r, &spec, druidCfg, grants) {
+			accessLogger.Write("SHARE_VIEW_FORBIDDEN id=" + link.ID + " user=" + username)
+			return
+		}
+		id := enqueueReport(&worker.ReportRequest{
+			Spec:    &spec,
+			Owner:   username,
+			Admin:   isAdmin,
+			Context: requestDomain(r, cfg),
+			Share:   link.ID,
+		})
+		writeJSON(w, http.StatusOK, map[string]string{"report": id, "status": string(worker.StatusWaiting)})
+		accessLogger.Write("SHARE_VIEW id=" + link.ID + " user=" + username + " run=" + id)
+	}
+}
@@ -0,0 +1,168 @@
+package api
+
+import (
+	"druid-insight/auth"
+	"druid-insight/report"
+	"druid-insight/store"
+	"druid-insight/worker"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+// newShareLink enregistre un rapport sauvegardé de owner sur la dimension dimension
+// et émet un lien de partage dessus
+func newShareLink(t *testing.T, env *testEnv, st *store.Store, owner, dimension string) string {
+	t.Helper()
+	saved := &store.SavedReport{ID: "sr1", Name: "events", Owner: owner, Visibility: "private",
+		Spec: report.Spec{Datasource: "events", Dimensions: []string{dimension}, Metrics: []string{"requests"}}}
+	if err := st.PutSavedReport(saved); err != nil {
+		t.Fatalf("PutSavedReport failed: %v", err)
+	}
+	h := ShareHandler(env.cfg, env.users, st, env.logger)
+	w := serve(h, env.request(t, "POST", "/api/share", map[string]string{"saved_report_id": "sr1"}, owner, env.users.Users[owner].Admin))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body)
+	}
+	var out map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &out)
+	return "/api/share/view?token=" + url.QueryEscape(out["token"].(string))
+}
+
+func TestShareViewHandler_RunsOnlyOnPost(t *testing.T) {
+	env := newTestEnv(t)
+	st, err := store.Open("file", "", t.TempDir())
+	if err != nil {
+		t.Fatalf("store.Open failed: %v", err)
+	}
+	view := newShareLink(t, env, st, "alice", "browser")
+	h := ShareViewHandler(env.cfg, env.users, env.druidCfg, st, env.logger)
+
+	w := serve(h, env.request(t, "GET", view, nil, "", false))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body)
+	}
+	var info map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &info)
+	if info["kind"] != "saved_report" || info["report"] != nil {
+		t.Errorf("Expected link description without a run, got %v", info)
+	}
+
+	w = serve(h, env.request(t, "POST", view, nil, "", false))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body)
+	}
+	var run map[string]string
+	json.Unmarshal(w.Body.Bytes(), &run)
+	owner, _, share, ok := worker.LookupReport(run["report"])
+	if !ok || owner != "alice" || share == "" {
+		t.Errorf("Expected a run queued as alice, got owner=%q share=%q ok=%t", owner, share, ok)
+	}
+}
+
+func TestShareViewHandler_ResolvesSharerAtViewTime(t *testing.T) {
+	env := newTestEnv(t)
+	st, err := store.Open("file", "", t.TempDir())
+	if err != nil {
+		t.Fatalf("store.Open failed: %v", err)
+	}
+	view := newShareLink(t, env, st, "root", "country")
+	h := ShareViewHandler(env.cfg, env.users, env.druidCfg, st, env.logger)
+
+	// un partageur rétrogradé perd la dimension réservée aux admins
+	env.users.Users["root"] = auth.UserInfo{}
+	if w := serve(h, env.request(t, "POST", view, nil, "", false)); w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 once the sharer is demoted, got %d: %s", w.Code, w.Body)
+	}
+	delete(env.users.Users, "root")
+	if w := serve(h, env.request(t, "POST", view, nil, "", false)); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 once the sharer is gone, got %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestShareHandler_APIKeyScope(t *testing.T) {
+	env := newTestEnv(t)
+	st, err := store.Open("file", "", t.TempDir())
+	if err != nil {
+		t.Fatalf("store.Open failed: %v", err)
+	}
+	st.PutSavedReport(&store.SavedReport{ID: "sr-billing", Owner: "alice", Visibility: store.VisibilityPrivate,
+		Spec: report.Spec{Datasource: "billing", Metrics: []string{"revenue"}}})
+	worker.AddPendingRequest(&worker.ReportRequest{ID: "share-scope-run", Owner: "alice",
+		Spec: &report.Spec{Datasource: "billing", Metrics: []string{"revenue"}}})
+	key := newAPIKey(t, st, "alice", "events")
+	h := ShareHandler(env.cfg, env.users, st, env.logger)
+
+	for _, body := range []map[string]string{{"saved_report_id": "sr-billing"}, {"report_id": "share-scope-run"}} {
+		if w := serve(h, keyRequest("POST", "/api/share", body, key)); w.Code != http.StatusForbidden {
+			t.Errorf("%v: expected 403 outside the key scope, got %d: %s", body, w.Code, w.Body)
+		}
+	}
+	if links, _ := st.ListShareLinks(nil); len(links) != 0 {
+		t.Errorf("Expected no link issued, got %d", len(links))
+	}
+}
+
+func TestShare_RequiresExport(t *testing.T) {
+	env := newTestEnv(t)
+	env.cfg.RBAC.Roles = map[string]auth.RoleConfig{"viewer": {Datasources: []string{"*"}}}
+	env.users.Users["carol"] = auth.UserInfo{Roles: []string{"viewer"}}
+	st, err := store.Open("file", "", t.TempDir())
+	if err != nil {
+		t.Fatalf("store.Open failed: %v", err)
+	}
+	h := ShareHandler(env.cfg, env.users, st, env.logger)
+	if w := serve(h, env.request(t, "POST", "/api/share", map[string]string{"saved_report_id": "sr1"}, "carol", false)); w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 sharing without export, got %d: %s", w.Code, w.Body)
+	}
+
+	worker.AddPendingRequest(&worker.ReportRequest{ID: "share-export-run", Owner: "alice",
+		Spec: &report.Spec{Datasource: "events", Metrics: []string{"requests"}}})
+	w := serve(h, env.request(t, "POST", "/api/share", map[string]string{"report_id": "share-export-run"}, "alice", false))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body)
+	}
+	var out map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &out)
+	download := "/api/share/view?download=1&token=" + url.QueryEscape(out["token"].(string))
+	view := ShareViewHandler(env.cfg, env.users, env.druidCfg, st, env.logger)
+
+	// pas encore de CSV : l'export est permis, le fichier manque
+	if w := serve(view, env.request(t, "GET", download, nil, "", false)); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 before the CSV exists, got %d: %s", w.Code, w.Body)
+	}
+	// le partageur perd l'export après l'émission du lien
+	env.users.Users["alice"] = auth.UserInfo{Roles: []string{"viewer"}}
+	if w := serve(view, env.request(t, "GET", download, nil, "", false)); w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 downloading without export, got %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestShareViewHandler_RechecksSavedReportVisibility(t *testing.T) {
+	env := newTestEnv(t)
+	st, err := store.Open("file", "", t.TempDir())
+	if err != nil {
+		t.Fatalf("store.Open failed: %v", err)
+	}
+	saved := &store.SavedReport{ID: "sr-public", Owner: "root", Visibility: store.VisibilityPublic,
+		Spec: report.Spec{Datasource: "events", Dimensions: []string{"browser"}, Metrics: []string{"requests"}}}
+	st.PutSavedReport(saved)
+	w := serve(ShareHandler(env.cfg, env.users, st, env.logger), env.request(t, "POST", "/api/share", map[string]string{"saved_report_id": "sr-public"}, "alice", false))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body)
+	}
+	var out map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &out)
+	view := "/api/share/view?token=" + url.QueryEscape(out["token"].(string))
+	h := ShareViewHandler(env.cfg, env.users, env.druidCfg, st, env.logger)
+
+	// le propriétaire rend le rapport privé : le lien d'alice ne le sert plus
+	saved.Visibility = store.VisibilityPrivate
+	st.PutSavedReport(saved)
+	for _, method := range []string{"GET", "POST"} {
+		if w := serve(h, env.request(t, method, view, nil, "", false)); w.Code != http.StatusNotFound {
+			t.Errorf("%s: expected 404 once the report is private, got %d: %s", method, w.Code, w.Body)
+		}
+	}
+}
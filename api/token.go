@@ -0,0 +1,152 @@
+package api
+
+import (
+	"druid-insight/auth"
+	"druid-insight/logging"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// writeTokens répond avec un jeton d'accès et, si les sessions sont actives, un jeton de
+// rafraîchissement (family "" = nouvelle session)
+func writeTokens(w http.ResponseWriter, cfg *auth.Config, sessions *auth.Sessions, username string, isAdmin bool, family string) error {
+	resp, err := issueTokens(cfg, sessions, username, isAdmin, family)
+	if err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusOK, resp)
+	return nil
+}
+
+// issueTokens émet le jeton d'accès et le jeton de rafraîchissement d'une nouvelle connexion
+func issueTokens(cfg *auth.Config, sessions *auth.Sessions, username string, isAdmin bool, family string) (map[string]interface{}, error) {
+	tokenString, err := auth.GenerateJWT(cfg.JWT.Secret, username, isAdmin, cfg.JWT.ExpirationMinutes)
+	if err != nil {
+		return nil, err
+	}
+	resp := map[string]interface{}{
+		"token":      tokenString,
+		"expires_in": cfg.JWT.ExpirationMinutes * 60,
+	}
+	if sessions != nil {
+		refresh, err := sessions.IssueRefreshToken(username, isAdmin, family)
+		if err != nil {
+			return nil, err
+		}
+		resp["refresh_token"] = refresh
+	}
+	return resp, nil
+}
+
+// TokenRefreshHandler échange un jeton de rafraîchissement (POST {"refresh_token"}) contre un
+// nouveau jeton d'accès et un nouveau jeton de rafraîchissement ; l'ancien devient inutilisable.
+func TokenRefreshHandler(cfg *auth.Config, users *auth.UsersFile, sessions *auth.Sessions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Méthode non autorisée", http.StatusMethodNotAllowed)
+			return
+		}
+		var req struct {
+			RefreshToken string `json:"refresh_token"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+			http.Error(w, "refresh_token requis", http.StatusBadRequest)
+			return
+		}
+		old, next, err := sessions.Rotate(req.RefreshToken)
+		if errors.Is(err, auth.ErrRefreshTokenInvalid) || errors.Is(err, auth.ErrRefreshTokenReused) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			log.Println("REFRESH FAIL (" + err.Error() + ")")
+			return
+		}
+		if err != nil {
+			http.Error(w, "Erreur stockage", http.StatusInternalServerError)
+			log.Println("REFRESH FAIL (store) " + err.Error())
+			return
+		}
+		// l'utilisateur a pu être supprimé ou changer de rôle depuis le login : il est relu dans
+		// son backend (users.yaml, annuaire LDAP, profil SSO ou auth.user_lookup_request)
+		isAdmin, err := auth.LookupUserAdmin(old.Username, users, cfg)
+		if err != nil {
+			sessions.RevokeRefreshToken(next)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			if errors.Is(err, auth.ErrUserNotFound) {
+				log.Println("REFRESH FAIL (no user) user=" + old.Username)
+			} else {
+				log.Println("REFRESH FAIL (" + cfg.Auth.UserBackend + ") user=" + old.Username + " " + err.Error())
+			}
+			return
+		}
+		isAdmin = auth.UserGrants(old.Username, isAdmin, users, cfg).Admin
+		tokenString, err := auth.GenerateJWT(cfg.JWT.Secret, old.Username, isAdmin, cfg.JWT.ExpirationMinutes)
+		if err != nil {
+			http.Error(w, "Erreur serveur", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"token":         tokenString,
+			"refresh_token": next,
+			"expires_in":    cfg.JWT.ExpirationMinutes * 60,
+		})
+		log.Println("REFRESH OK user=" + old.Username)
+	}
+}
+
+// LogoutHandler révoque le jeton d'accès courant et la session du jeton de rafraîchissement
+// fourni (POST {"refresh_token", "all"}). "all": true révoque toutes les sessions de
+// l'utilisateur ; un admin peut révoquer celles d'un autre avec ?user=.
+func LogoutHandler(cfg *auth.Config, sessions *auth.Sessions, accessLogger *logging.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Méthode non autorisée", http.StatusMethodNotAllowed)
+			return
+		}
+		tok, err := auth.ParseAccessToken(r, cfg.JWT.Secret)
+		if err != nil || tok.Username == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if target := r.URL.Query().Get("user"); target != "" && target != tok.Username {
+			if !tok.Admin {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			if err := sessions.RevokeUser(target); err != nil {
+				http.Error(w, "Erreur stockage", http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+			accessLogger.Write("REVOKE_USER user=" + tok.Username + " target=" + target)
+			return
+		}
+		var req struct {
+			RefreshToken string `json:"refresh_token"`
+			All          bool   `json:"all"`
+		}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "JSON invalide", http.StatusBadRequest)
+				return
+			}
+		}
+		err = sessions.RevokeAccessToken(tok.ID, tok.Username, tok.ExpiresAt)
+		if err == nil && req.RefreshToken != "" {
+			err = sessions.RevokeRefreshToken(req.RefreshToken)
+		}
+		if err == nil && req.All {
+			err = sessions.RevokeUser(tok.Username)
+		}
+		if err != nil {
+			http.Error(w, "Erreur stockage", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		if req.All {
+			accessLogger.Write("LOGOUT_ALL user=" + tok.Username)
+		} else {
+			accessLogger.Write("LOGOUT user=" + tok.Username)
+		}
+	}
+}
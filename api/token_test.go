@@ -0,0 +1,56 @@
+package api
+
+import (
+	"database/sql"
+	"druid-insight/auth"
+	"druid-insight/store"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestTokenRefreshHandler_SQLBackend(t *testing.T) {
+	env := newTestEnv(t)
+	dsn := newUsersDB(t, map[string]bool{"carol": true})
+	env.cfg.Auth.UserBackend = "sqlite3"
+	env.cfg.Auth.DBDSN = dsn
+	env.cfg.Auth.UserLookupRequest = "SELECT is_admin FROM users WHERE name = ?"
+	st, err := store.Open("file", "", t.TempDir())
+	if err != nil {
+		t.Fatalf("store.Open failed: %v", err)
+	}
+	sessions, err := auth.NewSessions(st, time.Hour)
+	if err != nil {
+		t.Fatalf("NewSessions failed: %v", err)
+	}
+	h := TokenRefreshHandler(env.cfg, nil, sessions)
+	refresh, err := sessions.IssueRefreshToken("carol", false, "")
+	if err != nil {
+		t.Fatalf("IssueRefreshToken failed: %v", err)
+	}
+
+	// admin relu en base, pas celui de la session
+	w := serve(h, env.request(t, "POST", "/api/token/refresh", map[string]string{"refresh_token": refresh}, "", false))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body)
+	}
+	var out map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &out)
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer "+out["token"].(string))
+	if _, admin, err := auth.ExtractUserAndAdminFromJWT(r, env.cfg.JWT.Secret); err != nil || !admin {
+		t.Errorf("Expected an admin token read from the database, got admin=%t err=%v", admin, err)
+	}
+
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		t.Fatalf("sql.Open failed: %v", err)
+	}
+	db.Exec("DELETE FROM users WHERE name = 'carol'")
+	db.Close()
+	w = serve(h, env.request(t, "POST", "/api/token/refresh", map[string]string{"refresh_token": out["refresh_token"].(string)}, "", false))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 once the user is deleted, got %d: %s", w.Code, w.Body)
+	}
+}
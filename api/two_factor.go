@@ -0,0 +1,211 @@
+package api
+
+import (
+	"druid-insight/auth"
+	"druid-insight/logging"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// requireSecondFactor termine la première étape de connexion si l'utilisateur a un second
+// facteur ou si son rôle l'impose : la réponse porte un mfa_token et, pour une inscription
+// imposée, le secret TOTP et son URI otpauth:// (QR code). false si le mot de passe suffit.
+func requireSecondFactor(w http.ResponseWriter, twoFactor *auth.TwoFactorAuth, username string, grants *auth.Grants, ip string, loginLogger *logging.Logger) bool {
+	enrolled, err := twoFactor.Enrolled(username)
+	if err == nil && !enrolled && !twoFactor.Required(grants.Roles) {
+		return false
+	}
+	resp := map[string]interface{}{
+		"mfa_required": true,
+		"expires_in":   int(auth.MFAChallengeTTL.Seconds()),
+	}
+	if err == nil && !enrolled {
+		var secret, uri string
+		secret, uri, err = twoFactor.BeginEnroll(username)
+		resp["mfa_enroll"], resp["secret"], resp["otpauth_url"] = true, secret, uri
+	}
+	if err == nil {
+		resp["mfa_token"], err = twoFactor.StartChallenge(username, grants.Admin, !enrolled)
+	}
+	if err != nil {
+		http.Error(w, "Erreur stockage", http.StatusInternalServerError)
+		log.Println("LOGIN FAIL (2fa store) user=" + username + " " + err.Error())
+		return true
+	}
+	writeJSON(w, http.StatusOK, resp)
+	if enrolled {
+		loginLogger.Write("LOGIN_MFA_CHALLENGE user=" + username + " ip=" + ip)
+	} else {
+		loginLogger.Write("LOGIN_MFA_ENROLL user=" + username + " ip=" + ip)
+	}
+	return true
+}
+
+// LoginTwoFactorHandler est la seconde étape de connexion (POST {"mfa_token", "code"}) : code
+// TOTP ou code de secours. Retourne les jetons comme /api/login, et les codes de secours si le
+// code confirme une inscription imposée. Les codes faux comptent comme des échecs de connexion.
+func LoginTwoFactorHandler(cfg *auth.Config, sessions *auth.Sessions, limiter *auth.LoginLimiter, twoFactor *auth.TwoFactorAuth, loginLogger *logging.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Méthode non autorisée", http.StatusMethodNotAllowed)
+			return
+		}
+		if twoFactor == nil {
+			http.Error(w, "Double authentification désactivée", http.StatusNotFound)
+			return
+		}
+		var req struct {
+			MFAToken string `json:"mfa_token"`
+			Code     string `json:"code"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.MFAToken == "" || req.Code == "" {
+			http.Error(w, "mfa_token et code requis", http.StatusBadRequest)
+			return
+		}
+		ip := auth.ClientIP(r, cfg.LoginProtection.TrustForwardedFor)
+		c, err := twoFactor.Challenge(req.MFAToken)
+		if err == nil && loginLocked(w, limiter, loginLogger, c.Username, ip) {
+			return
+		}
+		if err == nil {
+			var recovery []string
+			c, recovery, err = twoFactor.CompleteChallenge(req.MFAToken, req.Code)
+			if err == nil {
+				resp, err := issueTokens(cfg, sessions, c.Username, c.Admin, "")
+				if err != nil {
+					http.Error(w, "Erreur serveur", http.StatusInternalServerError)
+					log.Println("LOGIN FAIL (jwt error) user=" + c.Username + " " + err.Error())
+					return
+				}
+				if recovery != nil {
+					resp["recovery_codes"] = recovery
+				}
+				if limiter != nil {
+					limiter.Success(c.Username)
+				}
+				writeJSON(w, http.StatusOK, resp)
+				log.Println("LOGIN OK (2fa) user=" + c.Username)
+				loginLogger.Write("LOGIN_OK user=" + c.Username + " ip=" + ip + " mfa=totp")
+				return
+			}
+		}
+		switch {
+		case errors.Is(err, auth.ErrMFAChallengeInvalid), errors.Is(err, auth.ErrTwoFactorEnabled):
+			http.Error(w, "Connexion expirée, recommencer", http.StatusUnauthorized)
+		case errors.Is(err, auth.ErrTOTPInvalid), errors.Is(err, auth.ErrTwoFactorNotEnrolled):
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			loginFailed(limiter, loginLogger, c.Username, ip, "wrong_2fa_code")
+		default:
+			http.Error(w, "Erreur stockage", http.StatusInternalServerError)
+			log.Println("LOGIN FAIL (2fa store) " + err.Error())
+		}
+	}
+}
+
+// TwoFactorHandler gère le second facteur de l'utilisateur connecté (par JWT) :
+// GET /api/2fa (état), POST /api/2fa/enroll (nouveau secret), POST /api/2fa/confirm {"code"}
+// (activation, retourne les codes de secours) et DELETE /api/2fa {"code"} (désactivation,
+// refusée si le rôle impose un second facteur).
+func TwoFactorHandler(cfg *auth.Config, users *auth.UsersFile, limiter *auth.LoginLimiter, twoFactor *auth.TwoFactorAuth, loginLogger *logging.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tok, err := auth.ParseAccessToken(r, cfg.JWT.Secret)
+		if err != nil || tok.Username == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if twoFactor == nil {
+			http.Error(w, "Double authentification désactivée", http.StatusNotFound)
+			return
+		}
+		required := twoFactor.Required(auth.GetUserRoles(tok.Username, tok.Admin, users, cfg))
+		var req struct {
+			Code string `json:"code"`
+		}
+		route := r.Method + " " + r.URL.Path
+		if route == "POST /api/2fa/confirm" || route == "DELETE /api/2fa" {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+				http.Error(w, "code requis", http.StatusBadRequest)
+				return
+			}
+		}
+		switch route {
+		case "GET /api/2fa":
+			t, err := twoFactor.Status(tok.Username)
+			if err != nil {
+				http.Error(w, "Erreur stockage", http.StatusInternalServerError)
+				return
+			}
+			resp := map[string]interface{}{
+				"enabled":  t != nil && t.Enabled,
+				"pending":  t != nil && !t.Enabled,
+				"required": required,
+			}
+			if t != nil && t.Enabled {
+				resp["recovery_codes_left"] = len(t.RecoveryCodes)
+			}
+			writeJSON(w, http.StatusOK, resp)
+
+		case "POST /api/2fa/enroll":
+			secret, uri, err := twoFactor.BeginEnroll(tok.Username)
+			if errors.Is(err, auth.ErrTwoFactorEnabled) {
+				http.Error(w, "Double authentification déjà active", http.StatusConflict)
+				return
+			}
+			if err != nil {
+				http.Error(w, "Erreur stockage", http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]string{"secret": secret, "otpauth_url": uri})
+
+		case "POST /api/2fa/confirm":
+			codes, err := twoFactor.ConfirmEnroll(tok.Username, req.Code)
+			if !writeTwoFactorError(w, err) {
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]interface{}{"recovery_codes": codes})
+			loginLogger.Write("MFA_ENABLED user=" + tok.Username)
+
+		case "DELETE /api/2fa":
+			if required {
+				http.Error(w, "Double authentification obligatoire pour ce rôle", http.StatusForbidden)
+				return
+			}
+			// un code faux compte comme un échec de connexion : pas de recherche du code par force brute
+			ip := auth.ClientIP(r, cfg.LoginProtection.TrustForwardedFor)
+			if loginLocked(w, limiter, loginLogger, tok.Username, ip) {
+				return
+			}
+			err := twoFactor.Disable(tok.Username, req.Code)
+			if errors.Is(err, auth.ErrTOTPInvalid) {
+				loginFailed(limiter, loginLogger, tok.Username, ip, "wrong_2fa_code")
+			}
+			if !writeTwoFactorError(w, err) {
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+			loginLogger.Write("MFA_DISABLED user=" + tok.Username)
+
+		default:
+			http.Error(w, "Méthode non autorisée", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// writeTwoFactorError répond à une vérification de code échouée ; true si err est nil
+func writeTwoFactorError(w http.ResponseWriter, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, auth.ErrTOTPInvalid):
+		http.Error(w, "Code invalide", http.StatusBadRequest)
+	case errors.Is(err, auth.ErrTwoFactorNotEnrolled):
+		http.Error(w, "Aucune inscription en cours", http.StatusConflict)
+	case errors.Is(err, auth.ErrTwoFactorEnabled):
+		http.Error(w, "Double authentification déjà active", http.StatusConflict)
+	default:
+		http.Error(w, "Erreur stockage", http.StatusInternalServerError)
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"druid-insight/auth"
+	"druid-insight/store"
+	"net/http"
+	"strconv"
+)
+
+const defaultDeliveriesLimit = 100
+
+// WebhookDeliveriesHandler liste le journal de livraison des webhooks (admin uniquement).
+// Filtres optionnels : report_id, status (pending, delivered, failed), limit.
+func WebhookDeliveriesHandler(cfg *auth.Config, st *store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "Méthode non autorisée", http.StatusMethodNotAllowed)
+			return
+		}
+		_, isAdmin, err := auth.ExtractUserAndAdminFromJWT(r, cfg.JWT.Secret)
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if !isAdmin {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		q := r.URL.Query()
+		reportID, status := q.Get("report_id"), q.Get("status")
+		limit, err := strconv.Atoi(q.Get("limit"))
+		if err != nil || limit <= 0 {
+			limit = defaultDeliveriesLimit
+		}
+		list, err := st.ListWebhookDeliveries(func(d *store.WebhookDelivery) bool {
+			return (reportID == "" || d.ReportID == reportID) && (status == "" || d.Status == status)
+		})
+		if err != nil {
+			http.Error(w, "Erreur stockage", http.StatusInternalServerError)
+			return
+		}
+		if len(list) > limit {
+			list = list[:limit]
+		}
+		if list == nil {
+			list = []*store.WebhookDelivery{}
+		}
+		writeJSON(w, http.StatusOK, list)
+	}
+}
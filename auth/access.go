@@ -11,6 +11,12 @@ func GetAccessFilters(username string, isAdmin bool, datasource string, druidCfg
 		return nil
 	}
 
+	if cfg != nil && cfg.Auth.UserBackend == "ldap" {
+		return getFiltersFromLDAP(username, datasource, druidCfg)
+	}
+	if cfg != nil && cfg.Auth.UserBackend == "oidc" {
+		return getFiltersFromOIDC(username, datasource, druidCfg)
+	}
 	if users != nil {
 		return getFiltersFromFile(username, datasource, druidCfg, users)
 	} else {
@@ -18,6 +24,62 @@ func GetAccessFilters(username string, isAdmin bool, datasource string, druidCfg
 	}
 }
 
+func getFiltersFromLDAP(username string, datasource string, druidCfg *config.DruidConfig) map[string][]string {
+	dir := LDAP()
+	if dir == nil {
+		return map[string][]string{}
+	}
+	u, err := dir.Lookup(username)
+	if err != nil {
+		log.Println("ldap access filters - " + err.Error())
+		u = nil
+	}
+	return dir.AccessFilters(u, datasource, druidCfg)
+}
+
+func getFiltersFromOIDC(username string, datasource string, druidCfg *config.DruidConfig) map[string][]string {
+	if oidcProvider == nil {
+		return map[string][]string{}
+	}
+	u, err := oidcProvider.Profile(username)
+	if err != nil {
+		log.Println("oidc access filters - " + err.Error())
+		u = nil
+	}
+	return oidcProvider.AccessFilters(u, datasource, druidCfg)
+}
+
+// groupDenyValue : valeur impossible imposée aux dimensions restreintes quand l'utilisateur
+// ne peut pas être résolu (aucune ligne plutôt que toutes les lignes)
+const groupDenyValue = "\x00group:unresolved"
+
+// groupAccessFilters fait l'union des valeurs autorisées par les groupes dont l'utilisateur
+// est membre (access_groups LDAP ou OIDC) ; member nil = utilisateur non résolu
+func groupAccessFilters(accessGroups map[string]map[string]map[string][]string, member func(string) bool, datasource string, druidCfg *config.DruidConfig) map[string][]string {
+	result := map[string][]string{}
+	ds, ok := druidCfg.Datasources[datasource]
+	if !ok {
+		return result
+	}
+	for group, byDS := range accessGroups {
+		if member == nil {
+			for dim := range byDS[datasource] {
+				result[dim] = []string{groupDenyValue}
+			}
+			continue
+		}
+		if !member(group) {
+			continue
+		}
+		for dim, values := range byDS[datasource] {
+			if _, ok := ds.Dimensions[dim]; ok && len(values) > 0 {
+				result[dim] = append(result[dim], values...)
+			}
+		}
+	}
+	return result
+}
+
 func getFiltersFromFile(username string, datasource string, druidCfg *config.DruidConfig, users *UsersFile) map[string][]string {
 	result := make(map[string][]string, 0)
 
@@ -0,0 +1,240 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"druid-insight/store"
+	"druid-insight/utils"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// APIKeyPrefix distingue une clé d'API d'un JWT dans l'en-tête Authorization
+	APIKeyPrefix          = "dik_"
+	apiKeysReloadInterval = 30 * time.Second // relecture des clés (révocations par userctl, autres instances)
+	apiKeyLastUsedEvery   = time.Hour        // fréquence d'enregistrement de last_used_at
+)
+
+// Raisons de rejet propres aux clés d'API
+const (
+	ReasonBadAPIKey  = "bad_api_key"
+	ReasonOutOfScope = "out_of_scope"
+)
+
+var ErrAPIKeyInvalid = errors.New("invalid, expired or revoked API key")
+
+// APIKeyOptions : paramètres d'une nouvelle clé
+type APIKeyOptions struct {
+	Name        string
+	Username    string
+	Admin       bool
+	Datasources []string
+	Endpoints   []string
+	TTL         time.Duration // 0 = sans expiration
+	CreatedBy   string
+}
+
+// APIKeys authentifie les clés d'API des comptes de service (X-API-Key ou Bearer dik_...).
+// Les clés sont gardées en mémoire et relues périodiquement depuis le stockage.
+type APIKeys struct {
+	st *store.Store
+
+	mu       sync.Mutex
+	keys     map[string]*store.APIKey
+	loadedAt time.Time
+}
+
+// Clés actives (nil = clés d'API refusées)
+var apiKeys *APIKeys
+
+// SetAPIKeys active l'authentification par clé d'API dans ExtractUserAndAdminFromJWT
+func SetAPIKeys(k *APIKeys) { apiKeys = k }
+
+// NewAPIKeys charge les clés depuis le stockage
+func NewAPIKeys(st *store.Store) (*APIKeys, error) {
+	k := &APIKeys{st: st}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.reload(time.Now()); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// reload relit les clés (appelé sous k.mu)
+func (k *APIKeys) reload(now time.Time) error {
+	list, err := k.st.ListAPIKeys(nil)
+	if err != nil {
+		return err
+	}
+	k.keys = make(map[string]*store.APIKey, len(list))
+	for _, key := range list {
+		k.keys[key.ID] = key
+	}
+	k.loadedAt = now
+	return nil
+}
+
+// Create émet une clé et retourne son secret complet, qui n'est plus jamais affichable ensuite
+func (k *APIKeys) Create(opts APIKeyOptions) (string, *store.APIKey, error) {
+	if opts.Username == "" {
+		return "", nil, errors.New("username is required")
+	}
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", nil, err
+	}
+	secret := base64.RawURLEncoding.EncodeToString(raw)
+	now := time.Now().UTC()
+	key := &store.APIKey{
+		ID:          utils.RandomHex(6),
+		Name:        opts.Name,
+		Username:    opts.Username,
+		Admin:       opts.Admin,
+		Hash:        apiKeyHash(secret),
+		Datasources: opts.Datasources,
+		Endpoints:   opts.Endpoints,
+		CreatedBy:   opts.CreatedBy,
+		CreatedAt:   now,
+	}
+	if opts.TTL > 0 {
+		expires := now.Add(opts.TTL)
+		key.ExpiresAt = &expires
+	}
+	if err := k.st.PutAPIKey(key); err != nil {
+		return "", nil, err
+	}
+	k.mu.Lock()
+	k.keys[key.ID] = key
+	k.mu.Unlock()
+	return APIKeyPrefix + key.ID + "_" + secret, key, nil
+}
+
+// Authenticate vérifie une clé complète (dik_<id>_<secret>) et retourne sa définition
+func (k *APIKeys) Authenticate(raw string) (*store.APIKey, error) {
+	id, secret, ok := strings.Cut(strings.TrimPrefix(raw, APIKeyPrefix), "_")
+	if !ok || !strings.HasPrefix(raw, APIKeyPrefix) {
+		return nil, ErrAPIKeyInvalid
+	}
+	now := time.Now()
+	k.mu.Lock()
+	if now.Sub(k.loadedAt) >= apiKeysReloadInterval {
+		k.reload(now) // en cas d'échec on garde les clés précédentes
+	}
+	key, found := k.keys[id]
+	k.mu.Unlock()
+	if !found || subtle.ConstantTimeCompare([]byte(apiKeyHash(secret)), []byte(key.Hash)) != 1 || !key.Active(now) {
+		return nil, ErrAPIKeyInvalid
+	}
+	k.touch(key, now)
+	return key, nil
+}
+
+// touch enregistre la dernière utilisation, au plus une fois par heure. L'entrée est relue
+// pour ne pas écraser une révocation faite entre-temps (userctl, autre instance).
+func (k *APIKeys) touch(key *store.APIKey, now time.Time) {
+	if key.LastUsedAt != nil && now.Sub(*key.LastUsedAt) < apiKeyLastUsedEvery {
+		return
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	fresh, err := k.st.GetAPIKey(key.ID)
+	if err != nil {
+		return
+	}
+	if fresh.RevokedAt == nil {
+		used := now.UTC()
+		fresh.LastUsedAt = &used
+		if k.st.PutAPIKey(fresh) != nil {
+			return
+		}
+	}
+	k.keys[key.ID] = fresh
+}
+
+// Revoke révoque une clé (store.ErrNotFound si elle n'existe pas)
+func (k *APIKeys) Revoke(id, by string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	key, err := k.st.GetAPIKey(id)
+	if err != nil {
+		return err
+	}
+	if key.RevokedAt == nil {
+		now := time.Now().UTC()
+		key.RevokedAt, key.RevokedBy = &now, by
+		if err := k.st.PutAPIKey(key); err != nil {
+			return err
+		}
+	}
+	k.keys[key.ID] = key
+	return nil
+}
+
+// List retourne les clés retenues par keep, sans leur empreinte
+func (k *APIKeys) List(keep func(*store.APIKey) bool) ([]*store.APIKey, error) {
+	list, err := k.st.ListAPIKeys(keep)
+	for _, key := range list {
+		key.Hash = ""
+	}
+	return list, err
+}
+
+func apiKeyHash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// apiKeyFromRequest retourne la clé d'API présentée (X-API-Key ou Bearer dik_...)
+func apiKeyFromRequest(r *http.Request) (string, bool) {
+	if raw := r.Header.Get("X-API-Key"); raw != "" {
+		return raw, true
+	}
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer "+APIKeyPrefix) {
+		return strings.TrimPrefix(h, "Bearer "), true
+	}
+	return "", false
+}
+
+// authenticateAPIKey vérifie la clé et le périmètre d'endpoints pour la requête
+func authenticateAPIKey(r *http.Request, raw string) (*store.APIKey, error) {
+	var key *store.APIKey
+	err := error(&TokenError{Reason: ReasonBadAPIKey, Err: ErrAPIKeyInvalid})
+	if apiKeys != nil {
+		if key, err = apiKeys.Authenticate(raw); err != nil {
+			err = &TokenError{Reason: ReasonBadAPIKey, Err: err}
+		} else if !key.AllowsEndpoint(r.URL.Path) {
+			err = &TokenError{Reason: ReasonOutOfScope, Err: errors.New("endpoint not allowed for this API key")}
+		}
+	}
+	if err != nil {
+		line := "APIKEY_REJECT reason=" + err.(*TokenError).Reason + " path=" + r.URL.Path + " ip=" + r.RemoteAddr
+		if key != nil {
+			line += " key=" + key.ID + " user=" + key.Username
+		}
+		logReject(line)
+		return nil, err
+	}
+	return key, nil
+}
+
+// DatasourceAllowed indique si la requête peut lire la datasource : toujours vrai pour un JWT,
+// limité au périmètre de la clé pour une clé d'API
+func DatasourceAllowed(r *http.Request, datasource string) bool {
+	raw, ok := apiKeyFromRequest(r)
+	if !ok {
+		return true
+	}
+	if apiKeys == nil {
+		return false
+	}
+	key, err := apiKeys.Authenticate(raw)
+	return err == nil && key.AllowsDatasource(datasource)
+}
@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"druid-insight/store"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testAPIKeys(t *testing.T) (*APIKeys, *store.Store) {
+	st, err := store.Open("file", "", t.TempDir())
+	if err != nil {
+		t.Fatalf("store.Open failed: %v", err)
+	}
+	k, err := NewAPIKeys(st)
+	if err != nil {
+		t.Fatalf("NewAPIKeys failed: %v", err)
+	}
+	return k, st
+}
+
+func TestAPIKeys_CreateAuthenticateRevoke(t *testing.T) {
+	k, st := testAPIKeys(t)
+	secret, key, err := k.Create(APIKeyOptions{Username: "etl", Name: "nightly export", CreatedBy: "admin"})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if !strings.HasPrefix(secret, APIKeyPrefix+key.ID+"_") {
+		t.Fatalf("Unexpected key format %q", secret)
+	}
+	stored, _ := st.GetAPIKey(key.ID)
+	if stored.Hash == "" || strings.Contains(secret, stored.Hash) {
+		t.Errorf("Expected only a hash of the secret to be stored, got %q", stored.Hash)
+	}
+	if got, err := k.Authenticate(secret); err != nil || got.Username != "etl" {
+		t.Fatalf("Expected etl, got %+v (%v)", got, err)
+	}
+	if stored, _ := st.GetAPIKey(key.ID); stored.LastUsedAt == nil {
+		t.Error("Expected last_used_at to be recorded")
+	}
+	for _, bad := range []string{secret + "x", APIKeyPrefix + key.ID, APIKeyPrefix + "unknown_" + strings.Repeat("a", 43), "eyJhbGciOi"} {
+		if _, err := k.Authenticate(bad); !errors.Is(err, ErrAPIKeyInvalid) {
+			t.Errorf("Expected %q to be rejected, got %v", bad, err)
+		}
+	}
+	if err := k.Revoke(key.ID, "admin"); err != nil {
+		t.Fatalf("Revoke failed: %v", err)
+	}
+	if _, err := k.Authenticate(secret); !errors.Is(err, ErrAPIKeyInvalid) {
+		t.Errorf("Expected revoked key to be rejected, got %v", err)
+	}
+	if err := k.Revoke("unknown", "admin"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	expiring, _, _ := k.Create(APIKeyOptions{Username: "etl", TTL: time.Nanosecond})
+	time.Sleep(time.Millisecond)
+	if _, err := k.Authenticate(expiring); !errors.Is(err, ErrAPIKeyInvalid) {
+		t.Errorf("Expected expired key to be rejected, got %v", err)
+	}
+}
+
+func TestAPIKeys_ExtractAndScopes(t *testing.T) {
+	k, _ := testAPIKeys(t)
+	SetAPIKeys(k)
+	defer SetAPIKeys(nil)
+	secret, _, _ := k.Create(APIKeyOptions{
+		Username:    "etl",
+		Admin:       true,
+		Datasources: []string{"sales"},
+		Endpoints:   []string{"/api/reports", "/api/schema"},
+	})
+
+	req := httptest.NewRequest("POST", "/api/reports/execute", nil)
+	req.Header.Set("X-API-Key", secret)
+	if user, admin, err := ExtractUserAndAdminFromJWT(req, "secret"); err != nil || user != "etl" || !admin {
+		t.Fatalf("Expected admin etl via X-API-Key, got %q %v (%v)", user, admin, err)
+	}
+	if !DatasourceAllowed(req, "sales") || DatasourceAllowed(req, "finance") {
+		t.Error("Expected the key to be limited to the sales datasource")
+	}
+
+	req = httptest.NewRequest("GET", "/api/schema", nil)
+	req.Header.Set("Authorization", "Bearer "+secret)
+	if user, _, err := ExtractUserAndAdminFromJWT(req, "secret"); err != nil || user != "etl" {
+		t.Fatalf("Expected etl via bearer key, got %q (%v)", user, err)
+	}
+
+	var rejected []string
+	SetRejectLogger(func(line string) { rejected = append(rejected, line) })
+	defer SetRejectLogger(nil)
+	req = httptest.NewRequest("GET", "/api/reportsx", nil)
+	req.Header.Set("X-API-Key", secret)
+	_, _, err := ExtractUserAndAdminFromJWT(req, "secret")
+	var te *TokenError
+	if !errors.As(err, &te) || te.Reason != ReasonOutOfScope {
+		t.Errorf("Expected out_of_scope, got %v", err)
+	}
+	req = httptest.NewRequest("GET", "/api/schema", nil)
+	req.Header.Set("X-API-Key", "dik_nope_nope")
+	if _, _, err := ExtractUserAndAdminFromJWT(req, "secret"); !errors.As(err, &te) || te.Reason != ReasonBadAPIKey {
+		t.Errorf("Expected bad_api_key, got %v", err)
+	}
+	if len(rejected) != 2 || !strings.HasPrefix(rejected[0], "APIKEY_REJECT reason=out_of_scope") {
+		t.Errorf("Expected 2 APIKEY_REJECT lines, got %v", rejected)
+	}
+
+	// un JWT n'est pas concerné par les périmètres de clés
+	token, _ := GenerateJWT("secret", "alice", false, 10)
+	req = httptest.NewRequest("GET", "/api/schema", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if !DatasourceAllowed(req, "finance") {
+		t.Error("Expected JWT requests to be unrestricted by key scopes")
+	}
+}
@@ -1,47 +1,250 @@
 package auth
 
 import (
+	"druid-insight/utils"
 	"errors"
 	"net/http"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
+const (
+	defaultJWTIssuer   = "druid-insight"
+	defaultJWTAudience = "druid-insight"
+)
+
+// Raisons de rejet d'un jeton, écrites dans le journal d'accès
+const (
+	ReasonNoToken        = "no_token"
+	ReasonMalformed      = "malformed"
+	ReasonBadAlgorithm   = "bad_algorithm"
+	ReasonUnknownKey     = "unknown_key"
+	ReasonBadSignature   = "bad_signature"
+	ReasonExpired        = "expired"
+	ReasonNotYetValid    = "not_yet_valid"
+	ReasonIssuedInFuture = "issued_in_future"
+	ReasonBadIssuer      = "bad_issuer"
+	ReasonBadAudience    = "bad_audience"
+	ReasonMissingClaim   = "missing_claim"
+	ReasonBadClaimType   = "bad_claim_type"
+	ReasonRevoked        = "revoked"
+	ReasonInvalid        = "invalid"
+)
+
+var (
+	errBadAlgorithm = errors.New("unexpected signing method")
+	errUnknownKey   = errors.New("unknown signing key")
+)
+
+// TokenError : jeton refusé, avec une raison stable (Reason*)
+type TokenError struct {
+	Reason string
+	Err    error
+}
+
+func (e *TokenError) Error() string {
+	if e.Err != nil {
+		return "invalid JWT (" + e.Reason + "): " + e.Err.Error()
+	}
+	return "invalid JWT (" + e.Reason + ")"
+}
+
+func (e *TokenError) Unwrap() error { return e.Err }
+
+// jwtParams : paramètres de validation des jetons (ConfigureJWT), remplacés d'un bloc au
+// rechargement de la configuration pendant que les requêtes les lisent
+type jwtParams struct {
+	issuer   string
+	audience string
+	leeway   time.Duration
+}
+
+var (
+	jwtSettings  atomic.Pointer[jwtParams]
+	rejectLogger atomic.Pointer[func(string)]
+)
+
+func currentJWT() *jwtParams {
+	if p := jwtSettings.Load(); p != nil {
+		return p
+	}
+	return &jwtParams{issuer: defaultJWTIssuer, audience: defaultJWTAudience}
+}
+
+// ConfigureJWT applique l'émetteur, l'audience et la tolérance d'horloge de config.yaml
+func ConfigureJWT(cfg *Config) {
+	p := &jwtParams{
+		issuer:   defaultJWTIssuer,
+		audience: defaultJWTAudience,
+		leeway:   time.Duration(cfg.JWT.LeewaySeconds) * time.Second,
+	}
+	if cfg.JWT.Issuer != "" {
+		p.issuer = cfg.JWT.Issuer
+	}
+	if cfg.JWT.Audience != "" {
+		p.audience = cfg.JWT.Audience
+	}
+	jwtSettings.Store(p)
+}
+
+// SetRejectLogger reçoit une ligne par jeton refusé (absence de jeton exclue)
+func SetRejectLogger(fn func(string)) { rejectLogger.Store(&fn) }
+
+// logReject écrit une ligne de refus si un journal est configuré
+func logReject(line string) {
+	if fn := rejectLogger.Load(); fn != nil && *fn != nil {
+		(*fn)(line)
+	}
+}
+
 func GenerateJWT(secret string, username string, isAdmin bool, expirationMinutes int) (string, error) {
+	now := time.Now()
+	p := currentJWT()
 	claims := jwt.MapClaims{
+		"iss":   p.issuer,
+		"aud":   p.audience,
 		"sub":   username,
 		"admin": isAdmin,
-		"exp":   time.Now().Add(time.Duration(expirationMinutes) * time.Minute).Unix(),
+		"jti":   utils.RandomHex(16), // identifiant pour la révocation (logout)
+		"iat":   now.Unix(),
+		"nbf":   now.Unix(),
+		"exp":   now.Add(time.Duration(expirationMinutes) * time.Minute).Unix(),
+	}
+	if keySet != nil {
+		return keySet.Sign(claims)
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString([]byte(secret))
 }
 
+// AccessToken : informations d'un jeton d'accès valide
+type AccessToken struct {
+	ID        string // jti
+	Username  string
+	Admin     bool
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+// ExtractUserAndAdminFromJWT authentifie la requête par JWT ou, pour les comptes de service,
+// par clé d'API (X-API-Key ou Bearer dik_...) dans son périmètre d'endpoints
 func ExtractUserAndAdminFromJWT(r *http.Request, secret string) (username string, isAdmin bool, err error) {
+	if raw, ok := apiKeyFromRequest(r); ok {
+		key, err := authenticateAPIKey(r, raw)
+		if err != nil {
+			return "", false, err
+		}
+		return key.Username, key.Admin, nil
+	}
+	tok, err := ParseAccessToken(r, secret)
+	if err != nil {
+		return "", false, err
+	}
+	return tok.Username, tok.Admin, nil
+}
+
+// ParseAccessToken valide le jeton Bearer de la requête : algorithme attendu, signature,
+// iss/aud/exp/nbf/iat (avec tolérance d'horloge), types des claims et révocation.
+// Les erreurs sont des *TokenError.
+func ParseAccessToken(r *http.Request, secret string) (*AccessToken, error) {
 	auth := r.Header.Get("Authorization")
 	if auth == "" || !strings.HasPrefix(auth, "Bearer ") {
-		return "", false, errors.New("no bearer token")
+		return nil, &TokenError{Reason: ReasonNoToken}
 	}
-	tokenString := strings.TrimPrefix(auth, "Bearer ")
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+	tok, err := parseAccessToken(strings.TrimPrefix(auth, "Bearer "), secret)
+	if err != nil {
+		logReject("JWT_REJECT reason=" + err.(*TokenError).Reason + " path=" + r.URL.Path + " ip=" + r.RemoteAddr)
+		return nil, err
+	}
+	return tok, nil
+}
+
+func parseAccessToken(tokenString, secret string) (*AccessToken, error) {
+	p := currentJWT()
+	parser := jwt.NewParser(
+		jwt.WithIssuer(p.issuer),
+		jwt.WithAudience(p.audience),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(p.leeway),
+	)
+	token, err := parser.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if keySet != nil {
+			return keySet.Keyfunc(token)
+		}
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, errBadAlgorithm
+		}
 		return []byte(secret), nil
 	})
-	if err != nil || !token.Valid {
-		return "", false, errors.New("invalid or expired JWT")
-	}
-	if claims, ok := token.Claims.(jwt.MapClaims); ok {
-		username, _ = claims["sub"].(string)
-		switch v := claims["admin"].(type) {
-		case bool:
-			isAdmin = v
-		case string:
-			isAdmin = v == "true" || v == "1"
-		case float64:
-			isAdmin = v == 1
+	if err != nil {
+		return nil, &TokenError{Reason: tokenErrorReason(err), Err: err}
+	}
+	if !token.Valid {
+		return nil, &TokenError{Reason: ReasonInvalid}
+	}
+	claims := token.Claims.(jwt.MapClaims)
+
+	// exp et iat sont obligatoires ; sub, admin et jti doivent avoir le bon type
+	exp, _ := claims.GetExpirationTime()
+	iat, _ := claims.GetIssuedAt()
+	if exp == nil || iat == nil {
+		return nil, &TokenError{Reason: ReasonMissingClaim, Err: errors.New("exp and iat are required")}
+	}
+	tok := &AccessToken{IssuedAt: iat.Time, ExpiresAt: exp.Time}
+	var ok bool
+	if tok.Username, ok = claims["sub"].(string); !ok || tok.Username == "" {
+		return nil, claimError("sub", claims["sub"])
+	}
+	if tok.Admin, ok = claims["admin"].(bool); !ok {
+		return nil, claimError("admin", claims["admin"])
+	}
+	if v, present := claims["jti"]; present {
+		if tok.ID, ok = v.(string); !ok {
+			return nil, claimError("jti", v)
 		}
-		return username, isAdmin, nil
 	}
-	return "", false, errors.New("invalid JWT claims")
+	if sessions != nil && sessions.IsRevoked(tok.ID, tok.Username, tok.IssuedAt) {
+		return nil, &TokenError{Reason: ReasonRevoked}
+	}
+	return tok, nil
+}
+
+// claimError : claim absente ou de mauvais type
+func claimError(name string, v interface{}) error {
+	if v == nil {
+		return &TokenError{Reason: ReasonMissingClaim, Err: errors.New(name + " is required")}
+	}
+	return &TokenError{Reason: ReasonBadClaimType, Err: errors.New(name + " has an invalid type")}
+}
+
+// tokenErrorReason traduit une erreur de jwt.Parse en raison de rejet
+func tokenErrorReason(err error) string {
+	switch {
+	case errors.Is(err, errBadAlgorithm):
+		return ReasonBadAlgorithm
+	case errors.Is(err, errUnknownKey):
+		return ReasonUnknownKey
+	case errors.Is(err, jwt.ErrTokenMalformed):
+		return ReasonMalformed
+	case errors.Is(err, jwt.ErrInvalidType):
+		return ReasonBadClaimType
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid):
+		return ReasonBadSignature
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return ReasonExpired
+	case errors.Is(err, jwt.ErrTokenNotValidYet):
+		return ReasonNotYetValid
+	case errors.Is(err, jwt.ErrTokenUsedBeforeIssued):
+		return ReasonIssuedInFuture
+	case errors.Is(err, jwt.ErrTokenInvalidIssuer):
+		return ReasonBadIssuer
+	case errors.Is(err, jwt.ErrTokenInvalidAudience):
+		return ReasonBadAudience
+	case errors.Is(err, jwt.ErrTokenRequiredClaimMissing):
+		return ReasonMissingClaim
+	}
+	return ReasonInvalid
 }
@@ -1,9 +1,13 @@
 package auth
 
 import (
+	"errors"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/golang-jwt/jwt/v5"
 )
 
 func TestGenerateAndExtractJWT(t *testing.T) {
@@ -78,3 +82,75 @@ func TestGenerateJWT_Expiration(t *testing.T) {
 		t.Error("Expected error for expired token, got nil")
 	}
 }
+
+func TestParseAccessToken_RejectReasons(t *testing.T) {
+	secret := "test_secret"
+	now := time.Now()
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss": "druid-insight", "aud": "druid-insight", "sub": "alice", "admin": false,
+			"iat": now.Unix(), "nbf": now.Unix(), "exp": now.Add(time.Minute).Unix(),
+		}
+	}
+	with := func(k string, v interface{}) jwt.MapClaims {
+		c := valid()
+		if v == nil {
+			delete(c, k)
+		} else {
+			c[k] = v
+		}
+		return c
+	}
+	sign := func(method jwt.SigningMethod, claims jwt.MapClaims) string {
+		s, err := jwt.NewWithClaims(method, claims).SignedString([]byte(secret))
+		if err != nil {
+			t.Fatalf("SignedString failed: %v", err)
+		}
+		return s
+	}
+	none, _ := jwt.NewWithClaims(jwt.SigningMethodNone, valid()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+
+	cases := []struct {
+		name, token, reason string
+	}{
+		{"hs512", sign(jwt.SigningMethodHS512, valid()), ReasonBadAlgorithm},
+		{"none", none, ReasonBadAlgorithm},
+		{"malformed", "abc.def", ReasonMalformed},
+		{"signature", sign(jwt.SigningMethodHS256, valid()) + "x", ReasonBadSignature},
+		{"issuer", sign(jwt.SigningMethodHS256, with("iss", "other")), ReasonBadIssuer},
+		{"audience", sign(jwt.SigningMethodHS256, with("aud", "other")), ReasonBadAudience},
+		{"expired", sign(jwt.SigningMethodHS256, with("exp", now.Add(-time.Minute).Unix())), ReasonExpired},
+		{"nbf", sign(jwt.SigningMethodHS256, with("nbf", now.Add(time.Minute).Unix())), ReasonNotYetValid},
+		{"iat", sign(jwt.SigningMethodHS256, with("iat", now.Add(time.Minute).Unix())), ReasonIssuedInFuture},
+		{"no exp", sign(jwt.SigningMethodHS256, with("exp", nil)), ReasonMissingClaim},
+		{"admin string", sign(jwt.SigningMethodHS256, with("admin", "true")), ReasonBadClaimType},
+		{"sub number", sign(jwt.SigningMethodHS256, with("sub", 42)), ReasonBadClaimType},
+		{"exp string", sign(jwt.SigningMethodHS256, with("exp", "tomorrow")), ReasonBadClaimType},
+	}
+	var logged []string
+	SetRejectLogger(func(line string) { logged = append(logged, line) })
+	defer SetRejectLogger(nil)
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", "/api/schema", nil)
+		req.Header.Set("Authorization", "Bearer "+c.token)
+		_, err := ParseAccessToken(req, secret)
+		var terr *TokenError
+		if !errors.As(err, &terr) || terr.Reason != c.reason {
+			t.Errorf("%s: expected reason %s, got %v", c.name, c.reason, err)
+		}
+	}
+	if len(logged) != len(cases) || !strings.Contains(logged[0], "reason=bad_algorithm path=/api/schema") {
+		t.Errorf("Expected one access log line per rejected token, got %v", logged)
+	}
+
+	// tolérance d'horloge
+	leeway := &Config{}
+	leeway.JWT.LeewaySeconds = 120
+	ConfigureJWT(leeway)
+	defer ConfigureJWT(&Config{})
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+sign(jwt.SigningMethodHS256, with("exp", now.Add(-time.Minute).Unix())))
+	if _, err := ParseAccessToken(req, secret); err != nil {
+		t.Errorf("Expected token within leeway to be accepted, got %v", err)
+	}
+}
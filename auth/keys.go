@@ -0,0 +1,373 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Algorithmes de signature des jetons d'accès
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+)
+
+const (
+	defaultKeyPrepublish = time.Hour
+	keyRotationCheck     = time.Hour
+	rsaKeyBits           = 2048
+)
+
+// KeySet : clés privées RS256/ES256 d'un répertoire (<kid>.pem). La plus récente clé publiée
+// depuis au moins prepublish signe ; les autres restent valides pour la vérification tant
+// que des jetons signés avec elles peuvent circuler.
+type KeySet struct {
+	alg        string
+	dir        string
+	rotation   time.Duration // 0 = pas de rotation automatique
+	prepublish time.Duration // une nouvelle clé est publiée (JWKS) avant de signer
+	retain     time.Duration // durée de vie maximale d'un jeton signé par une clé remplacée
+
+	mu   sync.RWMutex
+	keys []*signingKey // plus récente en premier
+	stop chan struct{}
+}
+
+type signingKey struct {
+	ID      string
+	Created time.Time
+	Private crypto.Signer
+}
+
+// JWK : clé publique au format JSON Web Key
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// Clés de signature actives (nil = HS256 avec jwt.secret)
+var keySet *KeySet
+
+// SetKeySet active la signature asymétrique pour GenerateJWT et ExtractUserAndAdminFromJWT
+func SetKeySet(ks *KeySet) { keySet = ks }
+
+// JWTAlgorithm retourne l'algorithme configuré (HS256 par défaut)
+func (c *Config) JWTAlgorithm() string {
+	if c.JWT.Algorithm == "" {
+		return AlgHS256
+	}
+	return strings.ToUpper(c.JWT.Algorithm)
+}
+
+// NewKeySetFromConfig construit le jeu de clés de jwt.algorithm (nil pour HS256) et crée
+// une première clé si le répertoire est vide
+func NewKeySetFromConfig(cfg *Config) (*KeySet, error) {
+	alg := cfg.JWTAlgorithm()
+	if alg == AlgHS256 {
+		return nil, nil
+	}
+	dir := cfg.JWT.KeysDir
+	if dir == "" {
+		dir = "keys"
+	}
+	prepublish := time.Duration(cfg.JWT.KeyPrepublishMinutes) * time.Minute
+	if prepublish <= 0 {
+		prepublish = defaultKeyPrepublish
+	}
+	// un jeton peut circuler jusqu'à son expiration (+ marge d'horloge)
+	retain := time.Duration(cfg.JWT.ExpirationMinutes)*time.Minute + 5*time.Minute
+	ks, err := NewKeySet(alg, dir, time.Duration(cfg.JWT.RotationDays)*24*time.Hour, prepublish, retain)
+	if err != nil {
+		return nil, err
+	}
+	if err := ks.Rotate(time.Now()); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+// NewKeySet charge les clés de dir pour alg (RS256 ou ES256)
+func NewKeySet(alg, dir string, rotation, prepublish, retain time.Duration) (*KeySet, error) {
+	if alg != AlgRS256 && alg != AlgES256 {
+		return nil, fmt.Errorf("unsupported jwt algorithm %q", alg)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	ks := &KeySet{alg: alg, dir: dir, rotation: rotation, prepublish: prepublish, retain: retain}
+	if err := ks.load(); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+// load relit les clés du répertoire (ajoutées par un opérateur ou une autre instance)
+func (ks *KeySet) load() error {
+	files, err := filepath.Glob(filepath.Join(ks.dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+	var keys []*signingKey
+	for _, f := range files {
+		k, err := readSigningKey(f)
+		if err != nil {
+			return err
+		}
+		if keyAlg(k.Private) != ks.alg {
+			continue // clé d'un autre algorithme (migration en cours)
+		}
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Created.After(keys[j].Created) })
+	ks.mu.Lock()
+	ks.keys = keys
+	ks.mu.Unlock()
+	return nil
+}
+
+// Rotate relit les clés, en crée une nouvelle si aucune n'existe ou si la plus récente arrive
+// en fin de période, et supprime celles qui ne peuvent plus avoir signé un jeton valide
+func (ks *KeySet) Rotate(now time.Time) error {
+	if err := ks.load(); err != nil {
+		return err
+	}
+	ks.mu.RLock()
+	var newest *signingKey
+	if len(ks.keys) > 0 {
+		newest = ks.keys[0]
+	}
+	ks.mu.RUnlock()
+	if newest == nil || (ks.rotation > 0 && now.Sub(newest.Created) >= ks.rotation-ks.prepublish) {
+		if err := ks.generate(now); err != nil {
+			return err
+		}
+	}
+	return ks.prune(now)
+}
+
+// Start vérifie la rotation toutes les heures
+func (ks *KeySet) Start(onError func(error)) {
+	ks.stop = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(keyRotationCheck)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ks.stop:
+				return
+			case now := <-ticker.C:
+				if err := ks.Rotate(now); err != nil && onError != nil {
+					onError(err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop arrête la rotation automatique
+func (ks *KeySet) Stop() {
+	if ks.stop != nil {
+		close(ks.stop)
+	}
+}
+
+func (ks *KeySet) generate(now time.Time) error {
+	var priv crypto.Signer
+	var err error
+	if ks.alg == AlgRS256 {
+		priv, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	} else {
+		priv, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	}
+	if err != nil {
+		return err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return err
+	}
+	kid := strconv.FormatInt(now.Unix(), 10) + "-" + randomKidSuffix()
+	path := filepath.Join(ks.dir, kid+".pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		return err
+	}
+	os.Chtimes(path, now, now)
+	ks.mu.Lock()
+	ks.keys = append([]*signingKey{{ID: kid, Created: now, Private: priv}}, ks.keys...)
+	ks.mu.Unlock()
+	return nil
+}
+
+// prune supprime les clés remplacées depuis plus de retain
+func (ks *KeySet) prune(now time.Time) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	signer := ks.signerIndexLocked(now)
+	kept := append([]*signingKey(nil), ks.keys[:signer+1]...)
+	for i := signer + 1; i < len(ks.keys); i++ {
+		// la clé i a cessé de signer quand la suivante (i-1) a commencé
+		retiredAt := ks.keys[i-1].Created.Add(ks.prepublish)
+		if now.Sub(retiredAt) <= ks.retain {
+			kept = append(kept, ks.keys[i])
+			continue
+		}
+		if err := os.Remove(filepath.Join(ks.dir, ks.keys[i].ID+".pem")); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	ks.keys = kept
+	return nil
+}
+
+// signerIndexLocked : index de la clé de signature (la plus récente publiée depuis prepublish,
+// ou la plus ancienne si aucune ne l'est encore)
+func (ks *KeySet) signerIndexLocked(now time.Time) int {
+	for i, k := range ks.keys {
+		if now.Sub(k.Created) >= ks.prepublish || i == len(ks.keys)-1 {
+			return i
+		}
+	}
+	return 0
+}
+
+// Sign signe les claims avec la clé de signature courante (en-tête kid)
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	if len(ks.keys) == 0 {
+		return "", errors.New("no jwt signing key")
+	}
+	k := ks.keys[ks.signerIndexLocked(time.Now())]
+	method := jwt.SigningMethod(jwt.SigningMethodRS256)
+	if ks.alg == AlgES256 {
+		method = jwt.SigningMethodES256
+	}
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = k.ID
+	return token.SignedString(k.Private)
+}
+
+// Keyfunc retourne la clé publique désignée par le kid du jeton
+func (ks *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	if token.Method.Alg() != ks.alg {
+		return nil, fmt.Errorf("%w %s", errBadAlgorithm, token.Method.Alg())
+	}
+	kid, _ := token.Header["kid"].(string)
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	for _, k := range ks.keys {
+		if k.ID == kid {
+			return k.Private.Public(), nil
+		}
+	}
+	return nil, fmt.Errorf("%w: kid %q", errUnknownKey, kid)
+}
+
+// JWKS retourne les clés publiques (publiées, actives et en fin de validité)
+func (ks *KeySet) JWKS() []JWK {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	out := make([]JWK, 0, len(ks.keys))
+	for _, k := range ks.keys {
+		jwk := JWK{Kid: k.ID, Use: "sig", Alg: ks.alg}
+		switch pub := k.Private.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = b64(pub.N.Bytes())
+			jwk.E = b64(big.NewInt(int64(pub.E)).Bytes())
+		case *ecdsa.PublicKey:
+			jwk.Kty, jwk.Crv = "EC", "P-256"
+			jwk.X = b64(pub.X.FillBytes(make([]byte, 32)))
+			jwk.Y = b64(pub.Y.FillBytes(make([]byte, 32)))
+		}
+		out = append(out, jwk)
+	}
+	return out
+}
+
+func readSigningKey(path string) (*signingKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM block", path)
+	}
+	var priv interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		priv, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		priv, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		priv, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	signer, ok := priv.(crypto.Signer)
+	if !ok || keyAlg(signer) == "" {
+		return nil, fmt.Errorf("%s: unsupported key type", path)
+	}
+	kid := strings.TrimSuffix(filepath.Base(path), ".pem")
+	// kid "<unix>-<8 hex>" pour les clés générées, date du fichier sinon (2024-key.pem
+	// n'est pas une clé de 1970)
+	created := time.Time{}
+	if m := generatedKidPattern.FindStringSubmatch(kid); m != nil {
+		sec, _ := strconv.ParseInt(m[1], 10, 64)
+		created = time.Unix(sec, 0)
+	} else if fi, err := os.Stat(path); err == nil {
+		created = fi.ModTime()
+	}
+	return &signingKey{ID: kid, Created: created, Private: signer}, nil
+}
+
+func keyAlg(k crypto.Signer) string {
+	switch pub := k.Public().(type) {
+	case *rsa.PublicKey:
+		return AlgRS256
+	case *ecdsa.PublicKey:
+		if pub.Curve == elliptic.P256() {
+			return AlgES256
+		}
+	}
+	return ""
+}
+
+// generatedKidPattern : kid des clés générées par generate (secondes unix, suffixe aléatoire)
+var generatedKidPattern = regexp.MustCompile(`^(\d{10})-[0-9a-f]{8}$`)
+
+func randomKidSuffix() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return fmt.Sprintf("%x", b)
+}
+
+func b64(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestKeySet_RotationAndJWKS(t *testing.T) {
+	now := time.Now()
+	ks, err := NewKeySet(AlgES256, t.TempDir(), 24*time.Hour, time.Hour, 30*time.Minute)
+	if err != nil {
+		t.Fatalf("NewKeySet failed: %v", err)
+	}
+	SetKeySet(ks)
+	defer SetKeySet(nil)
+
+	if err := ks.Rotate(now.Add(-25 * time.Hour)); err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	oldToken, err := GenerateJWT("", "alice", false, 10)
+	if err != nil {
+		t.Fatalf("GenerateJWT failed: %v", err)
+	}
+	// fin de période : nouvelle clé publiée, l'ancienne signe encore pendant prepublish
+	if err := ks.Rotate(now.Add(-10 * time.Minute)); err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	jwks := ks.JWKS()
+	if len(jwks) != 2 || jwks[0].Kty != "EC" || jwks[0].Crv != "P-256" || jwks[0].X == "" {
+		t.Fatalf("Expected 2 EC keys in JWKS, got %+v", jwks)
+	}
+	token, _ := GenerateJWT("", "alice", false, 10)
+	req := httptest.NewRequest("GET", "/", nil)
+	for _, tok := range []string{oldToken, token} {
+		req.Header.Set("Authorization", "Bearer "+tok)
+		if user, _, err := ExtractUserAndAdminFromJWT(req, ""); err != nil || user != "alice" {
+			t.Errorf("Expected token to verify during overlap, got %q (%v)", user, err)
+		}
+	}
+
+	// la nouvelle clé signe depuis plus de retain : l'ancienne est retirée
+	if err := ks.Rotate(now.Add(2 * time.Hour)); err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	if jwks := ks.JWKS(); len(jwks) != 1 {
+		t.Fatalf("Expected 1 key after pruning, got %+v", jwks)
+	}
+	req.Header.Set("Authorization", "Bearer "+oldToken)
+	if _, _, err := ExtractUserAndAdminFromJWT(req, ""); err == nil {
+		t.Error("Expected token signed by a pruned key to be rejected")
+	}
+}
+
+func TestKeySet_RS256(t *testing.T) {
+	dir := t.TempDir()
+	ks, err := NewKeySet(AlgRS256, dir, 0, time.Hour, time.Hour)
+	if err != nil {
+		t.Fatalf("NewKeySet failed: %v", err)
+	}
+	if err := ks.Rotate(time.Now()); err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	SetKeySet(ks)
+	defer SetKeySet(nil)
+
+	token, err := GenerateJWT("", "bob", true, 10)
+	if err != nil {
+		t.Fatalf("GenerateJWT failed: %v", err)
+	}
+	// un autre processus relit les mêmes clés
+	other, _ := NewKeySet(AlgRS256, dir, 0, time.Hour, time.Hour)
+	SetKeySet(other)
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if user, admin, err := ExtractUserAndAdminFromJWT(req, ""); err != nil || user != "bob" || !admin {
+		t.Errorf("Expected bob/admin, got %q %v (%v)", user, admin, err)
+	}
+	if jwks := other.JWKS(); len(jwks) != 1 || jwks[0].Kty != "RSA" || jwks[0].E != "AQAB" {
+		t.Errorf("Expected one RSA key with e=AQAB, got %+v", jwks)
+	}
+
+	// un jeton HS256 n'est plus accepté
+	SetKeySet(nil)
+	hs, _ := GenerateJWT("secret", "bob", true, 10)
+	SetKeySet(other)
+	req.Header.Set("Authorization", "Bearer "+hs)
+	if _, _, err := ExtractUserAndAdminFromJWT(req, "secret"); err == nil {
+		t.Error("Expected HS256 token to be rejected with an asymmetric key set")
+	}
+}
+
+func TestReadSigningKey_CreationDate(t *testing.T) {
+	dir := t.TempDir()
+	ks, err := NewKeySet(AlgES256, dir, 0, time.Hour, time.Hour)
+	if err != nil {
+		t.Fatalf("NewKeySet failed: %v", err)
+	}
+	generatedAt := time.Date(2024, 3, 18, 7, 0, 0, 0, time.UTC)
+	if err := ks.generate(generatedAt); err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+	generated := ks.keys[0]
+	// clé ajoutée à la main, datée par son fichier et non par son préfixe numérique
+	data, _ := os.ReadFile(filepath.Join(dir, generated.ID+".pem"))
+	added := filepath.Join(dir, "2024-key.pem")
+	os.WriteFile(added, data, 0600)
+	addedAt := generatedAt.Add(time.Hour)
+	os.Chtimes(added, addedAt, addedAt)
+
+	if err := ks.load(); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if len(ks.keys) != 2 || ks.keys[0].ID != "2024-key" || !ks.keys[0].Created.Equal(addedAt) {
+		t.Fatalf("Expected 2024-key dated by its file as the newest key, got %+v", ks.keys)
+	}
+	if ks.keys[1].ID != generated.ID || !ks.keys[1].Created.Equal(generatedAt) {
+		t.Errorf("Expected the generated key dated by its kid, got %+v", ks.keys[1])
+	}
+}
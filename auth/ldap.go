@@ -0,0 +1,291 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"druid-insight/config"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+const (
+	defaultLDAPCacheTTL     = 5 * time.Minute
+	defaultLDAPTimeout      = 10 * time.Second
+	defaultLDAPGroupAttr    = "memberOf"
+	defaultLDAPUserFilter   = "(uid={username})"
+	ldapUsernamePlaceholder = "{username}"
+	ldapDNPlaceholder       = "{dn}"
+)
+
+var (
+	ErrLDAPUserNotFound   = errors.New("ldap: user not found")
+	ErrLDAPBadCredentials = errors.New("ldap: invalid credentials")
+)
+
+// LDAPUser : utilisateur de l'annuaire et droits déduits de ses groupes
+type LDAPUser struct {
+	Username string
+	DN       string
+	Groups   []string
+	Team     string
+	Admin    bool
+}
+
+type ldapCacheEntry struct {
+	user    *LDAPUser
+	expires time.Time
+}
+
+// LDAPDirectory authentifie les utilisateurs (recherche puis bind avec leur mot de passe)
+// et résout groupes, équipe et filtres d'accès, avec un cache des recherches.
+type LDAPDirectory struct {
+	cfg     LDAPConfig
+	tls     *tls.Config
+	ttl     time.Duration
+	timeout time.Duration
+
+	mu    sync.Mutex
+	cache map[string]ldapCacheEntry
+}
+
+// Annuaire actif (auth.user_backend: ldap), remplacé au rechargement de la configuration
+var ldapDirectory atomic.Pointer[LDAPDirectory]
+
+// SetLDAPDirectory active l'annuaire pour GetAccessFilters et GetUserTeam
+func SetLDAPDirectory(d *LDAPDirectory) { ldapDirectory.Store(d) }
+
+// LDAP retourne l'annuaire actif (nil hors backend ldap)
+func LDAP() *LDAPDirectory { return ldapDirectory.Load() }
+
+// NewLDAPDirectory prépare la connexion à l'annuaire (TLS, cache)
+func NewLDAPDirectory(c LDAPConfig) (*LDAPDirectory, error) {
+	if c.URL == "" {
+		return nil, errors.New("ldap: url is required")
+	}
+	if c.UserFilter == "" {
+		c.UserFilter = defaultLDAPUserFilter
+	}
+	if c.GroupAttribute == "" {
+		c.GroupAttribute = defaultLDAPGroupAttr
+	}
+	tlsCfg := &tls.Config{InsecureSkipVerify: c.InsecureSkipVerify}
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("ldap ca_file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("ldap ca_file: no certificate found")
+		}
+		tlsCfg.RootCAs = pool
+	}
+	d := &LDAPDirectory{
+		cfg:     c,
+		tls:     tlsCfg,
+		ttl:     time.Duration(c.CacheTTLSeconds) * time.Second,
+		timeout: time.Duration(c.TimeoutSeconds) * time.Second,
+		cache:   map[string]ldapCacheEntry{},
+	}
+	if d.ttl <= 0 {
+		d.ttl = defaultLDAPCacheTTL
+	}
+	if d.timeout <= 0 {
+		d.timeout = defaultLDAPTimeout
+	}
+	return d, nil
+}
+
+// dial ouvre une connexion (LDAPS ou StartTLS selon la configuration) liée au compte de service
+func (d *LDAPDirectory) dial() (*ldap.Conn, error) {
+	conn, err := ldap.DialURL(d.cfg.URL, ldap.DialWithTLSConfig(d.tls))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(d.timeout)
+	if d.cfg.StartTLS && strings.HasPrefix(strings.ToLower(d.cfg.URL), "ldap://") {
+		if err := conn.StartTLS(d.tls); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if d.cfg.BindDN != "" {
+		err = conn.Bind(d.cfg.BindDN, d.cfg.BindPassword)
+	} else {
+		err = conn.UnauthenticatedBind("")
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("ldap service bind: %w", err)
+	}
+	return conn, nil
+}
+
+// Authenticate vérifie le mot de passe par un bind avec le DN de l'utilisateur. Le résultat
+// de la recherche est mis en cache ; le mot de passe est vérifié à chaque appel.
+func (d *LDAPDirectory) Authenticate(username, password string) (*LDAPUser, error) {
+	// un bind avec mot de passe vide est un bind anonyme qui « réussit »
+	if username == "" || password == "" {
+		return nil, ErrLDAPBadCredentials
+	}
+	conn, err := d.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	u, err := d.search(conn, username)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Bind(u.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrLDAPBadCredentials
+		}
+		return nil, err
+	}
+	d.store(u)
+	return u, nil
+}
+
+// Lookup retourne l'utilisateur depuis le cache ou l'annuaire. Si l'annuaire est
+// injoignable, une entrée expirée du cache est encore utilisée.
+func (d *LDAPDirectory) Lookup(username string) (*LDAPUser, error) {
+	if d == nil {
+		return nil, errors.New("ldap: directory not configured")
+	}
+	d.mu.Lock()
+	e, cached := d.cache[username]
+	d.mu.Unlock()
+	if cached && time.Now().Before(e.expires) {
+		return e.user, nil
+	}
+	u, err := d.lookup(username)
+	if err != nil {
+		if cached && !errors.Is(err, ErrLDAPUserNotFound) {
+			log.Printf("ldap lookup %s failed, using cached entry: %v", username, err)
+			return e.user, nil
+		}
+		if errors.Is(err, ErrLDAPUserNotFound) {
+			d.Invalidate(username)
+		}
+		return nil, err
+	}
+	d.store(u)
+	return u, nil
+}
+
+func (d *LDAPDirectory) lookup(username string) (*LDAPUser, error) {
+	conn, err := d.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return d.search(conn, username)
+}
+
+// Invalidate vide le cache (tous les utilisateurs si username est vide)
+func (d *LDAPDirectory) Invalidate(username string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if username == "" {
+		d.cache = map[string]ldapCacheEntry{}
+		return
+	}
+	delete(d.cache, username)
+}
+
+func (d *LDAPDirectory) store(u *LDAPUser) {
+	d.mu.Lock()
+	d.cache[u.Username] = ldapCacheEntry{user: u, expires: time.Now().Add(d.ttl)}
+	d.mu.Unlock()
+}
+
+// search trouve l'entrée de l'utilisateur puis ses groupes
+func (d *LDAPDirectory) search(conn *ldap.Conn, username string) (*LDAPUser, error) {
+	attrs := []string{"dn", d.cfg.GroupAttribute}
+	if d.cfg.TeamAttribute != "" {
+		attrs = append(attrs, d.cfg.TeamAttribute)
+	}
+	filter := strings.ReplaceAll(d.cfg.UserFilter, ldapUsernamePlaceholder, ldap.EscapeFilter(username))
+	res, err := conn.Search(ldap.NewSearchRequest(d.cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, int(d.timeout.Seconds()), false, filter, attrs, nil))
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+			return nil, ErrLDAPUserNotFound
+		}
+		return nil, err
+	}
+	if len(res.Entries) != 1 {
+		return nil, ErrLDAPUserNotFound
+	}
+	entry := res.Entries[0]
+	u := &LDAPUser{Username: username, DN: entry.DN, Groups: entry.GetAttributeValues(d.cfg.GroupAttribute)}
+	if d.cfg.TeamAttribute != "" {
+		u.Team = entry.GetAttributeValue(d.cfg.TeamAttribute)
+	}
+	if d.cfg.GroupFilter != "" {
+		base := d.cfg.GroupBaseDN
+		if base == "" {
+			base = d.cfg.BaseDN
+		}
+		gfilter := strings.ReplaceAll(d.cfg.GroupFilter, ldapDNPlaceholder, ldap.EscapeFilter(entry.DN))
+		gfilter = strings.ReplaceAll(gfilter, ldapUsernamePlaceholder, ldap.EscapeFilter(username))
+		gres, err := conn.Search(ldap.NewSearchRequest(base, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+			0, int(d.timeout.Seconds()), false, gfilter, []string{"dn"}, nil))
+		if err != nil {
+			return nil, fmt.Errorf("ldap group search: %w", err)
+		}
+		for _, g := range gres.Entries {
+			u.Groups = append(u.Groups, g.DN)
+		}
+	}
+	for _, g := range d.cfg.AdminGroups {
+		if u.InGroup(g) {
+			u.Admin = true
+			break
+		}
+	}
+	return u, nil
+}
+
+// InGroup indique si l'utilisateur appartient au groupe (DN comparés sans tenir compte de la casse)
+func (u *LDAPUser) InGroup(group string) bool {
+	want := normalizeDN(group)
+	for _, g := range u.Groups {
+		if normalizeDN(g) == want {
+			return true
+		}
+	}
+	return false
+}
+
+// AccessFilters retourne les valeurs autorisées par dimension pour une datasource,
+// union des access_groups de l'utilisateur (u nil = utilisateur non résolu)
+func (d *LDAPDirectory) AccessFilters(u *LDAPUser, datasource string, druidCfg *config.DruidConfig) map[string][]string {
+	var member func(string) bool
+	if u != nil {
+		member = u.InGroup
+	}
+	return groupAccessFilters(d.cfg.AccessGroups, member, datasource, druidCfg)
+}
+
+func normalizeDN(dn string) string {
+	if parsed, err := ldap.ParseDN(dn); err == nil {
+		parts := make([]string, 0, len(parsed.RDNs))
+		for _, rdn := range parsed.RDNs {
+			for _, a := range rdn.Attributes {
+				parts = append(parts, strings.ToLower(a.Type)+"="+strings.ToLower(a.Value))
+			}
+		}
+		return strings.Join(parts, ",")
+	}
+	return strings.ToLower(strings.ReplaceAll(dn, " ", ""))
+}
@@ -0,0 +1,236 @@
+package auth
+
+import (
+	"druid-insight/config"
+	"errors"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+type fakeLDAPEntry struct {
+	dn       string
+	password string
+	attrs    map[string][]string
+}
+
+// fakeLDAPServer : annuaire minimal (bind simple, recherche par égalité) pour les tests
+type fakeLDAPServer struct {
+	ln       net.Listener
+	entries  []fakeLDAPEntry
+	searches int32
+}
+
+func newFakeLDAPServer(t *testing.T, entries []fakeLDAPEntry) *fakeLDAPServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	s := &fakeLDAPServer{ln: ln, entries: entries}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+func (s *fakeLDAPServer) URL() string { return "ldap://" + s.ln.Addr().String() }
+
+func (s *fakeLDAPServer) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		id := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			dn := op.Children[1].Data.String()
+			password := op.Children[2].Data.String()
+			code := int64(ldap.LDAPResultInvalidCredentials)
+			if dn == "" && password == "" {
+				code = ldap.LDAPResultSuccess
+			}
+			for _, e := range s.entries {
+				if e.dn == dn && e.password != "" && e.password == password {
+					code = ldap.LDAPResultSuccess
+				}
+			}
+			conn.Write(ldapResponse(id, ldap.ApplicationBindResponse, code).Bytes())
+		case ldap.ApplicationSearchRequest:
+			atomic.AddInt32(&s.searches, 1)
+			filter, _ := ldap.DecompileFilter(op.Children[6])
+			for _, e := range s.entries {
+				if e.matches(filter) {
+					conn.Write(ldapEntry(id, e).Bytes())
+				}
+			}
+			conn.Write(ldapResponse(id, ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess).Bytes())
+		case ldap.ApplicationUnbindRequest:
+			return
+		}
+	}
+}
+
+// matches : une des valeurs de l'entrée apparaît comme égalité "(attr=valeur)" dans le filtre
+func (e fakeLDAPEntry) matches(filter string) bool {
+	filter = strings.ToLower(filter)
+	for attr, values := range e.attrs {
+		for _, v := range values {
+			if strings.Contains(filter, "("+strings.ToLower(attr+"="+v)+")") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func ldapEnvelope(id int64, op *ber.Packet) *ber.Packet {
+	p := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	p.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "MessageID"))
+	p.AppendChild(op)
+	return p
+}
+
+func ldapResponse(id int64, tag ber.Tag, code int64) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Response")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "resultCode"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "diagnosticMessage"))
+	return ldapEnvelope(id, op)
+}
+
+func ldapEntry(id int64, e fakeLDAPEntry) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Entry")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.dn, "objectName"))
+	attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attributes")
+	for name, values := range e.attrs {
+		attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attribute")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "type"))
+		vals := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "vals")
+		for _, v := range values {
+			vals.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "val"))
+		}
+		attr.AppendChild(vals)
+		attrs.AppendChild(attr)
+	}
+	op.AppendChild(attrs)
+	return ldapEnvelope(id, op)
+}
+
+func testLDAP(t *testing.T) (*fakeLDAPServer, LDAPConfig) {
+	srv := newFakeLDAPServer(t, []fakeLDAPEntry{
+		{dn: "cn=svc,dc=example,dc=com", password: "svc-pw"},
+		{dn: "uid=alice,ou=people,dc=example,dc=com", password: "alice-pw", attrs: map[string][]string{
+			"uid": {"alice"}, "memberOf": {"CN=Insight-Admins,OU=Groups,DC=example,DC=com"}, "department": {"finance"},
+		}},
+		{dn: "uid=bob,ou=people,dc=example,dc=com", password: "bob-pw", attrs: map[string][]string{
+			"uid": {"bob"}, "memberOf": {"cn=sales-fr,ou=groups,dc=example,dc=com", "cn=sales-de,ou=groups,dc=example,dc=com"},
+		}},
+	})
+	return srv, LDAPConfig{
+		URL:           srv.URL(),
+		BindDN:        "cn=svc,dc=example,dc=com",
+		BindPassword:  "svc-pw",
+		BaseDN:        "dc=example,dc=com",
+		UserFilter:    "(&(objectClass=person)(uid={username}))",
+		TeamAttribute: "department",
+		AdminGroups:   []string{"cn=insight-admins,ou=groups,dc=example,dc=com"},
+		AccessGroups: map[string]map[string]map[string][]string{
+			"cn=sales-fr,ou=groups,dc=example,dc=com": {"myreport": {"country": {"FR"}}},
+			"cn=sales-de,ou=groups,dc=example,dc=com": {"myreport": {"country": {"DE"}, "unknown": {"x"}}},
+		},
+	}
+}
+
+func TestLDAP_Authenticate(t *testing.T) {
+	srv, cfg := testLDAP(t)
+	d, err := NewLDAPDirectory(cfg)
+	if err != nil {
+		t.Fatalf("NewLDAPDirectory failed: %v", err)
+	}
+	u, err := d.Authenticate("alice", "alice-pw")
+	if err != nil {
+		t.Fatalf("Authenticate failed: %v", err)
+	}
+	if !u.Admin || u.Team != "finance" || u.DN != "uid=alice,ou=people,dc=example,dc=com" {
+		t.Errorf("Expected admin alice in finance, got %+v", u)
+	}
+	if _, err := d.Authenticate("alice", "wrong"); !errors.Is(err, ErrLDAPBadCredentials) {
+		t.Errorf("Expected ErrLDAPBadCredentials, got %v", err)
+	}
+	if _, err := d.Authenticate("alice", ""); !errors.Is(err, ErrLDAPBadCredentials) {
+		t.Errorf("Expected empty password to be refused, got %v", err)
+	}
+	if _, err := d.Authenticate("nobody", "x"); !errors.Is(err, ErrLDAPUserNotFound) {
+		t.Errorf("Expected ErrLDAPUserNotFound, got %v", err)
+	}
+
+	// la recherche de l'authentification est mise en cache
+	before := atomic.LoadInt32(&srv.searches)
+	if u, err := d.Lookup("alice"); err != nil || !u.Admin {
+		t.Errorf("Expected cached alice, got %+v (%v)", u, err)
+	}
+	if n := atomic.LoadInt32(&srv.searches); n != before {
+		t.Errorf("Expected Lookup to hit the cache, got %d new searches", n-before)
+	}
+}
+
+func TestLDAP_AccessFilters(t *testing.T) {
+	_, cfg := testLDAP(t)
+	d, _ := NewLDAPDirectory(cfg)
+	SetLDAPDirectory(d)
+	defer SetLDAPDirectory(nil)
+
+	druidCfg := &config.DruidConfig{Datasources: map[string]config.DruidDatasourceSchema{
+		"myreport": {Dimensions: map[string]config.DruidField{"country": {Druid: "country"}}},
+	}}
+	authCfg := &Config{}
+	authCfg.Auth.UserBackend = "ldap"
+
+	filters := GetAccessFilters("bob", false, "myreport", druidCfg, nil, authCfg)
+	if len(filters) != 1 || len(filters["country"]) != 2 {
+		t.Errorf("Expected country [FR DE] for bob, got %v", filters)
+	}
+	if got := GetAccessFilters("alice", false, "myreport", druidCfg, nil, authCfg); len(got) != 0 {
+		t.Errorf("Expected no restriction for alice, got %v", got)
+	}
+	// utilisateur introuvable : les dimensions restreintes ne laissent rien passer
+	got := GetAccessFilters("nobody", false, "myreport", druidCfg, nil, authCfg)
+	if len(got["country"]) != 1 || got["country"][0] != groupDenyValue {
+		t.Errorf("Expected deny filter for unresolved user, got %v", got)
+	}
+	if team := GetUserTeam("alice", nil, authCfg); team != "finance" {
+		t.Errorf("Expected team finance, got %q", team)
+	}
+}
+
+func TestLDAP_GroupFilter(t *testing.T) {
+	srv := newFakeLDAPServer(t, []fakeLDAPEntry{
+		{dn: "uid=carol,ou=people,dc=example,dc=com", password: "carol-pw", attrs: map[string][]string{"uid": {"carol"}}},
+		{dn: "cn=admins,ou=groups,dc=example,dc=com", attrs: map[string][]string{"member": {"uid=carol,ou=people,dc=example,dc=com"}}},
+	})
+	d, _ := NewLDAPDirectory(LDAPConfig{
+		URL:         srv.URL(),
+		BaseDN:      "dc=example,dc=com",
+		GroupBaseDN: "ou=groups,dc=example,dc=com",
+		GroupFilter: "(member={dn})",
+		AdminGroups: []string{"cn=admins,ou=groups,dc=example,dc=com"},
+	})
+	u, err := d.Authenticate("carol", "carol-pw")
+	if err != nil || !u.Admin || len(u.Groups) != 1 {
+		t.Errorf("Expected carol admin through group search, got %+v (%v)", u, err)
+	}
+}
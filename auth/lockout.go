@@ -0,0 +1,249 @@
+package auth
+
+import (
+	"druid-insight/store"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultLoginWindow        = 15 * time.Minute
+	defaultMaxUserFailures    = 5
+	defaultMaxIPFailures      = 20
+	defaultLockout            = time.Minute
+	defaultMaxLockout         = time.Hour
+	lockoutLevelReset         = 24 * time.Hour   // après un jour sans verrouillage, la durée repart du minimum
+	lockoutsReloadInterval    = 30 * time.Second // déverrouillages par userctl, autres instances
+	loginFailuresPruneEvery   = time.Minute
+	lockoutUserPrefix         = "user:"
+	lockoutIPPrefix           = "ip:"
+	maxTrackedLoginFailureKey = 100000 // borne mémoire face à des noms d'utilisateur aléatoires
+)
+
+// LoginLimiter compte les échecs de connexion par utilisateur et par adresse IP sur une fenêtre
+// glissante et verrouille temporairement au-delà du seuil, avec une durée qui double à chaque
+// récidive. Les verrouillages sont stockés pour être partagés et levés par userctl.
+type LoginLimiter struct {
+	st         *store.Store
+	window     time.Duration
+	maxUser    int
+	maxIP      int
+	lockout    time.Duration
+	maxLockout time.Duration
+	now        func() time.Time
+
+	mu       sync.Mutex
+	failures map[string][]time.Time
+	locks    map[string]*store.LoginLockout
+	loadedAt time.Time
+	prunedAt time.Time
+}
+
+// NewLoginLimiter charge les verrouillages en cours ; nil si la protection est désactivée
+func NewLoginLimiter(c LoginProtectionConfig, st *store.Store) (*LoginLimiter, error) {
+	if c.Disabled {
+		return nil, nil
+	}
+	l := &LoginLimiter{
+		st:         st,
+		window:     secondsOr(c.WindowSeconds, defaultLoginWindow),
+		maxUser:    c.MaxUserFailures,
+		maxIP:      c.MaxIPFailures,
+		lockout:    secondsOr(c.LockoutSeconds, defaultLockout),
+		maxLockout: secondsOr(c.MaxLockoutSeconds, defaultMaxLockout),
+		now:        time.Now,
+		failures:   map[string][]time.Time{},
+	}
+	if l.maxUser <= 0 {
+		l.maxUser = defaultMaxUserFailures
+	}
+	if l.maxIP <= 0 {
+		l.maxIP = defaultMaxIPFailures
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.reload(l.now()); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func secondsOr(s int, def time.Duration) time.Duration {
+	if s <= 0 {
+		return def
+	}
+	return time.Duration(s) * time.Second
+}
+
+// reload relit les verrouillages et supprime ceux qui ne comptent plus (appelé sous l.mu)
+func (l *LoginLimiter) reload(now time.Time) error {
+	list, err := l.st.ListLoginLockouts(nil)
+	if err != nil {
+		return err
+	}
+	l.locks = make(map[string]*store.LoginLockout, len(list))
+	for _, lock := range list {
+		if now.Sub(lock.LockedUntil) > lockoutLevelReset {
+			l.st.DeleteLoginLockout(lock.Key)
+			continue
+		}
+		l.locks[lock.Key] = lock
+	}
+	l.loadedAt = now
+	return nil
+}
+
+// refresh relit les verrouillages si nécessaire et élague les échecs hors fenêtre (appelé sous l.mu)
+func (l *LoginLimiter) refresh(now time.Time) {
+	if now.Sub(l.loadedAt) >= lockoutsReloadInterval {
+		l.reload(now) // en cas d'échec on garde l'état précédent
+	}
+	if now.Sub(l.prunedAt) < loginFailuresPruneEvery {
+		return
+	}
+	l.prunedAt = now
+	for key, times := range l.failures {
+		if kept := l.inWindow(times, now); len(kept) > 0 {
+			l.failures[key] = kept
+		} else {
+			delete(l.failures, key)
+		}
+	}
+}
+
+func (l *LoginLimiter) inWindow(times []time.Time, now time.Time) []time.Time {
+	i := 0
+	for i < len(times) && now.Sub(times[i]) >= l.window {
+		i++
+	}
+	return times[i:]
+}
+
+func lockoutKeys(username, ip string) []string {
+	var keys []string
+	if username != "" {
+		keys = append(keys, LockoutKey(username, ""))
+	}
+	// sans adresse connue, LockoutKey("", "") serait la clé "user:" partagée par tous
+	if ip != "" {
+		keys = append(keys, LockoutKey("", ip))
+	}
+	return keys
+}
+
+// Check indique si l'utilisateur ou l'adresse est verrouillé, et jusqu'à quand
+func (l *LoginLimiter) Check(username, ip string) (time.Time, bool) {
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refresh(now)
+	var until time.Time
+	for _, key := range lockoutKeys(username, ip) {
+		if lock, ok := l.locks[key]; ok && now.Before(lock.LockedUntil) && lock.LockedUntil.After(until) {
+			until = lock.LockedUntil
+		}
+	}
+	return until, !until.IsZero()
+}
+
+// Failure enregistre un échec et retourne les verrouillages qu'il déclenche
+func (l *LoginLimiter) Failure(username, ip string) []*store.LoginLockout {
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refresh(now)
+	var locked []*store.LoginLockout
+	for _, key := range lockoutKeys(username, ip) {
+		max := l.maxUser
+		if strings.HasPrefix(key, lockoutIPPrefix) {
+			max = l.maxIP
+		}
+		times := l.inWindow(l.failures[key], now)
+		if len(times) == 0 && len(l.failures) >= maxTrackedLoginFailureKey {
+			continue
+		}
+		times = append(times, now)
+		if len(times) < max {
+			l.failures[key] = times
+			continue
+		}
+		delete(l.failures, key)
+		lock := &store.LoginLockout{Key: key, Level: 1, Failures: len(times), LockedAt: now}
+		if prev, ok := l.locks[key]; ok && now.Sub(prev.LockedUntil) <= lockoutLevelReset {
+			lock.Level = prev.Level + 1
+		}
+		d := l.lockout
+		for n := 1; n < lock.Level && d < l.maxLockout; n++ {
+			d *= 2
+		}
+		if d > l.maxLockout {
+			d = l.maxLockout
+		}
+		lock.LockedUntil = now.Add(d)
+		l.locks[key] = lock
+		l.st.PutLoginLockout(lock)
+		locked = append(locked, lock)
+	}
+	return locked
+}
+
+// Success efface les échecs de l'utilisateur ; ceux de l'adresse restent comptés pour
+// qu'une connexion valide ne remette pas à zéro une attaque depuis la même adresse
+func (l *LoginLimiter) Success(username string) {
+	key := LockoutKey(username, "")
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.failures, key)
+	if _, ok := l.locks[key]; ok {
+		delete(l.locks, key)
+		l.st.DeleteLoginLockout(key)
+	}
+}
+
+// Unlock lève le verrouillage d'un utilisateur ou d'une adresse et oublie ses échecs
+func (l *LoginLimiter) Unlock(key string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.failures, key)
+	delete(l.locks, key)
+	return UnlockLogin(l.st, key)
+}
+
+// UnlockLogin supprime un verrouillage stocké (userctl) ; les serveurs le voient sous 30 secondes
+func UnlockLogin(st *store.Store, key string) error {
+	err := st.DeleteLoginLockout(key)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// LockoutKey retourne la clé de verrouillage d'un utilisateur (ip vide) ou d'une adresse
+func LockoutKey(username, ip string) string {
+	if ip != "" {
+		return lockoutIPPrefix + ip
+	}
+	return lockoutUserPrefix + strings.ToLower(username)
+}
+
+// ClientIP retourne l'adresse du client, lue dans X-Forwarded-For derrière un proxy de confiance :
+// dernière entrée, celle ajoutée par le proxy (les précédentes sont fournies par le client)
+func ClientIP(r *http.Request, trustForwardedFor bool) string {
+	if trustForwardedFor {
+		if values := r.Header.Values("X-Forwarded-For"); len(values) > 0 {
+			entries := strings.Split(values[len(values)-1], ",")
+			if ip := strings.TrimSpace(entries[len(entries)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,164 @@
+package auth
+
+import (
+	"druid-insight/store"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func testLoginLimiter(t *testing.T, now *time.Time) (*LoginLimiter, *store.Store) {
+	st, err := store.Open("file", "", t.TempDir())
+	if err != nil {
+		t.Fatalf("store.Open failed: %v", err)
+	}
+	l, err := NewLoginLimiter(LoginProtectionConfig{MaxUserFailures: 3, MaxIPFailures: 5, WindowSeconds: 60, LockoutSeconds: 10, MaxLockoutSeconds: 30}, st)
+	if err != nil {
+		t.Fatalf("NewLoginLimiter failed: %v", err)
+	}
+	l.now = func() time.Time { return *now }
+	return l, st
+}
+
+func TestLoginLimiter_UserLockoutAndBackoff(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	l, st := testLoginLimiter(t, &now)
+
+	l.Failure("Bob", "10.0.0.1")
+	l.Failure("bob", "10.0.0.2")
+	if _, locked := l.Check("bob", "10.0.0.3"); locked {
+		t.Fatal("Expected no lockout below the threshold")
+	}
+	locks := l.Failure("bob", "10.0.0.3")
+	if len(locks) != 1 || locks[0].Key != "user:bob" || locks[0].Level != 1 {
+		t.Fatalf("Expected a level 1 user lockout, got %+v", locks)
+	}
+	if until, locked := l.Check("BOB", "10.0.0.9"); !locked || !until.Equal(now.Add(10*time.Second)) {
+		t.Errorf("Expected bob locked for 10s, got %v %v", until, locked)
+	}
+	if _, err := st.GetLoginLockout("user:bob"); err != nil {
+		t.Errorf("Expected the lockout to be stored: %v", err)
+	}
+
+	// récidives : 20s puis plafond à 30s
+	for _, want := range []time.Duration{20 * time.Second, 30 * time.Second, 30 * time.Second} {
+		now = now.Add(time.Minute)
+		var locks []*store.LoginLockout
+		for i := 0; i < 3; i++ {
+			locks = l.Failure("bob", "10.0.0.4")
+		}
+		if len(locks) != 1 || locks[0].LockedUntil.Sub(now) != want {
+			t.Errorf("Expected a %v lockout, got %+v", want, locks)
+		}
+	}
+
+	// succès : compteur et niveau remis à zéro
+	now = now.Add(time.Minute)
+	l.Success("bob")
+	if _, err := st.GetLoginLockout("user:bob"); err == nil {
+		t.Error("Expected the lockout to be cleared on success")
+	}
+	for i := 0; i < 3; i++ {
+		locks = l.Failure("bob", "10.0.0.4")
+	}
+	if len(locks) != 1 || locks[0].Level != 1 {
+		t.Errorf("Expected level reset after success, got %+v", locks)
+	}
+}
+
+func TestLoginLimiter_WindowAndIP(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	l, _ := testLoginLimiter(t, &now)
+
+	// échecs espacés de plus que la fenêtre : jamais verrouillé
+	for i := 0; i < 5; i++ {
+		if locks := l.Failure("alice", "10.0.0.1"); i < 4 && len(locks) != 0 {
+			t.Fatalf("Unexpected lockout %+v", locks)
+		}
+		now = now.Add(31 * time.Second)
+	}
+	// adresse IP : 5 échecs sur des comptes différents
+	now = now.Add(time.Hour)
+	var locks []*store.LoginLockout
+	for _, u := range []string{"a", "b", "c", "d", "e"} {
+		locks = l.Failure(u, "10.0.0.2")
+	}
+	if len(locks) != 1 || locks[0].Key != "ip:10.0.0.2" {
+		t.Fatalf("Expected an IP lockout, got %+v", locks)
+	}
+	if _, locked := l.Check("someone", "10.0.0.2"); !locked {
+		t.Error("Expected every user locked from 10.0.0.2")
+	}
+	// une connexion réussie ne lève pas le verrouillage de l'adresse
+	l.Success("a")
+	if _, locked := l.Check("a", "10.0.0.2"); !locked {
+		t.Error("Expected the IP lockout to survive a success")
+	}
+}
+
+func TestLoginLimiter_UnlockFromStore(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	l, st := testLoginLimiter(t, &now)
+	for i := 0; i < 3; i++ {
+		l.Failure("bob", "")
+	}
+	// userctl unlock : vu au rechargement suivant
+	if err := UnlockLogin(st, LockoutKey("bob", "")); err != nil {
+		t.Fatalf("UnlockLogin failed: %v", err)
+	}
+	if _, locked := l.Check("bob", ""); !locked {
+		t.Error("Expected the in-memory lockout until the next reload")
+	}
+	now = now.Add(lockoutsReloadInterval)
+	if _, locked := l.Check("bob", ""); locked {
+		t.Error("Expected the lockout lifted after reload")
+	}
+	if err := UnlockLogin(st, LockoutKey("nobody", "")); err != nil {
+		t.Errorf("Expected unlocking an unknown key to succeed, got %v", err)
+	}
+	if l, _ := NewLoginLimiter(LoginProtectionConfig{Disabled: true}, st); l != nil {
+		t.Error("Expected no limiter when disabled")
+	}
+}
+
+func TestLoginLimiter_UnknownAddress(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	l, st := testLoginLimiter(t, &now)
+	// sans adresse, seuls les comptes sont comptés : aucune clé commune à tous
+	var locks []*store.LoginLockout
+	for _, u := range []string{"a", "b", "c", "d", "e", "f"} {
+		locks = append(locks, l.Failure(u, "")...)
+	}
+	if len(locks) != 0 {
+		t.Fatalf("Expected no lockout, got %+v", locks)
+	}
+	if _, locked := l.Check("g", ""); locked {
+		t.Error("Expected other users not to be locked")
+	}
+	if _, err := st.GetLoginLockout("user:"); err == nil {
+		t.Error("Expected no shared user: lockout")
+	}
+	if keys := lockoutKeys("bob", ""); len(keys) != 1 || keys[0] != "user:bob" {
+		t.Errorf("Expected only the user key, got %v", keys)
+	}
+	if keys := lockoutKeys("", "10.0.0.1"); len(keys) != 1 || keys[0] != "ip:10.0.0.1" {
+		t.Errorf("Expected only the address key, got %v", keys)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	r := httptest.NewRequest("POST", "/api/login", nil)
+	r.RemoteAddr = "192.0.2.1:5555"
+	r.Header.Set("X-Forwarded-For", "203.0.113.7, 10.0.0.1")
+	if ip := ClientIP(r, false); ip != "192.0.2.1" {
+		t.Errorf("Expected remote address, got %q", ip)
+	}
+	if ip := ClientIP(r, true); ip != "10.0.0.1" {
+		t.Errorf("Expected the address appended by the proxy, got %q", ip)
+	}
+	// entrées ajoutées par le client : ignorées
+	r.Header.Set("X-Forwarded-For", "198.51.100.9, 203.0.113.7")
+	if ip := ClientIP(r, true); ip != "203.0.113.7" {
+		t.Errorf("Expected the rightmost forwarded address, got %q", ip)
+	}
+}
@@ -0,0 +1,274 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"druid-insight/config"
+	"druid-insight/store"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+const (
+	defaultOIDCTimeout       = 10 * time.Second
+	defaultOIDCUsernameClaim = "preferred_username"
+	defaultOIDCGroupsClaim   = "groups"
+	oidcStateTTL             = 10 * time.Minute // délai pour revenir du fournisseur
+	oidcPruneInterval        = time.Hour
+)
+
+var (
+	ErrOIDCStateInvalid = errors.New("oidc: unknown or expired state")
+	ErrOIDCNonce        = errors.New("oidc: nonce mismatch")
+	ErrOIDCNoIDToken    = errors.New("oidc: no id_token in token response")
+	ErrOIDCNoUsername   = errors.New("oidc: username claim missing")
+	ErrOIDCSubject      = errors.New("oidc: username already bound to another subject")
+)
+
+// OIDCProvider mène le flux authorization code + PKCE avec le fournisseur d'identité et
+// conserve le profil (admin, équipe, groupes) déduit des claims de chaque connexion.
+// La découverte est faite au premier usage et retentée tant qu'elle échoue.
+type OIDCProvider struct {
+	cfg    OIDCConfig
+	st     *store.Store
+	client *http.Client
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+	oauth    *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+	prunedAt time.Time
+}
+
+// Fournisseur actif (auth.user_backend: oidc)
+var oidcProvider *OIDCProvider
+
+// SetOIDCProvider active le SSO pour GetAccessFilters et GetUserTeam
+func SetOIDCProvider(p *OIDCProvider) { oidcProvider = p }
+
+// OIDC retourne le fournisseur actif (nil hors backend oidc)
+func OIDC() *OIDCProvider { return oidcProvider }
+
+// NewOIDCProvider vérifie la configuration ; aucun appel réseau n'est fait ici
+func NewOIDCProvider(c OIDCConfig, st *store.Store) (*OIDCProvider, error) {
+	if c.Issuer == "" || c.ClientID == "" || c.RedirectURL == "" {
+		return nil, errors.New("oidc: issuer, client_id and redirect_url are required")
+	}
+	if len(c.Scopes) == 0 {
+		c.Scopes = []string{"profile", "email"}
+	}
+	if !containsString(c.Scopes, oidc.ScopeOpenID) {
+		c.Scopes = append([]string{oidc.ScopeOpenID}, c.Scopes...)
+	}
+	if c.UsernameClaim == "" {
+		c.UsernameClaim = defaultOIDCUsernameClaim
+	}
+	if c.GroupsClaim == "" {
+		c.GroupsClaim = defaultOIDCGroupsClaim
+	}
+	timeout := time.Duration(c.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = defaultOIDCTimeout
+	}
+	return &OIDCProvider{cfg: c, st: st, client: &http.Client{Timeout: timeout}}, nil
+}
+
+// discover charge le document de découverte et les clés du fournisseur
+func (p *OIDCProvider) discover() (*oauth2.Config, *oidc.IDTokenVerifier, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.provider == nil {
+		// contexte sans échéance : il sert aussi aux téléchargements ultérieurs du JWKS
+		provider, err := oidc.NewProvider(oidc.ClientContext(context.Background(), p.client), p.cfg.Issuer)
+		if err != nil {
+			return nil, nil, fmt.Errorf("oidc discovery: %w", err)
+		}
+		p.provider = provider
+		p.oauth = &oauth2.Config{
+			ClientID:     p.cfg.ClientID,
+			ClientSecret: p.cfg.ClientSecret,
+			RedirectURL:  p.cfg.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       p.cfg.Scopes,
+		}
+		p.verifier = provider.Verifier(&oidc.Config{ClientID: p.cfg.ClientID})
+	}
+	return p.oauth, p.verifier, nil
+}
+
+// AuthCodeURL prépare une connexion (state, nonce, code_verifier conservés côté serveur) et
+// retourne l'URL d'autorisation du fournisseur et le state, à lier au navigateur.
+// redirect est le chemin du front à rouvrir ensuite.
+func (p *OIDCProvider) AuthCodeURL(redirect string) (string, string, error) {
+	oauth, _, err := p.discover()
+	if err != nil {
+		return "", "", err
+	}
+	now := time.Now()
+	p.prune(now)
+	s := &store.OIDCState{
+		ID:        randomToken(),
+		Nonce:     randomToken(),
+		Verifier:  oauth2.GenerateVerifier(),
+		Redirect:  redirect,
+		ExpiresAt: now.Add(oidcStateTTL),
+	}
+	if err := p.st.PutOIDCState(s); err != nil {
+		return "", "", err
+	}
+	return oauth.AuthCodeURL(s.ID, oidc.Nonce(s.Nonce), oauth2.S256ChallengeOption(s.Verifier)), s.ID, nil
+}
+
+// Exchange termine la connexion : échange du code (avec le code_verifier), vérification de
+// l'ID token (signature, iss, aud, exp, nonce) puis enregistrement du profil. Retourne le
+// profil et le chemin de redirection mémorisé par AuthCodeURL.
+func (p *OIDCProvider) Exchange(ctx context.Context, state, code string) (*store.OIDCUser, string, error) {
+	oauth, verifier, err := p.discover()
+	if err != nil {
+		return nil, "", err
+	}
+	s, err := p.st.TakeOIDCState(state)
+	if errors.Is(err, store.ErrNotFound) || (err == nil && time.Now().After(s.ExpiresAt)) {
+		return nil, "", ErrOIDCStateInvalid
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	ctx = oidc.ClientContext(ctx, p.client)
+	tok, err := oauth.Exchange(ctx, code, oauth2.VerifierOption(s.Verifier))
+	if err != nil {
+		return nil, "", fmt.Errorf("oidc code exchange: %w", err)
+	}
+	raw, ok := tok.Extra("id_token").(string)
+	if !ok || raw == "" {
+		return nil, "", ErrOIDCNoIDToken
+	}
+	idToken, err := verifier.Verify(ctx, raw)
+	if err != nil {
+		return nil, "", err
+	}
+	if idToken.Nonce != s.Nonce {
+		return nil, "", ErrOIDCNonce
+	}
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, "", err
+	}
+	u, err := p.mapClaims(idToken.Subject, claims)
+	if err != nil {
+		return nil, "", err
+	}
+	// la claim de nom d'utilisateur peut changer ou être reprise : le profil reste lié au
+	// sub de sa première connexion
+	prev, err := p.st.GetOIDCUser(u.Username)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return nil, "", err
+	}
+	if prev != nil && prev.Subject != "" && prev.Subject != u.Subject {
+		return nil, "", ErrOIDCSubject
+	}
+	if err := p.st.PutOIDCUser(u); err != nil {
+		return nil, "", err
+	}
+	return u, s.Redirect, nil
+}
+
+// mapClaims déduit nom d'utilisateur, équipe, groupes et rôle admin des claims configurées
+func (p *OIDCProvider) mapClaims(subject string, claims map[string]interface{}) (*store.OIDCUser, error) {
+	username, _ := claims[p.cfg.UsernameClaim].(string)
+	if username == "" {
+		return nil, ErrOIDCNoUsername
+	}
+	u := &store.OIDCUser{
+		Username:  username,
+		Subject:   subject,
+		Groups:    claimStrings(claims[p.cfg.GroupsClaim]),
+		LastLogin: time.Now().UTC(),
+	}
+	if p.cfg.TeamClaim != "" {
+		u.Team, _ = claims[p.cfg.TeamClaim].(string)
+	}
+	for _, g := range p.cfg.AdminGroups {
+		if containsString(u.Groups, g) {
+			u.Admin = true
+			break
+		}
+	}
+	return u, nil
+}
+
+// Profile retourne le profil enregistré à la dernière connexion
+func (p *OIDCProvider) Profile(username string) (*store.OIDCUser, error) {
+	if p == nil {
+		return nil, errors.New("oidc: provider not configured")
+	}
+	return p.st.GetOIDCUser(username)
+}
+
+// AccessFilters retourne les valeurs autorisées par dimension pour une datasource,
+// union des access_groups de l'utilisateur (u nil = profil introuvable)
+func (p *OIDCProvider) AccessFilters(u *store.OIDCUser, datasource string, druidCfg *config.DruidConfig) map[string][]string {
+	var member func(string) bool
+	if u != nil {
+		member = func(group string) bool { return containsString(u.Groups, group) }
+	}
+	return groupAccessFilters(p.cfg.AccessGroups, member, datasource, druidCfg)
+}
+
+// prune supprime de temps en temps les connexions jamais terminées
+func (p *OIDCProvider) prune(now time.Time) {
+	p.mu.Lock()
+	due := now.Sub(p.prunedAt) >= oidcPruneInterval
+	if due {
+		p.prunedAt = now
+	}
+	p.mu.Unlock()
+	if due {
+		p.st.PruneOIDCStates(now)
+	}
+}
+
+// claimStrings accepte une claim chaîne ou liste de chaînes
+func claimStrings(v interface{}) []string {
+	switch val := v.(type) {
+	case string:
+		if val == "" {
+			return nil
+		}
+		return []string{val}
+	case []interface{}:
+		out := make([]string, 0, len(val))
+		for _, item := range val {
+			if s, ok := item.(string); ok && s != "" {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func randomToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,231 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"druid-insight/config"
+	"druid-insight/store"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// fakeIdP : fournisseur OpenID Connect minimal (découverte, JWKS, endpoint token avec PKCE)
+type fakeIdP struct {
+	srv *httptest.Server
+	key *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]fakeCode
+}
+
+type fakeCode struct {
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newFakeIdP(t *testing.T) *fakeIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey failed: %v", err)
+	}
+	idp := &fakeIdP{key: key, codes: map[string]fakeCode{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                idp.srv.URL,
+			"authorization_endpoint":                idp.srv.URL + "/authorize",
+			"token_endpoint":                        idp.srv.URL + "/token",
+			"jwks_uri":                              idp.srv.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA", "kid": "idp-1", "alg": "RS256", "use": "sig",
+			"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		idp.mu.Lock()
+		c, ok := idp.codes[r.PostForm.Get("code")]
+		delete(idp.codes, r.PostForm.Get("code"))
+		idp.mu.Unlock()
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != c.challenge {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		tok := jwt.NewWithClaims(jwt.SigningMethodRS256, c.claims)
+		tok.Header["kid"] = "idp-1"
+		signed, _ := tok.SignedString(key)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "at", "token_type": "Bearer", "expires_in": 300, "id_token": signed,
+		})
+	})
+	idp.srv = httptest.NewServer(mux)
+	t.Cleanup(idp.srv.Close)
+	return idp
+}
+
+// authorize simule le passage de l'utilisateur chez le fournisseur : retourne state et code
+func (idp *fakeIdP) authorize(t *testing.T, p *OIDCProvider, edit func(jwt.MapClaims)) (string, string) {
+	authURL, _, err := p.AuthCodeURL("/reports")
+	if err != nil {
+		t.Fatalf("AuthCodeURL failed: %v", err)
+	}
+	u, _ := url.Parse(authURL)
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		t.Fatalf("Expected a PKCE S256 challenge, got %s", authURL)
+	}
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":                idp.srv.URL,
+		"aud":                "druid-insight",
+		"sub":                "00u1",
+		"iat":                now.Unix(),
+		"exp":                now.Add(5 * time.Minute).Unix(),
+		"nonce":              q.Get("nonce"),
+		"preferred_username": "bob",
+		"department":         "sales",
+		"groups":             []string{"sales-fr", "sales-de"},
+	}
+	if edit != nil {
+		edit(claims)
+	}
+	code := randomToken()
+	idp.mu.Lock()
+	idp.codes[code] = fakeCode{challenge: q.Get("code_challenge"), claims: claims}
+	idp.mu.Unlock()
+	return q.Get("state"), code
+}
+
+func testOIDC(t *testing.T) (*fakeIdP, *OIDCProvider) {
+	idp := newFakeIdP(t)
+	st, err := store.Open("file", "", t.TempDir())
+	if err != nil {
+		t.Fatalf("store.Open failed: %v", err)
+	}
+	p, err := NewOIDCProvider(OIDCConfig{
+		Issuer:      idp.srv.URL,
+		ClientID:    "druid-insight",
+		RedirectURL: "http://localhost/api/oidc/callback",
+		TeamClaim:   "department",
+		AdminGroups: []string{"insight-admins"},
+		AccessGroups: map[string]map[string]map[string][]string{
+			"sales-fr": {"myreport": {"country": {"FR"}}},
+			"sales-de": {"myreport": {"country": {"DE"}}},
+		},
+	}, st)
+	if err != nil {
+		t.Fatalf("NewOIDCProvider failed: %v", err)
+	}
+	return idp, p
+}
+
+func TestOIDC_LoginFlow(t *testing.T) {
+	idp, p := testOIDC(t)
+	state, code := idp.authorize(t, p, nil)
+	u, redirect, err := p.Exchange(context.Background(), state, code)
+	if err != nil {
+		t.Fatalf("Exchange failed: %v", err)
+	}
+	if u.Username != "bob" || u.Admin || u.Team != "sales" || len(u.Groups) != 2 || redirect != "/reports" {
+		t.Errorf("Unexpected profile %+v redirect %q", u, redirect)
+	}
+	// un state ne sert qu'une fois
+	if _, _, err := p.Exchange(context.Background(), state, code); !errors.Is(err, ErrOIDCStateInvalid) {
+		t.Errorf("Expected ErrOIDCStateInvalid on replay, got %v", err)
+	}
+
+	SetOIDCProvider(p)
+	defer SetOIDCProvider(nil)
+	druidCfg := &config.DruidConfig{Datasources: map[string]config.DruidDatasourceSchema{
+		"myreport": {Dimensions: map[string]config.DruidField{"country": {Druid: "country"}}},
+	}}
+	authCfg := &Config{}
+	authCfg.Auth.UserBackend = "oidc"
+	if filters := GetAccessFilters("bob", false, "myreport", druidCfg, nil, authCfg); len(filters["country"]) != 2 {
+		t.Errorf("Expected country [FR DE] for bob, got %v", filters)
+	}
+	if got := GetAccessFilters("nobody", false, "myreport", druidCfg, nil, authCfg); len(got["country"]) != 1 || got["country"][0] != groupDenyValue {
+		t.Errorf("Expected deny filter for unknown user, got %v", got)
+	}
+	if team := GetUserTeam("bob", nil, authCfg); team != "sales" {
+		t.Errorf("Expected team sales, got %q", team)
+	}
+
+	state, code = idp.authorize(t, p, func(c jwt.MapClaims) {
+		c["preferred_username"] = "alice"
+		c["groups"] = "Insight-Admins"
+	})
+	if u, _, err := p.Exchange(context.Background(), state, code); err != nil || !u.Admin {
+		t.Errorf("Expected admin alice, got %+v (%v)", u, err)
+	}
+}
+
+func TestOIDC_RejectsInvalidTokens(t *testing.T) {
+	idp, p := testOIDC(t)
+	cases := map[string]func(jwt.MapClaims){
+		"nonce":    func(c jwt.MapClaims) { c["nonce"] = "other" },
+		"audience": func(c jwt.MapClaims) { c["aud"] = "another-client" },
+		"issuer":   func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" },
+		"expired":  func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() },
+		"username": func(c jwt.MapClaims) { delete(c, "preferred_username") },
+	}
+	for name, edit := range cases {
+		state, code := idp.authorize(t, p, edit)
+		if _, _, err := p.Exchange(context.Background(), state, code); err == nil {
+			t.Errorf("%s: expected the ID token to be rejected", name)
+		}
+	}
+
+	// code_verifier d'une autre connexion : le fournisseur refuse l'échange
+	state1, _ := idp.authorize(t, p, nil)
+	_, code2 := idp.authorize(t, p, nil)
+	if _, _, err := p.Exchange(context.Background(), state1, code2); err == nil {
+		t.Error("Expected PKCE mismatch to be rejected")
+	}
+	if _, _, err := p.Exchange(context.Background(), "unknown", "code"); !errors.Is(err, ErrOIDCStateInvalid) {
+		t.Errorf("Expected ErrOIDCStateInvalid, got %v", err)
+	}
+	if _, err := p.Profile("bob"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Expected no profile after rejected logins, got %v", err)
+	}
+}
+
+func TestOIDC_RejectsUsernameOfAnotherSubject(t *testing.T) {
+	idp, p := testOIDC(t)
+	state, code := idp.authorize(t, p, nil)
+	if _, _, err := p.Exchange(context.Background(), state, code); err != nil {
+		t.Fatalf("Exchange failed: %v", err)
+	}
+	// un autre compte du fournisseur prend le nom bob
+	state, code = idp.authorize(t, p, func(c jwt.MapClaims) {
+		c["sub"] = "00u2"
+		c["groups"] = "insight-admins"
+	})
+	if _, _, err := p.Exchange(context.Background(), state, code); !errors.Is(err, ErrOIDCSubject) {
+		t.Errorf("Expected ErrOIDCSubject, got %v", err)
+	}
+	if u, err := p.Profile("bob"); err != nil || u.Subject != "00u1" || u.Admin {
+		t.Errorf("Expected bob's profile to be kept, got %+v (%v)", u, err)
+	}
+}
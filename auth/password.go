@@ -0,0 +1,255 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"druid-insight/utils"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+)
+
+// Paramètres des nouveaux hachages ; un hachage stocké avec d'autres paramètres est refait
+// à la connexion suivante
+const (
+	bcryptCost     = 12
+	argon2Memory   = 19 * 1024 // KiB
+	argon2Time     = 2
+	argon2Threads  = 1
+	argon2SaltLen  = 16
+	argon2KeyLen   = 32
+	argon2idPrefix = "$argon2id$"
+)
+
+func bcryptHash(plain string) (string, error) {
+	h, err := bcrypt.GenerateFromPassword([]byte(plain), bcryptCost)
+	if err != nil {
+		return "", err
+	}
+	return string(h), nil
+}
+
+// argon2idHash retourne un hachage au format PHC : $argon2id$v=19$m=...,t=...,p=...$sel$clé
+func argon2idHash(plain string) (string, error) {
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(plain), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version, argon2Memory, argon2Time, argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// argon2idVerify compare en temps constant et indique si les paramètres sont ceux d'aujourd'hui
+func argon2idVerify(stored, plain string) (ok, current bool) {
+	parts := strings.Split(stored, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return false, false
+	}
+	var version int
+	var memory, iterations uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, false
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &threads); err != nil || threads == 0 {
+		return false, false
+	}
+	salt, err1 := base64.RawStdEncoding.DecodeString(parts[4])
+	key, err2 := base64.RawStdEncoding.DecodeString(parts[5])
+	if err1 != nil || err2 != nil || len(key) == 0 {
+		return false, false
+	}
+	got := argon2.IDKey([]byte(plain), salt, iterations, memory, threads, uint32(len(key)))
+	ok = subtle.ConstantTimeCompare(got, key) == 1
+	current = memory == argon2Memory && iterations == argon2Time && threads == argon2Threads && len(key) == argon2KeyLen
+	return ok, current
+}
+
+// hashScheme reconnaît les hachages auto-descriptifs (bcrypt, argon2id) ; "" pour les anciens schémas
+func hashScheme(stored string) string {
+	switch {
+	case strings.HasPrefix(stored, "$2a$"), strings.HasPrefix(stored, "$2b$"), strings.HasPrefix(stored, "$2y$"):
+		return "bcrypt"
+	case strings.HasPrefix(stored, argon2idPrefix):
+		return "argon2id"
+	}
+	return ""
+}
+
+// macroScheme retourne le schéma d'une macro, ex: "sha256" pour {sha256}({password})
+func macroScheme(macro string) string {
+	macro = strings.TrimSpace(macro)
+	if !strings.HasPrefix(macro, "{") {
+		return ""
+	}
+	if end := strings.Index(macro, "}"); end > 0 {
+		return macro[1:end]
+	}
+	return ""
+}
+
+// VerifyPassword vérifie password contre le hachage stocké, en temps constant.
+// Un hachage bcrypt/argon2id est vérifié selon son propre format (le texte haché est décrit par
+// la macro de même schéma) ; un ancien hachage est comparé à macro puis à chacune des
+// legacy macros. rehash indique qu'il faut re-hacher le mot de passe avec macro : ancienne
+// macro, autre schéma ou paramètres de coût dépassés.
+func VerifyPassword(macro string, legacy []string, stored, password, user, userSalt, globalSalt string) (ok, rehash bool) {
+	if stored == "" {
+		return false, false
+	}
+	macros := append([]string{macro}, legacy...)
+	if scheme := hashScheme(stored); scheme != "" {
+		tmpl := "{" + scheme + "}({password})"
+		for _, m := range macros {
+			if macroScheme(m) == scheme {
+				tmpl = m
+				break
+			}
+		}
+		plain := expandMacro(extractBetween(tmpl, "{"+scheme+"}(", ")"), password, user, userSalt, globalSalt)
+		current := true
+		switch scheme {
+		case "bcrypt":
+			ok = bcrypt.CompareHashAndPassword([]byte(stored), []byte(plain)) == nil
+			if cost, err := bcrypt.Cost([]byte(stored)); err == nil && cost != bcryptCost {
+				current = false
+			}
+		case "argon2id":
+			ok, current = argon2idVerify(stored, plain)
+		}
+		return ok, ok && (macroScheme(macro) != scheme || !current)
+	}
+	for i, m := range macros {
+		if s := macroScheme(m); s == "bcrypt" || s == "argon2id" {
+			continue
+		}
+		h, err := ApplyHashMacro(m, password, user, userSalt, globalSalt)
+		if err == nil && subtle.ConstantTimeCompare([]byte(h), []byte(stored)) == 1 {
+			return true, i > 0 || macroScheme(macro) == "bcrypt" || macroScheme(macro) == "argon2id"
+		}
+	}
+	return false, false
+}
+
+// HashPassword calcule un nouveau hachage (et un nouveau sel utilisateur) avec macro
+func HashPassword(macro, password, user, globalSalt string) (hash, salt string, err error) {
+	salt = utils.RandomHex(8)
+	hash, err = ApplyHashMacro(macro, password, user, salt, globalSalt)
+	return hash, salt, err
+}
+
+// Hachages réécrits dans users.yaml depuis son chargement : la map UsersFile est lue sans
+// verrou par les handlers et n'est donc jamais modifiée en place
+var rehashed sync.Map // username => UserInfo (hash, salt)
+
+func resetRehashed() {
+	rehashed.Range(func(k, _ interface{}) bool {
+		rehashed.Delete(k)
+		return true
+	})
+}
+
+// Credentials retourne hachage et sel de l'utilisateur, y compris s'ils ont été re-hachés
+// depuis le chargement du fichier
+func (uf *UsersFile) Credentials(username string) (hash, salt string, ok bool) {
+	if v, found := rehashed.Load(username); found {
+		u := v.(UserInfo)
+		return u.Hash, u.Salt, true
+	}
+	u, ok := uf.Users[username]
+	return u.Hash, u.Salt, ok
+}
+
+var usersFileMu sync.Mutex
+
+// UpdateUserHash remplace hachage et sel d'un utilisateur dans users.yaml en conservant le
+// reste du fichier (commentaires, ordre, autres champs)
+func UpdateUserHash(file, username, hash, salt string) error {
+	usersFileMu.Lock()
+	defer usersFileMu.Unlock()
+	path := filepath.Join(utils.GetProjectRoot(), file)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	user := mappingValue(mappingValue(documentRoot(&doc), "users"), username)
+	if user == nil || user.Kind != yaml.MappingNode {
+		return errors.New("user " + username + " not found in " + file)
+	}
+	setMappingValue(user, "hash", hash)
+	setMappingValue(user, "salt", salt)
+	out, err := yaml.Marshal(&doc)
+	if err != nil {
+		return err
+	}
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, out, mode); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	rehashed.Store(username, UserInfo{Hash: hash, Salt: salt})
+	return nil
+}
+
+// UpdateDBUserHash exécute auth.db_rehash_request (hash, salt, username)
+func UpdateDBUserHash(cfg *Config, username, hash, salt string) error {
+	if cfg.Auth.DBRehashRequest == "" {
+		return errors.New("auth.db_rehash_request is not configured")
+	}
+	db, err := sql.Open(cfg.Auth.UserBackend, cfg.Auth.DBDSN)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	_, err = db.Exec(cfg.Auth.DBRehashRequest, hash, salt, username)
+	return err
+}
+
+func documentRoot(doc *yaml.Node) *yaml.Node {
+	if doc.Kind == yaml.DocumentNode && len(doc.Content) > 0 {
+		return doc.Content[0]
+	}
+	return doc
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func setMappingValue(node *yaml.Node, key, value string) {
+	if v := mappingValue(node, key); v != nil {
+		v.Kind, v.Tag, v.Value, v.Style = yaml.ScalarNode, "!!str", value, yaml.DoubleQuotedStyle
+		return
+	}
+	node.Content = append(node.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key},
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value, Style: yaml.DoubleQuotedStyle})
+}
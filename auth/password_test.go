@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+)
+
+func TestApplyHashMacro_Modern(t *testing.T) {
+	for _, macro := range []string{"{bcrypt}({password}{globalsalt})", "{argon2id}({password}{globalsalt})"} {
+		h1, err := ApplyHashMacro(macro, "pass", "bob", "usalt", "gsalt")
+		if err != nil {
+			t.Fatalf("%s failed: %v", macro, err)
+		}
+		h2, _ := ApplyHashMacro(macro, "pass", "bob", "usalt", "gsalt")
+		if h1 == h2 || hashScheme(h1) != macroScheme(macro) {
+			t.Errorf("%s: expected distinct self-describing hashes, got %q and %q", macro, h1, h2)
+		}
+		if ok, rehash := VerifyPassword(macro, nil, h1, "pass", "bob", "usalt", "gsalt"); !ok || rehash {
+			t.Errorf("%s: expected valid password without rehash, got ok=%v rehash=%v", macro, ok, rehash)
+		}
+		if ok, _ := VerifyPassword(macro, nil, h1, "wrong", "bob", "usalt", "gsalt"); ok {
+			t.Errorf("%s: expected wrong password to be rejected", macro)
+		}
+	}
+}
+
+func TestVerifyPassword_Migration(t *testing.T) {
+	legacy := "{sha256}({password}{user}{salt}{globalsalt})"
+	stored, _ := ApplyHashMacro(legacy, "pass", "bob", "usalt", "gsalt")
+
+	// macro inchangée : comparaison simple, pas de re-hachage
+	if ok, rehash := VerifyPassword(legacy, nil, stored, "pass", "bob", "usalt", "gsalt"); !ok || rehash {
+		t.Errorf("Expected legacy hash valid without rehash, got ok=%v rehash=%v", ok, rehash)
+	}
+	// nouvelle macro : l'ancien hachage est accepté via legacy_hash_macros puis re-haché
+	if ok, rehash := VerifyPassword("{argon2id}({password})", []string{legacy}, stored, "pass", "bob", "usalt", "gsalt"); !ok || !rehash {
+		t.Errorf("Expected legacy hash valid with rehash, got ok=%v rehash=%v", ok, rehash)
+	}
+	if ok, _ := VerifyPassword("{argon2id}({password})", nil, stored, "pass", "bob", "usalt", "gsalt"); ok {
+		t.Error("Expected legacy hash refused when its macro is not listed")
+	}
+	// bcrypt vers argon2id
+	bc, _ := ApplyHashMacro("{bcrypt}({password})", "pass", "bob", "", "")
+	if ok, rehash := VerifyPassword("{argon2id}({password})", nil, bc, "pass", "bob", "", ""); !ok || !rehash {
+		t.Errorf("Expected bcrypt hash valid with rehash, got ok=%v rehash=%v", ok, rehash)
+	}
+	// paramètres de coût dépassés
+	salt := []byte("saltsaltsaltsalt")
+	weak := "$argon2id$v=19$m=1024,t=1,p=1$" + base64.RawStdEncoding.EncodeToString(salt) + "$" +
+		base64.RawStdEncoding.EncodeToString(argon2.IDKey([]byte("pass"), salt, 1, 1024, 1, 32))
+	if ok, rehash := VerifyPassword("{argon2id}({password})", nil, weak, "pass", "bob", "", ""); !ok || !rehash {
+		t.Errorf("Expected weak argon2id hash valid with rehash, got ok=%v rehash=%v", ok, rehash)
+	}
+	if ok, _ := VerifyPassword("{argon2id}({password})", nil, weak[:len(weak)-43], "pass", "bob", "", ""); ok {
+		t.Error("Expected truncated argon2id hash to be rejected")
+	}
+	if ok, _ := VerifyPassword("{clear}({password})", nil, "", "", "bob", "", ""); ok {
+		t.Error("Expected empty stored hash to be rejected")
+	}
+}
+
+func TestUpdateUserHash(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("DRUID_INSIGHT_ROOT", dir)
+	content := `# comptes
+users:
+  bob:
+    hash: "old"
+    salt: "s"
+    admin: true # garde ce commentaire
+  alice:
+    hash: "other"
+`
+	os.WriteFile(filepath.Join(dir, "users.yaml"), []byte(content), 0640)
+	uf, err := LoadUsers("users.yaml")
+	if err != nil {
+		t.Fatalf("LoadUsers failed: %v", err)
+	}
+	if err := UpdateUserHash("users.yaml", "bob", "$argon2id$new", "s2"); err != nil {
+		t.Fatalf("UpdateUserHash failed: %v", err)
+	}
+	if hash, salt, ok := uf.Credentials("bob"); !ok || hash != "$argon2id$new" || salt != "s2" {
+		t.Errorf("Expected rehashed credentials, got %q %q %v", hash, salt, ok)
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "users.yaml"))
+	if !strings.Contains(string(data), "garde ce commentaire") || !strings.Contains(string(data), "other") {
+		t.Errorf("Expected the rest of users.yaml to be preserved, got:\n%s", data)
+	}
+	reloaded, _ := LoadUsers("users.yaml")
+	if u := reloaded.Users["bob"]; u.Hash != "$argon2id$new" || !u.Admin {
+		t.Errorf("Expected new hash on reload, got %+v", u)
+	}
+	if info, _ := os.Stat(filepath.Join(dir, "users.yaml")); info.Mode().Perm() != 0640 {
+		t.Errorf("Expected file mode kept, got %v", info.Mode().Perm())
+	}
+	if err := UpdateUserHash("users.yaml", "nobody", "h", "s"); err == nil {
+		t.Error("Expected an error for an unknown user")
+	}
+}
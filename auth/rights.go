@@ -1,37 +1,39 @@
 package auth
 
-import "druid-insight/config"
+import (
+	"druid-insight/config"
+	"druid-insight/report"
+)
 
-func CheckRights(payload map[string]interface{}, druidCfg *config.DruidConfig, datasource string, isAdmin bool) []string {
+// CheckRights liste les champs du rapport inconnus ou non accordés par les rôles, et la
+// datasource si aucun rôle n'y donne accès
+func CheckRights(spec *report.Spec, druidCfg *config.DruidConfig, g *Grants) []string {
 	problems := []string{}
-	ds, ok := druidCfg.Datasources[datasource]
+	ds, ok := druidCfg.Datasources[spec.Datasource]
 	if !ok {
 		return []string{"datasource_not_found"}
 	}
-	if dims, ok := payload["dimensions"].([]interface{}); ok {
-		for _, dimRaw := range dims {
-			dim, _ := dimRaw.(string)
-			if dim == "time" {
-				// La dimension "time" est TOUJOURS autorisée
-				continue
-			}
-			f, ok := ds.Dimensions[dim]
-			if !ok {
-				problems = append(problems, "dimension:"+dim+":unknown")
-			} else if f.Reserved && !isAdmin {
-				problems = append(problems, "dimension:"+dim+":forbidden")
-			}
+	if !g.DatasourceAllowed(spec.Datasource) {
+		return []string{"datasource_forbidden"}
+	}
+	for _, dim := range spec.Dimensions {
+		if dim == "time" {
+			// La dimension "time" est TOUJOURS autorisée
+			continue
+		}
+		f, ok := ds.Dimensions[dim]
+		if !ok {
+			problems = append(problems, "dimension:"+dim+":unknown")
+		} else if !g.FieldAllowed(f) {
+			problems = append(problems, "dimension:"+dim+":forbidden")
 		}
 	}
-	if mets, ok := payload["metrics"].([]interface{}); ok {
-		for _, mRaw := range mets {
-			metric, _ := mRaw.(string)
-			f, ok := ds.Metrics[metric]
-			if !ok {
-				problems = append(problems, "metric:"+metric+":unknown")
-			} else if f.Reserved && !isAdmin {
-				problems = append(problems, "metric:"+metric+":forbidden")
-			}
+	for _, metric := range spec.Metrics {
+		f, ok := ds.Metrics[metric]
+		if !ok {
+			problems = append(problems, "metric:"+metric+":unknown")
+		} else if !g.FieldAllowed(f) {
+			problems = append(problems, "metric:"+metric+":forbidden")
 		}
 	}
 	return problems
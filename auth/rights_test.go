@@ -2,6 +2,7 @@ package auth
 
 import (
 	"druid-insight/config"
+	"druid-insight/report"
 	"testing"
 )
 
@@ -25,22 +26,24 @@ func makeDruidConfig() *config.DruidConfig {
 }
 
 func TestCheckRights_AllOk_Admin(t *testing.T) {
-	payload := map[string]interface{}{
-		"dimensions": []interface{}{"date", "browser"},
-		"metrics":    []interface{}{"requests", "errors"},
+	spec := &report.Spec{
+		Datasource: "myreport",
+		Dimensions: []string{"date", "browser"},
+		Metrics:    []string{"requests", "errors"},
 	}
-	problems := CheckRights(payload, makeDruidConfig(), "myreport", true)
+	problems := CheckRights(spec, makeDruidConfig(), NewGrants(nil, []string{RoleAdmin}))
 	if len(problems) != 0 {
 		t.Errorf("Expected no problems for admin, got: %v", problems)
 	}
 }
 
 func TestCheckRights_ForbiddenForUser(t *testing.T) {
-	payload := map[string]interface{}{
-		"dimensions": []interface{}{"date", "browser"},
-		"metrics":    []interface{}{"requests", "errors"},
+	spec := &report.Spec{
+		Datasource: "myreport",
+		Dimensions: []string{"date", "browser"},
+		Metrics:    []string{"requests", "errors"},
 	}
-	problems := CheckRights(payload, makeDruidConfig(), "myreport", false)
+	problems := CheckRights(spec, makeDruidConfig(), NewGrants(nil, []string{RoleUser}))
 	expected := map[string]bool{
 		"dimension:browser:forbidden": true,
 		"metric:errors:forbidden":     true,
@@ -56,11 +59,12 @@ func TestCheckRights_ForbiddenForUser(t *testing.T) {
 }
 
 func TestCheckRights_UnknownDimensionAndMetric(t *testing.T) {
-	payload := map[string]interface{}{
-		"dimensions": []interface{}{"date", "unknown_dim"},
-		"metrics":    []interface{}{"requests", "unknown_metric"},
+	spec := &report.Spec{
+		Datasource: "myreport",
+		Dimensions: []string{"date", "unknown_dim"},
+		Metrics:    []string{"requests", "unknown_metric"},
 	}
-	problems := CheckRights(payload, makeDruidConfig(), "myreport", false)
+	problems := CheckRights(spec, makeDruidConfig(), NewGrants(nil, []string{RoleUser}))
 	expected := map[string]bool{
 		"dimension:unknown_dim:unknown": true,
 		"metric:unknown_metric:unknown": true,
@@ -76,22 +80,24 @@ func TestCheckRights_UnknownDimensionAndMetric(t *testing.T) {
 }
 
 func TestCheckRights_DatasourceNotFound(t *testing.T) {
-	payload := map[string]interface{}{
-		"dimensions": []interface{}{"date"},
-		"metrics":    []interface{}{"requests"},
+	spec := &report.Spec{
+		Datasource: "unknown_ds",
+		Dimensions: []string{"date"},
+		Metrics:    []string{"requests"},
 	}
-	problems := CheckRights(payload, makeDruidConfig(), "unknown_ds", false)
+	problems := CheckRights(spec, makeDruidConfig(), NewGrants(nil, []string{RoleUser}))
 	if len(problems) != 1 || problems[0] != "datasource_not_found" {
 		t.Errorf("Expected datasource_not_found, got %v", problems)
 	}
 }
 
 func TestCheckRights_TimeAlwaysAllowed(t *testing.T) {
-	payload := map[string]interface{}{
-		"dimensions": []interface{}{"time"},
-		"metrics":    []interface{}{"requests"},
+	spec := &report.Spec{
+		Datasource: "myreport",
+		Dimensions: []string{"time"},
+		Metrics:    []string{"requests"},
 	}
-	problems := CheckRights(payload, makeDruidConfig(), "myreport", false)
+	problems := CheckRights(spec, makeDruidConfig(), NewGrants(nil, []string{RoleUser}))
 	if len(problems) != 0 {
 		t.Errorf("Expected no problems for dimension 'time', got %v", problems)
 	}
@@ -0,0 +1,235 @@
+package auth
+
+import (
+	"database/sql"
+	"druid-insight/config"
+	"log"
+	"sort"
+)
+
+// Rôles intégrés, utilisés tant que la configuration ne les redéfinit pas
+const (
+	RoleAdmin = "admin" // drapeau admin des utilisateurs, des groupes LDAP/OIDC admin et des clés d'API
+	RoleUser  = "user"  // rôle par défaut : toutes les datasources, champs non restreints
+)
+
+// Capacités accordées par les rôles ; admin les comprend toutes
+const (
+	CapExport   = "export"   // téléchargement des résultats
+	CapSchedule = "schedule" // planification de rapports
+	CapExplain  = "explain"  // requête Druid générée (/api/reports/explain)
+	CapAdmin    = "admin"    // administration, tous les champs et toutes les datasources
+)
+
+var capabilities = []string{CapExport, CapSchedule, CapExplain, CapAdmin}
+
+var builtinRoles = map[string]RoleConfig{
+	RoleAdmin: {Datasources: []string{"*"}, Capabilities: []string{CapAdmin}},
+	RoleUser:  {Datasources: []string{"*"}, Capabilities: []string{CapExport, CapSchedule, CapExplain}},
+}
+
+// Grants : droits effectifs d'un utilisateur, union de ses rôles
+type Grants struct {
+	Roles        []string
+	Admin        bool
+	allSources   bool
+	datasources  map[string]bool
+	capabilities map[string]bool
+}
+
+// NewGrants calcule les droits accordés par roles (rôles inconnus ignorés)
+func NewGrants(cfg *Config, roles []string) *Grants {
+	g := &Grants{Roles: roles, datasources: map[string]bool{}, capabilities: map[string]bool{}}
+	for _, name := range roles {
+		role, ok := roleDefinition(cfg, name)
+		if !ok {
+			continue
+		}
+		for _, ds := range role.Datasources {
+			if ds == "*" {
+				g.allSources = true
+			}
+			g.datasources[ds] = true
+		}
+		for _, c := range role.Capabilities {
+			g.capabilities[c] = true
+		}
+	}
+	g.Admin = g.capabilities[CapAdmin]
+	return g
+}
+
+func roleDefinition(cfg *Config, name string) (RoleConfig, bool) {
+	if cfg != nil {
+		if role, ok := cfg.RBAC.Roles[name]; ok {
+			if name == RoleAdmin && !containsString(role.Capabilities, CapAdmin) {
+				// le rôle admin reste administrateur quelle que soit sa définition
+				role.Capabilities = append(role.Capabilities, CapAdmin)
+			}
+			return role, true
+		}
+	}
+	role, ok := builtinRoles[name]
+	return role, ok
+}
+
+// Can indique si les rôles accordent la capacité
+func (g *Grants) Can(capability string) bool {
+	return g.Admin || g.capabilities[capability]
+}
+
+// DatasourceAllowed indique si les rôles donnent accès à la datasource
+func (g *Grants) DatasourceAllowed(datasource string) bool {
+	return g.Admin || g.allSources || g.datasources[datasource]
+}
+
+// FieldAllowed indique si un champ de druid.yaml est visible : sans rôle il est ouvert à tous,
+// sinon réservé aux rôles cités (reserved: true équivaut à roles: [admin])
+func (g *Grants) FieldAllowed(f config.DruidField) bool {
+	if g.Admin {
+		return true
+	}
+	if f.Reserved {
+		return false
+	}
+	if len(f.Roles) == 0 {
+		return true
+	}
+	for _, r := range f.Roles {
+		if containsString(g.Roles, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// UserGrants retourne les droits de l'utilisateur (users : utilisateurs chargés du backend file)
+func UserGrants(username string, isAdmin bool, users *UsersFile, cfg *Config) *Grants {
+	return NewGrants(cfg, GetUserRoles(username, isAdmin, users, cfg))
+}
+
+// GetUserRoles résout les rôles d'un utilisateur : rôles directs (users.yaml ou role_request),
+// groupes rbac (membres, groupes users.yaml, groupes LDAP/OIDC) et rôle admin si isAdmin.
+// Un utilisateur sans rôle reçoit rbac.default_roles.
+func GetUserRoles(username string, isAdmin bool, users *UsersFile, cfg *Config) []string {
+	var roles, groups []string
+	var directory func(string) bool
+	if isAdmin {
+		roles = append(roles, RoleAdmin)
+	}
+	if users != nil {
+		u := users.Users[username]
+		roles = append(roles, u.Roles...)
+		groups = u.Groups
+	} else if cfg != nil && cfg.Auth.UserBackend == "ldap" {
+		if u, err := LDAP().Lookup(username); err == nil {
+			directory = u.InGroup
+		} else {
+			log.Println("ldap roles - " + err.Error())
+		}
+	} else if cfg != nil && cfg.Auth.UserBackend == "oidc" {
+		if u, err := oidcProvider.Profile(username); err == nil {
+			directory = func(group string) bool { return containsString(u.Groups, group) }
+		}
+	} else if cfg != nil {
+		roles = append(roles, getRolesFromDB(username, cfg)...)
+	}
+	if cfg != nil {
+		for name, group := range cfg.RBAC.Groups {
+			member := containsString(group.Members, username) || containsString(groups, name)
+			for _, dg := range group.DirectoryGroups {
+				member = member || (directory != nil && directory(dg))
+			}
+			if member {
+				roles = append(roles, group.Roles...)
+			}
+		}
+	}
+	if len(roles) == 0 {
+		roles = []string{RoleUser}
+		if cfg != nil && cfg.RBAC.DefaultRoles != nil {
+			roles = append([]string{}, cfg.RBAC.DefaultRoles...)
+		}
+	}
+	sort.Strings(roles)
+	out := roles[:0]
+	for i, r := range roles {
+		if i == 0 || r != roles[i-1] {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+func getRolesFromDB(username string, cfg *Config) []string {
+	if cfg.Auth.RoleRequest == "" || cfg.Auth.UserBackend == "file" || cfg.Auth.UserBackend == "" {
+		return nil
+	}
+	db, err := sql.Open(cfg.Auth.UserBackend, cfg.Auth.DBDSN)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	defer db.Close()
+	rows, err := db.Query(cfg.Auth.RoleRequest, username)
+	if err != nil {
+		log.Println("db roles - " + err.Error())
+		return nil
+	}
+	defer rows.Close()
+	var roles []string
+	for rows.Next() {
+		var role sql.NullString
+		if rows.Scan(&role) == nil && role.String != "" {
+			roles = append(roles, role.String)
+		}
+	}
+	return roles
+}
+
+// ValidateRoles signale les références rbac incohérentes entre config.yaml et druid.yaml
+// (rôle, datasource ou capacité inconnus)
+func ValidateRoles(cfg *Config, druidCfg *config.DruidConfig) []string {
+	var problems []string
+	known := func(role string) bool {
+		_, ok := roleDefinition(cfg, role)
+		return ok
+	}
+	for name, role := range cfg.RBAC.Roles {
+		for _, ds := range role.Datasources {
+			if _, ok := druidCfg.Datasources[ds]; !ok && ds != "*" {
+				problems = append(problems, "role "+name+": unknown datasource "+ds)
+			}
+		}
+		for _, c := range role.Capabilities {
+			if !containsString(capabilities, c) {
+				problems = append(problems, "role "+name+": unknown capability "+c)
+			}
+		}
+	}
+	for name, group := range cfg.RBAC.Groups {
+		for _, r := range group.Roles {
+			if !known(r) {
+				problems = append(problems, "group "+name+": unknown role "+r)
+			}
+		}
+	}
+	for _, r := range cfg.RBAC.DefaultRoles {
+		if !known(r) {
+			problems = append(problems, "default_roles: unknown role "+r)
+		}
+	}
+	for dsName, ds := range druidCfg.Datasources {
+		for kind, fields := range map[string]map[string]config.DruidField{"dimension": ds.Dimensions, "metric": ds.Metrics} {
+			for fname, f := range fields {
+				for _, r := range f.Roles {
+					if !known(r) {
+						problems = append(problems, dsName+" "+kind+" "+fname+": unknown role "+r)
+					}
+				}
+			}
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
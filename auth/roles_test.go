@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"druid-insight/config"
+	"druid-insight/report"
+	"reflect"
+	"testing"
+)
+
+func makeRBACConfig() *Config {
+	cfg := &Config{
+		RBAC: RBACConfig{
+			Roles: map[string]RoleConfig{
+				"analyst":  {Datasources: []string{"*"}, Capabilities: []string{CapExport, CapExplain}},
+				"finance":  {Datasources: []string{"myreport"}, Capabilities: []string{CapExport, CapSchedule}},
+				"customer": {Datasources: []string{"myreport"}},
+			},
+			Groups: map[string]GroupConfig{
+				"accounting": {Roles: []string{"finance"}, Members: []string{"carol"}},
+				"analysts":   {Roles: []string{"analyst"}},
+			},
+			DefaultRoles: []string{"customer"},
+		},
+	}
+	cfg.Auth.UserBackend = "file"
+	return cfg
+}
+
+func TestNewGrants_BuiltinRoles(t *testing.T) {
+	admin := NewGrants(nil, []string{RoleAdmin})
+	if !admin.Admin || !admin.Can(CapSchedule) || !admin.DatasourceAllowed("any") {
+		t.Errorf("Expected admin to be granted everything, got %+v", admin)
+	}
+	user := NewGrants(nil, []string{RoleUser})
+	if user.Admin || !user.Can(CapExport) || !user.Can(CapExplain) || user.Can(CapAdmin) || !user.DatasourceAllowed("any") {
+		t.Errorf("Expected user role without admin, got %+v", user)
+	}
+	if g := NewGrants(nil, []string{"nope"}); g.DatasourceAllowed("any") || g.Can(CapExport) {
+		t.Errorf("Expected unknown role to grant nothing, got %+v", g)
+	}
+}
+
+func TestNewGrants_ConfiguredRoles(t *testing.T) {
+	cfg := makeRBACConfig()
+	g := NewGrants(cfg, []string{"customer", "finance"})
+	if !g.DatasourceAllowed("myreport") || g.DatasourceAllowed("other") {
+		t.Errorf("Expected access limited to myreport, got %+v", g)
+	}
+	if !g.Can(CapSchedule) || g.Can(CapExplain) || g.Admin {
+		t.Errorf("Expected union of finance and customer capabilities, got %+v", g)
+	}
+	// une redéfinition du rôle admin garde la capacité admin
+	cfg.RBAC.Roles[RoleAdmin] = RoleConfig{Datasources: []string{"myreport"}}
+	if g := NewGrants(cfg, []string{RoleAdmin}); !g.Admin || !g.DatasourceAllowed("other") {
+		t.Errorf("Expected redefined admin role to stay admin, got %+v", g)
+	}
+}
+
+func TestGetUserRoles_File(t *testing.T) {
+	cfg := makeRBACConfig()
+	users := &UsersFile{Users: map[string]UserInfo{
+		"alice": {Roles: []string{"analyst"}, Groups: []string{"accounting"}},
+		"bob":   {},
+		"carol": {},
+		"dave":  {Admin: true},
+	}}
+	tests := map[string][]string{
+		"alice": {"analyst", "finance"},
+		"bob":   {"customer"},
+		"carol": {"finance"},
+		"dave":  {RoleAdmin},
+	}
+	for username, want := range tests {
+		got := GetUserRoles(username, users.Users[username].Admin, users, cfg)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: expected roles %v, got %v", username, want, got)
+		}
+	}
+	if got := GetUserRoles("bob", false, users, nil); !reflect.DeepEqual(got, []string{RoleUser}) {
+		t.Errorf("Expected built-in default role, got %v", got)
+	}
+}
+
+func TestGrants_FieldAllowed(t *testing.T) {
+	cfg := makeRBACConfig()
+	public := config.DruidField{Druid: "device"}
+	reserved := config.DruidField{Druid: "browser", Reserved: true}
+	finance := config.DruidField{Druid: "revenue", Roles: []string{"finance"}}
+
+	g := NewGrants(cfg, []string{"finance"})
+	if !g.FieldAllowed(public) || g.FieldAllowed(reserved) || !g.FieldAllowed(finance) {
+		t.Error("Expected finance to see public and finance fields only")
+	}
+	g = NewGrants(cfg, []string{"analyst"})
+	if !g.FieldAllowed(public) || g.FieldAllowed(finance) {
+		t.Error("Expected analyst not to see finance fields")
+	}
+	g = NewGrants(cfg, []string{RoleAdmin})
+	if !g.FieldAllowed(reserved) || !g.FieldAllowed(finance) {
+		t.Error("Expected admin to see every field")
+	}
+}
+
+func TestCheckRights_DatasourceAndRoleFields(t *testing.T) {
+	druidCfg := makeDruidConfig()
+	druidCfg.Datasources["myreport"].Metrics["revenue"] = config.DruidField{Druid: "revenue", Roles: []string{"finance"}}
+	druidCfg.Datasources["other"] = config.DruidDatasourceSchema{
+		Dimensions: map[string]config.DruidField{"date": {Druid: "__time"}},
+	}
+	cfg := makeRBACConfig()
+
+	spec := &report.Spec{Datasource: "other", Dimensions: []string{"date"}}
+	if problems := CheckRights(spec, druidCfg, NewGrants(cfg, []string{"finance"})); !reflect.DeepEqual(problems, []string{"datasource_forbidden"}) {
+		t.Errorf("Expected datasource_forbidden, got %v", problems)
+	}
+	spec = &report.Spec{Datasource: "myreport", Dimensions: []string{"date"}, Metrics: []string{"revenue"}}
+	if problems := CheckRights(spec, druidCfg, NewGrants(cfg, []string{"finance"})); len(problems) != 0 {
+		t.Errorf("Expected finance to query revenue, got %v", problems)
+	}
+	if problems := CheckRights(spec, druidCfg, NewGrants(cfg, []string{"customer"})); !reflect.DeepEqual(problems, []string{"metric:revenue:forbidden"}) {
+		t.Errorf("Expected revenue forbidden for customer, got %v", problems)
+	}
+}
+
+func TestValidateRoles(t *testing.T) {
+	cfg := makeRBACConfig()
+	druidCfg := makeDruidConfig()
+	if problems := ValidateRoles(cfg, druidCfg); len(problems) != 0 {
+		t.Errorf("Expected a consistent configuration, got %v", problems)
+	}
+	cfg.RBAC.Roles["broken"] = RoleConfig{Datasources: []string{"missing"}, Capabilities: []string{"fly"}}
+	cfg.RBAC.Groups["ghosts"] = GroupConfig{Roles: []string{"ghost"}}
+	druidCfg.Datasources["myreport"].Dimensions["region"] = config.DruidField{Druid: "region", Roles: []string{"sales"}}
+	want := []string{
+		"group ghosts: unknown role ghost",
+		"myreport dimension region: unknown role sales",
+		"role broken: unknown capability fly",
+		"role broken: unknown datasource missing",
+	}
+	if problems := ValidateRoles(cfg, druidCfg); !reflect.DeepEqual(problems, want) {
+		t.Errorf("Expected %v, got %v", want, problems)
+	}
+}
@@ -0,0 +1,275 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"druid-insight/store"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRefreshTTLMinutes = 7 * 24 * 60
+	sessionsReloadInterval   = 30 * time.Second // relecture des révocations (autres instances)
+	sessionsPruneInterval    = time.Hour
+)
+
+var (
+	ErrRefreshTokenInvalid = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+)
+
+// Sessions gère les jetons de rafraîchissement (rotation à chaque usage, stockés par empreinte)
+// et la liste de révocation des jetons d'accès consultée par ExtractUserAndAdminFromJWT.
+type Sessions struct {
+	st         *store.Store
+	refreshTTL time.Duration
+
+	mu          sync.Mutex
+	revoked     map[string]time.Time // jti => expiration du jeton
+	revokedUser map[string]time.Time // username => jetons émis avant cette date révoqués
+	loadedAt    time.Time
+	prunedAt    time.Time
+}
+
+// Sessions actives (nil = pas de révocation, seule l'expiration des jetons compte)
+var sessions *Sessions
+
+// SetSessions active la vérification des révocations dans ExtractUserAndAdminFromJWT
+func SetSessions(s *Sessions) { sessions = s }
+
+// RefreshTTL retourne la durée de vie des jetons de rafraîchissement (7 jours par défaut)
+func (c *Config) RefreshTTL() time.Duration {
+	minutes := c.JWT.RefreshExpirationMinutes
+	if minutes <= 0 {
+		minutes = defaultRefreshTTLMinutes
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// NewSessions charge les révocations depuis le stockage
+func NewSessions(st *store.Store, refreshTTL time.Duration) (*Sessions, error) {
+	s := &Sessions{st: st, refreshTTL: refreshTTL}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reload(time.Now()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// reload relit les révocations (appelé sous s.mu)
+func (s *Sessions) reload(now time.Time) error {
+	tokens, err := s.st.ListRevokedTokens()
+	if err != nil {
+		return err
+	}
+	users, err := s.st.ListUserRevocations()
+	if err != nil {
+		return err
+	}
+	s.revoked = make(map[string]time.Time, len(tokens))
+	for _, t := range tokens {
+		s.revoked[t.ID] = t.ExpiresAt
+	}
+	s.revokedUser = make(map[string]time.Time, len(users))
+	for _, u := range users {
+		s.revokedUser[u.Username] = u.Before
+	}
+	s.loadedAt = now
+	return nil
+}
+
+// IsRevoked indique si un jeton d'accès (jti, sujet, date d'émission) a été révoqué
+func (s *Sessions) IsRevoked(jti, username string, issuedAt time.Time) bool {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.loadedAt) >= sessionsReloadInterval {
+		s.reload(now) // en cas d'échec on garde la liste précédente
+	}
+	if jti != "" {
+		if _, ok := s.revoked[jti]; ok {
+			return true
+		}
+	}
+	if before, ok := s.revokedUser[username]; ok && issuedAt.Before(before) {
+		return true
+	}
+	return false
+}
+
+// IssueRefreshToken émet un jeton de rafraîchissement (family "" = nouvelle session)
+func (s *Sessions) IssueRefreshToken(username string, isAdmin bool, family string) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	if family == "" {
+		family = refreshTokenID(token)[:16]
+	}
+	now := time.Now()
+	rt := &store.RefreshToken{
+		ID:        refreshTokenID(token),
+		Family:    family,
+		Username:  username,
+		Admin:     isAdmin,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.refreshTTL),
+	}
+	if err := s.st.PutRefreshToken(rt); err != nil {
+		return "", err
+	}
+	s.pruneIfDue(now)
+	return token, nil
+}
+
+// Rotate échange un jeton de rafraîchissement contre un nouveau de la même famille et retourne
+// l'entrée consommée (utilisateur, admin). La réutilisation d'un jeton déjà échangé révoque
+// toute la famille : le jeton a probablement été volé.
+func (s *Sessions) Rotate(token string) (*store.RefreshToken, string, error) {
+	now := time.Now()
+	s.mu.Lock()
+	rt, err := s.st.GetRefreshToken(refreshTokenID(token))
+	if errors.Is(err, store.ErrNotFound) {
+		s.mu.Unlock()
+		return nil, "", ErrRefreshTokenInvalid
+	}
+	if err != nil {
+		s.mu.Unlock()
+		return nil, "", err
+	}
+	if rt.RotatedAt != nil {
+		s.mu.Unlock()
+		s.revokeFamily(rt.Family, now)
+		return nil, "", ErrRefreshTokenReused
+	}
+	if !rt.Usable(now) || s.userRevokedSince(rt.Username, rt.CreatedAt) {
+		s.mu.Unlock()
+		return nil, "", ErrRefreshTokenInvalid
+	}
+	rt.RotatedAt = &now
+	err = s.st.PutRefreshToken(rt)
+	s.mu.Unlock()
+	if err != nil {
+		return nil, "", err
+	}
+	next, err := s.IssueRefreshToken(rt.Username, rt.Admin, rt.Family)
+	if err != nil {
+		return nil, "", err
+	}
+	return rt, next, nil
+}
+
+// userRevokedSince indique si l'utilisateur a été révoqué après createdAt (appelé sous s.mu)
+func (s *Sessions) userRevokedSince(username string, createdAt time.Time) bool {
+	before, ok := s.revokedUser[username]
+	return ok && createdAt.Before(before)
+}
+
+// RevokeAccessToken révoque un jeton d'accès jusqu'à son expiration
+func (s *Sessions) RevokeAccessToken(jti, username string, expiresAt time.Time) error {
+	if jti == "" {
+		return nil
+	}
+	if err := s.st.PutRevokedToken(&store.RevokedToken{ID: jti, Username: username, ExpiresAt: expiresAt}); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.revoked[jti] = expiresAt
+	s.mu.Unlock()
+	return nil
+}
+
+// RevokeRefreshToken révoque la famille d'un jeton de rafraîchissement (déconnexion de la session).
+// Un jeton inconnu est ignoré.
+func (s *Sessions) RevokeRefreshToken(token string) error {
+	rt, err := s.st.GetRefreshToken(refreshTokenID(token))
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return s.revokeFamily(rt.Family, time.Now())
+}
+
+// RevokeUser révoque toutes les sessions d'un utilisateur : jetons d'accès émis jusqu'ici
+// et jetons de rafraîchissement
+func (s *Sessions) RevokeUser(username string) error {
+	now := time.Now()
+	// les "iat" sont à la seconde : un nouveau login dans la seconde courante reste valide
+	before := now.Truncate(time.Second)
+	if err := s.st.PutUserRevocation(&store.UserRevocation{Username: username, Before: before}); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.revokedUser[username] = before
+	s.mu.Unlock()
+	tokens, err := s.st.ListRefreshTokens(func(t *store.RefreshToken) bool {
+		return t.Username == username && t.RevokedAt == nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, t := range tokens {
+		t.RevokedAt = &now
+		if err := s.st.PutRefreshToken(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Sessions) revokeFamily(family string, now time.Time) error {
+	tokens, err := s.st.ListRefreshTokens(func(t *store.RefreshToken) bool {
+		return t.Family == family && t.RevokedAt == nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, t := range tokens {
+		t.RevokedAt = &now
+		if err := s.st.PutRefreshToken(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pruneIfDue supprime au plus une fois par heure les jetons et révocations expirés
+func (s *Sessions) pruneIfDue(now time.Time) {
+	s.mu.Lock()
+	due := now.Sub(s.prunedAt) >= sessionsPruneInterval
+	if due {
+		s.prunedAt = now
+	}
+	s.mu.Unlock()
+	if !due {
+		return
+	}
+	go func() {
+		if expired, err := s.st.ListRefreshTokens(func(t *store.RefreshToken) bool { return now.After(t.ExpiresAt) }); err == nil {
+			for _, t := range expired {
+				s.st.DeleteRefreshToken(t.ID)
+			}
+		}
+		if revoked, err := s.st.ListRevokedTokens(); err == nil {
+			for _, t := range revoked {
+				if now.After(t.ExpiresAt) {
+					s.st.DeleteRevokedToken(t.ID)
+				}
+			}
+		}
+	}()
+}
+
+// refreshTokenID : empreinte sous laquelle un jeton de rafraîchissement est stocké
+func refreshTokenID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
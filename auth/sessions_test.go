@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"druid-insight/store"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func testSessions(t *testing.T) *Sessions {
+	st, err := store.Open("file", "", t.TempDir())
+	if err != nil {
+		t.Fatalf("store.Open failed: %v", err)
+	}
+	s, err := NewSessions(st, time.Hour)
+	if err != nil {
+		t.Fatalf("NewSessions failed: %v", err)
+	}
+	return s
+}
+
+func TestSessions_RotateAndReuse(t *testing.T) {
+	s := testSessions(t)
+	first, err := s.IssueRefreshToken("alice", true, "")
+	if err != nil {
+		t.Fatalf("IssueRefreshToken failed: %v", err)
+	}
+	rt, second, err := s.Rotate(first)
+	if err != nil || rt.Username != "alice" || !rt.Admin || second == "" || second == first {
+		t.Fatalf("Expected rotation for alice, got %v %q (%v)", rt, second, err)
+	}
+	// réutilisation de l'ancien jeton : toute la famille est révoquée
+	if _, _, err := s.Rotate(first); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Errorf("Expected ErrRefreshTokenReused, got %v", err)
+	}
+	if _, _, err := s.Rotate(second); !errors.Is(err, ErrRefreshTokenInvalid) {
+		t.Errorf("Expected family revoked after reuse, got %v", err)
+	}
+	if _, _, err := s.Rotate("unknown"); !errors.Is(err, ErrRefreshTokenInvalid) {
+		t.Errorf("Expected ErrRefreshTokenInvalid for unknown token, got %v", err)
+	}
+}
+
+func TestSessions_RevocationCheckedOnExtract(t *testing.T) {
+	s := testSessions(t)
+	SetSessions(s)
+	defer SetSessions(nil)
+
+	token, _ := GenerateJWT("secret", "bob", false, 10)
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	tok, err := ParseAccessToken(req, "secret")
+	if err != nil {
+		t.Fatalf("ParseAccessToken failed: %v", err)
+	}
+	if err := s.RevokeAccessToken(tok.ID, tok.Username, tok.ExpiresAt); err != nil {
+		t.Fatalf("RevokeAccessToken failed: %v", err)
+	}
+	if _, _, err := ExtractUserAndAdminFromJWT(req, "secret"); err == nil {
+		t.Error("Expected revoked token to be rejected")
+	}
+
+	// révocation de l'utilisateur : jetons d'accès et de rafraîchissement existants
+	refresh, _ := s.IssueRefreshToken("carol", false, "")
+	old, _ := GenerateJWT("secret", "carol", false, 10)
+	time.Sleep(1100 * time.Millisecond)
+	if err := s.RevokeUser("carol"); err != nil {
+		t.Fatalf("RevokeUser failed: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+old)
+	if _, _, err := ExtractUserAndAdminFromJWT(req, "secret"); err == nil {
+		t.Error("Expected token issued before RevokeUser to be rejected")
+	}
+	if _, _, err := s.Rotate(refresh); !errors.Is(err, ErrRefreshTokenInvalid) {
+		t.Errorf("Expected refresh token revoked with user, got %v", err)
+	}
+	fresh, _ := GenerateJWT("secret", "carol", false, 10)
+	req.Header.Set("Authorization", "Bearer "+fresh)
+	if _, _, err := ExtractUserAndAdminFromJWT(req, "secret"); err != nil {
+		t.Errorf("Expected token issued after RevokeUser to be accepted, got %v", err)
+	}
+}
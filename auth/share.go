@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Portée d'un lien de partage
+const (
+	ShareKindSavedReport = "saved_report"
+	ShareKindResult      = "result"
+)
+
+// Identité sous laquelle un lien de partage est exécuté
+const (
+	ShareRunAsSharer = "sharer"
+	ShareRunAsViewer = "viewer"
+)
+
+var (
+	ErrShareTokenInvalid = errors.New("invalid share token")
+	ErrShareTokenExpired = errors.New("expired share token")
+)
+
+// ShareClaims : contenu signé d'un jeton de partage
+type ShareClaims struct {
+	ID        string `json:"id"`     // id du lien (pour la révocation)
+	Kind      string `json:"kind"`   // saved_report ou result
+	Target    string `json:"target"` // id du rapport sauvegardé ou du résultat
+	Sharer    string `json:"sharer"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// ShareSecret retourne la clé HMAC des liens de partage (jwt.secret par défaut)
+func (c *Config) ShareSecret() string {
+	if c.Share.Secret != "" {
+		return c.Share.Secret
+	}
+	return c.JWT.Secret
+}
+
+// ShareRunAs retourne l'identité d'exécution configurée pour les liens de partage
+func (c *Config) ShareRunAs() string {
+	if c.Share.RunAs == ShareRunAsViewer {
+		return ShareRunAsViewer
+	}
+	return ShareRunAsSharer
+}
+
+// SignShareToken produit un jeton "<payload base64url>.<hmac-sha256 base64url>"
+func SignShareToken(secret string, claims ShareClaims) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	p := base64.RawURLEncoding.EncodeToString(payload)
+	return p + "." + shareSignature(secret, p), nil
+}
+
+// VerifyShareToken contrôle la signature et l'expiration d'un jeton de partage
+func VerifyShareToken(secret, token string, now time.Time) (*ShareClaims, error) {
+	p, sig, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(shareSignature(secret, p))) {
+		return nil, ErrShareTokenInvalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(p)
+	if err != nil {
+		return nil, ErrShareTokenInvalid
+	}
+	var claims ShareClaims
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.ID == "" {
+		return nil, ErrShareTokenInvalid
+	}
+	if now.Unix() >= claims.ExpiresAt {
+		return nil, ErrShareTokenExpired
+	}
+	return &claims, nil
+}
+
+func shareSignature(secret, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestShareToken_SignAndVerify(t *testing.T) {
+	now := time.Now()
+	claims := ShareClaims{ID: "l1", Kind: ShareKindSavedReport, Target: "r1", Sharer: "alice", ExpiresAt: now.Add(time.Hour).Unix()}
+	token, err := SignShareToken("secret", claims)
+	if err != nil {
+		t.Fatalf("SignShareToken failed: %v", err)
+	}
+	got, err := VerifyShareToken("secret", token, now)
+	if err != nil {
+		t.Fatalf("VerifyShareToken failed: %v", err)
+	}
+	if *got != claims {
+		t.Errorf("Expected %+v, got %+v", claims, *got)
+	}
+}
+
+func TestShareToken_Rejected(t *testing.T) {
+	now := time.Now()
+	token, _ := SignShareToken("secret", ShareClaims{ID: "l1", Target: "r1", ExpiresAt: now.Add(time.Hour).Unix()})
+
+	if _, err := VerifyShareToken("other", token, now); err != ErrShareTokenInvalid {
+		t.Errorf("Expected ErrShareTokenInvalid with wrong secret, got %v", err)
+	}
+	forged, _ := SignShareToken("secret", ShareClaims{ID: "l1", Target: "r2", ExpiresAt: now.Add(time.Hour).Unix()})
+	tampered := forged[:len(forged)-43] + token[len(token)-43:]
+	if _, err := VerifyShareToken("secret", tampered, now); err != ErrShareTokenInvalid {
+		t.Errorf("Expected ErrShareTokenInvalid for swapped signature, got %v", err)
+	}
+	if _, err := VerifyShareToken("secret", token, now.Add(2*time.Hour)); err != ErrShareTokenExpired {
+		t.Errorf("Expected ErrShareTokenExpired, got %v", err)
+	}
+	if _, err := VerifyShareToken("secret", "garbage", now); err != ErrShareTokenInvalid {
+		t.Errorf("Expected ErrShareTokenInvalid for garbage, got %v", err)
+	}
+}
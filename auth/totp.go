@@ -0,0 +1,307 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"druid-insight/store"
+	"druid-insight/utils"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Paramètres TOTP (RFC 6238) compatibles avec les applications d'authentification courantes
+const (
+	totpPeriod        = 30
+	totpDigits        = 6
+	totpSkew          = 1 // pas de 30 s acceptés avant et après l'heure courante
+	totpSecretBytes   = 20
+	recoveryCodeCount = 10
+	MFAChallengeTTL   = 5 * time.Minute // délai pour saisir le code après le mot de passe
+	mfaMaxAttempts    = 5
+	mfaPruneInterval  = time.Hour
+)
+
+var (
+	ErrTOTPInvalid          = errors.New("invalid two-factor code")
+	ErrMFAChallengeInvalid  = errors.New("unknown or expired mfa token")
+	ErrTwoFactorEnabled     = errors.New("two-factor authentication already enabled")
+	ErrTwoFactorNotEnrolled = errors.New("two-factor authentication not enrolled")
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// totpCode calcule le code HOTP (RFC 4226) du pas step
+func totpCode(key []byte, step int64) string {
+	mac := hmac.New(sha1.New, key)
+	binary.Write(mac, binary.BigEndian, step)
+	sum := mac.Sum(nil)
+	off := sum[len(sum)-1] & 0x0f
+	v := binary.BigEndian.Uint32(sum[off:off+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, v%1000000)
+}
+
+// ProvisioningURI retourne l'URI otpauth:// à afficher en QR code pour l'application d'authentification
+func ProvisioningURI(issuer, username, secret string) string {
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", issuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprint(totpDigits))
+	q.Set("period", fmt.Sprint(totpPeriod))
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(username)
+	return "otpauth://totp/" + label + "?" + q.Encode()
+}
+
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(code, "-", ""))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// TwoFactorAuth gère l'inscription TOTP, les codes de secours et la seconde étape de connexion
+type TwoFactorAuth struct {
+	st       *store.Store
+	issuer   string
+	required []string
+	now      func() time.Time
+
+	mu       sync.Mutex // vérifications et anti-rejeu
+	prunedAt time.Time
+}
+
+// NewTwoFactorAuth retourne nil si la double authentification est désactivée
+func NewTwoFactorAuth(c TwoFactorConfig, st *store.Store) *TwoFactorAuth {
+	if c.Disabled {
+		return nil
+	}
+	a := &TwoFactorAuth{st: st, issuer: c.Issuer, required: c.RequiredRoles, now: time.Now}
+	if a.issuer == "" {
+		a.issuer = defaultJWTIssuer
+	}
+	if a.required == nil {
+		a.required = []string{RoleAdmin}
+	}
+	return a
+}
+
+// Required indique si l'un des rôles de l'utilisateur impose un second facteur
+func (a *TwoFactorAuth) Required(roles []string) bool {
+	for _, r := range roles {
+		if containsString(a.required, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// Status retourne le second facteur de l'utilisateur, nil s'il n'en a pas
+func (a *TwoFactorAuth) Status(username string) (*store.TwoFactor, error) {
+	t, err := a.st.GetTwoFactor(username)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, nil
+	}
+	return t, err
+}
+
+// Enrolled indique si l'utilisateur a un second facteur actif
+func (a *TwoFactorAuth) Enrolled(username string) (bool, error) {
+	t, err := a.Status(username)
+	return t != nil && t.Enabled, err
+}
+
+// BeginEnroll génère un nouveau secret, actif après confirmation d'un premier code
+func (a *TwoFactorAuth) BeginEnroll(username string) (secret, uri string, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if t, err := a.Status(username); err != nil {
+		return "", "", err
+	} else if t != nil && t.Enabled {
+		return "", "", ErrTwoFactorEnabled
+	}
+	key := make([]byte, totpSecretBytes)
+	if _, err := rand.Read(key); err != nil {
+		return "", "", err
+	}
+	secret = totpEncoding.EncodeToString(key)
+	t := &store.TwoFactor{Username: username, Secret: secret, CreatedAt: a.now()}
+	if err := a.st.PutTwoFactor(t); err != nil {
+		return "", "", err
+	}
+	return secret, ProvisioningURI(a.issuer, username, secret), nil
+}
+
+// ConfirmEnroll active le second facteur avec un premier code et retourne les codes de secours,
+// affichés une seule fois
+func (a *TwoFactorAuth) ConfirmEnroll(username, code string) ([]string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.confirm(username, code)
+}
+
+func (a *TwoFactorAuth) confirm(username, code string) ([]string, error) {
+	t, err := a.Status(username)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+	if t.Enabled {
+		return nil, ErrTwoFactorEnabled
+	}
+	if !a.checkTOTP(t, code) {
+		return nil, ErrTOTPInvalid
+	}
+	codes := make([]string, recoveryCodeCount)
+	t.RecoveryCodes = make([]string, recoveryCodeCount)
+	for i := range codes {
+		c := utils.RandomHex(5)
+		codes[i] = c[:5] + "-" + c[5:]
+		t.RecoveryCodes[i] = hashRecoveryCode(codes[i])
+	}
+	now := a.now()
+	t.Enabled, t.EnabledAt = true, &now
+	if err := a.st.PutTwoFactor(t); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Verify vérifie un code TOTP ou un code de secours (consommé) d'un second facteur actif
+func (a *TwoFactorAuth) Verify(username, code string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.verify(username, code)
+}
+
+func (a *TwoFactorAuth) verify(username, code string) error {
+	t, err := a.Status(username)
+	if err != nil {
+		return err
+	}
+	if t == nil || !t.Enabled {
+		return ErrTwoFactorNotEnrolled
+	}
+	if !a.checkTOTP(t, code) && !checkRecoveryCode(t, code) {
+		return ErrTOTPInvalid
+	}
+	return a.st.PutTwoFactor(t)
+}
+
+// checkTOTP accepte un code des pas voisins jamais utilisé et retient son pas (anti-rejeu)
+func (a *TwoFactorAuth) checkTOTP(t *store.TwoFactor, code string) bool {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != totpDigits {
+		return false
+	}
+	key, err := totpEncoding.DecodeString(t.Secret)
+	if err != nil {
+		return false
+	}
+	step := a.now().Unix() / totpPeriod
+	for s := step - totpSkew; s <= step+totpSkew; s++ {
+		if s > t.LastStep && subtle.ConstantTimeCompare([]byte(totpCode(key, s)), []byte(code)) == 1 {
+			t.LastStep = s
+			return true
+		}
+	}
+	return false
+}
+
+// checkRecoveryCode consomme un code de secours
+func checkRecoveryCode(t *store.TwoFactor, code string) bool {
+	h := hashRecoveryCode(strings.TrimSpace(code))
+	for i, rc := range t.RecoveryCodes {
+		if subtle.ConstantTimeCompare([]byte(rc), []byte(h)) == 1 {
+			t.RecoveryCodes = append(t.RecoveryCodes[:i], t.RecoveryCodes[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Disable supprime le second facteur après vérification d'un code
+func (a *TwoFactorAuth) Disable(username, code string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.verify(username, code); err != nil {
+		return err
+	}
+	return ResetTwoFactor(a.st, username)
+}
+
+// StartChallenge enregistre une connexion dont le mot de passe est vérifié et retourne le
+// mfa_token à présenter avec le code ; enroll : le code confirmera une inscription imposée
+func (a *TwoFactorAuth) StartChallenge(username string, admin, enroll bool) (string, error) {
+	now := a.now()
+	a.mu.Lock()
+	if now.Sub(a.prunedAt) >= mfaPruneInterval {
+		a.prunedAt = now
+		a.st.PruneMFAChallenges(now)
+	}
+	a.mu.Unlock()
+	c := &store.MFAChallenge{ID: randomToken(), Username: username, Admin: admin, Enroll: enroll, ExpiresAt: now.Add(MFAChallengeTTL)}
+	if err := a.st.PutMFAChallenge(c); err != nil {
+		return "", err
+	}
+	return c.ID, nil
+}
+
+// Challenge charge une connexion en attente du code
+func (a *TwoFactorAuth) Challenge(token string) (*store.MFAChallenge, error) {
+	c, err := a.st.GetMFAChallenge(token)
+	if errors.Is(err, store.ErrNotFound) || (err == nil && a.now().After(c.ExpiresAt)) {
+		return nil, ErrMFAChallengeInvalid
+	}
+	return c, err
+}
+
+// CompleteChallenge vérifie le code de la seconde étape (ou confirme l'inscription, avec les
+// codes de secours). Le mfa_token n'est utilisable qu'une fois et tombe après 5 codes faux.
+func (a *TwoFactorAuth) CompleteChallenge(token, code string) (*store.MFAChallenge, []string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	c, err := a.Challenge(token)
+	if err != nil {
+		return nil, nil, err
+	}
+	var recovery []string
+	if c.Enroll {
+		recovery, err = a.confirm(c.Username, code)
+	} else {
+		err = a.verify(c.Username, code)
+	}
+	if errors.Is(err, ErrTOTPInvalid) {
+		if c.Attempts++; c.Attempts >= mfaMaxAttempts {
+			a.st.DeleteMFAChallenge(c.ID)
+		} else {
+			a.st.PutMFAChallenge(c)
+		}
+		return c, nil, err
+	}
+	if err != nil {
+		return c, nil, err
+	}
+	a.st.DeleteMFAChallenge(c.ID)
+	return c, recovery, nil
+}
+
+// ResetTwoFactor supprime le second facteur d'un utilisateur (userctl) : il devra s'inscrire à
+// nouveau si son rôle l'impose
+func ResetTwoFactor(st *store.Store, username string) error {
+	err := st.DeleteTwoFactor(username)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	}
+	return err
+}
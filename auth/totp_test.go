@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"druid-insight/store"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testTwoFactor(t *testing.T, now *time.Time) *TwoFactorAuth {
+	st, err := store.Open("file", "", t.TempDir())
+	if err != nil {
+		t.Fatalf("store.Open failed: %v", err)
+	}
+	a := NewTwoFactorAuth(TwoFactorConfig{}, st)
+	a.now = func() time.Time { return *now }
+	return a
+}
+
+func currentCode(t *testing.T, secret string, now time.Time) string {
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil {
+		t.Fatalf("bad secret %q: %v", secret, err)
+	}
+	return totpCode(key, now.Unix()/totpPeriod)
+}
+
+func TestTOTPCode_RFC6238(t *testing.T) {
+	// RFC 6238 annexe B (SHA1), tronqué à 6 chiffres
+	key := []byte("12345678901234567890")
+	for ts, want := range map[int64]string{59: "287082", 1111111109: "081804", 1234567890: "005924", 2000000000: "279037"} {
+		if got := totpCode(key, ts/totpPeriod); got != want {
+			t.Errorf("T=%d: expected %s, got %s", ts, want, got)
+		}
+	}
+	uri := ProvisioningURI("druid insight", "bob", "ABC")
+	if !strings.HasPrefix(uri, "otpauth://totp/druid%20insight:bob?") || !strings.Contains(uri, "secret=ABC") {
+		t.Errorf("Unexpected provisioning URI %q", uri)
+	}
+}
+
+func TestTwoFactor_EnrollVerifyRecovery(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	a := testTwoFactor(t, &now)
+	if !a.Required([]string{RoleAdmin}) || a.Required([]string{RoleUser}) {
+		t.Error("Expected a second factor required for admins only by default")
+	}
+
+	secret, uri, err := a.BeginEnroll("bob")
+	if err != nil || !strings.Contains(uri, "secret="+secret) {
+		t.Fatalf("BeginEnroll failed: %v %q", err, uri)
+	}
+	if ok, _ := a.Enrolled("bob"); ok {
+		t.Error("Expected enrollment pending until confirmed")
+	}
+	if _, err := a.ConfirmEnroll("bob", "000000"); !errors.Is(err, ErrTOTPInvalid) {
+		t.Errorf("Expected ErrTOTPInvalid, got %v", err)
+	}
+	codes, err := a.ConfirmEnroll("bob", currentCode(t, secret, now))
+	if err != nil || len(codes) != recoveryCodeCount {
+		t.Fatalf("ConfirmEnroll failed: %v %v", err, codes)
+	}
+	if _, _, err := a.BeginEnroll("bob"); !errors.Is(err, ErrTwoFactorEnabled) {
+		t.Errorf("Expected ErrTwoFactorEnabled, got %v", err)
+	}
+
+	// le code de la confirmation ne peut pas être rejoué
+	if err := a.Verify("bob", currentCode(t, secret, now)); !errors.Is(err, ErrTOTPInvalid) {
+		t.Errorf("Expected replayed code refused, got %v", err)
+	}
+	now = now.Add(totpPeriod * time.Second)
+	if err := a.Verify("bob", currentCode(t, secret, now)); err != nil {
+		t.Errorf("Expected next code accepted, got %v", err)
+	}
+	// code de secours : insensible à la casse, une seule fois
+	if err := a.Verify("bob", strings.ToUpper(codes[0])); err != nil {
+		t.Errorf("Expected recovery code accepted, got %v", err)
+	}
+	if err := a.Verify("bob", codes[0]); !errors.Is(err, ErrTOTPInvalid) {
+		t.Errorf("Expected used recovery code refused, got %v", err)
+	}
+	if s, _ := a.Status("bob"); len(s.RecoveryCodes) != recoveryCodeCount-1 {
+		t.Errorf("Expected %d recovery codes left, got %d", recoveryCodeCount-1, len(s.RecoveryCodes))
+	}
+
+	if err := ResetTwoFactor(a.st, "bob"); err != nil {
+		t.Fatalf("ResetTwoFactor failed: %v", err)
+	}
+	if s, _ := a.Status("bob"); s != nil {
+		t.Errorf("Expected no second factor after reset, got %+v", s)
+	}
+}
+
+func TestTwoFactor_Challenge(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	a := testTwoFactor(t, &now)
+
+	// inscription imposée à la connexion : le premier code confirme et retourne les codes de secours
+	secret, _, _ := a.BeginEnroll("admin")
+	token, err := a.StartChallenge("admin", true, true)
+	if err != nil {
+		t.Fatalf("StartChallenge failed: %v", err)
+	}
+	c, codes, err := a.CompleteChallenge(token, currentCode(t, secret, now))
+	if err != nil || c.Username != "admin" || !c.Admin || len(codes) != recoveryCodeCount {
+		t.Fatalf("Expected enrollment completed, got %+v %v %v", c, codes, err)
+	}
+	if _, _, err := a.CompleteChallenge(token, codes[0]); !errors.Is(err, ErrMFAChallengeInvalid) {
+		t.Errorf("Expected single-use mfa token, got %v", err)
+	}
+
+	// cinq codes faux invalident le mfa_token
+	token, _ = a.StartChallenge("admin", true, false)
+	for i := 0; i < mfaMaxAttempts; i++ {
+		if _, _, err := a.CompleteChallenge(token, "000000"); !errors.Is(err, ErrTOTPInvalid) {
+			t.Fatalf("Expected ErrTOTPInvalid, got %v", err)
+		}
+	}
+	if _, _, err := a.CompleteChallenge(token, codes[1]); !errors.Is(err, ErrMFAChallengeInvalid) {
+		t.Errorf("Expected mfa token dropped after too many attempts, got %v", err)
+	}
+
+	// expiration
+	token, _ = a.StartChallenge("admin", true, false)
+	now = now.Add(MFAChallengeTTL + time.Second)
+	if _, err := a.Challenge(token); !errors.Is(err, ErrMFAChallengeInvalid) {
+		t.Errorf("Expected expired mfa token, got %v", err)
+	}
+
+	if NewTwoFactorAuth(TwoFactorConfig{Disabled: true}, a.st) != nil {
+		t.Error("Expected no two-factor auth when disabled")
+	}
+	if b := NewTwoFactorAuth(TwoFactorConfig{RequiredRoles: []string{}}, a.st); b.Required([]string{RoleAdmin}) {
+		t.Error("Expected an empty required_roles to make the second factor optional")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/sha1"
 	"crypto/sha256"
 	"database/sql"
+	"druid-insight/store"
 	"druid-insight/utils"
 	"encoding/hex"
 	"errors"
@@ -12,6 +13,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -28,18 +30,168 @@ type Config struct {
 	JWT struct {
 		Secret            string `yaml:"secret"`
 		ExpirationMinutes int    `yaml:"expiration_minutes"`
+
+		RefreshExpirationMinutes int `yaml:"refresh_expiration_minutes"` // durée de vie des jetons de rafraîchissement (défaut 7 jours)
+
+		Issuer        string `yaml:"issuer"`         // claim iss émise et exigée (défaut "druid-insight")
+		Audience      string `yaml:"audience"`       // claim aud émise et exigée (défaut "druid-insight")
+		LeewaySeconds int    `yaml:"leeway_seconds"` // tolérance d'horloge sur exp/nbf/iat (défaut 0)
+
+		Algorithm            string `yaml:"algorithm"`              // HS256 (défaut, jwt.secret), RS256 ou ES256
+		KeysDir              string `yaml:"keys_dir"`               // clés privées <kid>.pem (défaut "keys")
+		RotationDays         int    `yaml:"rotation_days"`          // rotation automatique des clés, 0 = désactivée
+		KeyPrepublishMinutes int    `yaml:"key_prepublish_minutes"` // publication JWKS avant usage (défaut 60)
 	} `yaml:"jwt"`
 	Auth struct {
-		UserBackend string `yaml:"user_backend"` // "file", "mysql", "postgres", "sqlite"
+		UserBackend string `yaml:"user_backend"` // "file", "mysql", "postgres", "sqlite", "ldap", "oidc"
 		UserFile    string `yaml:"user_file"`
 		HashMacro   string `yaml:"hash_macro"`
 		Salt        string `yaml:"salt"`
 		DBDSN       string `yaml:"db_dsn"`
 		UserRequest string `yaml:"user_request"` // ex: SELECT hash, salt, is_admin FROM users WHERE name = ? AND pass = ?
-		DBHashMacro string `yaml:"db_hash_macro"`
-		DBPassHash  bool   `yaml:"db_pass_hash"`
+		// relecture d'un utilisateur sans mot de passe (as_user, rafraîchissement, planifications)
+		UserLookupRequest string `yaml:"user_lookup_request"` // ex: SELECT is_admin FROM users WHERE name = ?
+		DBHashMacro       string `yaml:"db_hash_macro"`
+		DBPassHash        bool   `yaml:"db_pass_hash"`
+		// anciennes macros acceptées à la connexion ; le mot de passe est alors re-haché avec la macro courante
+		LegacyHashMacros []string `yaml:"legacy_hash_macros"`
+		DBRehashRequest  string   `yaml:"db_rehash_request"` // ex: UPDATE users SET hash = ?, salt = ? WHERE name = ?
+		TeamRequest      string   `yaml:"team_request"`      // ex: SELECT team FROM users WHERE name = ?
+		RoleRequest      string   `yaml:"role_request"`      // ex: SELECT role FROM user_roles WHERE name = ?
 	} `yaml:"auth"`
 	Context map[string]string `yaml:"context"` // contexte global pour les requêtes Druid{
+	Cache   struct {
+		Enabled         bool   `yaml:"enabled"`
+		Dir             string `yaml:"dir"`               // vide = cache mémoire uniquement
+		TTLSeconds      int    `yaml:"ttl_seconds"`       // durée de vie par défaut (défaut 3600)
+		TodayTTLSeconds int    `yaml:"today_ttl_seconds"` // durée de vie si l'intervalle touche aujourd'hui (défaut 300)
+		MaxEntries      int    `yaml:"max_entries"`       // nombre max d'entrées en mémoire
+		MaxDiskEntries  int    `yaml:"max_disk_entries"`  // nombre max de fichiers dans dir
+	} `yaml:"cache"`
+	Storage struct {
+		Backend string `yaml:"backend"` // "file", "mysql", "postgres", "sqlite" ; vide = même backend que les utilisateurs
+		DBDSN   string `yaml:"db_dsn"`  // vide = auth.db_dsn
+		Dir     string `yaml:"dir"`     // répertoire du backend "file"
+	} `yaml:"storage"`
+	Share struct {
+		Secret            string `yaml:"secret"`              // vide = jwt.secret
+		DefaultTTLMinutes int    `yaml:"default_ttl_minutes"` // durée de vie par défaut d'un lien
+		MaxTTLMinutes     int    `yaml:"max_ttl_minutes"`     // durée de vie maximale demandable
+		RunAs             string `yaml:"run_as"`              // "sharer" (défaut) ou "viewer"
+		BaseURL           string `yaml:"base_url"`            // préfixe des URLs retournées, ex: https://insight.example.com
+	} `yaml:"share"`
+	SMTP struct {
+		Host               string   `yaml:"host"` // vide = envoi d'e-mails désactivé
+		Port               int      `yaml:"port"`
+		TLS                string   `yaml:"tls"` // "none", "starttls" (défaut) ou "tls"
+		InsecureSkipVerify bool     `yaml:"insecure_skip_verify"`
+		Username           string   `yaml:"username"`
+		Password           string   `yaml:"password"`
+		From               string   `yaml:"from"`
+		SubjectTemplate    string   `yaml:"subject_template"`     // text/template
+		BodyTemplate       string   `yaml:"body_template"`        // text/template
+		MaxAttachmentBytes int64    `yaml:"max_attachment_bytes"` // au-delà, lien de téléchargement signé
+		LinkTTLMinutes     int      `yaml:"link_ttl_minutes"`     // durée de vie du lien de téléchargement
+		AllowedDomains     []string `yaml:"allowed_domains"`      // domaines destinataires autorisés, vide = tous
+	} `yaml:"smtp"`
+	LDAP     LDAPConfig      `yaml:"ldap"`
+	OIDC     OIDCConfig      `yaml:"oidc"`
+	Webhooks []WebhookConfig `yaml:"webhooks"`
+
+	RBAC            RBACConfig            `yaml:"rbac"`
+	LoginProtection LoginProtectionConfig `yaml:"login_protection"` // activée par défaut
+	TwoFactor       TwoFactorConfig       `yaml:"two_factor"`
+
+	History struct {
+		RetentionDays int `yaml:"retention_days"` // durée de conservation de l'historique (défaut 90, -1 = illimitée)
+	} `yaml:"history"`
+}
+
+// LoginProtectionConfig : limitation des tentatives de connexion (login_protection)
+type LoginProtectionConfig struct {
+	Disabled          bool `yaml:"disabled"`
+	WindowSeconds     int  `yaml:"window_seconds"`      // fenêtre glissante des échecs (défaut 900)
+	MaxUserFailures   int  `yaml:"max_user_failures"`   // échecs par utilisateur avant verrouillage (défaut 5)
+	MaxIPFailures     int  `yaml:"max_ip_failures"`     // échecs par adresse IP avant verrouillage (défaut 20)
+	LockoutSeconds    int  `yaml:"lockout_seconds"`     // premier verrouillage, doublé à chaque récidive (défaut 60)
+	MaxLockoutSeconds int  `yaml:"max_lockout_seconds"` // plafond (défaut 3600)
+	TrustForwardedFor bool `yaml:"trust_forwarded_for"` // adresse client lue dans X-Forwarded-For (derrière un proxy)
+}
+
+// LDAPConfig : annuaire LDAP / Active Directory (auth.user_backend: ldap)
+type LDAPConfig struct {
+	URL                string   `yaml:"url"`       // ldap://host:389 ou ldaps://host:636
+	StartTLS           bool     `yaml:"start_tls"` // StartTLS sur une URL ldap://
+	CAFile             string   `yaml:"ca_file"`
+	InsecureSkipVerify bool     `yaml:"insecure_skip_verify"`
+	BindDN             string   `yaml:"bind_dn"` // compte de service pour la recherche (vide = anonyme)
+	BindPassword       string   `yaml:"bind_password"`
+	BaseDN             string   `yaml:"base_dn"`
+	UserFilter         string   `yaml:"user_filter"`     // ex: (&(objectClass=user)(sAMAccountName={username}))
+	GroupAttribute     string   `yaml:"group_attribute"` // attribut des groupes de l'utilisateur (défaut memberOf)
+	GroupBaseDN        string   `yaml:"group_base_dn"`   // recherche des groupes, avec group_filter
+	GroupFilter        string   `yaml:"group_filter"`    // ex: (member={dn}) ; vide = group_attribute
+	TeamAttribute      string   `yaml:"team_attribute"`  // ex: department
+	AdminGroups        []string `yaml:"admin_groups"`    // DN des groupes administrateurs
+	// DN de groupe => datasource => dimension => valeurs autorisées (union des groupes)
+	AccessGroups    map[string]map[string]map[string][]string `yaml:"access_groups"`
+	CacheTTLSeconds int                                       `yaml:"cache_ttl_seconds"` // cache des recherches (défaut 300)
+	TimeoutSeconds  int                                       `yaml:"timeout_seconds"`   // défaut 10
+}
+
+// RBACConfig : rôles nommés et groupes (rbac). Sans rôle défini, les rôles intégrés "admin" et
+// "user" reproduisent l'ancien drapeau admin.
+type RBACConfig struct {
+	Roles        map[string]RoleConfig  `yaml:"roles"`
+	Groups       map[string]GroupConfig `yaml:"groups"`
+	DefaultRoles []string               `yaml:"default_roles"` // rôles des utilisateurs sans rôle (défaut [user])
+}
+
+// RoleConfig : droits accordés par un rôle. Les champs de druid.yaml qui citent le rôle dans
+// "roles" forment ses ensembles de dimensions et de métriques.
+type RoleConfig struct {
+	Datasources  []string `yaml:"datasources"`  // datasources accessibles, "*" = toutes
+	Capabilities []string `yaml:"capabilities"` // export, schedule, explain, admin
+}
+
+// GroupConfig : groupe d'utilisateurs recevant des rôles
+type GroupConfig struct {
+	Roles           []string `yaml:"roles"`
+	Members         []string `yaml:"members"`          // noms d'utilisateurs
+	DirectoryGroups []string `yaml:"directory_groups"` // DN LDAP ou groupes OIDC dont les membres font partie du groupe
+}
+
+// TwoFactorConfig : double authentification TOTP (two_factor)
+type TwoFactorConfig struct {
+	Disabled bool   `yaml:"disabled"`
+	Issuer   string `yaml:"issuer"` // nom affiché par l'application d'authentification (défaut "druid-insight")
+	// rôles rbac tenus d'utiliser un second facteur (défaut [admin], [] = facultatif pour tous)
+	RequiredRoles []string `yaml:"required_roles"`
+}
+
+// OIDCConfig : fournisseur d'identité OpenID Connect (auth.user_backend: oidc)
+type OIDCConfig struct {
+	Issuer        string   `yaml:"issuer"` // URL de découverte (/.well-known/openid-configuration)
+	ClientID      string   `yaml:"client_id"`
+	ClientSecret  string   `yaml:"client_secret"`
+	RedirectURL   string   `yaml:"redirect_url"`   // ex: https://insight.example.com/api/oidc/callback
+	Scopes        []string `yaml:"scopes"`         // défaut openid, profile, email
+	UsernameClaim string   `yaml:"username_claim"` // défaut preferred_username
+	GroupsClaim   string   `yaml:"groups_claim"`   // défaut groups
+	TeamClaim     string   `yaml:"team_claim"`
+	AdminGroups   []string `yaml:"admin_groups"` // valeurs de groups_claim donnant le rôle admin
+	// valeur de groups_claim => datasource => dimension => valeurs autorisées (union des groupes)
+	AccessGroups   map[string]map[string]map[string][]string `yaml:"access_groups"`
+	TimeoutSeconds int                                       `yaml:"timeout_seconds"` // défaut 10
+}
+
+// WebhookConfig : destination appelée à chaque fin de rapport
+type WebhookConfig struct {
+	URL            string   `yaml:"url"`
+	Secret         string   `yaml:"secret"`          // clé HMAC-SHA256 de la signature
+	Events         []string `yaml:"events"`          // complete, error, cancelled ; vide = tous
+	MaxAttempts    int      `yaml:"max_attempts"`    // tentatives avant abandon (défaut 5)
+	TimeoutSeconds int      `yaml:"timeout_seconds"` // timeout d'une tentative (défaut 10)
 }
 
 type UsersFile struct {
@@ -50,7 +202,10 @@ type UserInfo struct {
 	Hash   string                         `yaml:"hash"`
 	Salt   string                         `yaml:"salt"`
 	Admin  bool                           `yaml:"admin"`
+	Team   string                         `yaml:"team,omitempty"`
 	Access map[string]map[string][]string `yaml:"access,omitempty"` // si tu as ajouté la partie droits
+	Roles  []string                       `yaml:"roles,omitempty"`  // rôles rbac
+	Groups []string                       `yaml:"groups,omitempty"` // groupes rbac
 }
 
 func LoadConfig(file string) (*Config, error) {
@@ -68,6 +223,7 @@ func LoadConfig(file string) (*Config, error) {
 }
 
 func LoadUsers(file string) (*UsersFile, error) {
+	resetRehashed()
 	var uf UsersFile
 	root := utils.GetProjectRoot()
 	cfgPath := filepath.Join(root, file)
@@ -94,6 +250,132 @@ func GetUserFromDB(db *sql.DB, query, username string, password string) (hash, s
 	return
 }
 
+// ErrUserNotFound : l'utilisateur n'existe plus dans son backend (supprimé, désactivé)
+var ErrUserNotFound = errors.New("user not found")
+
+// LookupUserAdmin relit l'utilisateur dans son backend, hors connexion : ErrUserNotFound s'il a
+// disparu, sinon son drapeau admin actuel. users est le users.yaml chargé (backend file).
+func LookupUserAdmin(username string, users *UsersFile, cfg *Config) (bool, error) {
+	switch cfg.Auth.UserBackend {
+	case "file", "":
+		if users == nil {
+			return false, errors.New("users file not loaded")
+		}
+		u, ok := users.Users[username]
+		if !ok {
+			return false, ErrUserNotFound
+		}
+		return u.Admin, nil
+	case "ldap":
+		u, err := LDAP().Lookup(username)
+		if errors.Is(err, ErrLDAPUserNotFound) {
+			return false, ErrUserNotFound
+		}
+		if err != nil {
+			return false, err
+		}
+		return u.Admin, nil
+	case "oidc":
+		u, err := OIDC().Profile(username)
+		if errors.Is(err, store.ErrNotFound) {
+			return false, ErrUserNotFound
+		}
+		if err != nil {
+			return false, err
+		}
+		return u.Admin, nil
+	}
+	return getUserAdminFromDB(username, cfg)
+}
+
+// getUserAdminFromDB exécute auth.user_lookup_request (username) : aucune ligne = utilisateur supprimé
+func getUserAdminFromDB(username string, cfg *Config) (bool, error) {
+	if cfg.Auth.UserLookupRequest == "" {
+		return false, errors.New("auth.user_lookup_request not configured")
+	}
+	db, err := sql.Open(cfg.Auth.UserBackend, cfg.Auth.DBDSN)
+	if err != nil {
+		return false, err
+	}
+	defer db.Close()
+	var adminVal interface{}
+	err = db.QueryRow(cfg.Auth.UserLookupRequest, username).Scan(&adminVal)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, ErrUserNotFound
+	}
+	if err != nil {
+		return false, err
+	}
+	return dbToBool(adminVal), nil
+}
+
+// GetUserTeam retourne l'équipe de l'utilisateur (users.yaml ou auth.team_request), "" si aucune
+func GetUserTeam(username string, users *UsersFile, cfg *Config) string {
+	if users != nil {
+		return users.Users[username].Team
+	}
+	if cfg.Auth.UserBackend == "ldap" {
+		if u, err := LDAP().Lookup(username); err == nil {
+			return u.Team
+		}
+		return ""
+	}
+	if cfg.Auth.UserBackend == "oidc" {
+		if u, err := oidcProvider.Profile(username); err == nil {
+			return u.Team
+		}
+		return ""
+	}
+	if cfg.Auth.TeamRequest == "" || cfg.Auth.UserBackend == "file" || cfg.Auth.UserBackend == "" {
+		return ""
+	}
+	db, err := sql.Open(cfg.Auth.UserBackend, cfg.Auth.DBDSN)
+	if err != nil {
+		log.Println(err)
+		return ""
+	}
+	defer db.Close()
+	var team sql.NullString
+	if err := db.QueryRow(cfg.Auth.TeamRequest, username).Scan(&team); err != nil {
+		return ""
+	}
+	return team.String
+}
+
+// StorageSettings retourne backend, DSN et répertoire du stockage applicatif (rapports sauvegardés...),
+// par défaut alignés sur le backend utilisateurs.
+func (c *Config) StorageSettings() (backend, dsn, dir string) {
+	backend, dsn, dir = c.Storage.Backend, c.Storage.DBDSN, c.Storage.Dir
+	if backend == "" {
+		backend = c.Auth.UserBackend
+	}
+	if backend == "ldap" || backend == "oidc" {
+		backend = "file"
+	}
+	if backend == "" {
+		backend = "file"
+	}
+	if dsn == "" {
+		dsn = c.Auth.DBDSN
+	}
+	if dir == "" {
+		dir = "data"
+	}
+	return
+}
+
+// HistoryRetention retourne la durée de conservation de l'historique des rapports (0 = illimitée)
+func (c *Config) HistoryRetention() time.Duration {
+	switch days := c.History.RetentionDays; {
+	case days < 0:
+		return 0
+	case days == 0:
+		return 90 * 24 * time.Hour
+	default:
+		return time.Duration(days) * 24 * time.Hour
+	}
+}
+
 func dbToBool(v interface{}) bool {
 	switch val := v.(type) {
 	case bool:
@@ -111,11 +393,7 @@ func dbToBool(v interface{}) bool {
 
 func ApplyHashMacro(macro, password, user, userSalt, globalSalt string) (string, error) {
 	replace := func(s string) string {
-		s = strings.ReplaceAll(s, "{password}", password)
-		s = strings.ReplaceAll(s, "{user}", user)
-		s = strings.ReplaceAll(s, "{salt}", userSalt)
-		s = strings.ReplaceAll(s, "{globalsalt}", globalSalt)
-		return s
+		return expandMacro(s, password, user, userSalt, globalSalt)
 	}
 	macro = strings.TrimSpace(macro)
 	if strings.HasPrefix(macro, "{sha256}") {
@@ -133,6 +411,16 @@ func ApplyHashMacro(macro, password, user, userSalt, globalSalt string) (string,
 		plain = replace(plain)
 		return md5Hash(plain), nil
 	}
+	if strings.HasPrefix(macro, "{bcrypt}") {
+		plain := extractBetween(macro, "{bcrypt}(", ")")
+		plain = replace(plain)
+		return bcryptHash(plain)
+	}
+	if strings.HasPrefix(macro, "{argon2id}") {
+		plain := extractBetween(macro, "{argon2id}(", ")")
+		plain = replace(plain)
+		return argon2idHash(plain)
+	}
 	if strings.HasPrefix(macro, "{clear}") {
 		plain := extractBetween(macro, "{clear}(", ")")
 		plain = replace(plain)
@@ -141,6 +429,15 @@ func ApplyHashMacro(macro, password, user, userSalt, globalSalt string) (string,
 	return "", errors.New("unsupported hash macro")
 }
 
+// expandMacro remplace les variables {password}, {user}, {salt} et {globalsalt}
+func expandMacro(s, password, user, userSalt, globalSalt string) string {
+	s = strings.ReplaceAll(s, "{password}", password)
+	s = strings.ReplaceAll(s, "{user}", user)
+	s = strings.ReplaceAll(s, "{salt}", userSalt)
+	s = strings.ReplaceAll(s, "{globalsalt}", globalSalt)
+	return s
+}
+
 func extractBetween(str, start, end string) string {
 	a := strings.Index(str, start)
 	if a == -1 {
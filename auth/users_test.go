@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"errors"
 	"testing"
 )
 
@@ -100,3 +101,22 @@ func TestApplyHashMacro(t *testing.T) {
 		t.Error("ApplyHashMacro should fail for unsupported macro")
 	}
 }
+
+func TestLookupUserAdmin_File(t *testing.T) {
+	cfg := &Config{}
+	cfg.Auth.UserBackend = "file"
+	users := &UsersFile{Users: map[string]UserInfo{"root": {Admin: true}, "alice": {}}}
+	if admin, err := LookupUserAdmin("root", users, cfg); err != nil || !admin {
+		t.Errorf("Expected root to be admin, got %v %v", admin, err)
+	}
+	if admin, err := LookupUserAdmin("alice", users, cfg); err != nil || admin {
+		t.Errorf("Expected alice not to be admin, got %v %v", admin, err)
+	}
+	if _, err := LookupUserAdmin("ghost", users, cfg); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
+	}
+	cfg.Auth.UserBackend = "mysql"
+	if _, err := LookupUserAdmin("root", nil, cfg); err == nil || errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected a configuration error without user_lookup_request, got %v", err)
+	}
+}
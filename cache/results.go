@@ -0,0 +1,270 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Valeurs par défaut de la section cache de config.yaml
+const (
+	DefaultTTL            = time.Hour
+	DefaultTodayTTL       = 5 * time.Minute
+	DefaultMaxEntries     = 500
+	DefaultMaxDiskEntries = 5000
+	diskPruneInterval     = time.Minute
+)
+
+// Statut de cache remonté dans /api/reports/status
+const (
+	StatusHit      = "hit"
+	StatusMiss     = "miss"
+	StatusDisabled = ""
+)
+
+// entry : résultat Druid en cache (mémoire et disque)
+type entry struct {
+	Datasource string                   `json:"datasource"`
+	CreatedAt  time.Time                `json:"created_at"`
+	ExpiresAt  time.Time                `json:"expires_at"`
+	Results    []map[string]interface{} `json:"results"`
+}
+
+// ResultCache met en cache les résultats des requêtes de rapport, en mémoire et
+// (si dir est renseigné) sur disque pour survivre aux redémarrages.
+type ResultCache struct {
+	dir            string
+	ttl            time.Duration
+	todayTTL       time.Duration
+	maxEntries     int
+	maxDiskEntries int
+
+	mu       sync.Mutex
+	entries  map[string]*entry
+	prunedAt time.Time
+}
+
+// NewResultCache crée le cache. todayTTL s'applique aux requêtes dont un intervalle
+// touche la journée en cours (données encore en cours d'ingestion). Les valeurs nulles
+// prennent les valeurs par défaut ; maxDiskEntries borne le nombre de fichiers de dir.
+func NewResultCache(dir string, ttl, todayTTL time.Duration, maxEntries, maxDiskEntries int) (*ResultCache, error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	if todayTTL <= 0 {
+		todayTTL = DefaultTodayTTL
+	}
+	if todayTTL > ttl {
+		todayTTL = ttl
+	}
+	if maxEntries <= 0 {
+		maxEntries = DefaultMaxEntries
+	}
+	if maxDiskEntries <= 0 {
+		maxDiskEntries = DefaultMaxDiskEntries
+	}
+	c := &ResultCache{
+		dir:            dir,
+		ttl:            ttl,
+		todayTTL:       todayTTL,
+		maxEntries:     maxEntries,
+		maxDiskEntries: maxDiskEntries,
+		entries:        map[string]*entry{},
+	}
+	c.pruneDisk(time.Now())
+	return c, nil
+}
+
+// Key calcule le hash canonique de la requête Druid finale (filtres d'accès compris).
+// Le contexte de requête (application, timeout) n'influence pas le résultat et est ignoré.
+func Key(cluster string, query interface{}) string {
+	raw, _ := json.Marshal(query)
+	var canonical interface{}
+	_ = json.Unmarshal(raw, &canonical)
+	if m, ok := canonical.(map[string]interface{}); ok {
+		delete(m, "context")
+	}
+	// json.Marshal trie les clés des maps : la sérialisation est stable
+	b, _ := json.Marshal(map[string]interface{}{"cluster": cluster, "query": canonical})
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+// TouchesToday indique si un des intervalles ISO "start/end" déborde sur la journée en cours
+func TouchesToday(intervals []string, now time.Time) bool {
+	y, m, d := now.Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+	for _, itv := range intervals {
+		parts := strings.SplitN(itv, "/", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		end, err := time.Parse(time.RFC3339, parts[1])
+		if err != nil || end.After(today) {
+			return true
+		}
+	}
+	return len(intervals) == 0
+}
+
+// Get retourne les résultats en cache pour key, s'ils existent et ne sont pas expirés
+func (c *ResultCache) Get(key string) ([]map[string]interface{}, bool) {
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		if e.ExpiresAt.After(now) {
+			return e.Results, true
+		}
+		delete(c.entries, key)
+	}
+	e := c.readDisk(key)
+	if e == nil {
+		return nil, false
+	}
+	if !e.ExpiresAt.After(now) {
+		os.Remove(c.path(key))
+		return nil, false
+	}
+	c.storeMemory(key, e)
+	return e.Results, true
+}
+
+// Set met en cache les résultats, avec un TTL réduit si les intervalles touchent aujourd'hui
+func (c *ResultCache) Set(key, datasource string, intervals []string, results []map[string]interface{}) {
+	now := time.Now()
+	ttl := c.ttl
+	if TouchesToday(intervals, now) {
+		ttl = c.todayTTL
+	}
+	e := &entry{Datasource: datasource, CreatedAt: now, ExpiresAt: now.Add(ttl), Results: results}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.storeMemory(key, e)
+	c.writeDisk(key, e)
+	if now.Sub(c.prunedAt) >= diskPruneInterval {
+		c.pruneDisk(now)
+	}
+}
+
+// pruneDisk supprime les fichiers expirés puis, au-delà de maxDiskEntries, les plus anciens.
+// Seule la date de modification est lue : un fichier plus vieux que ttl est forcément expiré.
+func (c *ResultCache) pruneDisk(now time.Time) {
+	c.prunedAt = now
+	if c.dir == "" {
+		return
+	}
+	files, _ := filepath.Glob(filepath.Join(c.dir, "*.json"))
+	type diskFile struct {
+		path    string
+		modTime time.Time
+	}
+	var kept []diskFile
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			continue
+		}
+		if now.Sub(info.ModTime()) >= c.ttl {
+			os.Remove(f)
+			continue
+		}
+		kept = append(kept, diskFile{f, info.ModTime()})
+	}
+	if len(kept) <= c.maxDiskEntries {
+		return
+	}
+	sort.Slice(kept, func(i, j int) bool { return kept[i].modTime.Before(kept[j].modTime) })
+	for _, f := range kept[:len(kept)-c.maxDiskEntries] {
+		os.Remove(f.path)
+	}
+}
+
+// Purge vide le cache (ou seulement les entrées d'une datasource) et retourne le nombre d'entrées supprimées
+func (c *ResultCache) Purge(datasource string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	purged := map[string]bool{}
+	for key, e := range c.entries {
+		if datasource == "" || e.Datasource == datasource {
+			delete(c.entries, key)
+			purged[key] = true
+		}
+	}
+	if c.dir != "" {
+		files, _ := filepath.Glob(filepath.Join(c.dir, "*.json"))
+		for _, f := range files {
+			key := strings.TrimSuffix(filepath.Base(f), ".json")
+			if datasource != "" {
+				e := c.readDisk(key)
+				if e == nil || e.Datasource != datasource {
+					continue
+				}
+			}
+			if os.Remove(f) == nil {
+				purged[key] = true
+			}
+		}
+	}
+	return len(purged)
+}
+
+// storeMemory ajoute l'entrée en mémoire en évinçant, si besoin, celle qui expire le plus tôt
+func (c *ResultCache) storeMemory(key string, e *entry) {
+	if _, exists := c.entries[key]; !exists && len(c.entries) >= c.maxEntries {
+		var oldestKey string
+		var oldest time.Time
+		for k, v := range c.entries {
+			if oldestKey == "" || v.ExpiresAt.Before(oldest) {
+				oldestKey, oldest = k, v.ExpiresAt
+			}
+		}
+		delete(c.entries, oldestKey)
+	}
+	c.entries[key] = e
+}
+
+func (c *ResultCache) path(key string) string {
+	return filepath.Join(c.dir, key+".json")
+}
+
+func (c *ResultCache) readDisk(key string) *entry {
+	if c.dir == "" {
+		return nil
+	}
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return nil
+	}
+	var e entry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil
+	}
+	return &e
+}
+
+func (c *ResultCache) writeDisk(key string, e *entry) {
+	if c.dir == "" {
+		return
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	tmp := c.path(key) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return
+	}
+	os.Rename(tmp, c.path(key))
+}
@@ -0,0 +1,116 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestKey_IgnoresContextAndKeyOrder(t *testing.T) {
+	q1 := map[string]interface{}{
+		"queryType":  "groupBy",
+		"dataSource": "events",
+		"context":    map[string]interface{}{"application": "site-a"},
+	}
+	q2 := map[string]interface{}{
+		"dataSource": "events",
+		"queryType":  "groupBy",
+		"context":    map[string]interface{}{"application": "site-b", "timeout": 1000},
+	}
+	if Key("default", q1) != Key("default", q2) {
+		t.Error("Expected same key for queries differing only by context")
+	}
+	if Key("default", q1) == Key("archive", q1) {
+		t.Error("Expected different keys for different clusters")
+	}
+}
+
+func TestKey_AccessFiltersChangeKey(t *testing.T) {
+	q1 := map[string]interface{}{"filter": map[string]interface{}{"type": "in", "dimension": "country", "values": []string{"FR"}}}
+	q2 := map[string]interface{}{"filter": map[string]interface{}{"type": "in", "dimension": "country", "values": []string{"DE"}}}
+	if Key("default", q1) == Key("default", q2) {
+		t.Error("Expected different keys for different access filters")
+	}
+}
+
+func TestTouchesToday(t *testing.T) {
+	now := time.Date(2024, 3, 10, 15, 0, 0, 0, time.UTC)
+	if TouchesToday([]string{"2024-03-01T00:00:00Z/2024-03-10T00:00:00Z"}, now) {
+		t.Error("Interval ending at today's midnight should not touch today")
+	}
+	if !TouchesToday([]string{"2024-03-01T00:00:00Z/2024-03-11T00:00:00Z"}, now) {
+		t.Error("Interval including today should touch today")
+	}
+	if !TouchesToday(nil, now) {
+		t.Error("Query without interval should be considered as touching today")
+	}
+}
+
+func TestResultCache_DiskRoundTripAndPurge(t *testing.T) {
+	dir := t.TempDir()
+	c, err := NewResultCache(dir, time.Hour, time.Minute, 10, 0)
+	if err != nil {
+		t.Fatalf("NewResultCache failed: %v", err)
+	}
+	rows := []map[string]interface{}{{"event": map[string]interface{}{"n": 1.0}}}
+	c.Set("k1", "events", []string{"2000-01-01T00:00:00Z/2000-01-02T00:00:00Z"}, rows)
+
+	// Nouveau cache sur le même dossier : l'entrée est relue depuis le disque
+	c2, _ := NewResultCache(dir, time.Hour, time.Minute, 10, 0)
+	got, ok := c2.Get("k1")
+	if !ok || len(got) != 1 {
+		t.Fatalf("Expected cached rows from disk, got %v", got)
+	}
+	if n := c2.Purge("other"); n != 0 {
+		t.Errorf("Expected nothing purged for another datasource, got %d", n)
+	}
+	if n := c2.Purge("events"); n != 1 {
+		t.Errorf("Expected 1 entry purged, got %d", n)
+	}
+	if _, ok := c2.Get("k1"); ok {
+		t.Error("Expected cache miss after purge")
+	}
+}
+
+func TestNewResultCache_Defaults(t *testing.T) {
+	c, err := NewResultCache("", 0, 0, 0, 0)
+	if err != nil {
+		t.Fatalf("NewResultCache failed: %v", err)
+	}
+	if c.ttl != DefaultTTL || c.todayTTL != DefaultTodayTTL || c.maxEntries != DefaultMaxEntries {
+		t.Errorf("Expected defaults, got ttl=%v today=%v max=%d", c.ttl, c.todayTTL, c.maxEntries)
+	}
+	rows := []map[string]interface{}{{"n": 1.0}}
+	c.Set("k", "events", []string{"2000-01-01T00:00:00Z/2000-01-02T00:00:00Z"}, rows)
+	if _, ok := c.Get("k"); !ok {
+		t.Error("Expected results cached with the default ttl")
+	}
+	if c, _ := NewResultCache("", time.Minute, 0, 0, 0); c.todayTTL != time.Minute {
+		t.Errorf("Expected today ttl capped by ttl, got %v", c.todayTTL)
+	}
+}
+
+func TestResultCache_PruneDisk(t *testing.T) {
+	dir := t.TempDir()
+	c, _ := NewResultCache(dir, time.Hour, time.Minute, 10, 2)
+	rows := []map[string]interface{}{{"n": 1.0}}
+	past := []string{"2000-01-01T00:00:00Z/2000-01-02T00:00:00Z"}
+	for i, key := range []string{"a", "b", "c"} {
+		c.Set(key, "events", past, rows)
+		// dates de modification distinctes pour un ordre déterministe
+		mod := time.Now().Add(time.Duration(i-3) * time.Minute)
+		os.Chtimes(c.path(key), mod, mod)
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	c.Set("expired", "events", past, rows)
+	os.Chtimes(c.path("expired"), old, old)
+
+	c.pruneDisk(time.Now())
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	sort.Strings(files)
+	if len(files) != 2 || filepath.Base(files[0]) != "b.json" || filepath.Base(files[1]) != "c.json" {
+		t.Errorf("Expected the 2 most recent live entries kept, got %v", files)
+	}
+}
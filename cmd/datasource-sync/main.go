@@ -1,12 +1,10 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"flag"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
@@ -14,6 +12,7 @@ import (
 	"gopkg.in/yaml.v3"
 
 	"druid-insight/config"
+	"druid-insight/druid"
 	"druid-insight/utils"
 )
 
@@ -52,10 +51,12 @@ func main() {
 	var datasource string
 	var dryRun bool
 	var yamlFile string
+	var cluster string
 
 	flag.StringVar(&datasource, "datasource", "", "Name of datasync to sync (required)")
 	flag.BoolVar(&dryRun, "dry-run", false, "Simulate without update file")
 	flag.StringVar(&yamlFile, "yaml", "druid.yaml", "Absolute yaml file path")
+	flag.StringVar(&cluster, "cluster", "", "Druid cluster to query (default: datasource cluster or default_cluster)")
 	flag.Parse()
 
 	if datasource == "" {
@@ -71,25 +72,29 @@ func main() {
 	}
 
 	// 2. Appel SQL Druid pour introspection
-	endpoint := strings.TrimRight(cfg.HostURL, "/") + "/druid/v2/sql"
-	sqlReq := map[string]interface{}{
-		"query": fmt.Sprintf("SELECT COLUMN_NAME, DATA_TYPE FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_NAME = '%s'", datasource),
-	}
-	reqBody, _ := json.Marshal(sqlReq)
-	resp, err := http.Post(endpoint, "application/json", bytes.NewReader(reqBody))
+	clusters, err := druid.NewClusters(cfg)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed calling Druid SQL API : %v\n", err)
+		fmt.Fprintf(os.Stderr, "Failed loading Druid clusters : %v\n", err)
 		os.Exit(2)
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != 200 {
-		body, _ := io.ReadAll(resp.Body)
-		fmt.Fprintf(os.Stderr, "Failed Druid SQL : %s\n%s\n", resp.Status, body)
+	var client *druid.Client
+	if cluster != "" {
+		client, err = clusters.Get(cluster)
+	} else {
+		client, err = clusters.ForDatasource(datasource)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed creating Druid client : %v\n", err)
 		os.Exit(2)
 	}
+	sqlReq := &druid.SQLQuery{
+		Query:        "SELECT COLUMN_NAME, DATA_TYPE FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_NAME = ?",
+		Parameters:   []druid.SQLParameter{{Type: "VARCHAR", Value: datasource}},
+		ResultFormat: "object",
+	}
 	var columns []druidSQLCol
-	if err := json.NewDecoder(resp.Body).Decode(&columns); err != nil {
-		fmt.Fprintf(os.Stderr, "Failed parsing JSON SQL : %v\n", err)
+	if err := client.PostJSON(context.Background(), "/druid/v2/sql", sqlReq, &columns); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed calling Druid SQL API : %v\n", err)
 		os.Exit(2)
 	}
 
@@ -122,6 +127,7 @@ func main() {
 	ds, exists := cfg.Datasources[datasource]
 	if !exists {
 		ds = config.DruidDatasourceSchema{
+			Cluster:    cluster,
 			Dimensions: map[string]config.DruidField{},
 			Metrics:    map[string]config.DruidField{},
 		}
@@ -181,7 +187,7 @@ func main() {
 		}
 		fmt.Println("Update done. Backup send to archives/")
 	} else if dryRun && (len(newDims) > 0 || len(newMetrics) > 0) {
-		fmt.Println("\n--- YAML would be : ---\n")
+		fmt.Print("\n--- YAML would be : ---\n\n")
 		out, _ := yaml.Marshal(cfg)
 		fmt.Println(string(out))
 	}
@@ -3,31 +3,109 @@ package main
 import (
 	"druid-insight/api"
 	"druid-insight/auth"
+	"druid-insight/cache"
 	"druid-insight/config"
+	"druid-insight/druid"
 	"druid-insight/logging"
+	"druid-insight/notify"
+	"druid-insight/scheduler"
 	"druid-insight/static"
+	"druid-insight/store"
 	"druid-insight/utils"
 	"druid-insight/worker"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 )
 
 var (
-	cfg      *auth.Config
-	users    *auth.UsersFile
-	druidCfg *config.DruidConfig
-	loggers  []*logging.Logger
+	cfg           *auth.Config
+	users         *auth.UsersFile
+	druidCfg      *config.DruidConfig
+	druidClusters *druid.Clusters
+	loggers       []*logging.Logger
 )
 
 func main() {
 	utils.LogToFile("api.log")
 	loadEverything()
 
-	worker.StartReportWorkers(5, druidCfg, loggers[2], cfg)
+	if cfg.Cache.Enabled {
+		resultCache, err := cache.NewResultCache(
+			cfg.Cache.Dir,
+			time.Duration(cfg.Cache.TTLSeconds)*time.Second,
+			time.Duration(cfg.Cache.TodayTTLSeconds)*time.Second,
+			cfg.Cache.MaxEntries,
+			cfg.Cache.MaxDiskEntries,
+		)
+		if err != nil {
+			log.Fatalf("Failed result cache: %v", err)
+		}
+		worker.SetResultCache(resultCache)
+	}
+
+	st, err := store.Open(cfg.StorageSettings())
+	if err != nil {
+		log.Fatalf("Failed storage: %v", err)
+	}
+
+	keys, err := auth.NewKeySetFromConfig(cfg)
+	if err != nil {
+		log.Fatalf("Failed jwt keys: %v", err)
+	}
+	if keys != nil {
+		auth.SetKeySet(keys)
+		keys.Start(func(err error) { log.Printf("jwt key rotation: %v", err) })
+	}
+
+	sessions, err := auth.NewSessions(st, cfg.RefreshTTL())
+	if err != nil {
+		log.Fatalf("Failed sessions: %v", err)
+	}
+	auth.SetSessions(sessions)
 
-	api.RegisterHandlers(cfg, users, druidCfg, loggers[0], loggers[1], loggers[2])
+	apiKeys, err := auth.NewAPIKeys(st)
+	if err != nil {
+		log.Fatalf("Failed api keys: %v", err)
+	}
+	auth.SetAPIKeys(apiKeys)
+
+	limiter, err := auth.NewLoginLimiter(cfg.LoginProtection, st)
+	if err != nil {
+		log.Fatalf("Failed login protection: %v", err)
+	}
+	twoFactor := auth.NewTwoFactorAuth(cfg.TwoFactor, st)
+
+	if cfg.Auth.UserBackend == "oidc" {
+		provider, err := auth.NewOIDCProvider(cfg.OIDC, st)
+		if err != nil {
+			log.Fatalf("Failed oidc: %v", err)
+		}
+		auth.SetOIDCProvider(provider)
+	}
+
+	worker.OnFinished(worker.HistoryRecorder(st, cfg.HistoryRetention(), loggers[2]))
+
+	notifier, err := notify.New(cfg, st, loggers[2])
+	if err != nil {
+		log.Fatalf("Failed smtp: %v", err)
+	}
+	if notifier != nil {
+		worker.OnFinished(notifier.ReportFinished)
+	}
+	if webhooks := notify.NewWebhooks(cfg, st, loggers[2]); webhooks != nil {
+		worker.OnFinished(webhooks.ReportFinished)
+	}
+
+	worker.StartReportWorkers(5, druidCfg, druidClusters, loggers[2], cfg, users)
+
+	sched := scheduler.New(st, druidCfg, cfg, users, loggers[2])
+	sched.Start()
+
+	api.RegisterHandlers(cfg, users, druidCfg, druidClusters, st, sessions, apiKeys, limiter, twoFactor, keys, sched, loggers[0], loggers[1], loggers[2])
 	static.RegisterStaticHandler(cfg, loggers[0])
 
 	sigs := make(chan os.Signal, 1)
@@ -35,7 +113,7 @@ func main() {
 	go func() {
 		for range sigs {
 			log.Println("Reloading configs...")
-			loadEverything()
+			reloadConfigs()
 		}
 	}()
 
@@ -43,26 +121,81 @@ func main() {
 	log.Fatal(api.StartServer(cfg.Server.Listen))
 }
 
+// loadConfigs lit config.yaml, users.yaml (backend file) et druid.yaml
+func loadConfigs() (*auth.Config, *auth.UsersFile, *config.DruidConfig, error) {
+	c, err := auth.LoadConfig("config.yaml")
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("config.yaml: %w", err)
+	}
+	var u *auth.UsersFile
+	if c.Auth.UserBackend == "file" {
+		u, err = auth.LoadUsers(c.Auth.UserFile)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("users.yaml: %w", err)
+		}
+	}
+	d, err := config.LoadDruidConfig("druid.yaml")
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("druid.yaml: %w", err)
+	}
+	for _, problem := range auth.ValidateRoles(c, d) {
+		log.Println("rbac warning: " + problem)
+	}
+	return c, u, d, nil
+}
+
 func loadEverything() {
 	var err error
-	cfg, err = auth.LoadConfig("config.yaml")
+	cfg, users, druidCfg, err = loadConfigs()
 	if err != nil {
-		log.Fatalf("Failed config.yaml: %v", err)
+		log.Fatalf("Failed %v", err)
 	}
-	if cfg.Auth.UserBackend == "file" {
-		users, err = auth.LoadUsers(cfg.Auth.UserFile)
+	if cfg.Auth.UserBackend == "ldap" {
+		ldapDir, err := auth.NewLDAPDirectory(cfg.LDAP)
 		if err != nil {
-			log.Fatalf("Failed users.yaml: %v", err)
+			log.Fatalf("Failed ldap: %v", err)
 		}
+		auth.SetLDAPDirectory(ldapDir)
 	}
-	druidCfg, err = config.LoadDruidConfig("druid.yaml")
+	druidClusters, err = druid.NewClusters(druidCfg)
 	if err != nil {
-		log.Fatalf("Failed druid.yaml: %v", err)
+		log.Fatalf("Failed druid clusters: %v", err)
 	}
+	druidClusters.StartHealthChecks()
 	os.MkdirAll(cfg.Server.LogDir, 0755)
 	loggers = []*logging.Logger{
 		logging.NewLoggerOrDie(cfg.Server.LogDir, "access.log"),
 		logging.NewLoggerOrDie(cfg.Server.LogDir, "login.log"),
 		logging.NewLoggerOrDie(cfg.Server.LogDir, "report.log"),
 	}
+	auth.ConfigureJWT(cfg)
+	auth.SetRejectLogger(loggers[0].Write)
+}
+
+// reloadConfigs (SIGHUP) : handlers, workers et scheduler gardent config.yaml, users.yaml et
+// druid.yaml du démarrage ; seuls les réglages lus via l'état partagé sont rechargés
+// (paramètres JWT, annuaire LDAP, brokers des clusters Druid). Une erreur garde la
+// configuration en cours.
+func reloadConfigs() {
+	c, _, d, err := loadConfigs()
+	if err != nil {
+		log.Printf("Reload failed, keeping the current configuration: %v", err)
+		return
+	}
+	var ldapDir *auth.LDAPDirectory
+	if cfg.Auth.UserBackend == "ldap" && c.Auth.UserBackend == "ldap" {
+		if ldapDir, err = auth.NewLDAPDirectory(c.LDAP); err != nil {
+			log.Printf("Reload failed, keeping the current configuration: ldap: %v", err)
+			return
+		}
+	}
+	if err := druidClusters.Reload(d); err != nil {
+		log.Printf("Reload failed, keeping the current configuration: druid clusters: %v", err)
+		return
+	}
+	if ldapDir != nil {
+		auth.SetLDAPDirectory(ldapDir)
+	}
+	auth.ConfigureJWT(c)
+	log.Println("Reloaded JWT settings, LDAP directory and Druid brokers; other changes apply after a restart")
 }
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"druid-insight/auth"
+	"druid-insight/store"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func apiKeyCommand(args []string) {
+	if len(args) < 1 {
+		usage()
+		os.Exit(1)
+	}
+	keys := openAPIKeys()
+	switch args[0] {
+	case "create":
+		fs := flag.NewFlagSet("apikey create", flag.ExitOnError)
+		name := fs.String("name", "", "description of the key")
+		admin := fs.Bool("admin", false, "grant admin rights")
+		datasources := fs.String("datasources", "", "comma-separated datasources (default: all)")
+		endpoints := fs.String("endpoints", "", "comma-separated path prefixes (default: all)")
+		expires := fs.Int("expires-days", 0, "validity in days (0: no expiry)")
+		if len(args) < 2 || strings.HasPrefix(args[1], "-") {
+			fmt.Println("Usage: userctl apikey create <username> [options]")
+			os.Exit(1)
+		}
+		fs.Parse(args[2:])
+		secret, key, err := keys.Create(auth.APIKeyOptions{
+			Name:        *name,
+			Username:    args[1],
+			Admin:       *admin,
+			Datasources: splitList(*datasources),
+			Endpoints:   splitList(*endpoints),
+			TTL:         time.Duration(*expires) * 24 * time.Hour,
+			CreatedBy:   "userctl",
+		})
+		if err != nil {
+			fmt.Println("Failed creating key :", err)
+			os.Exit(1)
+		}
+		fmt.Println("API key " + key.ID + " created for " + key.Username + ", store it now (it cannot be shown again) :")
+		fmt.Println(secret)
+	case "list":
+		user := ""
+		if len(args) > 1 {
+			user = args[1]
+		}
+		list, err := keys.List(func(k *store.APIKey) bool { return user == "" || k.Username == user })
+		if err != nil {
+			fmt.Println("Failed listing keys :", err)
+			os.Exit(1)
+		}
+		now := time.Now()
+		for _, k := range list {
+			state := "active"
+			if k.RevokedAt != nil {
+				state = "revoked"
+			} else if !k.Active(now) {
+				state = "expired"
+			}
+			fmt.Printf("- %s %s [%s] name=%q admin=%v datasources=%s endpoints=%s\n", k.ID, k.Username, state, k.Name, k.Admin,
+				orAll(k.Datasources), orAll(k.Endpoints))
+		}
+	case "revoke":
+		if len(args) < 2 {
+			fmt.Println("Usage: userctl apikey revoke <id>")
+			os.Exit(1)
+		}
+		if err := keys.Revoke(args[1], "userctl"); err != nil {
+			fmt.Println("Failed revoking key :", err)
+			os.Exit(1)
+		}
+		fmt.Println("API key revoked")
+	default:
+		usage()
+		os.Exit(1)
+	}
+}
+
+func openStore() (*auth.Config, *store.Store) {
+	cfg, err := auth.LoadConfig("config.yaml")
+	if err != nil {
+		fmt.Println("Failed loading config.yaml :", err)
+		os.Exit(1)
+	}
+	st, err := store.Open(cfg.StorageSettings())
+	if err != nil {
+		fmt.Println("Failed opening storage :", err)
+		os.Exit(1)
+	}
+	return cfg, st
+}
+
+func openAPIKeys() *auth.APIKeys {
+	_, st := openStore()
+	keys, err := auth.NewAPIKeys(st)
+	if err != nil {
+		fmt.Println("Failed loading API keys :", err)
+		os.Exit(1)
+	}
+	return keys
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func orAll(list []string) string {
+	if len(list) == 0 {
+		return "*"
+	}
+	return strings.Join(list, ",")
+}
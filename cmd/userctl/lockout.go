@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"druid-insight/auth"
+	"druid-insight/logging"
+	"druid-insight/store"
+)
+
+func lockoutCommand(cmd string, args []string) {
+	cfg, st := openStore()
+	if cmd == "lockouts" {
+		list, err := st.ListLoginLockouts(nil)
+		if err != nil {
+			fmt.Println("Failed listing lockouts :", err)
+			os.Exit(1)
+		}
+		now := time.Now()
+		for _, l := range list {
+			state := "expired"
+			if now.Before(l.LockedUntil) {
+				state = "locked until " + l.LockedUntil.Format(time.RFC3339)
+			}
+			fmt.Printf("- %s [%s] level=%d failures=%d\n", l.Key, state, l.Level, l.Failures)
+		}
+		return
+	}
+	if len(args) < 1 {
+		usage()
+		os.Exit(1)
+	}
+	key := auth.LockoutKey(args[0], "")
+	if cmd == "unlock-ip" {
+		key = auth.LockoutKey("", args[0])
+	}
+	if _, err := st.GetLoginLockout(key); errors.Is(err, store.ErrNotFound) {
+		fmt.Println("No lockout for " + key)
+		return
+	}
+	if err := auth.UnlockLogin(st, key); err != nil {
+		fmt.Println("Failed unlocking :", err)
+		os.Exit(1)
+	}
+	// le déverrouillage figure dans login.log avec les verrouillages
+	if l, err := logging.NewLogger(cfg.Server.LogDir, "login.log"); err == nil {
+		l.Write("UNLOCK key=" + key + " by=userctl")
+		l.Close()
+	}
+	fmt.Println("Unlocked " + key + " (servers pick it up within 30 seconds)")
+}
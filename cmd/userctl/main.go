@@ -34,17 +34,32 @@ func main() {
 		disableUser(os.Args[2])
 	case "list":
 		listUsers()
+	case "apikey":
+		apiKeyCommand(os.Args[2:])
+	case "2fa":
+		twoFactorCommand(os.Args[2:])
+	case "unlock", "unlock-ip", "lockouts":
+		lockoutCommand(cmd, os.Args[2:])
 	default:
 		usage()
 	}
 }
 
 func usage() {
-	fmt.Println(`Usage: userctl [add|disable|list] <username>
+	fmt.Println(`Usage: userctl [add|disable|list|apikey|2fa|unlock|unlock-ip|lockouts] <username>
 
 add <username>       : Add a new user (password will be prompt)
 disable <username>   : Comment out a user (soft deletion in users.yaml)
-list                 : List all existing users`)
+list                 : List all existing users
+apikey create <username> [-name n] [-admin] [-datasources a,b] [-endpoints /api/x,/api/y] [-expires-days n]
+                     : Create an API key for a service user (the key is printed once)
+apikey list [username] : List API keys
+apikey revoke <id>   : Revoke an API key
+2fa list             : List users with a second factor
+2fa reset <username> : Remove a user's second factor (re-enrollment at next login if required)
+unlock <username>    : Lift a login lockout on a user
+unlock-ip <address>  : Lift a login lockout on a client address
+lockouts             : List login lockouts`)
 }
 
 // Demande un mot de passe à l’admin (masqué si possible)
@@ -176,11 +191,7 @@ func listUsers() {
 	}
 	fmt.Println("Existing users :")
 	for u, info := range users.Users {
-		role := "user"
-		if info.Admin {
-			role = "admin"
-		}
-		fmt.Printf("- %s [%s]\n", u, role)
+		fmt.Printf("- %s [%s]\n", u, strings.Join(auth.GetUserRoles(u, info.Admin, users, cfg), ","))
 	}
 }
 
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"druid-insight/auth"
+	"druid-insight/logging"
+)
+
+func twoFactorCommand(args []string) {
+	if len(args) < 1 {
+		usage()
+		os.Exit(1)
+	}
+	cfg, st := openStore()
+	switch args[0] {
+	case "list":
+		list, err := st.ListTwoFactor()
+		if err != nil {
+			fmt.Println("Failed listing second factors :", err)
+			os.Exit(1)
+		}
+		for _, t := range list {
+			state := "pending"
+			if t.Enabled {
+				state = fmt.Sprintf("enabled, %d recovery codes left", len(t.RecoveryCodes))
+			}
+			fmt.Printf("- %s [%s]\n", t.Username, state)
+		}
+	case "reset":
+		if len(args) < 2 {
+			fmt.Println("Usage: userctl 2fa reset <username>")
+			os.Exit(1)
+		}
+		if err := auth.ResetTwoFactor(st, args[1]); err != nil {
+			fmt.Println("Failed resetting second factor :", err)
+			os.Exit(1)
+		}
+		if l, err := logging.NewLogger(cfg.Server.LogDir, "login.log"); err == nil {
+			l.Write("MFA_RESET user=" + args[1] + " by=userctl")
+			l.Close()
+		}
+		fmt.Println("Second factor removed for " + args[1])
+	default:
+		usage()
+		os.Exit(1)
+	}
+}
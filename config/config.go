@@ -9,12 +9,49 @@ import (
 )
 
 type DruidConfig struct {
-	HostURL     string                           `yaml:"host_url"`
-	Datasources map[string]DruidDatasourceSchema `yaml:"datasources"`
+	HostURL        string                           `yaml:"host_url"`                  // cluster "default" (un seul broker)
+	Client         DruidClientConfig                `yaml:"client,omitempty"`          // paramètres communs à tous les clusters
+	DefaultCluster string                           `yaml:"default_cluster,omitempty"` // cluster des datasources sans "cluster"
+	Clusters       map[string]DruidClusterConfig    `yaml:"clusters,omitempty"`
+	Retry          ReportRetryConfig                `yaml:"retry,omitempty"` // nouvelles tentatives d'un rapport en échec transitoire
+	Datasources    map[string]DruidDatasourceSchema `yaml:"datasources"`
+}
+
+// ReportRetryConfig : nouvelles tentatives d'un rapport après une erreur Druid transitoire
+// (timeout, 5xx, limite de ressources), en plus des retries HTTP du client
+type ReportRetryConfig struct {
+	MaxAttempts  int `yaml:"max_attempts,omitempty"`   // nombre total de tentatives (défaut 3, 1 = pas de retry)
+	BackoffMs    int `yaml:"backoff_ms,omitempty"`     // délai avant la 2e tentative, doublé ensuite (défaut 2000)
+	MaxBackoffMs int `yaml:"max_backoff_ms,omitempty"` // plafond du délai (défaut 60000)
+}
+
+// DruidClusterConfig décrit un cluster Druid nommé et ses brokers (failover / round-robin)
+type DruidClusterConfig struct {
+	Brokers []string           `yaml:"brokers"`
+	Client  *DruidClientConfig `yaml:"client,omitempty"` // surcharge complète de la section client globale
+}
+
+// DruidClientConfig paramètre le client HTTP utilisé pour parler aux brokers Druid
+type DruidClientConfig struct {
+	TimeoutSeconds     int    `yaml:"timeout_seconds,omitempty"`      // timeout par requête, propagé dans le contexte Druid (défaut 120)
+	Username           string `yaml:"username,omitempty"`             // basic auth
+	Password           string `yaml:"password,omitempty"`             // basic auth
+	BearerToken        string `yaml:"bearer_token,omitempty"`         // prioritaire sur le basic auth
+	CAFile             string `yaml:"ca_file,omitempty"`              // CA personnalisée (PEM)
+	CertFile           string `yaml:"cert_file,omitempty"`            // certificat client TLS (PEM)
+	KeyFile            string `yaml:"key_file,omitempty"`             // clé du certificat client (PEM)
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify,omitempty"` // à réserver aux tests
+	MaxRetries         int    `yaml:"max_retries,omitempty"`          // nouvelles tentatives sur 5xx / erreur réseau (défaut 2, négatif = aucune)
+	RetryBackoffMs     int    `yaml:"retry_backoff_ms,omitempty"`     // délai initial, doublé à chaque tentative (défaut 500)
+	MaxIdleConns       int    `yaml:"max_idle_conns,omitempty"`       // taille du pool de connexions (défaut 20)
+	HealthCheckSeconds int    `yaml:"health_check_seconds,omitempty"` // intervalle de vérification des brokers (défaut 30)
 }
 
 type DruidDatasourceSchema struct {
-	DruidName  string                `yaml:"druid_name"` // nom réel dans Druid
+	DruidName  string                `yaml:"druid_name"`           // nom réel dans Druid
+	Cluster    string                `yaml:"cluster,omitempty"`    // cluster Druid (défaut : default_cluster)
+	QueryMode  string                `yaml:"query_mode,omitempty"` // "native" (défaut) ou "sql"
+	SQLFrom    string                `yaml:"sql_from,omitempty"`   // clause FROM SQL personnalisée (JOIN, sous-requête)
 	Dimensions map[string]DruidField `yaml:"dimensions"`
 	Metrics    map[string]DruidField `yaml:"metrics"`
 }
@@ -22,10 +59,13 @@ type DruidDatasourceSchema struct {
 type DruidField struct {
 	Druid       string `yaml:"druid"`
 	Formula     string `yaml:"formula,omitempty"`
-	Reserved    bool   `yaml:"reserved"`
+	Reserved    bool   `yaml:"reserved"`               // obsolète : équivaut à roles: [admin]
 	Type        string `yaml:"type,omitempty"`         // "bar" or "line"
 	AccessQuery string `yaml:"access_query,omitempty"` // nouvelle ligne
 	Lookup      string `yaml:"lookup,omitempty"`       // nom du lookup druid (optionnel)
+	SQL         string `yaml:"sql,omitempty"`          // expression SQL (mode sql uniquement)
+
+	Roles []string `yaml:"roles,omitempty"` // rôles rbac ayant accès au champ, vide = tous
 }
 
 func LoadDruidConfig(file string) (*DruidConfig, error) {
@@ -0,0 +1,289 @@
+package druid
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"druid-insight/config"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultTimeoutSeconds     = 120
+	defaultMaxRetries         = 2
+	defaultRetryBackoffMs     = 500
+	defaultMaxIdleConns       = 20
+	defaultHealthCheckSeconds = 30
+)
+
+// HTTPError est retournée quand un broker Druid répond avec un statut non 200
+type HTTPError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("druid HTTP %d: %s", e.StatusCode, e.Body)
+}
+
+// Client partagé vers un cluster Druid : pool de connexions, timeouts, authentification,
+// TLS, retries et répartition round-robin / failover entre les brokers du cluster.
+type Client struct {
+	brokers []*broker
+	next    uint32
+	cfg     config.DruidClientConfig
+	http    *http.Client
+	timeout time.Duration
+	retries int
+	backoff time.Duration
+	health  time.Duration
+
+	stopMu sync.Mutex
+	stop   chan struct{} // health checks en cours, nil sinon
+}
+
+// NewClient construit un client pour un broker unique (host_url) et la section client de druid.yaml
+func NewClient(baseURL string, cc config.DruidClientConfig) (*Client, error) {
+	return NewClusterClient([]string{baseURL}, cc)
+}
+
+// NewClusterClient construit un client répartissant les requêtes sur plusieurs brokers
+func NewClusterClient(brokerURLs []string, cc config.DruidClientConfig) (*Client, error) {
+	if len(brokerURLs) == 0 {
+		return nil, errors.New("druid client: no broker url")
+	}
+	timeout := time.Duration(cc.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = defaultTimeoutSeconds * time.Second
+	}
+	retries := cc.MaxRetries
+	if retries == 0 {
+		retries = defaultMaxRetries
+	} else if retries < 0 {
+		retries = 0
+	}
+	backoff := time.Duration(cc.RetryBackoffMs) * time.Millisecond
+	if backoff <= 0 {
+		backoff = defaultRetryBackoffMs * time.Millisecond
+	}
+	health := time.Duration(cc.HealthCheckSeconds) * time.Second
+	if health <= 0 {
+		health = defaultHealthCheckSeconds * time.Second
+	}
+	maxIdle := cc.MaxIdleConns
+	if maxIdle <= 0 {
+		maxIdle = defaultMaxIdleConns
+	}
+
+	tlsCfg, err := buildTLSConfig(cc)
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = maxIdle
+	transport.MaxIdleConnsPerHost = maxIdle
+	transport.TLSClientConfig = tlsCfg
+
+	brokers := make([]*broker, 0, len(brokerURLs))
+	for _, u := range brokerURLs {
+		brokers = append(brokers, &broker{url: strings.TrimRight(u, "/")})
+	}
+	return &Client{
+		brokers: brokers,
+		cfg:     cc,
+		http:    &http.Client{Transport: transport},
+		timeout: timeout,
+		retries: retries,
+		backoff: backoff,
+		health:  health,
+	}, nil
+}
+
+func buildTLSConfig(cc config.DruidClientConfig) (*tls.Config, error) {
+	tlsCfg := &tls.Config{InsecureSkipVerify: cc.InsecureSkipVerify}
+	if cc.CAFile != "" {
+		pem, err := os.ReadFile(cc.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("druid client ca_file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("druid client ca_file: no certificate found")
+		}
+		tlsCfg.RootCAs = pool
+	}
+	if cc.CertFile != "" || cc.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cc.CertFile, cc.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("druid client cert_file/key_file: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+	return tlsCfg, nil
+}
+
+// Brokers retourne les URLs des brokers du cluster
+func (c *Client) Brokers() []string {
+	urls := make([]string, 0, len(c.brokers))
+	for _, b := range c.brokers {
+		urls = append(urls, b.url)
+	}
+	return urls
+}
+
+// Timeout retourne le timeout appliqué à chaque requête
+func (c *Client) Timeout() time.Duration { return c.timeout }
+
+// noRetryKey marque le contexte d'une requête dont l'appelant gère les nouvelles tentatives
+type noRetryKey struct{}
+
+// WithoutRetries : le client ne retente pas la requête (l'appelant, le worker des rapports,
+// applique sa propre politique) ; chaque broker n'est essayé qu'une fois
+func WithoutRetries(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noRetryKey{}, true)
+}
+
+// PostJSON envoie payload en JSON sur path et décode la réponse dans out.
+// Les erreurs réseau et les réponses 5xx sont retentées avec un backoff exponentiel,
+// sauf si ctx vient de WithoutRetries.
+func (c *Client) PostJSON(ctx context.Context, path string, payload interface{}, out interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	retries := c.retries
+	if ctx.Value(noRetryKey{}) != nil {
+		retries = 0
+	}
+	delay := c.backoff
+	for attempt := 0; ; attempt++ {
+		err = c.post(ctx, path, body, out)
+		if err == nil || attempt >= retries || !retryable(err) {
+			return err
+		}
+		log.Printf("druid client - %s attempt %d failed, retry in %s: %v", path, attempt+1, delay, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// post essaie les brokers dans l'ordre round-robin (sains d'abord) jusqu'au premier succès
+func (c *Client) post(ctx context.Context, path string, body []byte, out interface{}) error {
+	var lastErr error
+	for _, b := range c.pickBrokers() {
+		lastErr = c.postTo(ctx, b, path, body, out)
+		if lastErr == nil {
+			b.markUp()
+			return nil
+		}
+		if !retryable(lastErr) || ctx.Err() != nil {
+			return lastErr
+		}
+		log.Printf("druid client - broker %s failed, failover: %v", b.url, lastErr)
+		b.markDown(c.health)
+	}
+	return lastErr
+}
+
+func (c *Client) postTo(ctx context.Context, b *broker, path string, body []byte, out interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.url+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	c.authenticate(req)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		bb, _ := io.ReadAll(resp.Body)
+		return &HTTPError{StatusCode: resp.StatusCode, Body: string(bb)}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (c *Client) authenticate(req *http.Request) {
+	if c.cfg.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.cfg.BearerToken)
+	} else if c.cfg.Username != "" {
+		req.SetBasicAuth(c.cfg.Username, c.cfg.Password)
+	}
+}
+
+// retryable : erreurs réseau et 5xx, jamais les 4xx (requête invalide), l'annulation ni le
+// timeout de la tentative (la même requête expirerait de nouveau sur un autre broker)
+func retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode >= 500
+	}
+	return true
+}
+
+// withTimeoutContext retourne une copie du contexte de requête Druid, avec le timeout du
+// client s'il n'est pas déjà fixé
+func (c *Client) withTimeoutContext(queryCtx map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(queryCtx)+1)
+	for k, v := range queryCtx {
+		out[k] = v
+	}
+	if _, ok := out["timeout"]; !ok {
+		out["timeout"] = c.timeout.Milliseconds()
+	}
+	return out
+}
+
+// NativeQuery exécute une requête native (groupBy...) sur /druid/v2/ ; query n'est pas modifiée
+func (c *Client) NativeQuery(ctx context.Context, query map[string]interface{}) ([]map[string]interface{}, error) {
+	sent := make(map[string]interface{}, len(query)+1)
+	for k, v := range query {
+		sent[k] = v
+	}
+	qctx, _ := query["context"].(map[string]interface{})
+	sent["context"] = c.withTimeoutContext(qctx)
+	var res []map[string]interface{}
+	if err := c.PostJSON(ctx, "/druid/v2/", sent, &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// SQLQuery exécute une requête SQL sur /druid/v2/sql, lignes au format objet ; query n'est
+// pas modifiée
+func (c *Client) SQLQuery(ctx context.Context, query *SQLQuery) ([]map[string]interface{}, error) {
+	sent := *query
+	sent.Context = c.withTimeoutContext(query.Context)
+	if sent.ResultFormat == "" {
+		sent.ResultFormat = "object"
+	}
+	var rows []map[string]interface{}
+	if err := c.PostJSON(ctx, "/druid/v2/sql", &sent, &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
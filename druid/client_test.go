@@ -0,0 +1,145 @@
+package druid
+
+import (
+	"context"
+	"druid-insight/config"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestClient_RetriesOn5xx(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`[{"event":{"browser":"Chrome"}}]`))
+	}))
+	defer srv.Close()
+
+	client, err := NewClient(srv.URL, config.DruidClientConfig{MaxRetries: 3, RetryBackoffMs: 1})
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	res, err := client.NativeQuery(context.Background(), map[string]interface{}{"queryType": "groupBy"})
+	if err != nil {
+		t.Fatalf("NativeQuery failed: %v", err)
+	}
+	if len(res) != 1 || atomic.LoadInt32(&calls) != 3 {
+		t.Errorf("Expected 1 row after 3 calls, got %v rows after %d calls", res, calls)
+	}
+}
+
+func TestClient_NoRetryOn4xx(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		http.Error(w, "bad query", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	client, _ := NewClient(srv.URL, config.DruidClientConfig{MaxRetries: 3, RetryBackoffMs: 1})
+	_, err := client.NativeQuery(context.Background(), map[string]interface{}{})
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Expected HTTPError 400, got %v", err)
+	}
+	if atomic.LoadInt32(&calls) != 1 {
+		t.Errorf("Expected a single call for a 4xx, got %d", calls)
+	}
+}
+
+func TestClient_AuthAndTimeoutContext(t *testing.T) {
+	var gotAuth string
+	var gotCtx map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		gotCtx, _ = body["context"].(map[string]interface{})
+		w.Write([]byte(`[]`))
+	}))
+	defer srv.Close()
+
+	client, _ := NewClient(srv.URL, config.DruidClientConfig{BearerToken: "tok", TimeoutSeconds: 30})
+	queryCtx := map[string]interface{}{"application": "test"}
+	_, err := client.NativeQuery(context.Background(), map[string]interface{}{"context": queryCtx})
+	if err != nil {
+		t.Fatalf("NativeQuery failed: %v", err)
+	}
+	if gotAuth != "Bearer tok" {
+		t.Errorf("Expected bearer token, got %q", gotAuth)
+	}
+	if gotCtx["timeout"] != float64(30000) || gotCtx["application"] != "test" {
+		t.Errorf("Expected timeout 30000 and application kept in context, got %v", gotCtx)
+	}
+	if _, ok := queryCtx["timeout"]; ok {
+		t.Errorf("Expected the caller's query context to be left untouched, got %v", queryCtx)
+	}
+}
+
+func TestClient_RetriesByDefault(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	client, _ := NewClient(srv.URL, config.DruidClientConfig{RetryBackoffMs: 1})
+	if _, err := client.NativeQuery(context.Background(), map[string]interface{}{}); err == nil {
+		t.Fatal("Expected an error")
+	}
+	if n := atomic.LoadInt32(&calls); n != defaultMaxRetries+1 {
+		t.Errorf("Expected %d calls with the default max_retries, got %d", defaultMaxRetries+1, n)
+	}
+
+	atomic.StoreInt32(&calls, 0)
+	client, _ = NewClient(srv.URL, config.DruidClientConfig{MaxRetries: -1})
+	client.NativeQuery(context.Background(), map[string]interface{}{})
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("Expected a single call with negative max_retries, got %d", n)
+	}
+}
+
+func TestClient_WithoutRetries(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	client, _ := NewClient(srv.URL, config.DruidClientConfig{MaxRetries: 3, RetryBackoffMs: 1})
+	if _, err := client.NativeQuery(WithoutRetries(context.Background()), map[string]interface{}{}); err == nil {
+		t.Fatal("Expected an error")
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("Expected a single call when the caller owns retries, got %d", n)
+	}
+}
+
+func TestClient_NoRetryOnTimeout(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	client, _ := NewClusterClient([]string{srv.URL, srv.URL}, config.DruidClientConfig{TimeoutSeconds: 1, MaxRetries: 3, RetryBackoffMs: 1})
+	_, err := client.NativeQuery(context.Background(), map[string]interface{}{})
+	if Classify(err) != ClassTimeout {
+		t.Fatalf("Expected a timeout, got %v", err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("Expected no retry nor failover after a timeout, got %d calls", n)
+	}
+}
@@ -0,0 +1,299 @@
+package druid
+
+import (
+	"context"
+	"druid-insight/config"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultClusterName est le nom du cluster construit à partir de host_url
+const DefaultClusterName = "default"
+
+// broker : un broker Druid et son état de santé
+type broker struct {
+	url       string
+	mu        sync.Mutex
+	downUntil time.Time
+}
+
+func (b *broker) healthy(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !now.Before(b.downUntil)
+}
+
+// markDown écarte le broker jusqu'au prochain health check (ou la fin du délai)
+func (b *broker) markDown(d time.Duration) {
+	b.mu.Lock()
+	b.downUntil = time.Now().Add(d)
+	b.mu.Unlock()
+}
+
+func (b *broker) markUp() {
+	b.mu.Lock()
+	b.downUntil = time.Time{}
+	b.mu.Unlock()
+}
+
+// pickBrokers retourne les brokers à essayer : rotation round-robin, brokers sains
+// en premier, puis les brokers écartés en dernier recours.
+func (c *Client) pickBrokers() []*broker {
+	n := len(c.brokers)
+	start := int(atomic.AddUint32(&c.next, 1)-1) % n
+	now := time.Now()
+	var up, down []*broker
+	for i := 0; i < n; i++ {
+		b := c.brokers[(start+i)%n]
+		if b.healthy(now) {
+			up = append(up, b)
+		} else {
+			down = append(down, b)
+		}
+	}
+	return append(up, down...)
+}
+
+// StartHealthChecks interroge périodiquement /status/health sur chaque broker
+func (c *Client) StartHealthChecks() {
+	if len(c.brokers) < 2 {
+		return
+	}
+	c.stopMu.Lock()
+	defer c.stopMu.Unlock()
+	if c.stop != nil {
+		return
+	}
+	stop := make(chan struct{})
+	c.stop = stop
+	go func() {
+		ticker := time.NewTicker(c.health)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				for _, b := range c.brokers {
+					c.checkBroker(b)
+				}
+			}
+		}
+	}()
+}
+
+// StopHealthChecks arrête la goroutine de health check
+func (c *Client) StopHealthChecks() {
+	c.stopMu.Lock()
+	defer c.stopMu.Unlock()
+	if c.stop != nil {
+		close(c.stop)
+		c.stop = nil
+	}
+}
+
+func (c *Client) checkBroker(b *broker) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.url+"/status/health", nil)
+	if err != nil {
+		return
+	}
+	c.authenticate(req)
+	resp, err := c.http.Do(req)
+	if err == nil {
+		resp.Body.Close()
+	}
+	if err != nil || resp.StatusCode != http.StatusOK {
+		if b.healthy(time.Now()) {
+			log.Printf("druid client - broker %s unhealthy", b.url)
+		}
+		b.markDown(c.health)
+		return
+	}
+	b.markUp()
+}
+
+// Clusters regroupe un client par cluster Druid déclaré dans druid.yaml. Les workers et les
+// handlers partagent la même instance : Reload remplace les clients sous verrou.
+type Clusters struct {
+	mu             sync.RWMutex
+	clients        map[string]*Client
+	defaultCluster string
+	datasources    map[string]string // datasource => cluster
+}
+
+// NewClusters construit les clients de tous les clusters. host_url, s'il est renseigné,
+// déclare le cluster "default" (sauf si un cluster de ce nom existe déjà).
+func NewClusters(druidCfg *config.DruidConfig) (*Clusters, error) {
+	cl := &Clusters{
+		clients:     map[string]*Client{},
+		datasources: map[string]string{},
+	}
+	defs := map[string]config.DruidClusterConfig{}
+	for name, def := range druidCfg.Clusters {
+		defs[name] = def
+	}
+	if _, ok := defs[DefaultClusterName]; !ok && druidCfg.HostURL != "" {
+		defs[DefaultClusterName] = config.DruidClusterConfig{Brokers: []string{druidCfg.HostURL}}
+	}
+	if len(defs) == 0 {
+		return nil, fmt.Errorf("druid.yaml: no host_url nor clusters defined")
+	}
+
+	for name, def := range defs {
+		cc := druidCfg.Client
+		if def.Client != nil {
+			cc = *def.Client
+		}
+		client, err := NewClusterClient(def.Brokers, cc)
+		if err != nil {
+			return nil, fmt.Errorf("cluster %s: %w", name, err)
+		}
+		cl.clients[name] = client
+	}
+
+	cl.defaultCluster = druidCfg.DefaultCluster
+	if cl.defaultCluster == "" {
+		if _, ok := cl.clients[DefaultClusterName]; ok {
+			cl.defaultCluster = DefaultClusterName
+		} else if len(cl.clients) == 1 {
+			for name := range cl.clients {
+				cl.defaultCluster = name
+			}
+		}
+	}
+	if cl.defaultCluster != "" {
+		if _, ok := cl.clients[cl.defaultCluster]; !ok {
+			return nil, fmt.Errorf("druid.yaml: default_cluster %s not defined", cl.defaultCluster)
+		}
+	}
+
+	for dsName, ds := range druidCfg.Datasources {
+		name := ds.Cluster
+		if name == "" {
+			name = cl.defaultCluster
+		}
+		if _, ok := cl.clients[name]; !ok {
+			return nil, fmt.Errorf("datasource %s: unknown cluster %q", dsName, name)
+		}
+		cl.datasources[dsName] = name
+	}
+	return cl, nil
+}
+
+// Reload remplace les clients des clusters (brokers, section client) par ceux de druidCfg ;
+// le rattachement des datasources et le cluster par défaut restent ceux du démarrage, car
+// handlers et workers gardent le druid.yaml reçu au démarrage. Les requêtes en cours
+// terminent sur les anciens clients, dont les health checks sont arrêtés.
+func (cl *Clusters) Reload(druidCfg *config.DruidConfig) error {
+	next, err := NewClusters(druidCfg)
+	if err != nil {
+		return err
+	}
+	cl.mu.RLock()
+	used := map[string]bool{cl.defaultCluster: cl.defaultCluster != ""}
+	for _, name := range cl.datasources {
+		used[name] = true
+	}
+	cl.mu.RUnlock()
+	for name, ok := range used {
+		if _, found := next.clients[name]; ok && !found {
+			return fmt.Errorf("druid.yaml: cluster %s is still in use, restart to remove it", name)
+		}
+	}
+	next.StartHealthChecks()
+	cl.mu.Lock()
+	old := cl.clients
+	cl.clients = next.clients
+	cl.mu.Unlock()
+	for _, c := range old {
+		c.StopHealthChecks()
+	}
+	return nil
+}
+
+// Get retourne le client du cluster nommé
+func (cl *Clusters) Get(name string) (*Client, error) {
+	cl.mu.RLock()
+	defer cl.mu.RUnlock()
+	return cl.get(name)
+}
+
+func (cl *Clusters) get(name string) (*Client, error) {
+	c, ok := cl.clients[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown druid cluster %q", name)
+	}
+	return c, nil
+}
+
+// Default retourne le client du cluster par défaut
+func (cl *Clusters) Default() (*Client, error) {
+	cl.mu.RLock()
+	defer cl.mu.RUnlock()
+	return cl.defaultClient()
+}
+
+func (cl *Clusters) defaultClient() (*Client, error) {
+	if cl.defaultCluster == "" {
+		return nil, fmt.Errorf("no default druid cluster")
+	}
+	return cl.get(cl.defaultCluster)
+}
+
+// ForDatasource retourne le client du cluster auquel la datasource est rattachée
+func (cl *Clusters) ForDatasource(dsName string) (*Client, error) {
+	cl.mu.RLock()
+	defer cl.mu.RUnlock()
+	name, ok := cl.datasources[dsName]
+	if !ok {
+		return cl.defaultClient()
+	}
+	return cl.get(name)
+}
+
+// ClusterName retourne le nom du cluster auquel la datasource est rattachée
+func (cl *Clusters) ClusterName(dsName string) string {
+	cl.mu.RLock()
+	defer cl.mu.RUnlock()
+	if name, ok := cl.datasources[dsName]; ok {
+		return name
+	}
+	return cl.defaultCluster
+}
+
+// Names retourne les noms de clusters, triés
+func (cl *Clusters) Names() []string {
+	cl.mu.RLock()
+	defer cl.mu.RUnlock()
+	names := make([]string, 0, len(cl.clients))
+	for name := range cl.clients {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// StartHealthChecks lance les health checks de tous les clusters multi-brokers
+func (cl *Clusters) StartHealthChecks() {
+	cl.mu.RLock()
+	defer cl.mu.RUnlock()
+	for _, c := range cl.clients {
+		c.StartHealthChecks()
+	}
+}
+
+// Close arrête les health checks
+func (cl *Clusters) Close() {
+	cl.mu.RLock()
+	defer cl.mu.RUnlock()
+	for _, c := range cl.clients {
+		c.StopHealthChecks()
+	}
+}
@@ -0,0 +1,153 @@
+package druid
+
+import (
+	"context"
+	"druid-insight/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClient_FailoverToHealthyBroker(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer down.Close()
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"event":{"n":1}}]`))
+	}))
+	defer up.Close()
+
+	client, err := NewClusterClient([]string{down.URL, up.URL}, config.DruidClientConfig{})
+	if err != nil {
+		t.Fatalf("NewClusterClient failed: %v", err)
+	}
+	for i := 0; i < 4; i++ {
+		res, err := client.NativeQuery(context.Background(), map[string]interface{}{})
+		if err != nil || len(res) != 1 {
+			t.Fatalf("Expected failover to healthy broker, got %v / %v", res, err)
+		}
+	}
+	if client.brokers[0].healthy(time.Now()) {
+		t.Error("Expected failing broker to be marked down")
+	}
+}
+
+func TestNewClusters_DatasourceRouting(t *testing.T) {
+	druidCfg := &config.DruidConfig{
+		HostURL: "http://realtime:8082",
+		Clusters: map[string]config.DruidClusterConfig{
+			"archive": {Brokers: []string{"http://archive-1:8082", "http://archive-2:8082"}},
+		},
+		Datasources: map[string]config.DruidDatasourceSchema{
+			"live":    {},
+			"history": {Cluster: "archive"},
+		},
+	}
+	clusters, err := NewClusters(druidCfg)
+	if err != nil {
+		t.Fatalf("NewClusters failed: %v", err)
+	}
+	live, _ := clusters.ForDatasource("live")
+	if got := live.Brokers(); len(got) != 1 || got[0] != "http://realtime:8082" {
+		t.Errorf("Expected live on default cluster, got %v", got)
+	}
+	history, _ := clusters.ForDatasource("history")
+	if got := history.Brokers(); len(got) != 2 {
+		t.Errorf("Expected history on archive cluster, got %v", got)
+	}
+}
+
+func TestNewClusters_UnknownCluster(t *testing.T) {
+	druidCfg := &config.DruidConfig{
+		HostURL: "http://realtime:8082",
+		Datasources: map[string]config.DruidDatasourceSchema{
+			"history": {Cluster: "archive"},
+		},
+	}
+	if _, err := NewClusters(druidCfg); err == nil {
+		t.Error("Expected error for unknown cluster reference, got nil")
+	}
+}
+
+func TestClusters_ReloadSwapsClientsInPlace(t *testing.T) {
+	clusters, err := NewClusters(&config.DruidConfig{
+		Clusters: map[string]config.DruidClusterConfig{
+			"main": {Brokers: []string{"http://old-1:8082", "http://old-2:8082"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewClusters failed: %v", err)
+	}
+	clusters.StartHealthChecks()
+	old, _ := clusters.Default()
+
+	err = clusters.Reload(&config.DruidConfig{
+		Clusters: map[string]config.DruidClusterConfig{
+			"main": {Brokers: []string{"http://new-1:8082", "http://new-2:8082"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	defer clusters.Close()
+	current, _ := clusters.Default()
+	if current == old || current.Brokers()[0] != "http://new-1:8082" {
+		t.Errorf("Expected reloaded client, got %v", current.Brokers())
+	}
+	if old.stop != nil {
+		t.Error("Expected health checks of the replaced client to be stopped")
+	}
+	if err := clusters.Reload(&config.DruidConfig{}); err == nil {
+		t.Error("Expected an invalid configuration to be rejected")
+	}
+	if current, _ := clusters.Default(); current.Brokers()[0] != "http://new-1:8082" {
+		t.Error("Expected a failed reload to keep the current clients")
+	}
+}
+
+func TestClusters_ReloadKeepsDatasourceRouting(t *testing.T) {
+	clusters, err := NewClusters(&config.DruidConfig{
+		Clusters: map[string]config.DruidClusterConfig{
+			"main":    {Brokers: []string{"http://main:8082"}},
+			"archive": {Brokers: []string{"http://archive:8082"}},
+		},
+		DefaultCluster: "main",
+		Datasources:    map[string]config.DruidDatasourceSchema{"history": {Cluster: "archive"}},
+	})
+	if err != nil {
+		t.Fatalf("NewClusters failed: %v", err)
+	}
+	defer clusters.Close()
+
+	// rattachement modifié dans druid.yaml : appliqué au redémarrage seulement
+	err = clusters.Reload(&config.DruidConfig{
+		Clusters: map[string]config.DruidClusterConfig{
+			"main":    {Brokers: []string{"http://main:8082"}},
+			"archive": {Brokers: []string{"http://archive-2:8082"}},
+		},
+		DefaultCluster: "main",
+		Datasources:    map[string]config.DruidDatasourceSchema{"history": {}, "added": {Cluster: "archive"}},
+	})
+	if err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if name := clusters.ClusterName("history"); name != "archive" {
+		t.Errorf("Expected history to stay on archive, got %s", name)
+	}
+	if name := clusters.ClusterName("added"); name != "main" {
+		t.Errorf("Expected a datasource unknown at startup to keep the default cluster, got %s", name)
+	}
+	if c, _ := clusters.ForDatasource("history"); c.Brokers()[0] != "http://archive-2:8082" {
+		t.Errorf("Expected reloaded archive brokers, got %v", c.Brokers())
+	}
+
+	// cluster encore utilisé retiré de druid.yaml : refusé
+	err = clusters.Reload(&config.DruidConfig{
+		Clusters: map[string]config.DruidClusterConfig{"main": {Brokers: []string{"http://main:8082"}}},
+	})
+	if err == nil {
+		t.Error("Expected removing a cluster in use to be rejected")
+	}
+}
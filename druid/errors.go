@@ -0,0 +1,82 @@
+package druid
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+)
+
+// ErrorClass : catégorie d'une erreur Druid, utilisée pour décider d'un nouvel essai
+type ErrorClass string
+
+const (
+	ClassTimeout       ErrorClass = "timeout"        // timeout client ou Druid (504, "Query timeout")
+	ClassUnavailable   ErrorClass = "unavailable"    // erreur réseau ou 5xx
+	ClassCapacity      ErrorClass = "capacity"       // 429 : trop de requêtes en cours sur Druid
+	ClassResourceLimit ErrorClass = "resource_limit" // requête trop lourde pour les ressources de Druid
+	ClassBadQuery      ErrorClass = "bad_query"      // 4xx : requête refusée par Druid
+	ClassCancelled     ErrorClass = "cancelled"      // requête annulée
+	ClassUnknown       ErrorClass = "unknown"        // erreur non reconnue
+)
+
+// Transient indique si une nouvelle tentative a une chance d'aboutir : une requête trop
+// lourde ou une erreur inconnue échouerait de nouveau
+func (c ErrorClass) Transient() bool {
+	return c == ClassTimeout || c == ClassUnavailable || c == ClassCapacity
+}
+
+// druidErrorBody : corps d'erreur JSON renvoyé par les brokers Druid
+type druidErrorBody struct {
+	Error     string `json:"error"`
+	ErrorCode string `json:"errorCode"`
+	Category  string `json:"category"`
+}
+
+// Classify range une erreur retournée par le client Druid dans une ErrorClass
+func Classify(err error) ErrorClass {
+	if errors.Is(err, context.Canceled) {
+		return ClassCancelled
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ClassTimeout
+	}
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		var body druidErrorBody
+		json.Unmarshal([]byte(httpErr.Body), &body)
+		switch {
+		case httpErr.StatusCode == http.StatusGatewayTimeout || body.Error == "Query timeout" ||
+			body.ErrorCode == "timeout" || body.Category == "TIMEOUT":
+			return ClassTimeout
+		case body.Error == "Resource limit exceeded" || body.ErrorCode == "resourceLimitExceeded" ||
+			body.Category == "RESOURCE_LIMIT":
+			return ClassResourceLimit
+		case httpErr.StatusCode == http.StatusTooManyRequests || body.Error == "Query capacity exceeded" ||
+			body.Category == "CAPACITY_EXCEEDED":
+			return ClassCapacity
+		case httpErr.StatusCode >= 500:
+			return ClassUnavailable
+		}
+		return ClassBadQuery
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return ClassTimeout
+		}
+		return ClassUnavailable
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		// connexion coupée par le broker
+		return ClassUnavailable
+	}
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+		return ClassBadQuery
+	}
+	return ClassUnknown
+}
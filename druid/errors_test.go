@@ -0,0 +1,38 @@
+package druid
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	cases := []struct {
+		err  error
+		want ErrorClass
+	}{
+		{context.Canceled, ClassCancelled},
+		{fmt.Errorf("post: %w", context.DeadlineExceeded), ClassTimeout},
+		{&HTTPError{StatusCode: 504, Body: ""}, ClassTimeout},
+		{&HTTPError{StatusCode: 500, Body: `{"error":"Query timeout","errorMessage":"Query [x] timed out"}`}, ClassTimeout},
+		{&HTTPError{StatusCode: 429, Body: `{"error":"Query capacity exceeded"}`}, ClassCapacity},
+		{&HTTPError{StatusCode: 400, Body: `{"error":"Resource limit exceeded","errorMessage":"Not enough merge buffers"}`}, ClassResourceLimit},
+		{&HTTPError{StatusCode: 503, Body: "Service Unavailable"}, ClassUnavailable},
+		{&HTTPError{StatusCode: 400, Body: `{"error":"Plan validation failed","errorCode":"invalidInput"}`}, ClassBadQuery},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, ClassUnavailable},
+		{fmt.Errorf("read body: %w", io.ErrUnexpectedEOF), ClassUnavailable},
+		{errors.New("something odd"), ClassUnknown},
+	}
+	for _, c := range cases {
+		if got := Classify(c.err); got != c.want {
+			t.Errorf("Classify(%v) = %s, expected %s", c.err, got, c.want)
+		}
+	}
+	if ClassBadQuery.Transient() || ClassCancelled.Transient() || ClassResourceLimit.Transient() ||
+		ClassUnknown.Transient() || !ClassTimeout.Transient() || !ClassCapacity.Transient() {
+		t.Errorf("Unexpected Transient() results")
+	}
+}
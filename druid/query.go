@@ -1,16 +1,11 @@
 package druid
 
 import (
-	"bytes"
-	"database/sql"
 	"druid-insight/auth"
 	"druid-insight/config"
-	"encoding/json"
+	"druid-insight/report"
 	"fmt"
-	"io"
-	"log"
-	"net/http"
-	"slices"
+	"sort"
 )
 
 // BuildAggsAndPostAggs analyse la liste des metrics demandées,
@@ -55,12 +50,20 @@ func BuildAggsAndPostAggs(metrics []string, ds config.DruidDatasourceSchema) (ag
 	return
 }
 
-// BuildDruidQuery construit la requête groupBy pour Druid (JSON map) à partir des inputs
-func BuildDruidQuery(dsName string, dims []string, mets []string, userFilters interface{}, intervals []string, ds config.DruidDatasourceSchema, granularity string, username string, isAdmin bool, druidCfg *config.DruidConfig, cfg *auth.Config, owner string, context string) (map[string]interface{}, error) {
-	var usersFile *auth.UsersFile
+// BuildDruidQuery construit la requête groupBy pour Druid (JSON map) à partir du rapport
+func BuildDruidQuery(spec *report.Spec, username string, isAdmin bool, druidCfg *config.DruidConfig, users *auth.UsersFile, cfg *auth.Config, context string) (map[string]interface{}, error) {
+	ds, ok := druidCfg.Datasources[spec.Datasource]
+	if !ok {
+		return nil, fmt.Errorf("unknown datasource: %s", spec.Datasource)
+	}
+	intervals, err := spec.Intervals()
+	if err != nil {
+		return nil, err
+	}
+	granularity := spec.Granularity()
 
 	var druidDims []interface{}
-	for _, d := range dims {
+	for _, d := range spec.Dimensions {
 		if d == "time" {
 			switch granularity {
 			case "month":
@@ -131,7 +134,7 @@ func BuildDruidQuery(dsName string, dims []string, mets []string, userFilters in
 			druidDims = append(druidDims, dr.Druid)
 		}
 	}
-	aggs, postAggs, err := BuildAggsAndPostAggs(mets, ds)
+	aggs, postAggs, err := BuildAggsAndPostAggs(spec.Metrics, ds)
 	if err != nil {
 		return nil, err
 	}
@@ -140,23 +143,16 @@ func BuildDruidQuery(dsName string, dims []string, mets []string, userFilters in
 		g = "all"
 	}
 
-	// 2. Construire la requête groupBy via BuildDruidQuery
-	if cfg.Auth.UserBackend == "file" {
-		usersFile, _ = auth.LoadUsers("config/users.yaml")
-	} else if slices.Contains([]string{"mysql", "postgres", "sqlite"}, cfg.Auth.UserBackend) {
-		db, err := sql.Open(cfg.Auth.UserBackend, cfg.Auth.DBDSN)
-		if err == nil {
-			defer db.Close()
-		}
-	}
-
 	// Appliquer les restrictions d'accès utilisateur
-	accessFilters := auth.GetAccessFilters(username, isAdmin, dsName, druidCfg, usersFile, cfg)
-	combinedFilters := MergeWithAccessFilters(userFilters, accessFilters, ds)
+	accessFilters, err := ResolveAccessFilters(spec.Datasource, username, isAdmin, druidCfg, users, cfg)
+	if err != nil {
+		return nil, err
+	}
+	combinedFilters := MergeWithAccessFilters(spec.Filters, accessFilters, ds)
 	druidDimFilter := ConvertFiltersToDruidDimFilter(combinedFilters, ds)
 
 	query := map[string]interface{}{
-		"context":      map[string]string{"application": context},
+		"context":      map[string]interface{}{"application": context},
 		"queryType":    "groupBy",
 		"dataSource":   ds.DruidName,
 		"dimensions":   druidDims,
@@ -175,44 +171,25 @@ func BuildDruidQuery(dsName string, dims []string, mets []string, userFilters in
 	return query, nil
 }
 
-// ExecuteDruidQuery exécute la requête groupBy sur Druid, et retourne le résultat.
-func ExecuteDruidQuery(hostURL string, query map[string]interface{}) ([]map[string]interface{}, error) {
-	j, _ := json.Marshal(query)
-	log.Println("execute query : " + string(j))
-	resp, err := http.Post(hostURL, "application/json", bytes.NewReader(j))
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != 200 {
-		bb, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("druid HTTP %d: %s", resp.StatusCode, string(bb))
+// ResolveAccessFilters charge les restrictions d'accès de l'utilisateur selon le backend configuré ;
+// sans users.yaml chargé (backend file), refuse plutôt que de ne rien filtrer
+func ResolveAccessFilters(dsName string, username string, isAdmin bool, druidCfg *config.DruidConfig, users *auth.UsersFile, cfg *auth.Config) (map[string][]string, error) {
+	if !isAdmin && cfg.Auth.UserBackend == "file" && users == nil {
+		return nil, fmt.Errorf("access filters: users file not loaded")
 	}
-	var res []map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
-		return nil, err
-	}
-	return res, nil
+	return auth.GetAccessFilters(username, isAdmin, dsName, druidCfg, users, cfg), nil
 }
 
-// filters doit être []interface{}, chaque élément étant map[string]interface{} avec "dimension" et "values"
+// ConvertFiltersToDruidDimFilter traduit les filtres en filtre Druid ("in", combinés par "and").
 // ds: DruidDatasourceSchema pour récupérer le vrai nom Druid
-func ConvertFiltersToDruidDimFilter(filters []interface{}, ds config.DruidDatasourceSchema) interface{} {
+func ConvertFiltersToDruidDimFilter(filters []report.Filter, ds config.DruidDatasourceSchema) interface{} {
 	var filterFields []interface{}
 	for _, f := range filters {
-		fmap, ok := f.(map[string]interface{})
-		if !ok {
-			continue
+		field := ds.Dimensions[f.Dimension]
+		svalues := f.Values
+		if svalues == nil {
+			svalues = []string{}
 		}
-		dimKey, _ := fmap["dimension"].(string)
-		values, _ := fmap["values"].([]interface{})
-		var svalues []string
-		for _, v := range values {
-			if sv, ok := v.(string); ok {
-				svalues = append(svalues, sv)
-			}
-		}
-		field := ds.Dimensions[dimKey]
 		if field.Lookup != "" {
 			filterFields = append(filterFields, map[string]interface{}{
 				"type":      "in",
@@ -243,27 +220,27 @@ func ConvertFiltersToDruidDimFilter(filters []interface{}, ds config.DruidDataso
 	}
 }
 
-func MergeWithAccessFilters(userFilters interface{}, access map[string][]string, ds config.DruidDatasourceSchema) []interface{} {
-	result := []interface{}{}
+// MergeWithAccessFilters ajoute aux filtres utilisateur les restrictions d'accès
+func MergeWithAccessFilters(userFilters []report.Filter, access map[string][]string, ds config.DruidDatasourceSchema) []report.Filter {
+	result := []report.Filter{}
+	result = append(result, userFilters...)
 
-	if userFilters != nil {
-		if arr, ok := userFilters.([]interface{}); ok {
-			result = append(result, arr...)
-		}
-	}
-
-	for dim, vals := range access {
+	// Ordre stable : la requête générée doit être identique d'un appel à l'autre
+	for _, dim := range sortedKeys(access) {
+		vals := access[dim]
 		if len(vals) == 0 {
 			continue
 		}
-		values := []interface{}{}
-		for _, v := range vals {
-			values = append(values, v)
-		}
-		result = append(result, map[string]interface{}{
-			"dimension": dim,
-			"values":    values,
-		})
+		result = append(result, report.Filter{Dimension: dim, Values: vals})
 	}
 	return result
 }
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -3,6 +3,7 @@ package druid
 import (
 	"druid-insight/auth"
 	"druid-insight/config"
+	"druid-insight/report"
 	"reflect"
 	"testing"
 )
@@ -85,8 +86,8 @@ func contains(arr []string, v string) bool {
 
 func TestMergeWithAccessFilters(t *testing.T) {
 	ds := makeTestDruidSchema()
-	userFilters := []interface{}{
-		map[string]interface{}{"dimension": "browser", "values": []interface{}{"Chrome"}},
+	userFilters := []report.Filter{
+		report.Filter{Dimension: "browser", Values: []string{"Chrome"}},
 	}
 	access := map[string][]string{
 		"device": {"Mobile"},
@@ -99,9 +100,9 @@ func TestMergeWithAccessFilters(t *testing.T) {
 
 func TestConvertFiltersToDruidDimFilter(t *testing.T) {
 	ds := makeTestDruidSchema()
-	filters := []interface{}{
-		map[string]interface{}{"dimension": "browser", "values": []interface{}{"Chrome", "Firefox"}},
-		map[string]interface{}{"dimension": "device", "values": []interface{}{"Mobile"}},
+	filters := []report.Filter{
+		report.Filter{Dimension: "browser", Values: []string{"Chrome", "Firefox"}},
+		report.Filter{Dimension: "device", Values: []string{"Mobile"}},
 	}
 	filter := ConvertFiltersToDruidDimFilter(filters, ds)
 	m, ok := filter.(map[string]interface{})
@@ -116,8 +117,8 @@ func TestConvertFiltersToDruidDimFilter(t *testing.T) {
 
 func TestConvertFiltersToDruidDimFilter_Single(t *testing.T) {
 	ds := makeTestDruidSchema()
-	filters := []interface{}{
-		map[string]interface{}{"dimension": "browser", "values": []interface{}{"Chrome"}},
+	filters := []report.Filter{
+		report.Filter{Dimension: "browser", Values: []string{"Chrome"}},
 	}
 	filter := ConvertFiltersToDruidDimFilter(filters, ds)
 	m, ok := filter.(map[string]interface{})
@@ -131,7 +132,7 @@ func TestConvertFiltersToDruidDimFilter_Single(t *testing.T) {
 
 func TestConvertFiltersToDruidDimFilter_Empty(t *testing.T) {
 	ds := makeTestDruidSchema()
-	filters := []interface{}{}
+	filters := []report.Filter{}
 	filter := ConvertFiltersToDruidDimFilter(filters, ds)
 	if filter != nil {
 		t.Errorf("Expected nil for empty filters, got %v", filter)
@@ -144,7 +145,7 @@ func TestBuildDruidQuery_UnknownDimension(t *testing.T) {
 	druidCfg := &config.DruidConfig{
 		Datasources: map[string]config.DruidDatasourceSchema{"myds": ds},
 	}
-	_, err := BuildDruidQuery("myds", []string{"unknown"}, []string{"requests"}, nil, nil, ds, "all", "alice", false, druidCfg, cfg, "", "test")
+	_, err := BuildDruidQuery(&report.Spec{Datasource: "myds", Dimensions: []string{"unknown"}, Metrics: []string{"requests"}}, "alice", false, druidCfg, &auth.UsersFile{}, cfg, "test")
 	if err == nil {
 		t.Error("Expected error for unknown dimension, got nil")
 	}
@@ -156,7 +157,7 @@ func TestBuildDruidQuery_Basic(t *testing.T) {
 	druidCfg := &config.DruidConfig{
 		Datasources: map[string]config.DruidDatasourceSchema{"myds": ds},
 	}
-	query, err := BuildDruidQuery("myds", []string{"browser"}, []string{"requests"}, nil, nil, ds, "all", "alice", false, druidCfg, cfg, "", "test")
+	query, err := BuildDruidQuery(&report.Spec{Datasource: "myds", Dimensions: []string{"browser"}, Metrics: []string{"requests"}}, "alice", false, druidCfg, &auth.UsersFile{}, cfg, "test")
 	if err != nil {
 		t.Fatalf("BuildDruidQuery failed: %v", err)
 	}
@@ -175,7 +176,7 @@ func TestBuildDruidQuery_LookupDimension(t *testing.T) {
 	druidCfg := &config.DruidConfig{
 		Datasources: map[string]config.DruidDatasourceSchema{"myds": ds},
 	}
-	query, err := BuildDruidQuery("myds", []string{"country"}, []string{"requests"}, nil, nil, ds, "all", "alice", false, druidCfg, cfg, "", "test")
+	query, err := BuildDruidQuery(&report.Spec{Datasource: "myds", Dimensions: []string{"country"}, Metrics: []string{"requests"}}, "alice", false, druidCfg, &auth.UsersFile{}, cfg, "test")
 	if err != nil {
 		t.Fatalf("BuildDruidQuery failed: %v", err)
 	}
@@ -189,8 +190,8 @@ func TestBuildDruidQuery_LookupDimension(t *testing.T) {
 func TestConvertFiltersToDruidDimFilter_Lookup(t *testing.T) {
 	ds := makeTestDruidSchema()
 	ds.Dimensions["country"] = config.DruidField{Druid: "country_code", Lookup: "country_lookup"}
-	filters := []interface{}{
-		map[string]interface{}{"dimension": "country", "values": []interface{}{"France"}},
+	filters := []report.Filter{
+		report.Filter{Dimension: "country", Values: []string{"France"}},
 	}
 	filter := ConvertFiltersToDruidDimFilter(filters, ds)
 	m, ok := filter.(map[string]interface{})
@@ -201,3 +202,28 @@ func TestConvertFiltersToDruidDimFilter_Lookup(t *testing.T) {
 		t.Errorf("Expected extractionFn for lookup, got %v", m)
 	}
 }
+
+func TestBuildDruidQuery_AccessFiltersFromLoadedUsers(t *testing.T) {
+	druidCfg := &config.DruidConfig{
+		Datasources: map[string]config.DruidDatasourceSchema{"myds": makeTestDruidSchema()},
+	}
+	cfg := &auth.Config{}
+	cfg.Auth.UserBackend = "file"
+	cfg.Auth.UserFile = "does-not-exist.yaml"
+	users := &auth.UsersFile{Users: map[string]auth.UserInfo{
+		"bob": {Access: map[string]map[string][]string{"myds": {"browser": {"Firefox"}}}},
+	}}
+	spec := &report.Spec{Datasource: "myds", Dimensions: []string{"browser"}, Metrics: []string{"requests"}}
+
+	query, err := BuildDruidQuery(spec, "bob", false, druidCfg, users, cfg, "test")
+	if err != nil {
+		t.Fatalf("BuildDruidQuery failed: %v", err)
+	}
+	if query["filter"] == nil {
+		t.Errorf("Expected bob's access filter from the loaded users, got %v", query)
+	}
+	// users.yaml non chargé : refus plutôt qu'une requête sans filtre
+	if _, err := BuildDruidQuery(spec, "bob", false, druidCfg, nil, cfg, "test"); err == nil {
+		t.Error("Expected an error without loaded users")
+	}
+}
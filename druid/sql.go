@@ -0,0 +1,273 @@
+package druid
+
+import (
+	"druid-insight/auth"
+	"druid-insight/config"
+	"druid-insight/report"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Modes d'exécution possibles pour une datasource (champ query_mode de druid.yaml)
+const (
+	QueryModeNative = "native"
+	QueryModeSQL    = "sql"
+)
+
+// SQLParameter est un paramètre positionnel de l'API /druid/v2/sql
+type SQLParameter struct {
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
+}
+
+// SQLQuery est le corps envoyé à /druid/v2/sql
+type SQLQuery struct {
+	Query        string                 `json:"query"`
+	Parameters   []SQLParameter         `json:"parameters,omitempty"`
+	ResultFormat string                 `json:"resultFormat"`
+	Context      map[string]interface{} `json:"context,omitempty"`
+}
+
+// Formats de temps identiques à ceux de la requête native (extraction timeFormat)
+var sqlTimeFormats = map[string]string{
+	"month": "yyyy-MM",
+	"day":   "yyyy-MM-dd",
+	"hour":  "yyyy-MM-dd HH",
+	"week":  "YYYY-'W'ww",
+}
+
+// Périodes ISO équivalentes aux granularités natives
+var sqlGranularityPeriods = map[string]string{
+	"hour":  "PT1H",
+	"day":   "P1D",
+	"week":  "P1W",
+	"month": "P1M",
+}
+
+// UsesSQL indique si la datasource doit être interrogée via l'API SQL
+func UsesSQL(ds config.DruidDatasourceSchema) bool {
+	return strings.EqualFold(ds.QueryMode, QueryModeSQL)
+}
+
+// BuildDruidSQLQuery construit l'équivalent SQL de BuildDruidQuery : mêmes dimensions,
+// métriques, formules, filtres utilisateur et restrictions d'accès. Toutes les valeurs
+// venant de l'utilisateur sont passées en paramètres.
+func BuildDruidSQLQuery(spec *report.Spec, username string, isAdmin bool, druidCfg *config.DruidConfig, users *auth.UsersFile, cfg *auth.Config, context string) (*SQLQuery, error) {
+	ds, ok := druidCfg.Datasources[spec.Datasource]
+	if !ok {
+		return nil, fmt.Errorf("unknown datasource: %s", spec.Datasource)
+	}
+	intervals, err := spec.Intervals()
+	if err != nil {
+		return nil, err
+	}
+	granularity := spec.Granularity()
+
+	var (
+		selects  []string
+		groupBys []string
+		where    []string
+		params   []SQLParameter
+	)
+
+	timeSelected := false
+	for _, d := range spec.Dimensions {
+		if d == "time" {
+			timeSelected = true
+			if format, ok := sqlTimeFormats[granularity]; ok {
+				selects = append(selects, "TIME_FORMAT(\"__time\", "+sqlString(format)+", 'Europe/Paris') AS \"time\"")
+			} else {
+				selects = append(selects, "\"__time\" AS \"time\"")
+			}
+			groupBys = append(groupBys, strconv.Itoa(len(selects)))
+			continue
+		}
+		dr, ok := ds.Dimensions[d]
+		if !ok {
+			return nil, fmt.Errorf("unknown dimension: %s", d)
+		}
+		// Mêmes noms de colonnes en sortie que la requête native
+		alias := dr.Druid
+		if dr.Lookup != "" {
+			alias = d
+		}
+		selects = append(selects, sqlDimensionExpr(dr)+" AS "+sqlIdent(alias))
+		groupBys = append(groupBys, strconv.Itoa(len(selects)))
+	}
+	// Granularité sans dimension time : Druid découpe quand même par période
+	if period, ok := sqlGranularityPeriods[granularity]; ok && !timeSelected {
+		groupBys = append(groupBys, "TIME_FLOOR(\"__time\", "+sqlString(period)+")")
+	}
+
+	metSelects, err := BuildSQLMetrics(spec.Metrics, ds)
+	if err != nil {
+		return nil, err
+	}
+	selects = append(selects, metSelects...)
+	if len(selects) == 0 {
+		return nil, fmt.Errorf("no dimension nor metric requested")
+	}
+
+	if len(intervals) > 0 {
+		var ors []string
+		for _, itv := range intervals {
+			parts := strings.SplitN(itv, "/", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("invalid interval: %s", itv)
+			}
+			ors = append(ors, "(\"__time\" >= TIME_PARSE(?) AND \"__time\" < TIME_PARSE(?))")
+			params = append(params, SQLParameter{Type: "VARCHAR", Value: parts[0]}, SQLParameter{Type: "VARCHAR", Value: parts[1]})
+		}
+		where = append(where, "("+strings.Join(ors, " OR ")+")")
+	}
+
+	accessFilters, err := ResolveAccessFilters(spec.Datasource, username, isAdmin, druidCfg, users, cfg)
+	if err != nil {
+		return nil, err
+	}
+	combinedFilters := MergeWithAccessFilters(spec.Filters, accessFilters, ds)
+	filterSQL, filterParams := ConvertFiltersToSQLWhere(combinedFilters, ds)
+	where = append(where, filterSQL...)
+	params = append(params, filterParams...)
+
+	from := sqlIdent(ds.DruidName)
+	if ds.SQLFrom != "" {
+		from = ds.SQLFrom
+	}
+
+	var sb strings.Builder
+	sb.WriteString("SELECT ")
+	sb.WriteString(strings.Join(selects, ", "))
+	sb.WriteString(" FROM ")
+	sb.WriteString(from)
+	if len(where) > 0 {
+		sb.WriteString(" WHERE ")
+		sb.WriteString(strings.Join(where, " AND "))
+	}
+	if len(groupBys) > 0 {
+		sb.WriteString(" GROUP BY ")
+		sb.WriteString(strings.Join(groupBys, ", "))
+	}
+
+	return &SQLQuery{
+		Query:        sb.String(),
+		Parameters:   params,
+		ResultFormat: "object",
+		Context:      map[string]interface{}{"application": context},
+	}, nil
+}
+
+// BuildSQLMetrics traduit les métriques demandées (simples ou formules) en expressions SQL agrégées
+func BuildSQLMetrics(metrics []string, ds config.DruidDatasourceSchema) ([]string, error) {
+	var out []string
+	for _, m := range metrics {
+		mf := ds.Metrics[m]
+		switch {
+		case mf.Formula != "":
+			node, err := ParseFormula(mf.Formula)
+			if err != nil {
+				return nil, fmt.Errorf("parse formula for %s: %w", m, err)
+			}
+			expr, err := NodeToSQL(node, ds)
+			if err != nil {
+				return nil, fmt.Errorf("formula %s: %w", m, err)
+			}
+			out = append(out, expr+" AS "+sqlIdent(m))
+		case mf.SQL != "":
+			out = append(out, mf.SQL+" AS "+sqlIdent(m))
+		case mf.Druid != "":
+			out = append(out, "SUM("+sqlIdent(mf.Druid)+") AS "+sqlIdent(m))
+		}
+	}
+	return out, nil
+}
+
+// NodeToSQL convertit l'arbre de formule en expression SQL (divisions par zéro => 0, comme en natif)
+func NodeToSQL(node *FormulaNode, ds config.DruidDatasourceSchema) (string, error) {
+	if node.Op == "" {
+		if _, err := strconv.ParseFloat(node.Value, 64); err == nil {
+			return node.Value, nil
+		}
+		return sqlMetricAgg(node.Value, ds)
+	}
+	if node.Op == "func" {
+		if node.Value != "sum" || node.Left == nil || node.Left.Op != "" {
+			return "", fmt.Errorf("unsupported function %s", node.Value)
+		}
+		return sqlMetricAgg(node.Left.Value, ds)
+	}
+	left, err := NodeToSQL(node.Left, ds)
+	if err != nil {
+		return "", err
+	}
+	right, err := NodeToSQL(node.Right, ds)
+	if err != nil {
+		return "", err
+	}
+	if node.Op == "/" {
+		return "COALESCE(CAST(" + left + " AS DOUBLE) / NULLIF(" + right + ", 0), 0)", nil
+	}
+	return "(" + left + " " + node.Op + " " + right + ")", nil
+}
+
+func sqlMetricAgg(name string, ds config.DruidDatasourceSchema) (string, error) {
+	base, ok := ds.Metrics[name]
+	if !ok || (base.Druid == "" && base.SQL == "") {
+		return "", fmt.Errorf("metric %s used in formula not found", name)
+	}
+	if base.SQL != "" {
+		return "(" + base.SQL + ")", nil
+	}
+	return "SUM(" + sqlIdent(base.Druid) + ")", nil
+}
+
+// ConvertFiltersToSQLWhere est l'équivalent SQL de ConvertFiltersToDruidDimFilter
+func ConvertFiltersToSQLWhere(filters []report.Filter, ds config.DruidDatasourceSchema) ([]string, []SQLParameter) {
+	var (
+		clauses []string
+		params  []SQLParameter
+	)
+	for _, f := range filters {
+		field := ds.Dimensions[f.Dimension]
+		if len(f.Values) == 0 {
+			// "in" natif sans valeur : ne matche rien
+			clauses = append(clauses, "1 = 0")
+			continue
+		}
+		placeholders := make([]string, 0, len(f.Values))
+		for _, v := range f.Values {
+			placeholders = append(placeholders, "?")
+			params = append(params, SQLParameter{Type: "VARCHAR", Value: v})
+		}
+		clauses = append(clauses, sqlDimensionExpr(field)+" IN ("+strings.Join(placeholders, ", ")+")")
+	}
+	return clauses, params
+}
+
+func sqlDimensionExpr(field config.DruidField) string {
+	if field.SQL != "" {
+		return "(" + field.SQL + ")"
+	}
+	if field.Lookup != "" {
+		return "LOOKUP(" + sqlIdent(field.Druid) + ", " + sqlString(field.Lookup) + ")"
+	}
+	return sqlIdent(field.Druid)
+}
+
+func sqlIdent(name string) string {
+	return "\"" + strings.ReplaceAll(name, "\"", "\"\"") + "\""
+}
+
+func sqlString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// SQLRowsToEvents enveloppe les lignes SQL dans le format {event: ...} des groupBy natifs
+func SQLRowsToEvents(rows []map[string]interface{}) []map[string]interface{} {
+	res := make([]map[string]interface{}, 0, len(rows))
+	for _, row := range rows {
+		res = append(res, map[string]interface{}{"event": row})
+	}
+	return res
+}
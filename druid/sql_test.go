@@ -0,0 +1,102 @@
+package druid
+
+import (
+	"druid-insight/auth"
+	"druid-insight/config"
+	"druid-insight/report"
+	"strings"
+	"testing"
+)
+
+func TestBuildDruidSQLQuery_Basic(t *testing.T) {
+	ds := makeTestDruidSchema()
+	ds.DruidName = "events"
+	cfg := &auth.Config{}
+	druidCfg := &config.DruidConfig{
+		Datasources: map[string]config.DruidDatasourceSchema{"myds": ds},
+	}
+	filters := []report.Filter{
+		report.Filter{Dimension: "browser", Values: []string{"Chrome", "Firefox"}},
+	}
+	spec := &report.Spec{
+		Datasource: "myds",
+		Dimensions: []string{"time", "browser"},
+		Metrics:    []string{"requests"},
+		Filters:    filters,
+		Dates:      []string{"2024-01-01", "2024-01-01"},
+		TimeGroup:  "day",
+	}
+	q, err := BuildDruidSQLQuery(spec, "alice", false, druidCfg, &auth.UsersFile{}, cfg, "test")
+	if err != nil {
+		t.Fatalf("BuildDruidSQLQuery failed: %v", err)
+	}
+	expected := `SELECT TIME_FORMAT("__time", 'yyyy-MM-dd', 'Europe/Paris') AS "time", "browser" AS "browser", SUM("requests") AS "requests" FROM "events" WHERE (("__time" >= TIME_PARSE(?) AND "__time" < TIME_PARSE(?))) AND "browser" IN (?, ?) GROUP BY 1, 2`
+	if q.Query != expected {
+		t.Errorf("Unexpected SQL:\n got: %s\nwant: %s", q.Query, expected)
+	}
+	if len(q.Parameters) != 4 || q.Parameters[2].Value != "Chrome" {
+		t.Errorf("Expected 4 parameters (2 interval bounds + 2 values), got %v", q.Parameters)
+	}
+	if q.Context["application"] != "test" {
+		t.Errorf("Expected application context 'test', got %v", q.Context)
+	}
+}
+
+func TestBuildDruidSQLQuery_FormulaAndLookup(t *testing.T) {
+	ds := makeTestDruidSchema()
+	ds.Metrics["revenue"] = config.DruidField{Druid: "revenue"}
+	ds.Metrics["impressions"] = config.DruidField{Druid: "impressions"}
+	ds.Dimensions["country"] = config.DruidField{Druid: "country_code", Lookup: "country_lookup"}
+	cfg := &auth.Config{}
+	druidCfg := &config.DruidConfig{
+		Datasources: map[string]config.DruidDatasourceSchema{"myds": ds},
+	}
+	q, err := BuildDruidSQLQuery(&report.Spec{Datasource: "myds", Dimensions: []string{"country"}, Metrics: []string{"cpm"}}, "alice", false, druidCfg, &auth.UsersFile{}, cfg, "test")
+	if err != nil {
+		t.Fatalf("BuildDruidSQLQuery failed: %v", err)
+	}
+	if !strings.Contains(q.Query, `LOOKUP("country_code", 'country_lookup') AS "country"`) {
+		t.Errorf("Expected lookup expression, got %s", q.Query)
+	}
+	if !strings.Contains(q.Query, `COALESCE(CAST((1000 * SUM("revenue")) AS DOUBLE) / NULLIF(SUM("impressions"), 0), 0) AS "cpm"`) {
+		t.Errorf("Expected cpm formula translated to SQL, got %s", q.Query)
+	}
+	if len(q.Parameters) != 0 {
+		t.Errorf("Expected no parameters, got %v", q.Parameters)
+	}
+}
+
+func TestBuildDruidSQLQuery_UnknownDimension(t *testing.T) {
+	ds := makeTestDruidSchema()
+	cfg := &auth.Config{}
+	druidCfg := &config.DruidConfig{
+		Datasources: map[string]config.DruidDatasourceSchema{"myds": ds},
+	}
+	_, err := BuildDruidSQLQuery(&report.Spec{Datasource: "myds", Dimensions: []string{"unknown"}, Metrics: []string{"requests"}}, "alice", false, druidCfg, &auth.UsersFile{}, cfg, "test")
+	if err == nil {
+		t.Error("Expected error for unknown dimension, got nil")
+	}
+}
+
+func TestConvertFiltersToSQLWhere_Parameterised(t *testing.T) {
+	ds := makeTestDruidSchema()
+	filters := []report.Filter{
+		report.Filter{Dimension: "device", Values: []string{"x' OR '1'='1"}},
+	}
+	clauses, params := ConvertFiltersToSQLWhere(filters, ds)
+	if len(clauses) != 1 || clauses[0] != `"device" IN (?)` {
+		t.Errorf("Expected parameterised IN clause, got %v", clauses)
+	}
+	if len(params) != 1 || params[0].Value != "x' OR '1'='1" {
+		t.Errorf("Expected raw value passed as parameter, got %v", params)
+	}
+}
+
+func TestSQLRowsToEvents(t *testing.T) {
+	rows := []map[string]interface{}{{"browser": "Chrome", "requests": 12.0}}
+	events := SQLRowsToEvents(rows)
+	evt, ok := events[0]["event"].(map[string]interface{})
+	if !ok || evt["browser"] != "Chrome" {
+		t.Errorf("Expected rows wrapped in event, got %v", events)
+	}
+}
@@ -0,0 +1,252 @@
+package notify
+
+import (
+	"bytes"
+	"druid-insight/auth"
+	"druid-insight/logging"
+	"druid-insight/store"
+	"druid-insight/utils"
+	"druid-insight/worker"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	defaultMaxAttachmentBytes = 5 << 20
+	defaultLinkTTLMinutes     = 7 * 24 * 60
+
+	defaultSubjectTemplate = `[druid-insight] {{if .Schedule}}{{.Schedule}}{{else}}Report {{.Datasource}}{{end}}: {{.Status}}`
+	defaultBodyTemplate    = `Report {{.ID}} on {{.Datasource}} finished with status {{.Status}}.
+{{if .Schedule}}Schedule: {{.Schedule}}
+{{end}}{{if .Error}}Error: {{.Error}}
+{{end}}{{if .Attached}}The CSV result ({{.Rows}} rows) is attached.
+{{else if .DownloadURL}}Download the CSV result ({{.Rows}} rows, link valid until {{.LinkExpiresAt.Format "2006-01-02 15:04"}}):
+{{.DownloadURL}}
+{{end}}`
+)
+
+// TemplateData : variables disponibles dans smtp.subject_template et smtp.body_template
+type TemplateData struct {
+	ID            string
+	Owner         string
+	Datasource    string
+	Status        string
+	Error         string
+	Rows          int
+	Schedule      string
+	Attached      bool
+	DownloadURL   string
+	LinkExpiresAt time.Time
+}
+
+// Notifier envoie le résultat des rapports terminés aux destinataires demandés
+type Notifier struct {
+	cfg     *auth.Config
+	st      *store.Store
+	mailer  *Mailer
+	subject *template.Template
+	body    *template.Template
+	logger  *logging.Logger
+}
+
+// New crée le notifier SMTP ; retourne nil si smtp.host n'est pas configuré
+func New(cfg *auth.Config, st *store.Store, logger *logging.Logger) (*Notifier, error) {
+	if cfg.SMTP.Host == "" {
+		return nil, nil
+	}
+	subjectTpl, bodyTpl := cfg.SMTP.SubjectTemplate, cfg.SMTP.BodyTemplate
+	if subjectTpl == "" {
+		subjectTpl = defaultSubjectTemplate
+	}
+	if bodyTpl == "" {
+		bodyTpl = defaultBodyTemplate
+	}
+	subject, err := template.New("subject").Parse(subjectTpl)
+	if err != nil {
+		return nil, fmt.Errorf("smtp subject_template: %w", err)
+	}
+	body, err := template.New("body").Parse(bodyTpl)
+	if err != nil {
+		return nil, fmt.Errorf("smtp body_template: %w", err)
+	}
+	if _, err := mail.ParseAddress(cfg.SMTP.From); err != nil {
+		return nil, fmt.Errorf("smtp from: %w", err)
+	}
+	return &Notifier{
+		cfg: cfg,
+		st:  st,
+		mailer: &Mailer{
+			Host:               cfg.SMTP.Host,
+			Port:               cfg.SMTP.Port,
+			TLS:                cfg.SMTP.TLS,
+			InsecureSkipVerify: cfg.SMTP.InsecureSkipVerify,
+			Username:           cfg.SMTP.Username,
+			Password:           cfg.SMTP.Password,
+			From:               cfg.SMTP.From,
+		},
+		subject: subject,
+		body:    body,
+		logger:  logger,
+	}, nil
+}
+
+// ParseRecipients découpe une liste d'adresses séparées par des virgules
+func ParseRecipients(s string) []string {
+	var out []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// ValidateRecipients vérifie que l'envoi est configuré, que les adresses sont valides
+// et que leur domaine est autorisé (smtp.allowed_domains)
+func ValidateRecipients(cfg *auth.Config, recipients []string) error {
+	if len(recipients) == 0 {
+		return nil
+	}
+	if cfg.SMTP.Host == "" {
+		return errors.New("email delivery is not configured")
+	}
+	for _, r := range recipients {
+		addr, err := mail.ParseAddress(r)
+		if err != nil || addr.Address != r {
+			return fmt.Errorf("invalid email address %q", r)
+		}
+		if len(cfg.SMTP.AllowedDomains) == 0 {
+			continue
+		}
+		domain := strings.ToLower(r[strings.LastIndex(r, "@")+1:])
+		allowed := false
+		for _, d := range cfg.SMTP.AllowedDomains {
+			if strings.ToLower(d) == domain {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("email domain %s is not allowed", domain)
+		}
+	}
+	return nil
+}
+
+// ReportFinished est le hook worker : envoie l'e-mail en arrière-plan si des destinataires sont demandés
+func (n *Notifier) ReportFinished(req *worker.ReportRequest, res *worker.ReportResult) {
+	if len(req.Notify) == 0 {
+		return
+	}
+	go func() {
+		if err := n.Deliver(req, res); err != nil {
+			n.logger.Write(fmt.Sprintf("[MAIL_FAIL] id=%s to=%s %v", req.ID, strings.Join(req.Notify, ","), err))
+		}
+	}()
+}
+
+// Deliver envoie le résultat : CSV en pièce jointe s'il tient dans smtp.max_attachment_bytes,
+// sinon lien de téléchargement signé ; statut seul si req.NotifyOnly
+func (n *Notifier) Deliver(req *worker.ReportRequest, res *worker.ReportResult) error {
+	data := TemplateData{
+		ID:         req.ID,
+		Owner:      req.Owner,
+		Datasource: req.Datasource,
+		Status:     string(res.Status),
+		Error:      res.ErrorMsg,
+		Schedule:   req.Schedule,
+	}
+	data.Rows = res.Rows
+	var attachments []Attachment
+	if res.Status == worker.StatusComplete && res.CSVPath != "" && !req.NotifyOnly {
+		limit := n.cfg.SMTP.MaxAttachmentBytes
+		if limit == 0 {
+			limit = defaultMaxAttachmentBytes
+		}
+		info, err := os.Stat(res.CSVPath)
+		if err != nil {
+			return err
+		}
+		if limit > 0 && info.Size() <= limit {
+			csv, err := os.ReadFile(res.CSVPath)
+			if err != nil {
+				return err
+			}
+			attachments = append(attachments, Attachment{Name: "report_" + req.ID + ".csv", ContentType: "text/csv; charset=utf-8", Data: csv})
+			data.Attached = true
+		} else {
+			link, err := n.downloadLink(req)
+			if err != nil {
+				return err
+			}
+			data.DownloadURL, data.LinkExpiresAt = link, n.linkExpiry(time.Now())
+		}
+	}
+
+	var subject, body bytes.Buffer
+	if err := n.subject.Execute(&subject, data); err != nil {
+		return fmt.Errorf("subject template: %w", err)
+	}
+	if err := n.body.Execute(&body, data); err != nil {
+		return fmt.Errorf("body template: %w", err)
+	}
+	err := n.mailer.Send(&Message{
+		To:          req.Notify,
+		Subject:     strings.TrimSpace(subject.String()),
+		Body:        body.String(),
+		Attachments: attachments,
+	})
+	if err != nil {
+		return err
+	}
+	n.logger.Write(fmt.Sprintf("[MAIL] id=%s to=%s attached=%t", req.ID, strings.Join(req.Notify, ","), data.Attached))
+	return nil
+}
+
+func (n *Notifier) linkExpiry(now time.Time) time.Time {
+	ttl := n.cfg.SMTP.LinkTTLMinutes
+	if ttl <= 0 {
+		ttl = defaultLinkTTLMinutes
+	}
+	return now.Add(time.Duration(ttl) * time.Minute)
+}
+
+// downloadLink émet un lien de partage signé donnant directement le CSV du résultat
+func (n *Notifier) downloadLink(req *worker.ReportRequest) (string, error) {
+	link, _, err := ResultDownloadLink(n.cfg, n.st, req, n.linkExpiry(time.Now()))
+	return link, err
+}
+
+// ResultDownloadLink enregistre un lien de partage "direct" vers le CSV du résultat de req
+// et retourne son URL signée (share.base_url + /api/share/view?token=...&download=1)
+func ResultDownloadLink(cfg *auth.Config, st *store.Store, req *worker.ReportRequest, expiresAt time.Time) (string, *store.ShareLink, error) {
+	link := &store.ShareLink{
+		ID:        utils.GenerateRequestID(),
+		Kind:      auth.ShareKindResult,
+		Target:    req.ID,
+		Sharer:    req.Owner,
+		Direct:    true,
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	}
+	token, err := auth.SignShareToken(cfg.ShareSecret(), auth.ShareClaims{
+		ID:        link.ID,
+		Kind:      link.Kind,
+		Target:    link.Target,
+		Sharer:    link.Sharer,
+		ExpiresAt: link.ExpiresAt.Unix(),
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	if err := st.PutShareLink(link); err != nil {
+		return "", nil, err
+	}
+	return cfg.Share.BaseURL + "/api/share/view?token=" + url.QueryEscape(token) + "&download=1", link, nil
+}
@@ -0,0 +1,218 @@
+package notify
+
+import (
+	"bufio"
+	"druid-insight/auth"
+	"druid-insight/logging"
+	"druid-insight/store"
+	"druid-insight/worker"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeSMTP : serveur SMTP minimal (sans TLS ni auth) qui capture les messages reçus
+type fakeSMTP struct {
+	ln       net.Listener
+	messages chan string
+	rcpts    chan []string
+}
+
+func startFakeSMTP(t *testing.T) *fakeSMTP {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	f := &fakeSMTP{ln: ln, messages: make(chan string, 10), rcpts: make(chan []string, 10)}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeSMTP) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+	reply("220 localhost ESMTP")
+	var rcpts []string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(cmd, "MAIL FROM"):
+			reply("250 OK")
+		case strings.HasPrefix(cmd, "RCPT TO"):
+			rcpts = append(rcpts, strings.Trim(strings.TrimSpace(line[8:]), "<>"))
+			reply("250 OK")
+		case cmd == "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			f.messages <- data.String()
+			f.rcpts <- rcpts
+			reply("250 queued")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func newTestNotifier(t *testing.T, srv *fakeSMTP, maxAttachment int64) (*Notifier, *store.Store) {
+	dir := t.TempDir()
+	st, err := store.Open("file", "", filepath.Join(dir, "data"))
+	if err != nil {
+		t.Fatalf("store.Open failed: %v", err)
+	}
+	logger, _ := logging.NewLogger(dir, "report.log")
+	cfg := &auth.Config{}
+	cfg.JWT.Secret = "secret"
+	cfg.Share.BaseURL = "https://insight.example.com"
+	cfg.SMTP.Host = "127.0.0.1"
+	cfg.SMTP.Port = srv.ln.Addr().(*net.TCPAddr).Port
+	cfg.SMTP.TLS = TLSNone
+	cfg.SMTP.From = "Druid Insight <insight@example.com>"
+	cfg.SMTP.MaxAttachmentBytes = maxAttachment
+	n, err := New(cfg, st, logger)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	return n, st
+}
+
+func writeCSV(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "r.csv")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDeliver_AttachesCSV(t *testing.T) {
+	srv := startFakeSMTP(t)
+	n, _ := newTestNotifier(t, srv, 0)
+	req := &worker.ReportRequest{ID: "r1", Owner: "alice", Datasource: "myds", Schedule: "Weekly", Notify: []string{"bob@example.com"}}
+	res := &worker.ReportResult{Status: worker.StatusComplete, CSVPath: writeCSV(t, "browser,requests\nChrome,12\n"), Result: []map[string]interface{}{{}}}
+
+	if err := n.Deliver(req, res); err != nil {
+		t.Fatalf("Deliver failed: %v", err)
+	}
+	msg := <-srv.messages
+	if rcpts := <-srv.rcpts; len(rcpts) != 1 || rcpts[0] != "bob@example.com" {
+		t.Errorf("Unexpected recipients %v", rcpts)
+	}
+	if !strings.Contains(msg, "Subject: [druid-insight] Weekly: complete") {
+		t.Errorf("Expected templated subject, got:\n%s", msg)
+	}
+	if !strings.Contains(msg, `filename="report_r1.csv"`) {
+		t.Errorf("Expected CSV attachment, got:\n%s", msg)
+	}
+}
+
+func TestDeliver_FallsBackToSignedLink(t *testing.T) {
+	srv := startFakeSMTP(t)
+	n, st := newTestNotifier(t, srv, 10)
+	req := &worker.ReportRequest{ID: "r2", Owner: "alice", Datasource: "myds", Notify: []string{"bob@example.com"}}
+	res := &worker.ReportResult{Status: worker.StatusComplete, CSVPath: writeCSV(t, "browser,requests\nChrome,12\nFirefox,3\n")}
+
+	if err := n.Deliver(req, res); err != nil {
+		t.Fatalf("Deliver failed: %v", err)
+	}
+	msg := <-srv.messages
+	if strings.Contains(msg, "filename=") {
+		t.Errorf("Expected no attachment above the size limit")
+	}
+	links, _ := st.ListShareLinks(nil)
+	if len(links) != 1 || links[0].Target != "r2" || !links[0].Direct || links[0].Kind != auth.ShareKindResult {
+		t.Fatalf("Expected a direct result share link, got %+v", links)
+	}
+	// Le corps est encodé en base64 : on vérifie via le décodage MIME du lien
+	if !strings.Contains(decodeBody(t, msg), "https://insight.example.com/api/share/view?token=") {
+		t.Errorf("Expected signed download link in body")
+	}
+}
+
+func TestDeliver_StatusOnlyWithoutExport(t *testing.T) {
+	srv := startFakeSMTP(t)
+	n, st := newTestNotifier(t, srv, 10)
+	req := &worker.ReportRequest{ID: "r3", Owner: "alice", Datasource: "myds", Notify: []string{"bob@example.com"}, NotifyOnly: true}
+	res := &worker.ReportResult{Status: worker.StatusComplete, CSVPath: writeCSV(t, "browser,requests\nChrome,12\nFirefox,3\n")}
+
+	if err := n.Deliver(req, res); err != nil {
+		t.Fatalf("Deliver failed: %v", err)
+	}
+	msg := <-srv.messages
+	if strings.Contains(msg, "filename=") || strings.Contains(decodeBody(t, msg), "/api/share/view") {
+		t.Errorf("Expected a status-only email, got:\n%s", msg)
+	}
+	if links, _ := st.ListShareLinks(nil); len(links) != 0 {
+		t.Errorf("Expected no share link, got %+v", links)
+	}
+}
+
+func TestValidateRecipients(t *testing.T) {
+	cfg := &auth.Config{}
+	if err := ValidateRecipients(cfg, []string{"a@example.com"}); err == nil {
+		t.Error("Expected error when smtp is not configured")
+	}
+	cfg.SMTP.Host = "smtp.example.com"
+	cfg.SMTP.AllowedDomains = []string{"example.com"}
+	if err := ValidateRecipients(cfg, []string{"a@example.com"}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := ValidateRecipients(cfg, []string{"a@evil.com"}); err == nil {
+		t.Error("Expected error for a domain outside allowed_domains")
+	}
+	if err := ValidateRecipients(cfg, []string{"Bob <a@example.com>"}); err == nil {
+		t.Error("Expected error for a non bare address")
+	}
+}
+
+// decodeBody retourne la partie texte (décodée) d'un message multipart
+func decodeBody(t *testing.T, raw string) string {
+	msg, err := mail.ReadMessage(strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("ReadMessage failed: %v", err)
+	}
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("ParseMediaType failed: %v", err)
+	}
+	part, err := multipart.NewReader(msg.Body, params["boundary"]).NextPart()
+	if err != nil {
+		t.Fatalf("NextPart failed: %v", err)
+	}
+	body, _ := io.ReadAll(base64.NewDecoder(base64.StdEncoding, part))
+	return string(body)
+}
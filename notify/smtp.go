@@ -0,0 +1,172 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Modes TLS de la connexion SMTP
+const (
+	TLSNone     = "none"
+	TLSStartTLS = "starttls"
+	TLSImplicit = "tls"
+)
+
+const dialTimeout = 10 * time.Second
+
+// Attachment : pièce jointe d'un e-mail
+type Attachment struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// Message : e-mail texte avec pièces jointes éventuelles
+type Message struct {
+	To          []string
+	Subject     string
+	Body        string
+	Attachments []Attachment
+}
+
+// Mailer envoie des e-mails via un serveur SMTP
+type Mailer struct {
+	Host               string
+	Port               int
+	TLS                string
+	InsecureSkipVerify bool
+	Username           string
+	Password           string
+	From               string
+}
+
+// Send envoie le message (connexion, TLS, authentification, MAIL/RCPT/DATA)
+func (m *Mailer) Send(msg *Message) error {
+	if len(msg.To) == 0 {
+		return errors.New("smtp: no recipient")
+	}
+	from, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return fmt.Errorf("smtp from: %w", err)
+	}
+	port := m.Port
+	mode := m.TLS
+	if mode == "" {
+		mode = TLSStartTLS
+	}
+	if port == 0 {
+		port = 587
+		if mode == TLSImplicit {
+			port = 465
+		}
+	}
+	addr := net.JoinHostPort(m.Host, strconv.Itoa(port))
+	tlsCfg := &tls.Config{ServerName: m.Host, InsecureSkipVerify: m.InsecureSkipVerify}
+
+	var conn net.Conn
+	if mode == TLSImplicit {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: dialTimeout}, "tcp", addr, tlsCfg)
+	} else {
+		conn, err = net.DialTimeout("tcp", addr, dialTimeout)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(2 * time.Minute))
+	c, err := smtp.NewClient(conn, m.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if mode == TLSStartTLS {
+		if err := c.StartTLS(tlsCfg); err != nil {
+			return fmt.Errorf("smtp starttls: %w", err)
+		}
+	}
+	if m.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", m.Username, m.Password, m.Host)); err != nil {
+			return fmt.Errorf("smtp auth: %w", err)
+		}
+	}
+	if err := c.Mail(from.Address); err != nil {
+		return err
+	}
+	for _, to := range msg.To {
+		if err := c.Rcpt(to); err != nil {
+			return fmt.Errorf("smtp rcpt %s: %w", to, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(buildMIME(from.String(), msg)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// buildMIME construit le message multipart/mixed (texte + pièces jointes en base64)
+func buildMIME(from string, msg *Message) []byte {
+	var b bytes.Buffer
+	boundary := randomBoundary()
+	header := func(k, v string) { b.WriteString(k + ": " + v + "\r\n") }
+	header("From", from)
+	header("To", strings.Join(msg.To, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", `multipart/mixed; boundary="`+boundary+`"`)
+	b.WriteString("\r\n")
+
+	b.WriteString("--" + boundary + "\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+	writeBase64Lines(&b, []byte(msg.Body))
+
+	for _, a := range msg.Attachments {
+		ct := a.ContentType
+		if ct == "" {
+			ct = "application/octet-stream"
+		}
+		b.WriteString("--" + boundary + "\r\n")
+		b.WriteString("Content-Type: " + ct + "\r\n")
+		b.WriteString("Content-Transfer-Encoding: base64\r\n")
+		b.WriteString(`Content-Disposition: attachment; filename="` + strings.ReplaceAll(a.Name, `"`, "") + "\"\r\n\r\n")
+		writeBase64Lines(&b, a.Data)
+	}
+	b.WriteString("--" + boundary + "--\r\n")
+	return b.Bytes()
+}
+
+func writeBase64Lines(b *bytes.Buffer, data []byte) {
+	enc := base64.StdEncoding.EncodeToString(data)
+	for len(enc) > 76 {
+		b.WriteString(enc[:76] + "\r\n")
+		enc = enc[76:]
+	}
+	b.WriteString(enc + "\r\n")
+}
+
+func randomBoundary() string {
+	buf := make([]byte, 12)
+	rand.Read(buf)
+	return "di-" + hex.EncodeToString(buf)
+}
@@ -0,0 +1,201 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"druid-insight/auth"
+	"druid-insight/logging"
+	"druid-insight/store"
+	"druid-insight/utils"
+	"druid-insight/worker"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultWebhookAttempts = 5
+	defaultWebhookTimeout  = 10 * time.Second
+	webhookBackoff         = time.Second
+
+	// En-têtes des appels de webhook
+	HeaderSignature = "X-Insight-Signature" // sha256=<hex HMAC(secret, timestamp + "." + corps)>
+	HeaderTimestamp = "X-Insight-Timestamp" // secondes Unix
+	HeaderDelivery  = "X-Insight-Delivery"  // id de la livraison
+)
+
+// WebhookEvent : corps JSON envoyé aux webhooks
+type WebhookEvent struct {
+	Event       string    `json:"event"` // report.complete, report.error, report.cancelled
+	ID          string    `json:"id"`
+	Owner       string    `json:"owner"`
+	Datasource  string    `json:"datasource"`
+	Status      string    `json:"status"`
+	RowCount    int       `json:"row_count"`
+	Error       string    `json:"error,omitempty"`
+	DownloadURL string    `json:"download_url,omitempty"`
+	Schedule    string    `json:"schedule,omitempty"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// Webhooks envoie les événements de fin de rapport aux webhooks configurés,
+// avec retries et journal des livraisons dans le stockage
+type Webhooks struct {
+	cfg     *auth.Config
+	st      *store.Store
+	logger  *logging.Logger
+	client  *http.Client
+	backoff time.Duration
+}
+
+// NewWebhooks crée le dispatcher ; retourne nil si aucun webhook n'est configuré
+func NewWebhooks(cfg *auth.Config, st *store.Store, logger *logging.Logger) *Webhooks {
+	if len(cfg.Webhooks) == 0 {
+		return nil
+	}
+	return &Webhooks{cfg: cfg, st: st, logger: logger, client: &http.Client{}, backoff: webhookBackoff}
+}
+
+// SignWebhook calcule la signature d'un corps de webhook
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// ReportFinished est le hook worker : une livraison en arrière-plan par webhook abonné
+func (wh *Webhooks) ReportFinished(req *worker.ReportRequest, res *worker.ReportResult) {
+	var event *WebhookEvent
+	for i := range wh.cfg.Webhooks {
+		hook := wh.cfg.Webhooks[i]
+		if !subscribed(hook, string(res.Status)) {
+			continue
+		}
+		if event == nil {
+			event = wh.buildEvent(req, res)
+		}
+		go wh.Deliver(hook, event)
+	}
+}
+
+func subscribed(hook auth.WebhookConfig, status string) bool {
+	if len(hook.Events) == 0 {
+		return true
+	}
+	for _, e := range hook.Events {
+		if e == status {
+			return true
+		}
+	}
+	return false
+}
+
+func (wh *Webhooks) buildEvent(req *worker.ReportRequest, res *worker.ReportResult) *WebhookEvent {
+	event := &WebhookEvent{
+		Event:      "report." + string(res.Status),
+		ID:         req.ID,
+		Owner:      req.Owner,
+		Datasource: req.Datasource,
+		Status:     string(res.Status),
+		Error:      res.ErrorMsg,
+		Schedule:   req.Schedule,
+		Timestamp:  time.Now().UTC(),
+	}
+	event.RowCount = res.Rows
+	if res.Status == worker.StatusComplete && res.CSVPath != "" {
+		ttl := wh.cfg.Share.DefaultTTLMinutes
+		if ttl <= 0 {
+			ttl = defaultLinkTTLMinutes
+		}
+		link, _, err := ResultDownloadLink(wh.cfg, wh.st, req, time.Now().Add(time.Duration(ttl)*time.Minute))
+		if err != nil {
+			wh.logger.Write(fmt.Sprintf("[WEBHOOK_FAIL] id=%s download link: %v", req.ID, err))
+		}
+		event.DownloadURL = link
+	}
+	return event
+}
+
+// Deliver envoie l'événement au webhook, en retentant les erreurs réseau, 429 et 5xx
+// avec un backoff exponentiel, et journalise chaque tentative
+func (wh *Webhooks) Deliver(hook auth.WebhookConfig, event *WebhookEvent) *store.WebhookDelivery {
+	body, _ := json.Marshal(event)
+	maxAttempts := hook.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultWebhookAttempts
+	}
+	timeout := time.Duration(hook.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = defaultWebhookTimeout
+	}
+	d := &store.WebhookDelivery{
+		ID:        utils.GenerateRequestID(),
+		URL:       hook.URL,
+		Event:     event.Event,
+		ReportID:  event.ID,
+		Owner:     event.Owner,
+		Status:    store.DeliveryPending,
+		CreatedAt: time.Now(),
+	}
+	delay := wh.backoff
+	for attempt := 1; ; attempt++ {
+		a, retry := wh.attempt(hook, d.ID, body, timeout)
+		d.Attempts = append(d.Attempts, a)
+		d.UpdatedAt = time.Now()
+		switch {
+		case a.Error == "":
+			d.Status = store.DeliveryDelivered
+		case !retry || attempt >= maxAttempts:
+			d.Status = store.DeliveryFailed
+		}
+		if err := wh.st.PutWebhookDelivery(d); err != nil {
+			wh.logger.Write(fmt.Sprintf("[WEBHOOK_FAIL] delivery=%s save: %v", d.ID, err))
+		}
+		if d.Status != store.DeliveryPending {
+			break
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+	wh.logger.Write(fmt.Sprintf("[WEBHOOK] id=%s url=%s event=%s status=%s attempts=%d", event.ID, hook.URL, event.Event, d.Status, len(d.Attempts)))
+	return d
+}
+
+func (wh *Webhooks) attempt(hook auth.WebhookConfig, deliveryID string, body []byte, timeout time.Duration) (store.DeliveryAttempt, bool) {
+	start := time.Now()
+	a := store.DeliveryAttempt{At: start}
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		a.Error = err.Error()
+		return a, false
+	}
+	ts := strconv.FormatInt(start.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderTimestamp, ts)
+	req.Header.Set(HeaderDelivery, deliveryID)
+	if hook.Secret != "" {
+		req.Header.Set(HeaderSignature, SignWebhook(hook.Secret, ts, body))
+	}
+	client := *wh.client
+	client.Timeout = timeout
+	resp, err := client.Do(req)
+	a.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		a.Error = err.Error()
+		return a, true
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+	a.StatusCode = resp.StatusCode
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return a, false
+	}
+	a.Error = "HTTP " + strconv.Itoa(resp.StatusCode)
+	return a, resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
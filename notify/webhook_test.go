@@ -0,0 +1,86 @@
+package notify
+
+import (
+	"druid-insight/auth"
+	"druid-insight/logging"
+	"druid-insight/store"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestWebhooks(t *testing.T, hooks ...auth.WebhookConfig) (*Webhooks, *store.Store) {
+	dir := t.TempDir()
+	st, err := store.Open("file", "", filepath.Join(dir, "data"))
+	if err != nil {
+		t.Fatalf("store.Open failed: %v", err)
+	}
+	logger, _ := logging.NewLogger(dir, "report.log")
+	cfg := &auth.Config{Webhooks: hooks}
+	wh := NewWebhooks(cfg, st, logger)
+	wh.backoff = time.Millisecond
+	return wh, st
+}
+
+func TestWebhook_SignedAndRetried(t *testing.T) {
+	var calls int32
+	var gotEvent WebhookEvent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if SignWebhook("s3cret", r.Header.Get(HeaderTimestamp), body) != r.Header.Get(HeaderSignature) {
+			t.Errorf("Bad signature %q", r.Header.Get(HeaderSignature))
+		}
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		json.Unmarshal(body, &gotEvent)
+	}))
+	defer srv.Close()
+
+	hook := auth.WebhookConfig{URL: srv.URL, Secret: "s3cret", MaxAttempts: 5}
+	wh, st := newTestWebhooks(t, hook)
+	d := wh.Deliver(hook, &WebhookEvent{Event: "report.complete", ID: "r1", Owner: "alice", Datasource: "myds", Status: "complete", RowCount: 42})
+
+	if d.Status != store.DeliveryDelivered || len(d.Attempts) != 3 || d.Attempts[0].StatusCode != http.StatusBadGateway {
+		t.Errorf("Expected delivered after 3 attempts, got %+v", d)
+	}
+	if gotEvent.ID != "r1" || gotEvent.RowCount != 42 || gotEvent.Owner != "alice" {
+		t.Errorf("Unexpected event received: %+v", gotEvent)
+	}
+	logged, _ := st.ListWebhookDeliveries(nil)
+	if len(logged) != 1 || logged[0].Status != store.DeliveryDelivered {
+		t.Errorf("Expected delivery log entry, got %+v", logged)
+	}
+}
+
+func TestWebhook_NoRetryOn4xx(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	hook := auth.WebhookConfig{URL: srv.URL, MaxAttempts: 5}
+	wh, _ := newTestWebhooks(t, hook)
+	d := wh.Deliver(hook, &WebhookEvent{Event: "report.error", ID: "r2"})
+	if d.Status != store.DeliveryFailed || atomic.LoadInt32(&calls) != 1 {
+		t.Errorf("Expected a single failed attempt, got %+v after %d calls", d, calls)
+	}
+}
+
+func TestWebhook_Subscribed(t *testing.T) {
+	hook := auth.WebhookConfig{Events: []string{"complete"}}
+	if !subscribed(hook, "complete") || subscribed(hook, "cancelled") {
+		t.Error("Event filter not applied")
+	}
+	if !subscribed(auth.WebhookConfig{}, "error") {
+		t.Error("Empty events should subscribe to everything")
+	}
+}
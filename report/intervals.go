@@ -0,0 +1,131 @@
+package report
+
+import (
+	"fmt"
+	"time"
+)
+
+// Format des dates envoyées par le front (champ "dates")
+const dateLayout = "2006-01-02"
+
+// CompareAuto ("Automatic" dans le front) choisit la comparaison selon la durée de la période
+const CompareAuto = "prev_auto"
+
+// autoCompare : veille pour un jour, semaine précédente jusqu'à 7 jours, mois précédent
+// jusqu'à 31 jours, année précédente au-delà
+func autoCompare(period time.Duration) string {
+	switch days := int(period.Hours() / 24); {
+	case days <= 1:
+		return "prev_day"
+	case days <= 7:
+		return "prev_week"
+	case days <= 31:
+		return "prev_month"
+	}
+	return "prev_year"
+}
+
+// ComputeIntervals calcule l'intervalle Druid de la période [start, end] (fin incluse)
+// et, si demandé, celui de la période de comparaison.
+func ComputeIntervals(start, end, compare string) (mainInterval, compareInterval string, err error) {
+	const layoutOutput = "2006-01-02T15:04:05Z"
+
+	startT, err := time.Parse(dateLayout, start)
+	if err != nil {
+		return "", "", err
+	}
+	endT, err := time.Parse(dateLayout, end)
+	if err != nil {
+		return "", "", err
+	}
+	// Pour couvrir toute la journée end incluse, on rajoute 1 jour à endT (convention Druid "end exclusive")
+	endT = endT.AddDate(0, 0, 1)
+
+	mainInterval = startT.Format(layoutOutput) + "/" + endT.Format(layoutOutput)
+	periodDuration := endT.Sub(startT)
+
+	var compareStart, compareEnd time.Time
+
+	if compare == CompareAuto {
+		compare = autoCompare(periodDuration)
+	}
+	switch compare {
+	case "prev_day":
+		compareEnd = startT
+		compareStart = compareEnd.Add(-periodDuration)
+	case "prev_week":
+		if periodDuration > 7*time.Hour*24 {
+			compareEnd = startT.AddDate(0, 0, -7)
+			compareStart = compareEnd.Add(-periodDuration)
+		} else {
+			compareStart = startT.AddDate(0, 0, -7)
+			compareEnd = endT.AddDate(0, 0, -7)
+		}
+	case "prev_month":
+		if periodDuration > 28*time.Hour*24 {
+			compareEnd = startT.AddDate(0, -1, 0)
+			compareStart = compareEnd.Add(-periodDuration)
+		} else {
+			compareStart = startT.AddDate(0, -1, 0)
+			compareEnd = endT.AddDate(0, -1, 0)
+		}
+	case "prev_year":
+		if periodDuration > 365*time.Hour*24 {
+			compareEnd = startT.AddDate(-1, 0, 0)
+			compareStart = compareEnd.Add(-periodDuration)
+		} else {
+			compareStart = startT.AddDate(-1, 0, 0)
+			compareEnd = endT.AddDate(-1, 0, 0)
+		}
+	default:
+		return mainInterval, "", nil
+	}
+
+	compareInterval = compareStart.Format(layoutOutput) + "/" + compareEnd.Format(layoutOutput)
+	return mainInterval, compareInterval, nil
+}
+
+// Plages de dates relatives, résolues au moment de l'exécution (rapports planifiés)
+const (
+	RangeToday      = "today"
+	RangeYesterday  = "yesterday"
+	RangeThisWeek   = "this_week"
+	RangeLastWeek   = "last_week"
+	RangeThisMonth  = "this_month"
+	RangeLastMonth  = "last_month"
+	rangeLastNDays  = "last_%d_days" // ex: last_7_days, hier inclus, aujourd'hui exclu
+	maxRelativeDays = 3660
+)
+
+// ResolveRelativeRange convertit une plage relative ("yesterday", "last_7_days"...) en
+// dates [début, fin] (fin incluse) au format YYYY-MM-DD, par rapport à now.
+// Les semaines commencent le lundi.
+func ResolveRelativeRange(name string, now time.Time) ([]string, error) {
+	y, m, d := now.Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+	span := func(start, end time.Time) []string {
+		return []string{start.Format(dateLayout), end.Format(dateLayout)}
+	}
+	weekStart := today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7))
+	monthStart := time.Date(y, m, 1, 0, 0, 0, 0, now.Location())
+
+	switch name {
+	case RangeToday:
+		return span(today, today), nil
+	case RangeYesterday:
+		return span(today.AddDate(0, 0, -1), today.AddDate(0, 0, -1)), nil
+	case RangeThisWeek:
+		return span(weekStart, today), nil
+	case RangeLastWeek:
+		return span(weekStart.AddDate(0, 0, -7), weekStart.AddDate(0, 0, -1)), nil
+	case RangeThisMonth:
+		return span(monthStart, today), nil
+	case RangeLastMonth:
+		return span(monthStart.AddDate(0, -1, 0), monthStart.AddDate(0, 0, -1)), nil
+	}
+	var n int
+	if _, err := fmt.Sscanf(name, rangeLastNDays, &n); err == nil && fmt.Sprintf(rangeLastNDays, n) == name && n > 0 && n <= maxRelativeDays {
+		return span(today.AddDate(0, 0, -n), today.AddDate(0, 0, -1)), nil
+	}
+	return nil, fmt.Errorf("unknown relative range %q", name)
+}
@@ -0,0 +1,193 @@
+package report
+
+import (
+	"bytes"
+	"druid-insight/config"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// CurrentVersion est la version du format de rapport comprise par le serveur
+const CurrentVersion = 1
+
+// Filter : filtre utilisateur sur une dimension (valeurs autorisées)
+type Filter struct {
+	Dimension string   `json:"dimension"`
+	Values    []string `json:"values"`
+}
+
+// Spec est la définition typée d'un rapport, telle qu'envoyée à /api/reports/execute
+type Spec struct {
+	Version    int      `json:"version,omitempty"` // 0 = CurrentVersion
+	Datasource string   `json:"datasource"`
+	Dimensions []string `json:"dimensions"`
+	Metrics    []string `json:"metrics"`
+	Filters    []Filter `json:"filters,omitempty"`
+	Dates      []string `json:"dates,omitempty"`      // [début, fin] au format YYYY-MM-DD, fin incluse
+	Compare    string   `json:"compare,omitempty"`    // prev_day, prev_week, prev_month, prev_year, prev_auto
+	TimeGroup  string   `json:"time_group,omitempty"` // hour, day, week, month
+	ChartType  string   `json:"chartType,omitempty"`  // indication d'affichage pour le front
+}
+
+// FieldError : erreur de validation rattachée à un champ du rapport
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError regroupe toutes les erreurs d'un rapport
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, 0, len(e.Errors))
+	for _, fe := range e.Errors {
+		parts = append(parts, fe.Field+": "+fe.Message)
+	}
+	return "invalid report: " + strings.Join(parts, "; ")
+}
+
+var (
+	validCompare    = map[string]bool{"": true, "prev_day": true, "prev_week": true, "prev_month": true, "prev_year": true, CompareAuto: true}
+	validTimeGroups = map[string]bool{"": true, "all": true, "hour": true, "day": true, "week": true, "month": true}
+)
+
+// Decode lit un rapport JSON en refusant les champs inconnus : une clé mal orthographiée
+// est une erreur, et non plus un paramètre silencieusement ignoré.
+func Decode(r io.Reader) (*Spec, error) {
+	var spec Spec
+	if err := DecodeStrict(r, &spec); err != nil {
+		return nil, err
+	}
+	return &spec, nil
+}
+
+// DecodeStrict décode r dans v (champs inconnus interdits) et traduit les erreurs en ValidationError
+func DecodeStrict(r io.Reader, v interface{}) error {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return decodeError(err)
+	}
+	if dec.More() {
+		return &ValidationError{Errors: []FieldError{{Field: "", Message: "trailing data after JSON object"}}}
+	}
+	return nil
+}
+
+// DecodeMap convertit un payload déjà décodé (map) en Spec, avec les mêmes règles strictes
+func DecodeMap(payload map[string]interface{}) (*Spec, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return Decode(bytes.NewReader(raw))
+}
+
+func decodeError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &typeErr):
+		return &ValidationError{Errors: []FieldError{{Field: typeErr.Field, Message: "expected " + typeErr.Type.String()}}}
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), "\"")
+		return &ValidationError{Errors: []FieldError{{Field: field, Message: "unknown field"}}}
+	}
+	return &ValidationError{Errors: []FieldError{{Field: "", Message: "invalid JSON: " + err.Error()}}}
+}
+
+// Validate contrôle la structure du rapport par rapport à druid.yaml. Les droits
+// (champs réservés) sont vérifiés à part par auth.CheckRights.
+func (s *Spec) Validate(druidCfg *config.DruidConfig) []FieldError {
+	var errs []FieldError
+	add := func(field, format string, args ...interface{}) {
+		errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if s.Version < 0 || s.Version > CurrentVersion {
+		add("version", "unsupported version %d (current is %d)", s.Version, CurrentVersion)
+	}
+	if s.Datasource == "" {
+		add("datasource", "required")
+		return errs
+	}
+	ds, ok := druidCfg.Datasources[s.Datasource]
+	if !ok {
+		add("datasource", "unknown datasource %s", s.Datasource)
+		return errs
+	}
+	if len(s.Dimensions) == 0 && len(s.Metrics) == 0 {
+		add("metrics", "at least one dimension or metric is required")
+	}
+	for i, d := range s.Dimensions {
+		if _, ok := ds.Dimensions[d]; !ok && d != "time" {
+			add(fmt.Sprintf("dimensions[%d]", i), "unknown dimension %s", d)
+		}
+	}
+	for i, m := range s.Metrics {
+		if _, ok := ds.Metrics[m]; !ok {
+			add(fmt.Sprintf("metrics[%d]", i), "unknown metric %s", m)
+		}
+	}
+	for i, f := range s.Filters {
+		if _, ok := ds.Dimensions[f.Dimension]; !ok {
+			add(fmt.Sprintf("filters[%d].dimension", i), "unknown dimension %s", f.Dimension)
+		}
+		if len(f.Values) == 0 {
+			add(fmt.Sprintf("filters[%d].values", i), "at least one value is required")
+		}
+	}
+	if len(s.Dates) != 0 {
+		if len(s.Dates) != 2 {
+			add("dates", "expected [start, end]")
+		} else {
+			start, err1 := time.Parse(dateLayout, s.Dates[0])
+			end, err2 := time.Parse(dateLayout, s.Dates[1])
+			if err1 != nil {
+				add("dates[0]", "expected YYYY-MM-DD")
+			}
+			if err2 != nil {
+				add("dates[1]", "expected YYYY-MM-DD")
+			}
+			if err1 == nil && err2 == nil && end.Before(start) {
+				add("dates", "end is before start")
+			}
+		}
+	}
+	if !validCompare[s.Compare] {
+		add("compare", "unknown comparison %s", s.Compare)
+	}
+	if !validTimeGroups[s.TimeGroup] {
+		add("time_group", "unknown time group %s", s.TimeGroup)
+	}
+	return errs
+}
+
+// Granularity retourne la granularité Druid du rapport ("all" par défaut)
+func (s *Spec) Granularity() string {
+	if s.TimeGroup == "" {
+		return "all"
+	}
+	return s.TimeGroup
+}
+
+// Intervals retourne les intervalles Druid (période principale puis période de comparaison)
+func (s *Spec) Intervals() ([]string, error) {
+	if len(s.Dates) != 2 {
+		return nil, nil
+	}
+	mainInterval, compareInterval, err := ComputeIntervals(s.Dates[0], s.Dates[1], s.Compare)
+	if err != nil {
+		return nil, err
+	}
+	intervals := []string{mainInterval}
+	if compareInterval != "" {
+		intervals = append(intervals, compareInterval)
+	}
+	return intervals, nil
+}
@@ -0,0 +1,147 @@
+package report
+
+import (
+	"druid-insight/config"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func makeTestDruidConfig() *config.DruidConfig {
+	return &config.DruidConfig{
+		Datasources: map[string]config.DruidDatasourceSchema{
+			"myreport": {
+				Dimensions: map[string]config.DruidField{
+					"browser": {Druid: "browser"},
+					"country": {Druid: "country"},
+				},
+				Metrics: map[string]config.DruidField{
+					"requests": {Druid: "requests"},
+				},
+			},
+		},
+	}
+}
+
+func TestDecode_Valid(t *testing.T) {
+	body := `{"datasource":"myreport","dimensions":["time","browser"],"metrics":["requests"],
+		"filters":[{"dimension":"country","values":["FR"]}],"dates":["2024-01-01","2024-01-31"],
+		"compare":"prev_month","time_group":"day","chartType":"auto"}`
+	spec, err := Decode(strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if errs := spec.Validate(makeTestDruidConfig()); len(errs) != 0 {
+		t.Errorf("Expected valid spec, got %v", errs)
+	}
+	intervals, err := spec.Intervals()
+	if err != nil || len(intervals) != 2 {
+		t.Errorf("Expected main and compare intervals, got %v (%v)", intervals, err)
+	}
+	if spec.Granularity() != "day" {
+		t.Errorf("Expected granularity day, got %s", spec.Granularity())
+	}
+}
+
+func TestDecode_UnknownField(t *testing.T) {
+	_, err := Decode(strings.NewReader(`{"datasource":"myreport","metric":["requests"]}`))
+	var verr *ValidationError
+	if !errors.As(err, &verr) || verr.Errors[0].Field != "metric" {
+		t.Fatalf("Expected unknown field error on 'metric', got %v", err)
+	}
+}
+
+func TestDecode_WrongType(t *testing.T) {
+	_, err := Decode(strings.NewReader(`{"datasource":"myreport","metrics":"requests"}`))
+	var verr *ValidationError
+	if !errors.As(err, &verr) || verr.Errors[0].Field != "metrics" {
+		t.Fatalf("Expected type error on 'metrics', got %v", err)
+	}
+}
+
+func TestValidate_FieldErrors(t *testing.T) {
+	spec := &Spec{
+		Datasource: "myreport",
+		Dimensions: []string{"device"},
+		Metrics:    []string{"requests"},
+		Filters:    []Filter{{Dimension: "country"}},
+		Dates:      []string{"2024-02-01", "2024-01-01"},
+		TimeGroup:  "year",
+	}
+	errs := spec.Validate(makeTestDruidConfig())
+	fields := map[string]bool{}
+	for _, e := range errs {
+		fields[e.Field] = true
+	}
+	for _, f := range []string{"dimensions[0]", "filters[0].values", "dates", "time_group"} {
+		if !fields[f] {
+			t.Errorf("Expected an error on %s, got %v", f, errs)
+		}
+	}
+}
+
+func TestValidate_UnknownDatasource(t *testing.T) {
+	spec := &Spec{Datasource: "nope", Metrics: []string{"requests"}}
+	errs := spec.Validate(makeTestDruidConfig())
+	if len(errs) != 1 || errs[0].Field != "datasource" {
+		t.Errorf("Expected a single datasource error, got %v", errs)
+	}
+}
+
+func TestComputeIntervals_PrevWeek(t *testing.T) {
+	main, compare, err := ComputeIntervals("2024-01-08", "2024-01-14", "prev_week")
+	if err != nil {
+		t.Fatalf("ComputeIntervals failed: %v", err)
+	}
+	if main != "2024-01-08T00:00:00Z/2024-01-15T00:00:00Z" {
+		t.Errorf("Unexpected main interval %s", main)
+	}
+	if compare != "2024-01-01T00:00:00Z/2024-01-08T00:00:00Z" {
+		t.Errorf("Unexpected compare interval %s", compare)
+	}
+}
+
+func TestResolveRelativeRange(t *testing.T) {
+	now := time.Date(2024, 3, 13, 8, 30, 0, 0, time.UTC) // mercredi
+	cases := map[string][]string{
+		"today":        {"2024-03-13", "2024-03-13"},
+		"yesterday":    {"2024-03-12", "2024-03-12"},
+		"last_7_days":  {"2024-03-06", "2024-03-12"},
+		"this_week":    {"2024-03-11", "2024-03-13"},
+		"last_week":    {"2024-03-04", "2024-03-10"},
+		"this_month":   {"2024-03-01", "2024-03-13"},
+		"last_month":   {"2024-02-01", "2024-02-29"},
+		"last_30_days": {"2024-02-12", "2024-03-12"},
+	}
+	for name, want := range cases {
+		got, err := ResolveRelativeRange(name, now)
+		if err != nil || len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+			t.Errorf("%s: expected %v, got %v (%v)", name, want, got, err)
+		}
+	}
+	for _, bad := range []string{"", "last_week_days", "last_0_days", "last_7_daysx"} {
+		if _, err := ResolveRelativeRange(bad, now); err == nil {
+			t.Errorf("Expected error for %q", bad)
+		}
+	}
+}
+
+func TestComputeIntervals_PrevAuto(t *testing.T) {
+	cases := []struct{ start, end, want string }{
+		{"2024-03-15", "2024-03-15", "2024-03-14T00:00:00Z/2024-03-15T00:00:00Z"},
+		{"2024-03-11", "2024-03-17", "2024-03-04T00:00:00Z/2024-03-11T00:00:00Z"},
+		{"2024-03-01", "2024-03-31", "2024-01-01T00:00:00Z/2024-02-01T00:00:00Z"},
+		{"2024-01-01", "2024-06-30", "2023-01-01T00:00:00Z/2023-07-01T00:00:00Z"},
+	}
+	for _, c := range cases {
+		_, compare, err := ComputeIntervals(c.start, c.end, CompareAuto)
+		if err != nil || compare != c.want {
+			t.Errorf("%s..%s: expected %s, got %s (%v)", c.start, c.end, c.want, compare, err)
+		}
+	}
+	spec := &Spec{Datasource: "myreport", Metrics: []string{"requests"}, Dates: []string{"2024-03-15", "2024-03-15"}, Compare: CompareAuto}
+	if errs := spec.Validate(makeTestDruidConfig()); len(errs) != 0 {
+		t.Errorf("Expected prev_auto to be accepted, got %v", errs)
+	}
+}
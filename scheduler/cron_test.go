@@ -0,0 +1,50 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron_Next(t *testing.T) {
+	from := time.Date(2024, 3, 13, 8, 30, 0, 0, time.UTC) // mercredi
+	cases := []struct {
+		expr string
+		want time.Time
+	}{
+		{"0 7 * * mon", time.Date(2024, 3, 18, 7, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 3, 13, 8, 45, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, 3, 14, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"30 8 * * *", time.Date(2024, 3, 14, 8, 30, 0, 0, time.UTC)},
+		{"0 9-17/4 * * 1-5", time.Date(2024, 3, 13, 9, 0, 0, 0, time.UTC)},
+		{"0 0 29 feb *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * 7", time.Date(2024, 3, 17, 0, 0, 0, 0, time.UTC)}, // 1er du mois OU dimanche
+	}
+	for _, tc := range cases {
+		c, err := ParseCron(tc.expr)
+		if err != nil {
+			t.Fatalf("ParseCron(%q) failed: %v", tc.expr, err)
+		}
+		if got := c.Next(from); !got.Equal(tc.want) {
+			t.Errorf("%q: expected %s, got %s", tc.expr, tc.want, got)
+		}
+	}
+}
+
+func TestParseCron_Invalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "* * * foo *"} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("Expected error for %q", expr)
+		}
+	}
+}
+
+func TestCron_NoOccurrence(t *testing.T) {
+	c, err := ParseCron("0 0 31 2 *")
+	if err != nil {
+		t.Fatalf("ParseCron failed: %v", err)
+	}
+	if got := c.Next(time.Now()); !got.IsZero() {
+		t.Errorf("Expected no occurrence, got %s", got)
+	}
+}
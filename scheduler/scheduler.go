@@ -0,0 +1,283 @@
+package scheduler
+
+import (
+	"druid-insight/auth"
+	"druid-insight/config"
+	"druid-insight/logging"
+	"druid-insight/report"
+	"druid-insight/store"
+	"druid-insight/utils"
+	"druid-insight/worker"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Contexte Druid ("application") des exécutions planifiées
+const ScheduleContext = "schedule"
+
+const tickInterval = 30 * time.Second
+
+// Scheduler lance les rapports sauvegardés planifiés dans la file des workers.
+// Toutes les modifications de planifications passent par lui pour ne pas perdre
+// l'historique d'exécution mis à jour en parallèle.
+type Scheduler struct {
+	st       *store.Store
+	druidCfg *config.DruidConfig
+	cfg      *auth.Config
+	users    *auth.UsersFile // backend file : utilisateurs chargés au démarrage
+	logger   *logging.Logger
+
+	mu   sync.Mutex
+	stop chan struct{}
+}
+
+// New crée le scheduler ; Start le démarre
+func New(st *store.Store, druidCfg *config.DruidConfig, cfg *auth.Config, users *auth.UsersFile, logger *logging.Logger) *Scheduler {
+	return &Scheduler{st: st, druidCfg: druidCfg, cfg: cfg, users: users, logger: logger}
+}
+
+// Start vérifie les planifications échues toutes les 30 secondes
+func (s *Scheduler) Start() {
+	s.stop = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(tickInterval)
+		defer ticker.Stop()
+		for {
+			s.Tick(time.Now())
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop arrête la boucle du scheduler
+func (s *Scheduler) Stop() {
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
+
+// Location retourne le fuseau d'une planification (fuseau du serveur par défaut)
+func Location(sc *store.Schedule) (*time.Location, error) {
+	if sc.Timezone == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(sc.Timezone)
+}
+
+// NextRun calcule la prochaine exécution d'une planification après after
+func NextRun(sc *store.Schedule, after time.Time) (time.Time, error) {
+	c, err := ParseCron(sc.Cron)
+	if err != nil {
+		return time.Time{}, err
+	}
+	loc, err := Location(sc)
+	if err != nil {
+		return time.Time{}, err
+	}
+	next := c.Next(after.In(loc))
+	if next.IsZero() {
+		return next, fmt.Errorf("cron %q never fires", sc.Cron)
+	}
+	return next, nil
+}
+
+// Validate contrôle cron, fuseau et plage relative d'une planification
+func Validate(sc *store.Schedule) []report.FieldError {
+	var errs []report.FieldError
+	_, cronErr := ParseCron(sc.Cron)
+	if cronErr != nil {
+		errs = append(errs, report.FieldError{Field: "cron", Message: cronErr.Error()})
+	}
+	_, tzErr := Location(sc)
+	if tzErr != nil {
+		errs = append(errs, report.FieldError{Field: "timezone", Message: tzErr.Error()})
+	}
+	if cronErr == nil && tzErr == nil {
+		if _, err := NextRun(sc, time.Now()); err != nil {
+			errs = append(errs, report.FieldError{Field: "cron", Message: err.Error()})
+		}
+	}
+	if sc.Range != "" {
+		if _, err := report.ResolveRelativeRange(sc.Range, time.Now()); err != nil {
+			errs = append(errs, report.FieldError{Field: "range", Message: err.Error()})
+		}
+	}
+	return errs
+}
+
+// Create enregistre une nouvelle planification et calcule sa prochaine exécution
+func (s *Scheduler) Create(sc *store.Schedule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.plan(sc, time.Now()); err != nil {
+		return err
+	}
+	return s.st.PutSchedule(sc)
+}
+
+// Update applique fn à la planification id puis recalcule sa prochaine exécution
+func (s *Scheduler) Update(id string, fn func(sc *store.Schedule) error) (*store.Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sc, err := s.st.GetSchedule(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := fn(sc); err != nil {
+		return nil, err
+	}
+	if err := s.plan(sc, time.Now()); err != nil {
+		return nil, err
+	}
+	return sc, s.st.PutSchedule(sc)
+}
+
+// Delete supprime une planification
+func (s *Scheduler) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.st.DeleteSchedule(id)
+}
+
+func (s *Scheduler) plan(sc *store.Schedule, now time.Time) error {
+	sc.NextRun = time.Time{}
+	if !sc.Enabled {
+		return nil
+	}
+	next, err := NextRun(sc, now)
+	if err != nil {
+		return err
+	}
+	sc.NextRun = next
+	return nil
+}
+
+// Tick met à jour le statut des exécutions en cours et lance les planifications échues.
+// Une planification manquée pendant un arrêt du serveur n'est rattrapée qu'une fois.
+func (s *Scheduler) Tick(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list, err := s.st.ListSchedules(nil)
+	if err != nil {
+		s.logger.Write("[SCHEDULE_FAIL] list: " + err.Error())
+		return
+	}
+	for _, sc := range list {
+		changed := refreshRuns(sc, now)
+		if sc.Enabled && !sc.NextRun.IsZero() && !now.Before(sc.NextRun) {
+			sc.AddRun(s.launch(sc, now))
+			if err := s.plan(sc, now); err != nil {
+				s.logger.Write(fmt.Sprintf("[SCHEDULE_FAIL] schedule=%s next run: %v", sc.ID, err))
+			}
+			changed = true
+		}
+		if changed {
+			if err := s.st.PutSchedule(sc); err != nil {
+				s.logger.Write(fmt.Sprintf("[SCHEDULE_FAIL] schedule=%s save: %v", sc.ID, err))
+			}
+		}
+	}
+}
+
+// launch place le rapport sauvegardé dans la file, avec les dates résolues à l'instant now
+func (s *Scheduler) launch(sc *store.Schedule, now time.Time) store.ScheduleRun {
+	run := store.ScheduleRun{ScheduledAt: sc.NextRun, Status: string(worker.StatusWaiting)}
+	fail := func(msg string) store.ScheduleRun {
+		run.Status, run.Error, run.FinishedAt = string(worker.StatusError), msg, now
+		s.logger.Write(fmt.Sprintf("[SCHEDULE_FAIL] schedule=%s owner=%s %s", sc.ID, sc.Owner, msg))
+		return run
+	}
+
+	saved, err := s.st.GetSavedReport(sc.SavedReportID)
+	if errors.Is(err, store.ErrNotFound) {
+		return fail("saved report " + sc.SavedReportID + " not found")
+	} else if err != nil {
+		return fail("saved report: " + err.Error())
+	}
+	spec := saved.Spec
+	if sc.Range != "" {
+		loc, _ := Location(sc)
+		dates, err := report.ResolveRelativeRange(sc.Range, now.In(loc))
+		if err != nil {
+			return fail(err.Error())
+		}
+		spec.Dates = dates
+	}
+	run.Dates = spec.Dates
+	if errs := spec.Validate(s.druidCfg); len(errs) > 0 {
+		return fail((&report.ValidationError{Errors: errs}).Error())
+	}
+	// le propriétaire et ses rôles ont pu changer depuis la création
+	ownerAdmin, err := auth.LookupUserAdmin(sc.Owner, s.users, s.cfg)
+	if errors.Is(err, auth.ErrUserNotFound) {
+		return fail("forbidden: " + sc.Owner + " no longer exists")
+	} else if err != nil {
+		return fail("owner lookup: " + err.Error())
+	}
+	if !saved.VisibleTo(sc.Owner, auth.GetUserTeam(sc.Owner, s.users, s.cfg), ownerAdmin) {
+		return fail("forbidden: saved report " + sc.SavedReportID + " is no longer visible to " + sc.Owner)
+	}
+	grants := auth.UserGrants(sc.Owner, ownerAdmin, s.users, s.cfg)
+	if !grants.Can(auth.CapSchedule) {
+		return fail("forbidden: " + sc.Owner + " may no longer schedule reports")
+	}
+	if problems := auth.CheckRights(&spec, s.druidCfg, grants); len(problems) > 0 {
+		return fail("forbidden: " + strings.Join(problems, ", "))
+	}
+
+	run.ReportID = utils.GenerateRequestID()
+	worker.AddPendingRequest(&worker.ReportRequest{
+		ID:         run.ReportID,
+		Spec:       &spec,
+		Owner:      sc.Owner,
+		Admin:      ownerAdmin,
+		Datasource: spec.Datasource,
+		CreatedAt:  now,
+		Context:    ScheduleContext,
+		Schedule:   scheduleLabel(sc),
+		Notify:     sc.Recipients,
+		NotifyOnly: !grants.Can(auth.CapExport),
+	})
+	s.logger.Write(fmt.Sprintf("[SCHEDULE] schedule=%s owner=%s id=%s dates=%v", sc.ID, sc.Owner, run.ReportID, spec.Dates))
+	return run
+}
+
+func scheduleLabel(sc *store.Schedule) string {
+	if sc.Name != "" {
+		return sc.Name
+	}
+	return sc.ID
+}
+
+// refreshRuns reporte le statut worker des exécutions non terminées
+func refreshRuns(sc *store.Schedule, now time.Time) bool {
+	changed := false
+	for i := range sc.Runs {
+		run := &sc.Runs[i]
+		if run.Status != string(worker.StatusWaiting) && run.Status != string(worker.StatusProcessing) {
+			continue
+		}
+		status, errMsg, ok := worker.Status(run.ReportID)
+		if !ok {
+			// Requête perdue (redémarrage du serveur)
+			status, errMsg = worker.StatusError, "lost before completion"
+		}
+		if string(status) == run.Status {
+			continue
+		}
+		run.Status, run.Error = string(status), errMsg
+		if status == worker.StatusComplete || status == worker.StatusError || status == worker.StatusCancelled {
+			run.FinishedAt = now
+		}
+		changed = true
+	}
+	return changed
+}
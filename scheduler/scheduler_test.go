@@ -0,0 +1,149 @@
+package scheduler
+
+import (
+	"druid-insight/auth"
+	"druid-insight/config"
+	"druid-insight/logging"
+	"druid-insight/report"
+	"druid-insight/store"
+	"druid-insight/worker"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestScheduler(t *testing.T) (*Scheduler, *store.Store) {
+	dir := t.TempDir()
+	st, err := store.Open("file", "", filepath.Join(dir, "data"))
+	if err != nil {
+		t.Fatalf("store.Open failed: %v", err)
+	}
+	druidCfg := &config.DruidConfig{
+		Datasources: map[string]config.DruidDatasourceSchema{
+			"myds": {
+				Dimensions: map[string]config.DruidField{
+					"browser": {Druid: "browser"},
+					"country": {Druid: "country", Roles: []string{auth.RoleAdmin}},
+				},
+				Metrics: map[string]config.DruidField{"requests": {Druid: "requests"}},
+			},
+		},
+	}
+	logger, err := logging.NewLogger(dir, "report.log")
+	if err != nil {
+		t.Fatalf("NewLogger failed: %v", err)
+	}
+	users := &auth.UsersFile{Users: map[string]auth.UserInfo{"alice": {}, "bob": {}}}
+	return New(st, druidCfg, &auth.Config{}, users, logger), st
+}
+
+func TestScheduler_TickLaunchesDueSchedule(t *testing.T) {
+	s, st := newTestScheduler(t)
+	st.PutSavedReport(&store.SavedReport{
+		ID:         "saved1",
+		Name:       "Weekly",
+		Owner:      "alice",
+		Visibility: store.VisibilityPrivate,
+		Spec:       report.Spec{Datasource: "myds", Dimensions: []string{"browser"}, Metrics: []string{"requests"}},
+		Version:    1,
+	})
+	now := time.Date(2024, 3, 18, 7, 0, 10, 0, time.UTC) // lundi
+	sc := &store.Schedule{
+		ID:            "sched1",
+		Owner:         "alice",
+		SavedReportID: "saved1",
+		Cron:          "0 7 * * mon",
+		Timezone:      "UTC",
+		Range:         "last_week",
+		Enabled:       true,
+		NextRun:       time.Date(2024, 3, 18, 7, 0, 0, 0, time.UTC),
+	}
+	if err := st.PutSchedule(sc); err != nil {
+		t.Fatalf("PutSchedule failed: %v", err)
+	}
+
+	s.Tick(now)
+
+	got, _ := st.GetSchedule("sched1")
+	if len(got.Runs) != 1 {
+		t.Fatalf("Expected one run, got %+v", got.Runs)
+	}
+	run := got.Runs[0]
+	if run.Status != string(worker.StatusWaiting) || run.ReportID == "" {
+		t.Errorf("Expected a waiting run with a report id, got %+v", run)
+	}
+	if len(run.Dates) != 2 || run.Dates[0] != "2024-03-11" || run.Dates[1] != "2024-03-17" {
+		t.Errorf("Expected last_week resolved at run time, got %v", run.Dates)
+	}
+	if !got.NextRun.Equal(time.Date(2024, 3, 25, 7, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected next run the following monday, got %s", got.NextRun)
+	}
+	v, ok := worker.PendingRequests().Load(run.ReportID)
+	if !ok || v.(*worker.ReportRequest).Owner != "alice" || v.(*worker.ReportRequest).Spec.Dates[0] != "2024-03-11" {
+		t.Errorf("Expected request queued for alice with resolved dates, got %v", v)
+	}
+
+	// Pas de nouvelle exécution avant l'échéance suivante
+	s.Tick(now.Add(time.Minute))
+	got, _ = st.GetSchedule("sched1")
+	if len(got.Runs) != 1 {
+		t.Errorf("Expected still one run, got %d", len(got.Runs))
+	}
+}
+
+func TestScheduler_MissingSavedReportRecordsError(t *testing.T) {
+	s, st := newTestScheduler(t)
+	now := time.Now()
+	st.PutSchedule(&store.Schedule{ID: "s", Owner: "bob", SavedReportID: "gone", Cron: "* * * * *", Enabled: true, NextRun: now.Add(-time.Minute)})
+
+	s.Tick(now)
+
+	got, _ := st.GetSchedule("s")
+	if len(got.Runs) != 1 || got.Runs[0].Status != string(worker.StatusError) || got.Runs[0].Error == "" {
+		t.Errorf("Expected an error run, got %+v", got.Runs)
+	}
+}
+
+func TestScheduler_ResolvesOwnerRightsAtRunTime(t *testing.T) {
+	s, st := newTestScheduler(t)
+	st.PutSavedReport(&store.SavedReport{
+		ID:         "saved1",
+		Owner:      "alice",
+		Visibility: store.VisibilityPrivate,
+		Spec:       report.Spec{Datasource: "myds", Dimensions: []string{"country"}, Metrics: []string{"requests"}},
+	})
+	now := time.Now()
+	due := func(id, owner string) {
+		st.PutSchedule(&store.Schedule{ID: id, Owner: owner, SavedReportID: "saved1", Cron: "* * * * *", Enabled: true, NextRun: now.Add(-time.Minute)})
+	}
+	tests := []struct {
+		name  string
+		owner string
+		users map[string]auth.UserInfo
+		want  string
+	}{
+		{"admin", "alice", map[string]auth.UserInfo{"alice": {Admin: true}}, string(worker.StatusWaiting)},
+		{"demoted", "alice", map[string]auth.UserInfo{"alice": {}}, "forbidden: dimension:country:forbidden"},
+		{"deleted", "alice", map[string]auth.UserInfo{}, "forbidden: alice no longer exists"},
+		{"private", "bob", map[string]auth.UserInfo{"alice": {}, "bob": {}}, "forbidden: saved report saved1 is no longer visible to bob"},
+	}
+	for _, tt := range tests {
+		s.users.Users = tt.users
+		due(tt.name, tt.owner)
+		s.Tick(now)
+		got, _ := st.GetSchedule(tt.name)
+		if len(got.Runs) != 1 {
+			t.Fatalf("%s: expected one run, got %+v", tt.name, got.Runs)
+		}
+		if run := got.Runs[0]; run.Status != tt.want && run.Error != tt.want {
+			t.Errorf("%s: expected %q, got %+v", tt.name, tt.want, run)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	errs := Validate(&store.Schedule{Cron: "61 * * * *", Timezone: "Mars/Olympus", Range: "someday"})
+	if len(errs) != 3 {
+		t.Errorf("Expected cron, timezone and range errors, got %v", errs)
+	}
+}
@@ -32,8 +32,19 @@ async function showDashboard() {
   startSessionCountdown();
 }
 
+// Retour du SSO : le jeton arrive dans le fragment (#token=...), retiré aussitôt de l'URL
+function consumeSSOFragment() {
+  if (!location.hash) return;
+  const params = new URLSearchParams(location.hash.slice(1));
+  const token = params.get("token");
+  if (!token) return;
+  localStorage.setItem("jwt", token);
+  history.replaceState(null, "", location.pathname + location.search);
+}
+
 // Au chargement : check JWT
 window.addEventListener("DOMContentLoaded", () => {
+  consumeSSOFragment();
   const token = localStorage.getItem("jwt");
   if (!token || isJWTExpired(token)) {
     localStorage.removeItem("jwt");
@@ -65,7 +76,9 @@ document.getElementById("login-form").addEventListener("submit", async function(
       return;
     }
     const data = await resp.json();
-    if (data.token) {
+    if (data.mfa_required) {
+      showMfaStep(data);
+    } else if (data.token) {
       localStorage.setItem("jwt", data.token);
       showDashboard();
     } else {
@@ -78,6 +91,59 @@ document.getElementById("login-form").addEventListener("submit", async function(
   }
 });
 
+// Seconde étape : code TOTP (ou code de secours), avec inscription si le rôle l'impose
+let mfaToken = null;
+
+function showMfaStep(data) {
+  mfaToken = data.mfa_token;
+  document.getElementById("login-form").style.display = "none";
+  document.getElementById("mfa-form").style.display = "";
+  document.getElementById("mfa-enroll").style.display = data.mfa_enroll ? "" : "none";
+  if (data.mfa_enroll) {
+    document.getElementById("mfa-secret").textContent = data.secret;
+    document.getElementById("mfa-uri").href = data.otpauth_url;
+  }
+  document.getElementById("mfa-code").focus();
+}
+
+document.getElementById("mfa-form").addEventListener("submit", async function(e) {
+  e.preventDefault();
+  const code = document.getElementById("mfa-code").value.trim();
+  const errorDiv = document.getElementById("login-error");
+  errorDiv.style.display = "none";
+
+  try {
+    const resp = await fetch("/api/login/2fa", {
+      method: "POST",
+      headers: {"Content-Type": "application/json"},
+      body: JSON.stringify({mfa_token: mfaToken, code}),
+    });
+    if (!resp.ok) {
+      const msg = await resp.text();
+      errorDiv.textContent = "Verification failed: " + msg;
+      errorDiv.style.display = "block";
+      if (resp.status !== 401 || msg.includes("recommencer")) {
+        // jeton expiré ou verrouillage : retour au mot de passe
+        document.getElementById("mfa-form").style.display = "none";
+        document.getElementById("login-form").style.display = "";
+      }
+      return;
+    }
+    const data = await resp.json();
+    if (data.recovery_codes) {
+      alert("Store these recovery codes now, each one can replace a code once:\n\n" + data.recovery_codes.join("\n"));
+    }
+    document.getElementById("mfa-form").style.display = "none";
+    document.getElementById("login-form").style.display = "";
+    document.getElementById("mfa-code").value = "";
+    localStorage.setItem("jwt", data.token);
+    showDashboard();
+  } catch (err) {
+    errorDiv.textContent = "Network error: " + err;
+    errorDiv.style.display = "block";
+  }
+});
+
 function loadDashboard() {
   // Ici, tu charges le reporting/dashboard (filtres, graphiques, requêtes API...)
   // Exemple : fetch des rapports, génération des graphs...
@@ -0,0 +1,91 @@
+package store
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Collection des clés d'API des comptes de service
+const APIKeysCollection = "api_keys"
+
+// APIKey : clé d'API longue durée, stockée par empreinte (le secret n'est montré qu'à la création)
+type APIKey struct {
+	ID          string     `json:"id"` // partie publique de la clé
+	Name        string     `json:"name,omitempty"`
+	Username    string     `json:"username"`
+	Admin       bool       `json:"admin"`
+	Hash        string     `json:"hash,omitempty"`        // sha256 hex du secret
+	Datasources []string   `json:"datasources,omitempty"` // vide = toutes
+	Endpoints   []string   `json:"endpoints,omitempty"`   // préfixes de chemins autorisés, vide = tous
+	CreatedBy   string     `json:"created_by"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+	RevokedBy   string     `json:"revoked_by,omitempty"`
+}
+
+// Active indique si la clé n'est ni révoquée ni expirée
+func (k *APIKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// AllowsDatasource indique si la clé peut lire la datasource
+func (k *APIKey) AllowsDatasource(datasource string) bool {
+	if len(k.Datasources) == 0 {
+		return true
+	}
+	for _, ds := range k.Datasources {
+		if ds == datasource {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsEndpoint indique si la clé peut appeler le chemin (préfixe exact ou sous-chemin)
+func (k *APIKey) AllowsEndpoint(path string) bool {
+	if len(k.Endpoints) == 0 {
+		return true
+	}
+	for _, p := range k.Endpoints {
+		p = strings.TrimSuffix(p, "/")
+		if path == p || strings.HasPrefix(path, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// GetAPIKey charge une clé d'API par identifiant
+func (st *Store) GetAPIKey(id string) (*APIKey, error) {
+	var k APIKey
+	if err := st.Get(APIKeysCollection, id, &k); err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+// PutAPIKey crée ou remplace une clé d'API
+func (st *Store) PutAPIKey(k *APIKey) error {
+	return st.Put(APIKeysCollection, k.ID, k)
+}
+
+// ListAPIKeys retourne les clés retenues par keep (toutes si nil), les plus récentes d'abord
+func (st *Store) ListAPIKeys(keep func(*APIKey) bool) ([]*APIKey, error) {
+	var out []*APIKey
+	err := st.List(APIKeysCollection, func(id string, data []byte) error {
+		var k APIKey
+		if err := json.Unmarshal(data, &k); err != nil {
+			return err
+		}
+		if keep == nil || keep(&k) {
+			out = append(out, &k)
+		}
+		return nil
+	})
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out, err
+}
@@ -0,0 +1,56 @@
+package store
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// Collection des verrouillages de connexion (utilisateurs et adresses IP)
+const LoginLockoutsCollection = "login_lockouts"
+
+// LoginLockout : verrouillage en cours ou passé d'un utilisateur ("user:<nom>") ou d'une
+// adresse ("ip:<adresse>"). Level compte les verrouillages successifs (durée doublée à chaque fois).
+type LoginLockout struct {
+	Key         string    `json:"key"`
+	Level       int       `json:"level"`
+	Failures    int       `json:"failures"` // échecs ayant déclenché le dernier verrouillage
+	LockedAt    time.Time `json:"locked_at"`
+	LockedUntil time.Time `json:"locked_until"`
+}
+
+// GetLoginLockout charge un verrouillage
+func (st *Store) GetLoginLockout(key string) (*LoginLockout, error) {
+	var l LoginLockout
+	if err := st.Get(LoginLockoutsCollection, key, &l); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// PutLoginLockout crée ou remplace un verrouillage
+func (st *Store) PutLoginLockout(l *LoginLockout) error {
+	return st.Put(LoginLockoutsCollection, l.Key, l)
+}
+
+// DeleteLoginLockout supprime un verrouillage (déverrouillage, ErrNotFound s'il n'existe pas)
+func (st *Store) DeleteLoginLockout(key string) error {
+	return st.Delete(LoginLockoutsCollection, key)
+}
+
+// ListLoginLockouts retourne les verrouillages retenus par keep (tous si nil), par clé
+func (st *Store) ListLoginLockouts(keep func(*LoginLockout) bool) ([]*LoginLockout, error) {
+	var out []*LoginLockout
+	err := st.List(LoginLockoutsCollection, func(id string, data []byte) error {
+		var l LoginLockout
+		if err := json.Unmarshal(data, &l); err != nil {
+			return err
+		}
+		if keep == nil || keep(&l) {
+			out = append(out, &l)
+		}
+		return nil
+	})
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out, err
+}
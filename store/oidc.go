@@ -0,0 +1,87 @@
+package store
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Collections du SSO OpenID Connect : connexions en cours et profils des utilisateurs
+const (
+	OIDCStatesCollection = "oidc_states"
+	OIDCUsersCollection  = "oidc_users"
+)
+
+// OIDCState : connexion en cours, entre la redirection vers le fournisseur et le callback
+type OIDCState struct {
+	ID        string    `json:"id"` // paramètre state
+	Nonce     string    `json:"nonce"`
+	Verifier  string    `json:"verifier"` // code_verifier PKCE
+	Redirect  string    `json:"redirect"` // chemin du front après connexion
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// OIDCUser : profil déduit des claims du dernier ID token, utilisé pour les filtres d'accès
+// et le rafraîchissement des jetons
+type OIDCUser struct {
+	Username  string    `json:"username"`
+	Subject   string    `json:"subject"`
+	Admin     bool      `json:"admin"`
+	Team      string    `json:"team,omitempty"`
+	Groups    []string  `json:"groups,omitempty"`
+	LastLogin time.Time `json:"last_login"`
+}
+
+// PutOIDCState enregistre une connexion en cours
+func (st *Store) PutOIDCState(s *OIDCState) error {
+	return st.Put(OIDCStatesCollection, s.ID, s)
+}
+
+// TakeOIDCState charge puis supprime une connexion en cours : un state n'est utilisable qu'une fois
+func (st *Store) TakeOIDCState(id string) (*OIDCState, error) {
+	var s OIDCState
+	if err := st.Get(OIDCStatesCollection, id, &s); err != nil {
+		return nil, err
+	}
+	if err := st.Delete(OIDCStatesCollection, id); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// PruneOIDCStates supprime les connexions abandonnées expirées avant before
+func (st *Store) PruneOIDCStates(before time.Time) (int, error) {
+	var expired []string
+	err := st.List(OIDCStatesCollection, func(id string, data []byte) error {
+		var s OIDCState
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		if s.ExpiresAt.Before(before) {
+			expired = append(expired, id)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, id := range expired {
+		if err := st.Delete(OIDCStatesCollection, id); err != nil && err != ErrNotFound {
+			return 0, err
+		}
+	}
+	return len(expired), nil
+}
+
+// GetOIDCUser charge le profil d'un utilisateur SSO
+func (st *Store) GetOIDCUser(username string) (*OIDCUser, error) {
+	var u OIDCUser
+	if err := st.Get(OIDCUsersCollection, username, &u); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// PutOIDCUser crée ou remplace le profil d'un utilisateur SSO
+func (st *Store) PutOIDCUser(u *OIDCUser) error {
+	return st.Put(OIDCUsersCollection, u.Username, u)
+}
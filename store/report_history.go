@@ -0,0 +1,74 @@
+package store
+
+import (
+	"druid-insight/report"
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// Collection de l'historique des exécutions de rapports
+const ReportHistoryCollection = "report_history"
+
+// HistoryEntry : une exécution de rapport terminée
+type HistoryEntry struct {
+	ID         string      `json:"id"`
+	Owner      string      `json:"owner"`
+	Datasource string      `json:"datasource"`
+	Spec       report.Spec `json:"spec"`
+	Status     string      `json:"status"`
+	Error      string      `json:"error,omitempty"`
+	Context    string      `json:"context,omitempty"`
+	Schedule   string      `json:"schedule,omitempty"`
+	Cache      string      `json:"cache,omitempty"`
+	CreatedAt  time.Time   `json:"created_at"`
+	StartedAt  time.Time   `json:"started_at,omitempty"`
+	FinishedAt time.Time   `json:"finished_at,omitempty"`
+	DurationMs int64       `json:"duration_ms"`
+	RowCount   int         `json:"row_count"`
+}
+
+// PutHistoryEntry enregistre une exécution
+func (st *Store) PutHistoryEntry(e *HistoryEntry) error {
+	return st.Put(ReportHistoryCollection, e.ID, e)
+}
+
+// GetHistoryEntry charge une exécution
+func (st *Store) GetHistoryEntry(id string) (*HistoryEntry, error) {
+	var e HistoryEntry
+	if err := st.Get(ReportHistoryCollection, id, &e); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// ListHistory retourne les exécutions retenues par keep, les plus récentes d'abord
+func (st *Store) ListHistory(keep func(*HistoryEntry) bool) ([]*HistoryEntry, error) {
+	var out []*HistoryEntry
+	err := st.List(ReportHistoryCollection, func(id string, data []byte) error {
+		var e HistoryEntry
+		if err := json.Unmarshal(data, &e); err != nil {
+			return err
+		}
+		if keep == nil || keep(&e) {
+			out = append(out, &e)
+		}
+		return nil
+	})
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out, err
+}
+
+// PruneHistory supprime les exécutions créées avant before et retourne leur nombre
+func (st *Store) PruneHistory(before time.Time) (int, error) {
+	old, err := st.ListHistory(func(e *HistoryEntry) bool { return e.CreatedAt.Before(before) })
+	if err != nil {
+		return 0, err
+	}
+	for _, e := range old {
+		if err := st.Delete(ReportHistoryCollection, e.ID); err != nil && err != ErrNotFound {
+			return 0, err
+		}
+	}
+	return len(old), nil
+}
@@ -0,0 +1,131 @@
+package store
+
+import (
+	"druid-insight/report"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Collection des rapports sauvegardés
+const SavedReportsCollection = "saved_reports"
+
+// Visibilité d'un rapport sauvegardé
+const (
+	VisibilityPrivate = "private" // propriétaire (et admins) uniquement
+	VisibilityTeam    = "team"    // utilisateurs de la même équipe
+	VisibilityPublic  = "public"  // tous les utilisateurs authentifiés
+)
+
+// ErrInvalidVisibility est retournée pour une visibilité inconnue
+var ErrInvalidVisibility = errors.New("visibility must be private, team or public")
+
+// SavedReportVersion : état d'un rapport sauvegardé avant une modification
+type SavedReportVersion struct {
+	Version    int         `json:"version"`
+	Name       string      `json:"name"`
+	Visibility string      `json:"visibility"`
+	Spec       report.Spec `json:"spec"`
+	UpdatedBy  string      `json:"updated_by"`
+	UpdatedAt  time.Time   `json:"updated_at"`
+}
+
+// SavedReport : définition de rapport nommée, réutilisable et partageable
+type SavedReport struct {
+	ID         string               `json:"id"`
+	Name       string               `json:"name"`
+	Owner      string               `json:"owner"`
+	Team       string               `json:"team,omitempty"`
+	Visibility string               `json:"visibility"`
+	Spec       report.Spec          `json:"spec"`
+	Version    int                  `json:"version"`
+	CreatedAt  time.Time            `json:"created_at"`
+	UpdatedBy  string               `json:"updated_by"`
+	UpdatedAt  time.Time            `json:"updated_at"`
+	History    []SavedReportVersion `json:"history,omitempty"` // versions précédentes, la plus ancienne en premier
+}
+
+// ValidVisibility indique si v est une visibilité connue
+func ValidVisibility(v string) bool {
+	return v == VisibilityPrivate || v == VisibilityTeam || v == VisibilityPublic
+}
+
+// VisibleTo indique si l'utilisateur peut consulter et exécuter le rapport
+func (s *SavedReport) VisibleTo(username, team string, isAdmin bool) bool {
+	switch {
+	case isAdmin || s.Owner == username:
+		return true
+	case s.Visibility == VisibilityPublic:
+		return true
+	case s.Visibility == VisibilityTeam:
+		return team != "" && team == s.Team
+	}
+	return false
+}
+
+// EditableBy indique si l'utilisateur peut modifier ou supprimer le rapport
+func (s *SavedReport) EditableBy(username string, isAdmin bool) bool {
+	return isAdmin || s.Owner == username
+}
+
+// Update archive l'état courant dans l'historique puis applique les modifications
+func (s *SavedReport) Update(name, visibility string, spec *report.Spec, by string, now time.Time) {
+	s.History = append(s.History, SavedReportVersion{
+		Version:    s.Version,
+		Name:       s.Name,
+		Visibility: s.Visibility,
+		Spec:       s.Spec,
+		UpdatedBy:  s.UpdatedBy,
+		UpdatedAt:  s.UpdatedAt,
+	})
+	if name != "" {
+		s.Name = name
+	}
+	if visibility != "" {
+		s.Visibility = visibility
+	}
+	if spec != nil {
+		s.Spec = *spec
+	}
+	s.Version++
+	s.UpdatedBy = by
+	s.UpdatedAt = now
+}
+
+// GetSavedReport charge un rapport sauvegardé
+func (st *Store) GetSavedReport(id string) (*SavedReport, error) {
+	var s SavedReport
+	if err := st.Get(SavedReportsCollection, id, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// PutSavedReport crée ou remplace un rapport sauvegardé
+func (st *Store) PutSavedReport(s *SavedReport) error {
+	if !ValidVisibility(s.Visibility) {
+		return ErrInvalidVisibility
+	}
+	return st.Put(SavedReportsCollection, s.ID, s)
+}
+
+// DeleteSavedReport supprime un rapport sauvegardé
+func (st *Store) DeleteSavedReport(id string) error {
+	return st.Delete(SavedReportsCollection, id)
+}
+
+// ListSavedReports retourne les rapports sauvegardés pour lesquels keep renvoie true (tous si keep est nil)
+func (st *Store) ListSavedReports(keep func(*SavedReport) bool) ([]*SavedReport, error) {
+	var out []*SavedReport
+	err := st.List(SavedReportsCollection, func(id string, data []byte) error {
+		var s SavedReport
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		if keep == nil || keep(&s) {
+			out = append(out, &s)
+		}
+		return nil
+	})
+	return out, err
+}
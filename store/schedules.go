@@ -0,0 +1,82 @@
+package store
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Collection des planifications de rapports
+const SchedulesCollection = "schedules"
+
+// MaxScheduleRuns : nombre d'exécutions conservées dans l'historique d'une planification
+const MaxScheduleRuns = 50
+
+// ScheduleRun : une exécution d'une planification
+type ScheduleRun struct {
+	ReportID    string    `json:"report_id,omitempty"` // id de la requête worker
+	ScheduledAt time.Time `json:"scheduled_at"`
+	Dates       []string  `json:"dates,omitempty"` // dates résolues pour cette exécution
+	Status      string    `json:"status"`          // waiting, processing, complete, error
+	Error       string    `json:"error,omitempty"`
+	FinishedAt  time.Time `json:"finished_at,omitempty"`
+}
+
+// Schedule : exécution périodique d'un rapport sauvegardé
+type Schedule struct {
+	ID            string        `json:"id"`
+	Name          string        `json:"name"`
+	Owner         string        `json:"owner"`
+	SavedReportID string        `json:"saved_report_id"`
+	Cron          string        `json:"cron"`
+	Timezone      string        `json:"timezone,omitempty"`   // ex: Europe/Paris, vide = fuseau du serveur
+	Range         string        `json:"range,omitempty"`      // plage relative (yesterday, last_7_days...), vide = dates du rapport
+	Recipients    []string      `json:"recipients,omitempty"` // e-mails prévenus à chaque exécution
+	Enabled       bool          `json:"enabled"`
+	CreatedAt     time.Time     `json:"created_at"`
+	UpdatedAt     time.Time     `json:"updated_at"`
+	NextRun       time.Time     `json:"next_run,omitempty"`
+	Runs          []ScheduleRun `json:"runs,omitempty"` // historique, la plus récente en dernier
+}
+
+// AddRun ajoute une exécution à l'historique en ne gardant que les MaxScheduleRuns dernières
+func (s *Schedule) AddRun(run ScheduleRun) {
+	s.Runs = append(s.Runs, run)
+	if len(s.Runs) > MaxScheduleRuns {
+		s.Runs = s.Runs[len(s.Runs)-MaxScheduleRuns:]
+	}
+}
+
+// GetSchedule charge une planification
+func (st *Store) GetSchedule(id string) (*Schedule, error) {
+	var s Schedule
+	if err := st.Get(SchedulesCollection, id, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// PutSchedule crée ou remplace une planification
+func (st *Store) PutSchedule(s *Schedule) error {
+	return st.Put(SchedulesCollection, s.ID, s)
+}
+
+// DeleteSchedule supprime une planification
+func (st *Store) DeleteSchedule(id string) error {
+	return st.Delete(SchedulesCollection, id)
+}
+
+// ListSchedules retourne les planifications pour lesquelles keep renvoie true (toutes si keep est nil)
+func (st *Store) ListSchedules(keep func(*Schedule) bool) ([]*Schedule, error) {
+	var out []*Schedule
+	err := st.List(SchedulesCollection, func(id string, data []byte) error {
+		var s Schedule
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		if keep == nil || keep(&s) {
+			out = append(out, &s)
+		}
+		return nil
+	})
+	return out, err
+}
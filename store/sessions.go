@@ -0,0 +1,121 @@
+package store
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Collections des sessions : jetons de rafraîchissement et révocations
+const (
+	RefreshTokensCollection   = "refresh_tokens"
+	RevokedTokensCollection   = "revoked_tokens"
+	UserRevocationsCollection = "user_revocations"
+)
+
+// RefreshToken : jeton de rafraîchissement émis, stocké par empreinte (jamais en clair)
+type RefreshToken struct {
+	ID        string     `json:"id"`     // sha256 hex du jeton
+	Family    string     `json:"family"` // chaîne de rotation issue d'un même login
+	Username  string     `json:"username"`
+	Admin     bool       `json:"admin"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RotatedAt *time.Time `json:"rotated_at,omitempty"` // remplacé par un nouveau jeton
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Usable indique si le jeton peut encore être échangé
+func (t *RefreshToken) Usable(now time.Time) bool {
+	return t.RotatedAt == nil && t.RevokedAt == nil && now.Before(t.ExpiresAt)
+}
+
+// RevokedToken : jeton d'accès révoqué (jti), conservé jusqu'à son expiration
+type RevokedToken struct {
+	ID        string    `json:"id"` // jti
+	Username  string    `json:"username"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// UserRevocation : tous les jetons d'un utilisateur émis avant Before sont révoqués
+type UserRevocation struct {
+	Username string    `json:"username"`
+	Before   time.Time `json:"before"`
+}
+
+// GetRefreshToken charge un jeton de rafraîchissement par empreinte
+func (st *Store) GetRefreshToken(id string) (*RefreshToken, error) {
+	var t RefreshToken
+	if err := st.Get(RefreshTokensCollection, id, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// PutRefreshToken crée ou remplace un jeton de rafraîchissement
+func (st *Store) PutRefreshToken(t *RefreshToken) error {
+	return st.Put(RefreshTokensCollection, t.ID, t)
+}
+
+// DeleteRefreshToken supprime un jeton de rafraîchissement
+func (st *Store) DeleteRefreshToken(id string) error {
+	return st.Delete(RefreshTokensCollection, id)
+}
+
+// ListRefreshTokens retourne les jetons retenus par keep (tous si nil)
+func (st *Store) ListRefreshTokens(keep func(*RefreshToken) bool) ([]*RefreshToken, error) {
+	var out []*RefreshToken
+	err := st.List(RefreshTokensCollection, func(id string, data []byte) error {
+		var t RefreshToken
+		if err := json.Unmarshal(data, &t); err != nil {
+			return err
+		}
+		if keep == nil || keep(&t) {
+			out = append(out, &t)
+		}
+		return nil
+	})
+	return out, err
+}
+
+// PutRevokedToken enregistre la révocation d'un jeton d'accès
+func (st *Store) PutRevokedToken(t *RevokedToken) error {
+	return st.Put(RevokedTokensCollection, t.ID, t)
+}
+
+// DeleteRevokedToken supprime une révocation (jeton expiré)
+func (st *Store) DeleteRevokedToken(id string) error {
+	return st.Delete(RevokedTokensCollection, id)
+}
+
+// ListRevokedTokens retourne toutes les révocations de jetons d'accès
+func (st *Store) ListRevokedTokens() ([]*RevokedToken, error) {
+	var out []*RevokedToken
+	err := st.List(RevokedTokensCollection, func(id string, data []byte) error {
+		var t RevokedToken
+		if err := json.Unmarshal(data, &t); err != nil {
+			return err
+		}
+		out = append(out, &t)
+		return nil
+	})
+	return out, err
+}
+
+// PutUserRevocation enregistre la révocation de tous les jetons d'un utilisateur
+func (st *Store) PutUserRevocation(u *UserRevocation) error {
+	return st.Put(UserRevocationsCollection, u.Username, u)
+}
+
+// ListUserRevocations retourne les révocations par utilisateur
+func (st *Store) ListUserRevocations() ([]*UserRevocation, error) {
+	var out []*UserRevocation
+	err := st.List(UserRevocationsCollection, func(id string, data []byte) error {
+		var u UserRevocation
+		if err := json.Unmarshal(data, &u); err != nil {
+			return err
+		}
+		out = append(out, &u)
+		return nil
+	})
+	return out, err
+}
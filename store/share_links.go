@@ -0,0 +1,57 @@
+package store
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Collection des liens de partage émis
+const ShareLinksCollection = "share_links"
+
+// ShareLink : lien de partage signé émis pour un rapport sauvegardé ou un résultat
+type ShareLink struct {
+	ID        string     `json:"id"`
+	Kind      string     `json:"kind"`   // saved_report ou result
+	Target    string     `json:"target"` // id du rapport sauvegardé ou du résultat
+	Sharer    string     `json:"sharer"`
+	Direct    bool       `json:"direct,omitempty"` // résultat servi tel quel quel que soit share.run_as (liens envoyés par e-mail)
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	RevokedBy string     `json:"revoked_by,omitempty"`
+}
+
+// Active indique si le lien n'est ni révoqué ni expiré
+func (l *ShareLink) Active(now time.Time) bool {
+	return l.RevokedAt == nil && now.Before(l.ExpiresAt)
+}
+
+// GetShareLink charge un lien de partage
+func (st *Store) GetShareLink(id string) (*ShareLink, error) {
+	var l ShareLink
+	if err := st.Get(ShareLinksCollection, id, &l); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// PutShareLink crée ou remplace un lien de partage
+func (st *Store) PutShareLink(l *ShareLink) error {
+	return st.Put(ShareLinksCollection, l.ID, l)
+}
+
+// ListShareLinks retourne les liens pour lesquels keep renvoie true (tous si keep est nil)
+func (st *Store) ListShareLinks(keep func(*ShareLink) bool) ([]*ShareLink, error) {
+	var out []*ShareLink
+	err := st.List(ShareLinksCollection, func(id string, data []byte) error {
+		var l ShareLink
+		if err := json.Unmarshal(data, &l); err != nil {
+			return err
+		}
+		if keep == nil || keep(&l) {
+			out = append(out, &l)
+		}
+		return nil
+	})
+	return out, err
+}
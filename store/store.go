@@ -0,0 +1,289 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrNotFound est retournée quand un document n'existe pas
+var ErrNotFound = errors.New("not found")
+
+var collectionName = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// Store conserve des documents JSON rangés par collection (saved reports, planifications...),
+// soit dans des fichiers (backend "file"), soit dans la base SQL des utilisateurs.
+type Store struct {
+	backend string // "file", "mysql", "postgres", "sqlite"
+	dir     string
+	db      *sql.DB
+
+	mu      sync.Mutex
+	created map[string]bool // tables SQL déjà créées
+}
+
+// Open ouvre le stockage. backend "file" (ou vide) range les collections dans dir/<collection>.json ;
+// les backends SQL utilisent une table di_<collection> (id, data) dans la base dsn.
+func Open(backend, dsn, dir string) (*Store, error) {
+	st := &Store{backend: backend, dir: dir, created: map[string]bool{}}
+	switch backend {
+	case "", "file":
+		st.backend = "file"
+		if st.dir == "" {
+			st.dir = "data"
+		}
+		if err := os.MkdirAll(st.dir, 0755); err != nil {
+			return nil, err
+		}
+	case "mysql", "postgres", "sqlite", "sqlite3":
+		if backend == "sqlite" {
+			backend = "sqlite3"
+		}
+		db, err := sql.Open(backend, dsn)
+		if err != nil {
+			return nil, err
+		}
+		st.db = db
+	default:
+		return nil, fmt.Errorf("unsupported storage backend %q", backend)
+	}
+	return st, nil
+}
+
+// Close ferme la connexion SQL éventuelle
+func (st *Store) Close() error {
+	if st.db != nil {
+		return st.db.Close()
+	}
+	return nil
+}
+
+// Put crée ou remplace le document id de la collection
+func (st *Store) Put(collection, id string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if st.db != nil {
+		return st.sqlPut(collection, id, data)
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	docs, err := st.readFile(collection)
+	if err != nil {
+		return err
+	}
+	docs[id] = data
+	return st.writeFile(collection, docs)
+}
+
+// Get décode le document id dans v
+func (st *Store) Get(collection, id string, v interface{}) error {
+	var data []byte
+	if st.db != nil {
+		if err := st.ensureTable(collection); err != nil {
+			return err
+		}
+		row := st.db.QueryRow(st.rebind("SELECT data FROM "+table(collection)+" WHERE id = ?"), id)
+		var s string
+		if err := row.Scan(&s); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrNotFound
+			}
+			return err
+		}
+		data = []byte(s)
+	} else {
+		st.mu.Lock()
+		docs, err := st.readFile(collection)
+		st.mu.Unlock()
+		if err != nil {
+			return err
+		}
+		raw, ok := docs[id]
+		if !ok {
+			return ErrNotFound
+		}
+		data = raw
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Delete supprime le document id (ErrNotFound s'il n'existe pas)
+func (st *Store) Delete(collection, id string) error {
+	if st.db != nil {
+		if err := st.ensureTable(collection); err != nil {
+			return err
+		}
+		res, err := st.db.Exec(st.rebind("DELETE FROM "+table(collection)+" WHERE id = ?"), id)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrNotFound
+		}
+		return nil
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	docs, err := st.readFile(collection)
+	if err != nil {
+		return err
+	}
+	if _, ok := docs[id]; !ok {
+		return ErrNotFound
+	}
+	delete(docs, id)
+	return st.writeFile(collection, docs)
+}
+
+// List appelle fn pour chaque document de la collection, dans l'ordre des identifiants
+func (st *Store) List(collection string, fn func(id string, data []byte) error) error {
+	docs := map[string][]byte{}
+	if st.db != nil {
+		if err := st.ensureTable(collection); err != nil {
+			return err
+		}
+		rows, err := st.db.Query("SELECT id, data FROM " + table(collection))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id, data string
+			if err := rows.Scan(&id, &data); err != nil {
+				return err
+			}
+			docs[id] = []byte(data)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	} else {
+		st.mu.Lock()
+		var err error
+		docs, err = st.readFile(collection)
+		st.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	ids := make([]string, 0, len(docs))
+	for id := range docs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if err := fn(id, docs[id]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func table(collection string) string {
+	if !collectionName.MatchString(collection) {
+		panic("store: invalid collection name " + collection)
+	}
+	return "di_" + collection
+}
+
+func (st *Store) ensureTable(collection string) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.created[collection] {
+		return nil
+	}
+	_, err := st.db.Exec("CREATE TABLE IF NOT EXISTS " + table(collection) + " (id VARCHAR(191) PRIMARY KEY, data TEXT NOT NULL)")
+	if err != nil {
+		return err
+	}
+	st.created[collection] = true
+	return nil
+}
+
+// sqlPut remplace le document dans une transaction (pas d'upsert portable entre les 3 bases)
+func (st *Store) sqlPut(collection, id string, data []byte) error {
+	if err := st.ensureTable(collection); err != nil {
+		return err
+	}
+	tx, err := st.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(st.rebind("DELETE FROM "+table(collection)+" WHERE id = ?"), id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec(st.rebind("INSERT INTO "+table(collection)+" (id, data) VALUES (?, ?)"), id, string(data)); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// rebind remplace les ? par $1, $2... pour postgres
+func (st *Store) rebind(query string) string {
+	if st.backend != "postgres" {
+		return query
+	}
+	var sb strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			sb.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		sb.WriteRune(c)
+	}
+	return sb.String()
+}
+
+func (st *Store) path(collection string) string {
+	return filepath.Join(st.dir, collection+".json")
+}
+
+func (st *Store) readFile(collection string) (map[string][]byte, error) {
+	docs := map[string]json.RawMessage{}
+	data, err := os.ReadFile(st.path(collection))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string][]byte{}, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &docs); err != nil {
+		return nil, fmt.Errorf("store %s: %w", collection, err)
+	}
+	out := make(map[string][]byte, len(docs))
+	for id, raw := range docs {
+		out[id] = raw
+	}
+	return out, nil
+}
+
+// writeFile réécrit la collection de façon atomique (fichier temporaire puis rename)
+func (st *Store) writeFile(collection string, docs map[string][]byte) error {
+	raw := make(map[string]json.RawMessage, len(docs))
+	for id, d := range docs {
+		raw[id] = d
+	}
+	data, err := json.MarshalIndent(raw, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := st.path(collection) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, st.path(collection))
+}
@@ -0,0 +1,153 @@
+package store
+
+import (
+	"druid-insight/report"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func testStores(t *testing.T) map[string]*Store {
+	dir := t.TempDir()
+	fileStore, err := Open("file", "", filepath.Join(dir, "data"))
+	if err != nil {
+		t.Fatalf("Open file failed: %v", err)
+	}
+	sqlStore, err := Open("sqlite", filepath.Join(dir, "store.db"), "")
+	if err != nil {
+		t.Fatalf("Open sqlite failed: %v", err)
+	}
+	t.Cleanup(func() { sqlStore.Close() })
+	return map[string]*Store{"file": fileStore, "sqlite": sqlStore}
+}
+
+func TestStore_PutGetListDelete(t *testing.T) {
+	for name, st := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			if err := st.Put("things", "b", map[string]int{"n": 2}); err != nil {
+				t.Fatalf("Put failed: %v", err)
+			}
+			if err := st.Put("things", "a", map[string]int{"n": 1}); err != nil {
+				t.Fatalf("Put failed: %v", err)
+			}
+			if err := st.Put("things", "a", map[string]int{"n": 3}); err != nil {
+				t.Fatalf("Put (replace) failed: %v", err)
+			}
+			var got map[string]int
+			if err := st.Get("things", "a", &got); err != nil || got["n"] != 3 {
+				t.Errorf("Expected replaced document n=3, got %v (%v)", got, err)
+			}
+			var ids []string
+			st.List("things", func(id string, data []byte) error {
+				ids = append(ids, id)
+				return nil
+			})
+			if len(ids) != 2 || ids[0] != "a" || ids[1] != "b" {
+				t.Errorf("Expected ids [a b], got %v", ids)
+			}
+			if err := st.Delete("things", "a"); err != nil {
+				t.Fatalf("Delete failed: %v", err)
+			}
+			if err := st.Get("things", "a", &got); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Expected ErrNotFound after delete, got %v", err)
+			}
+			if err := st.Delete("things", "a"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Expected ErrNotFound deleting twice, got %v", err)
+			}
+		})
+	}
+}
+
+func TestSavedReport_VisibilityAndVersions(t *testing.T) {
+	st := testStores(t)["file"]
+	now := time.Now()
+	s := &SavedReport{
+		ID:         "r1",
+		Name:       "Daily",
+		Owner:      "alice",
+		Team:       "sales",
+		Visibility: VisibilityTeam,
+		Spec:       report.Spec{Datasource: "ds", Metrics: []string{"requests"}},
+		Version:    1,
+		CreatedAt:  now,
+		UpdatedBy:  "alice",
+		UpdatedAt:  now,
+	}
+	if err := st.PutSavedReport(s); err != nil {
+		t.Fatalf("PutSavedReport failed: %v", err)
+	}
+	if !s.VisibleTo("bob", "sales", false) || s.VisibleTo("carol", "ops", false) || s.VisibleTo("dave", "", false) {
+		t.Error("Team visibility not applied")
+	}
+	if s.EditableBy("bob", false) || !s.EditableBy("root", true) {
+		t.Error("Only owner and admins may edit")
+	}
+
+	s.Update("Daily v2", "", &report.Spec{Datasource: "ds", Metrics: []string{"clicks"}}, "root", now.Add(time.Minute))
+	if err := st.PutSavedReport(s); err != nil {
+		t.Fatalf("PutSavedReport failed: %v", err)
+	}
+	got, err := st.GetSavedReport("r1")
+	if err != nil {
+		t.Fatalf("GetSavedReport failed: %v", err)
+	}
+	if got.Version != 2 || got.Name != "Daily v2" || got.Visibility != VisibilityTeam || got.Spec.Metrics[0] != "clicks" {
+		t.Errorf("Unexpected updated report: %+v", got)
+	}
+	if len(got.History) != 1 || got.History[0].Version != 1 || got.History[0].Spec.Metrics[0] != "requests" {
+		t.Errorf("Expected previous version kept in history, got %+v", got.History)
+	}
+
+	s.Visibility = "everyone"
+	if err := st.PutSavedReport(s); !errors.Is(err, ErrInvalidVisibility) {
+		t.Errorf("Expected ErrInvalidVisibility, got %v", err)
+	}
+}
+
+func TestHistory_ListAndPrune(t *testing.T) {
+	now := time.Date(2024, 3, 18, 7, 0, 0, 0, time.UTC)
+	for name, st := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			for i, id := range []string{"r1", "r2", "r3"} {
+				e := &HistoryEntry{ID: id, Owner: "alice", Datasource: "ds", Status: "complete", CreatedAt: now.AddDate(0, 0, -10*i)}
+				if err := st.PutHistoryEntry(e); err != nil {
+					t.Fatalf("PutHistoryEntry failed: %v", err)
+				}
+			}
+			list, err := st.ListHistory(nil)
+			if err != nil || len(list) != 3 || list[0].ID != "r1" || list[2].ID != "r3" {
+				t.Fatalf("Expected 3 entries newest first, got %v (%v)", list, err)
+			}
+			n, err := st.PruneHistory(now.AddDate(0, 0, -15))
+			if err != nil || n != 1 {
+				t.Fatalf("Expected 1 pruned entry, got %d (%v)", n, err)
+			}
+			if _, err := st.GetHistoryEntry("r3"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Expected r3 pruned, got %v", err)
+			}
+		})
+	}
+}
+
+func TestOIDCState_SingleUseAndPrune(t *testing.T) {
+	now := time.Date(2024, 3, 18, 7, 0, 0, 0, time.UTC)
+	for name, st := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			st.PutOIDCState(&OIDCState{ID: "s1", Nonce: "n", Verifier: "v", Redirect: "/", ExpiresAt: now.Add(time.Minute)})
+			st.PutOIDCState(&OIDCState{ID: "s2", ExpiresAt: now.Add(-time.Minute)})
+			s, err := st.TakeOIDCState("s1")
+			if err != nil || s.Verifier != "v" {
+				t.Fatalf("Expected state s1, got %+v (%v)", s, err)
+			}
+			if _, err := st.TakeOIDCState("s1"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Expected s1 consumed, got %v", err)
+			}
+			if n, err := st.PruneOIDCStates(now); err != nil || n != 1 {
+				t.Errorf("Expected 1 pruned state, got %d (%v)", n, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package store
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// Collections de la double authentification : second facteur des utilisateurs et connexions
+// en attente du code
+const (
+	TwoFactorCollection     = "two_factor"
+	MFAChallengesCollection = "mfa_challenges"
+)
+
+// TwoFactor : second facteur TOTP d'un utilisateur. Tant que Enabled est faux, l'inscription
+// attend la confirmation d'un premier code.
+type TwoFactor struct {
+	Username      string     `json:"username"`
+	Secret        string     `json:"secret"` // base32, RFC 6238
+	Enabled       bool       `json:"enabled"`
+	RecoveryCodes []string   `json:"recovery_codes,omitempty"` // sha256 des codes de secours inutilisés
+	LastStep      int64      `json:"last_step"`                // dernier pas de 30 s accepté (anti-rejeu)
+	CreatedAt     time.Time  `json:"created_at"`
+	EnabledAt     *time.Time `json:"enabled_at,omitempty"`
+}
+
+// MFAChallenge : connexion dont le mot de passe est vérifié, en attente du code TOTP
+type MFAChallenge struct {
+	ID        string    `json:"id"` // mfa_token
+	Username  string    `json:"username"`
+	Admin     bool      `json:"admin"`
+	Enroll    bool      `json:"enroll"` // le code confirme une inscription imposée
+	Attempts  int       `json:"attempts"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// GetTwoFactor charge le second facteur d'un utilisateur
+func (st *Store) GetTwoFactor(username string) (*TwoFactor, error) {
+	var t TwoFactor
+	if err := st.Get(TwoFactorCollection, username, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// PutTwoFactor crée ou remplace le second facteur d'un utilisateur
+func (st *Store) PutTwoFactor(t *TwoFactor) error {
+	return st.Put(TwoFactorCollection, t.Username, t)
+}
+
+// DeleteTwoFactor supprime le second facteur (ErrNotFound s'il n'existe pas)
+func (st *Store) DeleteTwoFactor(username string) error {
+	return st.Delete(TwoFactorCollection, username)
+}
+
+// ListTwoFactor retourne les seconds facteurs, par utilisateur
+func (st *Store) ListTwoFactor() ([]*TwoFactor, error) {
+	var out []*TwoFactor
+	err := st.List(TwoFactorCollection, func(id string, data []byte) error {
+		var t TwoFactor
+		if err := json.Unmarshal(data, &t); err != nil {
+			return err
+		}
+		out = append(out, &t)
+		return nil
+	})
+	sort.Slice(out, func(i, j int) bool { return out[i].Username < out[j].Username })
+	return out, err
+}
+
+// GetMFAChallenge charge une connexion en attente du code
+func (st *Store) GetMFAChallenge(id string) (*MFAChallenge, error) {
+	var c MFAChallenge
+	if err := st.Get(MFAChallengesCollection, id, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// PutMFAChallenge crée ou met à jour une connexion en attente du code
+func (st *Store) PutMFAChallenge(c *MFAChallenge) error {
+	return st.Put(MFAChallengesCollection, c.ID, c)
+}
+
+// DeleteMFAChallenge supprime une connexion en attente (ErrNotFound si elle n'existe pas)
+func (st *Store) DeleteMFAChallenge(id string) error {
+	return st.Delete(MFAChallengesCollection, id)
+}
+
+// PruneMFAChallenges supprime les connexions en attente expirées avant before
+func (st *Store) PruneMFAChallenges(before time.Time) (int, error) {
+	var expired []string
+	err := st.List(MFAChallengesCollection, func(id string, data []byte) error {
+		var c MFAChallenge
+		if err := json.Unmarshal(data, &c); err != nil {
+			return err
+		}
+		if c.ExpiresAt.Before(before) {
+			expired = append(expired, id)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, id := range expired {
+		if err := st.Delete(MFAChallengesCollection, id); err != nil && err != ErrNotFound {
+			return 0, err
+		}
+	}
+	return len(expired), nil
+}
@@ -0,0 +1,60 @@
+package store
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// Collection du journal de livraison des webhooks
+const WebhookDeliveriesCollection = "webhook_deliveries"
+
+// Statut d'une livraison de webhook
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// DeliveryAttempt : une tentative d'appel d'un webhook
+type DeliveryAttempt struct {
+	At         time.Time `json:"at"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+}
+
+// WebhookDelivery : livraison d'un événement de rapport à un webhook, avec ses tentatives
+type WebhookDelivery struct {
+	ID        string            `json:"id"`
+	URL       string            `json:"url"`
+	Event     string            `json:"event"`
+	ReportID  string            `json:"report_id"`
+	Owner     string            `json:"owner"`
+	Status    string            `json:"status"`
+	Attempts  []DeliveryAttempt `json:"attempts"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// PutWebhookDelivery crée ou remplace une livraison
+func (st *Store) PutWebhookDelivery(d *WebhookDelivery) error {
+	return st.Put(WebhookDeliveriesCollection, d.ID, d)
+}
+
+// ListWebhookDeliveries retourne les livraisons retenues par keep, les plus récentes d'abord
+func (st *Store) ListWebhookDeliveries(keep func(*WebhookDelivery) bool) ([]*WebhookDelivery, error) {
+	var out []*WebhookDelivery
+	err := st.List(WebhookDeliveriesCollection, func(id string, data []byte) error {
+		var d WebhookDelivery
+		if err := json.Unmarshal(data, &d); err != nil {
+			return err
+		}
+		if keep == nil || keep(&d) {
+			out = append(out, &d)
+		}
+		return nil
+	})
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out, err
+}
@@ -0,0 +1,154 @@
+package worker
+
+import (
+	"sync"
+	"time"
+)
+
+// Event : transition de statut d'un rapport, diffusée sur le bus d'événements
+type Event struct {
+	ID        string       `json:"id"`
+	Owner     string       `json:"-"`
+	Status    ReportStatus `json:"status"`
+	Position  int          `json:"position,omitempty"`   // waiting : position dans la file (1 = prochain)
+	ElapsedMs int64        `json:"elapsed_ms,omitempty"` // processing : temps écoulé depuis le début
+	RowCount  int          `json:"row_count,omitempty"`  // complete : nombre de lignes
+	Attempt   int          `json:"attempt,omitempty"`    // processing : numéro de la nouvelle tentative Druid
+	Error     string       `json:"error,omitempty"`      // error / cancelled : message (processing : échec de la tentative précédente)
+	At        time.Time    `json:"at"`
+}
+
+// Terminal indique si l'événement clôt la vie du rapport
+func (e Event) Terminal() bool {
+	return e.Status == StatusComplete || e.Status == StatusError || e.Status == StatusCancelled
+}
+
+const subscriberBuffer = 64
+
+type subscriber struct {
+	ch     chan Event
+	filter func(Event) bool
+	closed bool // canal fermé (désabonnement ou abonné débordé), protégé par subscribersMu
+}
+
+// Bus d'événements : diffusion non bloquante. Un abonné trop lent n'en perd jamais
+// silencieusement : il est désabonné et son canal fermé, à lui de relire l'état courant
+// (Snapshot) pour retrouver notamment un statut final.
+var (
+	subscribersMu sync.Mutex
+	subscribers   = map[*subscriber]struct{}{}
+)
+
+// Subscribe s'abonne aux événements retenus par filter (tous si nil).
+// La fonction retournée désabonne et ferme le canal.
+func Subscribe(filter func(Event) bool) (<-chan Event, func()) {
+	sub := &subscriber{ch: make(chan Event, subscriberBuffer), filter: filter}
+	subscribersMu.Lock()
+	subscribers[sub] = struct{}{}
+	subscribersMu.Unlock()
+	return sub.ch, func() {
+		subscribersMu.Lock()
+		defer subscribersMu.Unlock()
+		sub.close()
+	}
+}
+
+// close retire l'abonné et ferme son canal (subscribersMu verrouillé)
+func (sub *subscriber) close() {
+	if sub.closed {
+		return
+	}
+	sub.closed = true
+	delete(subscribers, sub)
+	close(sub.ch)
+}
+
+func publish(e Event) {
+	if e.At.IsZero() {
+		e.At = time.Now()
+	}
+	subscribersMu.Lock()
+	defer subscribersMu.Unlock()
+	for sub := range subscribers {
+		if sub.filter != nil && !sub.filter(e) {
+			continue
+		}
+		select {
+		case sub.ch <- e:
+		default:
+			sub.close()
+		}
+	}
+}
+
+// QueuePosition retourne la position (1 = prochain) d'une requête en attente, 0 sinon
+func QueuePosition(id string) int {
+	pendingMutex.Lock()
+	defer pendingMutex.Unlock()
+	for i, pid := range pendingOrder {
+		if pid == id {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// publishQueuePositions diffuse la nouvelle position de chaque requête en attente
+func publishQueuePositions() {
+	pendingMutex.Lock()
+	ids := append([]string(nil), pendingOrder...)
+	pendingMutex.Unlock()
+	for i, id := range ids {
+		if v, ok := pendingRequests.Load(id); ok {
+			publish(Event{ID: id, Owner: v.(*ReportRequest).Owner, Status: StatusWaiting, Position: i + 1})
+		}
+	}
+}
+
+// Snapshot retourne l'état courant d'une requête sous forme d'événement
+func Snapshot(id string) (Event, bool) {
+	if v, ok := pendingRequests.Load(id); ok {
+		return Event{ID: id, Owner: v.(*ReportRequest).Owner, Status: StatusWaiting, Position: QueuePosition(id), At: time.Now()}, true
+	}
+	if v, ok := processingRequests.Load(id); ok {
+		return resultEvent(id, v.(*ReportResult)), true
+	}
+	return Event{}, false
+}
+
+// ActiveSnapshots retourne l'état des requêtes en attente ou en cours d'un utilisateur
+func ActiveSnapshots(owner string) []Event {
+	var out []Event
+	pendingMutex.Lock()
+	ids := append([]string(nil), pendingOrder...)
+	pendingMutex.Unlock()
+	for _, id := range ids {
+		if e, ok := Snapshot(id); ok && e.Owner == owner {
+			out = append(out, e)
+		}
+	}
+	processingRequests.Range(func(k, v interface{}) bool {
+		rr := v.(*ReportResult)
+		if rr.Owner == owner && rr.Status == StatusProcessing {
+			out = append(out, resultEvent(k.(string), rr))
+		}
+		return true
+	})
+	return out
+}
+
+func resultEvent(id string, rr *ReportResult) Event {
+	e := Event{ID: id, Owner: rr.Owner, Status: rr.Status, At: time.Now()}
+	switch rr.Status {
+	case StatusProcessing:
+		e.ElapsedMs = time.Since(rr.StartedAt).Milliseconds()
+		if n := len(rr.Attempts); n > 0 {
+			e.Attempt = n + 1
+		}
+	case StatusComplete:
+		e.RowCount = rr.Rows
+	case StatusError, StatusCancelled:
+		e.Error = rr.ErrorMsg
+	}
+	return e
+}
@@ -0,0 +1,97 @@
+package worker
+
+import "testing"
+
+// drain lit les événements déjà dans le canal et indique s'il a été fermé
+func drain(ch <-chan Event) ([]Event, bool) {
+	var out []Event
+	for {
+		select {
+		case e, ok := <-ch:
+			if !ok {
+				return out, true
+			}
+			out = append(out, e)
+		default:
+			return out, false
+		}
+	}
+}
+
+func TestSubscribe_Filter(t *testing.T) {
+	events, unsubscribe := Subscribe(func(e Event) bool { return e.Owner == "alice" })
+	defer unsubscribe()
+
+	publish(Event{ID: "f1", Owner: "alice", Status: StatusWaiting, Position: 1})
+	publish(Event{ID: "f2", Owner: "bob", Status: StatusWaiting, Position: 2})
+
+	got, closed := drain(events)
+	if closed || len(got) != 1 || got[0].ID != "f1" || got[0].At.IsZero() {
+		t.Errorf("Expected only alice's event with a timestamp, got %+v (closed=%t)", got, closed)
+	}
+}
+
+func TestPublish_DeliversTerminalEvents(t *testing.T) {
+	events, unsubscribe := Subscribe(func(e Event) bool { return e.ID == "t1" })
+	defer unsubscribe()
+
+	statuses := []ReportStatus{StatusWaiting, StatusProcessing, StatusComplete}
+	for _, status := range statuses {
+		publish(Event{ID: "t1", Status: status})
+	}
+	got, _ := drain(events)
+	if len(got) != len(statuses) {
+		t.Fatalf("Expected %d events, got %+v", len(statuses), got)
+	}
+	for i, e := range got {
+		if e.Status != statuses[i] || e.Terminal() != (e.Status == StatusComplete) {
+			t.Errorf("Unexpected event %d: %+v", i, e)
+		}
+	}
+}
+
+func TestPublish_ClosesOverflowingSubscriber(t *testing.T) {
+	events, unsubscribe := Subscribe(func(e Event) bool { return e.ID == "o1" })
+	for i := 0; i < subscriberBuffer; i++ {
+		publish(Event{ID: "o1", Status: StatusProcessing})
+	}
+	// le statut final ne tient plus : l'abonné est fermé au lieu de le perdre en silence
+	publish(Event{ID: "o1", Status: StatusError, Error: "boom"})
+
+	got, closed := drain(events)
+	if !closed || len(got) != subscriberBuffer {
+		t.Errorf("Expected %d buffered events then a closed stream, got %d (closed=%t)", subscriberBuffer, len(got), closed)
+	}
+	subscribersMu.Lock()
+	n := len(subscribers)
+	subscribersMu.Unlock()
+	if n != 0 {
+		t.Errorf("Expected the subscriber to be removed, %d left", n)
+	}
+	unsubscribe() // sans effet après la fermeture
+}
+
+func TestUnsubscribe(t *testing.T) {
+	events, unsubscribe := Subscribe(nil)
+	unsubscribe()
+	unsubscribe()
+	publish(Event{ID: "u1", Status: StatusWaiting})
+	if got, closed := drain(events); !closed || len(got) != 0 {
+		t.Errorf("Expected a closed stream without events, got %+v (closed=%t)", got, closed)
+	}
+}
+
+func TestEvent_Terminal(t *testing.T) {
+	tests := map[ReportStatus]bool{
+		StatusWaiting:    false,
+		StatusProcessing: false,
+		StatusComplete:   true,
+		StatusError:      true,
+		StatusCancelled:  true,
+	}
+	for status, want := range tests {
+		if got := (Event{Status: status}).Terminal(); got != want {
+			t.Errorf("%s: expected terminal=%t, got %t", status, want, got)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package worker
+
+import (
+	"druid-insight/logging"
+	"druid-insight/store"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// historyPruneInterval : fréquence minimale de purge de l'historique
+const historyPruneInterval = time.Hour
+
+// HistoryRecorder retourne un hook OnFinished qui enregistre chaque exécution terminée
+// dans l'historique. Les entrées plus anciennes que retention sont purgées (0 = jamais).
+func HistoryRecorder(st *store.Store, retention time.Duration, logger *logging.Logger) func(req *ReportRequest, res *ReportResult) {
+	var mu sync.Mutex
+	var lastPrune time.Time
+	return func(req *ReportRequest, res *ReportResult) {
+		if err := st.PutHistoryEntry(historyEntry(req.ID, res)); err != nil {
+			logger.Write("[HISTORY_FAIL] id=" + req.ID + " err=" + err.Error())
+		}
+		if retention <= 0 {
+			return
+		}
+		mu.Lock()
+		due := time.Since(lastPrune) >= historyPruneInterval
+		if due {
+			lastPrune = time.Now()
+		}
+		mu.Unlock()
+		if due {
+			go func() {
+				if _, err := st.PruneHistory(time.Now().Add(-retention)); err != nil {
+					logger.Write("[HISTORY_FAIL] prune err=" + err.Error())
+				}
+			}()
+		}
+	}
+}
+
+// ActiveHistory retourne les requêtes en attente ou en cours sous forme d'entrées d'historique
+func ActiveHistory(keep func(*store.HistoryEntry) bool) []*store.HistoryEntry {
+	var out []*store.HistoryEntry
+	add := func(e *store.HistoryEntry) {
+		if keep == nil || keep(e) {
+			out = append(out, e)
+		}
+	}
+	pendingRequests.Range(func(k, v interface{}) bool {
+		req := v.(*ReportRequest)
+		add(&store.HistoryEntry{
+			ID:         req.ID,
+			Owner:      req.Owner,
+			Datasource: req.Spec.Datasource,
+			Spec:       *req.Spec,
+			Status:     string(StatusWaiting),
+			Context:    req.Context,
+			Schedule:   req.Schedule,
+			CreatedAt:  req.CreatedAt,
+		})
+		return true
+	})
+	processingRequests.Range(func(k, v interface{}) bool {
+		if rr := v.(*ReportResult); rr.Status == StatusProcessing {
+			add(historyEntry(k.(string), rr))
+		}
+		return true
+	})
+	return out
+}
+
+// ResultAvailable indique si le CSV d'un rapport est encore téléchargeable
+func ResultAvailable(id string) bool {
+	_, err := os.Stat(filepath.Join("csv", id+".csv"))
+	return err == nil
+}
+
+func historyEntry(id string, rr *ReportResult) *store.HistoryEntry {
+	e := &store.HistoryEntry{
+		ID:         id,
+		Owner:      rr.Owner,
+		Status:     string(rr.Status),
+		Error:      rr.ErrorMsg,
+		Context:    rr.Context,
+		Schedule:   rr.Schedule,
+		Cache:      rr.Cache,
+		CreatedAt:  rr.CreatedAt,
+		StartedAt:  rr.StartedAt,
+		FinishedAt: rr.FinishedAt,
+		RowCount:   rr.Rows,
+	}
+	if rr.Spec != nil {
+		e.Spec = *rr.Spec
+		e.Datasource = rr.Spec.Datasource
+	}
+	switch {
+	case !rr.FinishedAt.IsZero() && !rr.StartedAt.IsZero():
+		e.DurationMs = rr.FinishedAt.Sub(rr.StartedAt).Milliseconds()
+	case rr.Status == StatusProcessing:
+		e.DurationMs = time.Since(rr.StartedAt).Milliseconds()
+	}
+	return e
+}
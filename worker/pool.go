@@ -1,6 +1,7 @@
 package worker
 
 import (
+	"context"
 	"encoding/csv"
 	"fmt"
 	"os"
@@ -11,9 +12,11 @@ import (
 	"time"
 
 	"druid-insight/auth"
+	"druid-insight/cache"
 	"druid-insight/config"
 	"druid-insight/druid"
 	"druid-insight/logging"
+	"druid-insight/report"
 )
 
 // Maps et file d’attente FIFO
@@ -22,14 +25,20 @@ var (
 	processingRequests = sync.Map{} // id => *ReportResult
 	pendingMutex       = &sync.Mutex{}
 	pendingOrder       = []string{}
+	cancelFuncs        = sync.Map{} // id => context.CancelFunc des requêtes en cours
 )
 
 // Ajoute une requête dans la file FIFO
 func AddPendingRequest(req *ReportRequest) {
+	if req.CreatedAt.IsZero() {
+		req.CreatedAt = time.Now()
+	}
 	pendingRequests.Store(req.ID, req)
 	pendingMutex.Lock()
 	pendingOrder = append(pendingOrder, req.ID)
+	position := len(pendingOrder)
 	pendingMutex.Unlock()
+	publish(Event{ID: req.ID, Owner: req.Owner, Status: StatusWaiting, Position: position})
 }
 
 // Récupère puis supprime la plus ancienne requête FIFO (ou "" si aucune)
@@ -44,191 +53,246 @@ func NextPendingID() string {
 	return nextID
 }
 
+// Cancel annule une requête en attente (retirée de la file) ou en cours (requête Druid interrompue).
+// Retourne false si la requête est inconnue ou déjà terminée.
+func Cancel(id string) bool {
+	if v, ok := pendingRequests.LoadAndDelete(id); ok {
+		pendingMutex.Lock()
+		for i, pid := range pendingOrder {
+			if pid == id {
+				pendingOrder = append(pendingOrder[:i], pendingOrder[i+1:]...)
+				break
+			}
+		}
+		pendingMutex.Unlock()
+		finish(v.(*ReportRequest), StatusCancelled, nil, "", "Rapport annulé", time.Time{}, 0)
+		publishQueuePositions()
+		return true
+	}
+	if cancel, ok := cancelFuncs.Load(id); ok {
+		cancel.(context.CancelFunc)()
+		return true
+	}
+	return false
+}
+
 // Expose les maps pour l’API statut
 func PendingRequests() *sync.Map    { return &pendingRequests }
 func ProcessingRequests() *sync.Map { return &processingRequests }
 
+// LookupReport retourne le propriétaire, le rapport et le lien de partage d'une requête
+// en attente, en cours ou terminée
+func LookupReport(id string) (owner string, spec *report.Spec, share string, ok bool) {
+	if v, found := pendingRequests.Load(id); found {
+		req := v.(*ReportRequest)
+		return req.Owner, req.Spec, req.Share, true
+	}
+	if v, found := processingRequests.Load(id); found {
+		rr := v.(*ReportResult)
+		return rr.Owner, rr.Spec, rr.Share, true
+	}
+	return "", nil, "", false
+}
+
+// Status retourne le statut courant d'une requête et son message d'erreur éventuel
+func Status(id string) (status ReportStatus, errMsg string, ok bool) {
+	if _, found := pendingRequests.Load(id); found {
+		return StatusWaiting, "", true
+	}
+	if v, found := processingRequests.Load(id); found {
+		rr := v.(*ReportResult)
+		return rr.Status, rr.ErrorMsg, true
+	}
+	return "", "", false
+}
+
+// Cache de résultats partagé par les workers (nil = désactivé)
+var resultCache *cache.ResultCache
+
+func SetResultCache(c *cache.ResultCache) { resultCache = c }
+func ResultCache() *cache.ResultCache     { return resultCache }
+
+// Hooks appelés quand un rapport se termine (complete, error ou cancelled)
+var finishedHooks []func(req *ReportRequest, res *ReportResult)
+
+// OnFinished enregistre un hook de fin de rapport (au démarrage, avant StartReportWorkers).
+// Le hook est appelé depuis le worker : un traitement long doit partir dans une goroutine.
+func OnFinished(fn func(req *ReportRequest, res *ReportResult)) {
+	finishedHooks = append(finishedHooks, fn)
+}
+
 // Lance N workers en parallèle
-func StartReportWorkers(num int, druidCfg *config.DruidConfig, reportLogger *logging.Logger, cfg *auth.Config) {
+func StartReportWorkers(num int, druidCfg *config.DruidConfig, clusters *druid.Clusters, reportLogger *logging.Logger, cfg *auth.Config, users *auth.UsersFile) {
+	workerCount = num
 	for i := 0; i < num; i++ {
-		go reportWorker(druidCfg, reportLogger, cfg)
+		go reportWorker(i+1, druidCfg, clusters, reportLogger, cfg, users)
 	}
 }
 
 // Un worker traite une requête à la fois, dès qu’il en trouve une dans la file FIFO
-func reportWorker(druidCfg *config.DruidConfig, reportLogger *logging.Logger, cfg *auth.Config) {
+func reportWorker(workerID int, druidCfg *config.DruidConfig, clusters *druid.Clusters, reportLogger *logging.Logger, cfg *auth.Config, users *auth.UsersFile) {
 	for {
 		nextID := NextPendingID()
 		if nextID == "" {
 			time.Sleep(300 * time.Millisecond)
 			continue
 		}
+		// la fonction d'annulation est publiée avant que la requête ne quitte la file :
+		// Cancel trouve toujours la requête, en attente ou en cours
+		ctx, cancel := context.WithCancel(context.Background())
+		cancelFuncs.Store(nextID, cancel)
 		v, ok := pendingRequests.LoadAndDelete(nextID)
 		if !ok {
+			cancelFuncs.Delete(nextID)
+			cancel()
 			continue
 		}
 		req := v.(*ReportRequest)
-		processingRequests.Store(nextID, &ReportResult{Status: StatusProcessing})
-
-		reportLogger.Write("[START] id=" + nextID + " owner=" + req.Owner)
-
-		status, result, csvPath, errMsg := ProcessRequest(req, druidCfg, reportLogger, cfg)
+		busyWorkers.Add(1)
+		startedAt := time.Now()
 		processingRequests.Store(nextID, &ReportResult{
-			Status:   status,
-			Result:   result,
-			CSVPath:  csvPath,
-			ErrorMsg: errMsg,
+			Status:    StatusProcessing,
+			Owner:     req.Owner,
+			Spec:      req.Spec,
+			Share:     req.Share,
+			Context:   req.Context,
+			Schedule:  req.Schedule,
+			CreatedAt: req.CreatedAt,
+			StartedAt: startedAt,
+			WorkerID:  workerID,
 		})
-	}
-}
+		publish(Event{ID: nextID, Owner: req.Owner, Status: StatusProcessing, At: startedAt})
+		publishQueuePositions()
 
-func ComputeIntervals(start, end, compare string) (mainInterval, compareInterval string, err error) {
-	const layoutInput = "2006-01-02"
-	const layoutOutput = "2006-01-02T15:04:05Z"
+		reportLogger.Write("[START] id=" + nextID + " owner=" + req.Owner + " worker=" + strconv.Itoa(workerID))
 
-	startT, err := time.Parse(layoutInput, start)
-	if err != nil {
-		return "", "", err
-	}
-	endT, err := time.Parse(layoutInput, end)
-	if err != nil {
-		return "", "", err
-	}
-	// Pour couvrir toute la journée end incluse, on rajoute 1 jour à endT (convention Druid "end exclusive")
-	endT = endT.AddDate(0, 0, 1)
-
-	mainInterval = startT.Format(layoutOutput) + "/" + endT.Format(layoutOutput)
-	periodDuration := endT.Sub(startT)
-
-	var compareStart, compareEnd time.Time
-
-	switch compare {
-	case "prev_day":
-		compareEnd = startT
-		compareStart = compareEnd.Add(-periodDuration)
-	case "prev_week":
-		if periodDuration > 7*time.Hour*24 {
-			compareEnd = startT.AddDate(0, 0, -7)
-			compareStart = compareEnd.Add(-periodDuration)
-		} else {
-			compareStart = startT.AddDate(0, 0, -7)
-			compareEnd = endT.AddDate(0, 0, -7)
-		}
-	case "prev_month":
-		if periodDuration > 28*time.Hour*24 {
-			compareEnd = startT.AddDate(0, -1, 0)
-			compareStart = compareEnd.Add(-periodDuration)
+		var status ReportStatus
+		var result interface{}
+		var csvPath, errMsg string
+		if ctx.Err() == nil {
+			status, result, csvPath, errMsg = ProcessRequest(ctx, req, druidCfg, clusters, reportLogger, cfg, users)
 		} else {
-			compareStart = startT.AddDate(0, -1, 0)
-			compareEnd = endT.AddDate(0, -1, 0)
+			status = StatusError
 		}
-	case "prev_year":
-		if periodDuration > 365*time.Hour*24 {
-			compareEnd = startT.AddDate(-1, 0, 0)
-			compareStart = compareEnd.Add(-periodDuration)
-		} else {
-			compareStart = startT.AddDate(-1, 0, 0)
-			compareEnd = endT.AddDate(-1, 0, 0)
+		if ctx.Err() != nil && status == StatusError {
+			status, errMsg = StatusCancelled, "Rapport annulé"
+			reportLogger.Write("[CANCELLED] id=" + nextID)
 		}
-	default:
-		return mainInterval, "", nil
+		cancelFuncs.Delete(nextID)
+		cancel()
+		finish(req, status, result, csvPath, errMsg, startedAt, workerID)
+		busyWorkers.Add(-1)
 	}
-
-	compareInterval = compareStart.Format(layoutOutput) + "/" + compareEnd.Format(layoutOutput)
-	return mainInterval, compareInterval, nil
 }
 
-// Utilise les helpers du module druid pour exécuter la requête et générer un CSV
-func ProcessRequest(req *ReportRequest, druidCfg *config.DruidConfig, logger *logging.Logger, cfg *auth.Config) (ReportStatus, interface{}, string, string) {
-	// Récupération des paramètres attendus dans le payload (dimensions, metrics, filters, intervals)
-	var dims, mets []string
-	var filters []interface{}
-	var intervals []string
-
-	// Parsing souple pour extraire les params du payload
-	if v, ok := req.Payload["dimensions"]; ok {
-		if arr, ok := v.([]interface{}); ok {
-			for _, d := range arr {
-				if s, ok := d.(string); ok {
-					dims = append(dims, s)
-				}
-			}
-		}
+// finish enregistre le résultat final d'une requête et appelle les hooks de fin
+func finish(req *ReportRequest, status ReportStatus, result interface{}, csvPath, errMsg string, startedAt time.Time, workerID int) {
+	now := time.Now()
+	if !startedAt.IsZero() && status == StatusComplete && req.CacheStatus != cache.StatusHit {
+		recordDuration(now.Sub(startedAt))
 	}
-	if v, ok := req.Payload["metrics"]; ok {
-		if arr, ok := v.([]interface{}); ok {
-			for _, m := range arr {
-				if s, ok := m.(string); ok {
-					mets = append(mets, s)
-				}
-			}
-		}
+	res := &ReportResult{
+		Status:     status,
+		Result:     result,
+		CSVPath:    csvPath,
+		ErrorMsg:   errMsg,
+		Cache:      req.CacheStatus,
+		Owner:      req.Owner,
+		Spec:       req.Spec,
+		Share:      req.Share,
+		Context:    req.Context,
+		Schedule:   req.Schedule,
+		CreatedAt:  req.CreatedAt,
+		StartedAt:  startedAt,
+		FinishedAt: now,
+		WorkerID:   workerID,
+		DruidTime:  req.DruidDuration,
+		Rows:       req.RowsWritten,
+		Attempts:   req.Attempts,
 	}
-	if v, ok := req.Payload["filters"]; ok {
-		if arr, ok := v.([]interface{}); ok {
-			filters = arr
-		}
+	processingRequests.Store(req.ID, res)
+	publish(resultEvent(req.ID, res))
+	for _, fn := range finishedHooks {
+		fn(req, res)
 	}
-	if v, ok := req.Payload["dates"]; ok {
-		if arr, ok := v.([]interface{}); ok && len(arr) == 2 {
-			start, ok1 := arr[0].(string)
-			end, ok2 := arr[1].(string)
-			if ok1 && ok2 {
-				compare := ""
-				if c, ok := req.Payload["compare"].(string); ok {
-					compare = c
-				}
-				mainInterval, compareInterval, err := ComputeIntervals(start, end, compare)
-				if err != nil {
-					logger.Write(fmt.Sprintf("[FAIL] id=%s bad interval: %v", req.ID, err))
-					return StatusError, nil, "", "Intervalle invalide"
-				}
-				intervals = append(intervals, mainInterval)
-				if compareInterval != "" {
-					intervals = append(intervals, compareInterval)
-				}
-			}
-		}
+}
+
+// Utilise les helpers du module druid pour exécuter la requête et générer un CSV
+func ProcessRequest(ctx context.Context, req *ReportRequest, druidCfg *config.DruidConfig, clusters *druid.Clusters, logger *logging.Logger, cfg *auth.Config, users *auth.UsersFile) (ReportStatus, interface{}, string, string) {
+	spec := req.Spec
+	intervals, err := spec.Intervals()
+	if err != nil {
+		logger.Write(fmt.Sprintf("[FAIL] id=%s bad interval: %v", req.ID, err))
+		return StatusError, nil, "", "Intervalle invalide"
 	}
 
 	// 1. Retrouver la config de la datasource
-	ds, ok := druidCfg.Datasources[req.Datasource]
+	ds, ok := druidCfg.Datasources[spec.Datasource]
 	if !ok {
 		logger.Write(fmt.Sprintf("[FAIL] id=%s unknown datasource %s", req.ID, req.Datasource))
 		return StatusError, nil, "", "Datasource inconnue"
 	}
-
-	granularity := "all"
-	if tg, ok := req.Payload["time_group"].(string); ok && tg != "" {
-		// Druid supporte hour, day, week, month (par défaut en minuscule)
-		granularity = tg
+	client, err := clusters.ForDatasource(req.Datasource)
+	if err != nil {
+		logger.Write(fmt.Sprintf("[FAIL] id=%s cluster: %v", req.ID, err))
+		return StatusError, nil, "", "Cluster Druid inconnu"
 	}
 
-	query, err := druid.BuildDruidQuery(
-		req.Datasource,
-		dims,
-		mets,
-		filters, // les filtres utilisateur bruts
-		intervals,
-		ds,
-		granularity,
-		req.Owner,
-		req.Admin,
-		druidCfg,
-		cfg,
-		req.Owner,
-		req.Context,
-	)
-	if err != nil {
-		logger.Write(fmt.Sprintf("[FAIL] id=%s buildquery: %v", req.ID, err))
-		return StatusError, nil, "", "Erreur construction requête Druid"
+	var query interface{}
+	if druid.UsesSQL(ds) {
+		// 2bis. Datasource configurée en mode SQL : même modèle, traduit en Druid SQL
+		sqlQuery, err := druid.BuildDruidSQLQuery(spec, req.Owner, req.Admin, druidCfg, users, cfg, req.Context)
+		if err != nil {
+			logger.Write(fmt.Sprintf("[FAIL] id=%s buildsql: %v", req.ID, err))
+			return StatusError, nil, "", "Erreur construction requête Druid"
+		}
+		query = sqlQuery
+	} else {
+		nativeQuery, err := druid.BuildDruidQuery(spec, req.Owner, req.Admin, druidCfg, users, cfg, req.Context)
+		if err != nil {
+			logger.Write(fmt.Sprintf("[FAIL] id=%s buildquery: %v", req.ID, err))
+			return StatusError, nil, "", "Erreur construction requête Druid"
+		}
+		query = nativeQuery
 	}
 
-	// 3. Exécuter la requête avec ExecuteDruidQuery
-	results, err := druid.ExecuteDruidQuery(druidCfg.HostURL+"/druid/v2/", query)
-	if err != nil {
-		logger.Write(fmt.Sprintf("[FAIL] id=%s druid error: %v", req.ID, err))
-		return StatusError, nil, "", fmt.Sprintf("Erreur Druid: %v", err)
+	// 3. Cache de résultats : la clé porte sur la requête finale, filtres d'accès compris,
+	// deux utilisateurs aux droits différents ne partagent donc jamais une entrée.
+	var results []map[string]interface{}
+	cacheKey := ""
+	if resultCache != nil {
+		cacheKey = cache.Key(clusters.ClusterName(req.Datasource), query)
+		if cached, ok := resultCache.Get(cacheKey); ok {
+			results = cached
+			req.CacheStatus = cache.StatusHit
+			logger.Write(fmt.Sprintf("[CACHE_HIT] id=%s key=%s", req.ID, cacheKey))
+		} else {
+			req.CacheStatus = cache.StatusMiss
+		}
+	}
+	if req.CacheStatus != cache.StatusHit {
+		// les nouvelles tentatives sont celles du worker uniquement (druid.yaml retry)
+		druidCtx := druid.WithoutRetries(ctx)
+		results, err = runWithRetry(ctx, req, druidCfg.Retry, logger, func() ([]map[string]interface{}, error) {
+			switch q := query.(type) {
+			case *druid.SQLQuery:
+				rows, err := client.SQLQuery(druidCtx, q)
+				if err != nil {
+					return nil, err
+				}
+				return druid.SQLRowsToEvents(rows), nil
+			case map[string]interface{}:
+				return client.NativeQuery(druidCtx, q)
+			}
+			return nil, fmt.Errorf("unexpected query type %T", query)
+		})
+		if err != nil {
+			logger.Write(fmt.Sprintf("[FAIL] id=%s druid error (%s, %d attempt(s)): %v", req.ID, druid.Classify(err), len(req.Attempts), err))
+			return StatusError, nil, "", fmt.Sprintf("Erreur Druid (%s): %v", druid.Classify(err), err)
+		}
+		if resultCache != nil {
+			resultCache.Set(cacheKey, req.Datasource, intervals, results)
+		}
 	}
 
 	// 4. Générer un CSV dans csv/<id>.csv
@@ -358,6 +422,7 @@ func ProcessRequest(req *ReportRequest, druidCfg *config.DruidConfig, logger *lo
 		}
 	}
 
-	logger.Write(fmt.Sprintf("[COMPLETE] id=%s lignes=%d fichier=%s", req.ID, len(results), csvPath))
+	req.RowsWritten = len(results)
+	logger.Write(fmt.Sprintf("[COMPLETE] id=%s lignes=%d fichier=%s druid_ms=%d", req.ID, len(results), csvPath, req.DruidDuration.Milliseconds()))
 	return StatusComplete, results, csvPath, ""
 }
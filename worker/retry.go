@@ -0,0 +1,81 @@
+package worker
+
+import (
+	"context"
+	"druid-insight/config"
+	"druid-insight/druid"
+	"druid-insight/logging"
+	"fmt"
+	"time"
+)
+
+const (
+	defaultRetryAttempts   = 3
+	defaultRetryBackoff    = 2 * time.Second
+	defaultRetryMaxBackoff = time.Minute
+)
+
+// retryPolicy applique les valeurs par défaut de la section retry de druid.yaml
+func retryPolicy(rc config.ReportRetryConfig) (attempts int, backoff, maxBackoff time.Duration) {
+	attempts, backoff, maxBackoff = rc.MaxAttempts, time.Duration(rc.BackoffMs)*time.Millisecond, time.Duration(rc.MaxBackoffMs)*time.Millisecond
+	if attempts <= 0 {
+		attempts = defaultRetryAttempts
+	}
+	if backoff <= 0 {
+		backoff = defaultRetryBackoff
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = defaultRetryMaxBackoff
+	}
+	return
+}
+
+// runWithRetry exécute run jusqu'au succès, à une erreur non transitoire ou au nombre
+// maximal de tentatives, avec un backoff exponentiel. Chaque échec est ajouté à
+// req.Attempts, visible dans le statut du rapport, et journalisé ([RETRY]).
+// req.DruidDuration mesure la dernière tentative.
+func runWithRetry(ctx context.Context, req *ReportRequest, rc config.ReportRetryConfig, logger *logging.Logger, run func() ([]map[string]interface{}, error)) ([]map[string]interface{}, error) {
+	maxAttempts, delay, maxDelay := retryPolicy(rc)
+	for attempt := 1; ; attempt++ {
+		start := time.Now()
+		results, err := run()
+		req.DruidDuration = time.Since(start)
+		if err == nil {
+			return results, nil
+		}
+		class := druid.Classify(err)
+		retry := class.Transient() && attempt < maxAttempts && ctx.Err() == nil
+		recordAttempt(req, Attempt{
+			Number:     attempt,
+			At:         start,
+			Class:      string(class),
+			Error:      err.Error(),
+			DurationMs: req.DruidDuration.Milliseconds(),
+			Retry:      retry,
+		})
+		if !retry {
+			return nil, err
+		}
+		logger.Write(fmt.Sprintf("[RETRY] id=%s attempt=%d/%d class=%s delay=%s err=%v", req.ID, attempt, maxAttempts, class, delay, err))
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxDelay)
+	}
+}
+
+// recordAttempt ajoute une tentative à la requête et met à jour son état « processing »
+// (copie remplacée en bloc pour ne pas modifier une valeur lue par l'API)
+func recordAttempt(req *ReportRequest, a Attempt) {
+	req.Attempts = append(req.Attempts, a)
+	if v, ok := processingRequests.Load(req.ID); ok {
+		rr := *v.(*ReportResult)
+		rr.Attempts = append([]Attempt(nil), req.Attempts...)
+		processingRequests.Store(req.ID, &rr)
+	}
+	if a.Retry {
+		publish(Event{ID: req.ID, Owner: req.Owner, Status: StatusProcessing, Attempt: a.Number + 1, Error: a.Error})
+	}
+}
@@ -0,0 +1,71 @@
+package worker
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Nombre d'exécutions récentes retenues pour estimer les temps d'attente
+const recentDurationsSize = 50
+
+var (
+	workerCount = 1
+	busyWorkers atomic.Int32 // workers en train de traiter une requête
+
+	durationsMu     sync.Mutex
+	recentDurations []time.Duration
+)
+
+// recordDuration mémorise la durée de traitement d'un rapport exécuté sur Druid
+// (les réponses du cache fausseraient les estimations)
+func recordDuration(d time.Duration) {
+	durationsMu.Lock()
+	defer durationsMu.Unlock()
+	recentDurations = append(recentDurations, d)
+	if len(recentDurations) > recentDurationsSize {
+		recentDurations = recentDurations[len(recentDurations)-recentDurationsSize:]
+	}
+}
+
+// AverageDuration retourne la durée moyenne des derniers traitements (0 si aucun)
+func AverageDuration() time.Duration {
+	durationsMu.Lock()
+	defer durationsMu.Unlock()
+	if len(recentDurations) == 0 {
+		return 0
+	}
+	var total time.Duration
+	for _, d := range recentDurations {
+		total += d
+	}
+	return total / time.Duration(len(recentDurations))
+}
+
+// EstimatedWait estime l'attente avant le début du traitement d'une requête en position
+// position (1 = prochaine). Retourne 0 sans historique.
+func EstimatedWait(position int) time.Duration {
+	return estimateWait(position, workerCount, int(busyWorkers.Load()), AverageDuration())
+}
+
+// estimateWait : les requêtes trouvant un worker libre démarrent aussitôt, les suivantes
+// attendent par "vagues" de workers requêtes d'une durée moyenne avg
+func estimateWait(position, workers, busy int, avg time.Duration) time.Duration {
+	if avg == 0 || position <= 0 || workers <= 0 {
+		return 0
+	}
+	idle := max(workers-busy, 0)
+	if position <= idle {
+		return 0
+	}
+	waves := (position - idle + workers - 1) / workers
+	return time.Duration(waves) * avg
+}
+
+// EstimatedRemaining estime le temps restant d'un traitement commencé depuis elapsed
+func EstimatedRemaining(elapsed time.Duration) time.Duration {
+	if remaining := AverageDuration() - elapsed; remaining > 0 {
+		return remaining
+	}
+	return 0
+}
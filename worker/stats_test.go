@@ -0,0 +1,86 @@
+package worker
+
+import (
+	"druid-insight/cache"
+	"testing"
+	"time"
+)
+
+func resetDurations() {
+	durationsMu.Lock()
+	recentDurations = nil
+	durationsMu.Unlock()
+}
+
+func TestEstimateWait(t *testing.T) {
+	avg := 10 * time.Second
+	tests := []struct {
+		name                    string
+		position, workers, busy int
+		avg                     time.Duration
+		want                    time.Duration
+	}{
+		{"no history", 3, 2, 2, 0, 0},
+		{"not queued", 0, 2, 2, avg, 0},
+		{"idle worker", 1, 2, 1, avg, 0},
+		{"all idle", 2, 2, 0, avg, 0},
+		{"next behind busy workers", 1, 2, 2, avg, avg},
+		{"second wave", 3, 2, 2, avg, 2 * avg},
+		{"after idle workers", 3, 2, 1, avg, avg},
+		{"single worker", 3, 1, 1, avg, 3 * avg},
+	}
+	for _, tt := range tests {
+		if got := estimateWait(tt.position, tt.workers, tt.busy, tt.avg); got != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestAverageDuration_RecentWindow(t *testing.T) {
+	resetDurations()
+	defer resetDurations()
+	if AverageDuration() != 0 {
+		t.Fatalf("Expected no average without history")
+	}
+	for i := 0; i < recentDurationsSize; i++ {
+		recordDuration(time.Second)
+	}
+	for i := 0; i < recentDurationsSize; i++ {
+		recordDuration(3 * time.Second)
+	}
+	if got := AverageDuration(); got != 3*time.Second {
+		t.Errorf("Expected only the last %d durations, got average %s", recentDurationsSize, got)
+	}
+	if got := EstimatedRemaining(time.Second); got != 2*time.Second {
+		t.Errorf("Expected 2s remaining, got %s", got)
+	}
+	if got := EstimatedRemaining(5 * time.Second); got != 0 {
+		t.Errorf("Expected no remaining time past the average, got %s", got)
+	}
+}
+
+func TestFinish_RecordsOnlyDruidRuns(t *testing.T) {
+	resetDurations()
+	defer resetDurations()
+	startedAt := time.Now().Add(-2 * time.Second)
+	tests := []struct {
+		name   string
+		cache  string
+		status ReportStatus
+		want   int
+	}{
+		{"cache hit", cache.StatusHit, StatusComplete, 0},
+		{"error", cache.StatusMiss, StatusError, 0},
+		{"cache miss", cache.StatusMiss, StatusComplete, 1},
+		{"cache disabled", "", StatusComplete, 2},
+	}
+	for _, tt := range tests {
+		finish(&ReportRequest{ID: "stats-" + tt.name, CacheStatus: tt.cache}, tt.status, nil, "", "", startedAt, 1)
+		durationsMu.Lock()
+		got := len(recentDurations)
+		durationsMu.Unlock()
+		if got != tt.want {
+			t.Errorf("%s: expected %d recorded durations, got %d", tt.name, tt.want, got)
+		}
+	}
+}
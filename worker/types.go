@@ -1,6 +1,7 @@
 package worker
 
 import (
+	"druid-insight/report"
 	"time"
 )
 
@@ -12,23 +13,57 @@ const (
 	StatusProcessing ReportStatus = "processing"
 	StatusComplete   ReportStatus = "complete"
 	StatusError      ReportStatus = "error"
+	StatusCancelled  ReportStatus = "cancelled"
 )
 
 // Stockage d’une requête à traiter
 type ReportRequest struct {
-	ID         string                 // id unique
-	Payload    map[string]interface{} // le json reçu du client
-	Owner      string                 // user à l'origine
-	Admin      bool                   // user admin ?
-	Datasource string                 // ex: myreport
-	CreatedAt  time.Time
-	Context    string
+	ID          string       // id unique
+	Spec        *report.Spec // le rapport reçu du client, validé
+	Owner       string       // user à l'origine
+	Admin       bool         // user admin ?
+	Datasource  string       // ex: myreport
+	CreatedAt   time.Time
+	Context     string
+	Share       string   // id du lien de partage à l'origine de l'exécution, "" sinon
+	Schedule    string   // nom de la planification à l'origine de l'exécution, "" sinon
+	Notify      []string // destinataires e-mail à prévenir à la fin du rapport
+	NotifyOnly  bool     // statut seul, sans CSV ni lien (propriétaire sans capacité export)
+	CacheStatus string   // "hit", "miss" ou "" (cache désactivé), renseigné par le worker
+
+	// Renseignés par le worker
+	DruidDuration time.Duration // temps d'exécution de la requête Druid (0 si cache)
+	RowsWritten   int           // lignes écrites dans le CSV
+	Attempts      []Attempt     // tentatives Druid en échec
+}
+
+// Attempt : tentative d'exécution Druid en échec
+type Attempt struct {
+	Number     int       `json:"number"`
+	At         time.Time `json:"at"`
+	Class      string    `json:"class"` // timeout, unavailable, resource_limit, bad_query, cancelled
+	Error      string    `json:"error"`
+	DurationMs int64     `json:"duration_ms"`
+	Retry      bool      `json:"retry"` // une nouvelle tentative a suivi
 }
 
 // Résultat traité
 type ReportResult struct {
-	Status   ReportStatus
-	Result   interface{} // []map[string]interface{} ou autre
-	CSVPath  string
-	ErrorMsg string
+	Status     ReportStatus
+	Result     interface{} // []map[string]interface{} ou autre
+	CSVPath    string
+	ErrorMsg   string
+	Cache      string        // statut du cache de résultats
+	Owner      string        // user à l'origine
+	Spec       *report.Spec  // rapport exécuté
+	Share      string        // lien de partage à l'origine de l'exécution
+	Context    string        // contexte Druid de la requête
+	Schedule   string        // planification à l'origine de l'exécution
+	CreatedAt  time.Time     // mise en file
+	StartedAt  time.Time     // début du traitement par un worker
+	FinishedAt time.Time     // fin du traitement
+	WorkerID   int           // worker ayant traité la requête
+	DruidTime  time.Duration // temps d'exécution Druid
+	Rows       int           // lignes écrites dans le CSV
+	Attempts   []Attempt     // tentatives Druid en échec
 }